@@ -0,0 +1,252 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	actionNameBootstrap = "bootstrap"
+
+	bootstrapArguments = flag.NewFlagSet(actionNameBootstrap, flag.ContinueOnError)
+	bootstrapDomain    = bootstrapArguments.String("domain", "", "Domain (e.g. example.net)")
+	bootstrapTemplate  = bootstrapArguments.String("template", "", "The name of the record template of the configuration file (e.g. webhost)")
+	bootstrapVariables = bootstrapArguments.String("var", "", "Values of the template placeholders (e.g. ip=203.0.113.1,mail=mx.example.com)")
+	bootstrapApply     = bootstrapArguments.Bool("apply", false, "Create the records instead of only previewing them")
+)
+
+// templatePlaceholderPattern matches the placeholders of record templates (e.g. "{ip}").
+var templatePlaceholderPattern = regexp.MustCompile(`\{[a-zA-Z0-9_-]+\}`)
+
+// recordTemplate is a record of a template of the configuration file.
+// The name and content can contain placeholders (e.g. "{domain}").
+type recordTemplate struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+
+	// TTL is the time to live in seconds (default: the default TTL of the TTL policy).
+	TTL int `json:"ttl"`
+}
+
+type bootstrapAction struct {
+	clientFactory  dnsClientFactory
+	fs             afero.Fs
+	decrypter      configDecrypter
+	configFilePath string
+	ttlPolicy      ttlPolicyProvider
+}
+
+func (action bootstrapAction) Name() string {
+	return actionNameBootstrap
+}
+
+func (action bootstrapAction) Description() string {
+	return "Create the records of a template for a new domain"
+}
+
+func (action bootstrapAction) Usage() string {
+	buf := new(bytes.Buffer)
+	bootstrapArguments.SetOutput(buf)
+	bootstrapArguments.PrintDefaults()
+	return buf.String()
+}
+
+// Execute previews or creates the records of the given template for the
+// given domain. The domain can either be passed with -domain or as the
+// first positional argument (e.g. "bootstrap example.net -template webhost").
+func (action bootstrapAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*bootstrapDomain = ""
+	*bootstrapTemplate = ""
+	*bootstrapVariables = ""
+	*bootstrapApply = false
+	if parseError := bootstrapArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	domain := *bootstrapDomain
+	if domain == "" && bootstrapArguments.NArg() > 0 {
+		domain = bootstrapArguments.Arg(0)
+
+		// the flags that follow the domain
+		if parseError := bootstrapArguments.Parse(bootstrapArguments.Args()[1:]); parseError != nil {
+			return nil, parseError
+		}
+	}
+
+	if isEmpty(domain) {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	if isEmpty(*bootstrapTemplate) {
+		return nil, fmt.Errorf("No template supplied")
+	}
+
+	variables, variablesError := parseLabels(*bootstrapVariables)
+	if variablesError != nil {
+		return nil, variablesError
+	}
+
+	variables["domain"] = domain
+
+	// template
+	template, templateError := action.getTemplate(*bootstrapTemplate)
+	if templateError != nil {
+		return nil, templateError
+	}
+
+	records, expandError := expandRecordTemplate(template, variables)
+	if expandError != nil {
+		return nil, expandError
+	}
+
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	existingRecords, recordsError := client.GetRecords(domain)
+	if recordsError != nil {
+		return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", domain, recordsError.Error())
+	}
+
+	// the records that do not exist yet
+	preview := new(bytes.Buffer)
+	var newRecords []recordTemplate
+	for _, record := range records {
+		ttl, ttlError := applyRecordTTLPolicy(action.ttlPolicy, actionNameBootstrap, false, record.TTL)
+		if ttlError != nil {
+			return nil, ttlError
+		}
+
+		record.TTL = ttl
+		if validationError := validateRecord(record.Name, record.Type, record.Content, record.TTL); validationError != nil {
+			return nil, fmt.Errorf("Invalid %s record %q of the template %q: %s", record.Type, getFormattedDomainName(record.Name, domain), *bootstrapTemplate, validationError.Error())
+		}
+
+		if containsTemplateRecord(existingRecords, record) {
+			fmt.Fprintf(preview, "Exists: %s %s %s\n", getFormattedDomainName(record.Name, domain), record.Type, record.Content)
+			continue
+		}
+
+		fmt.Fprintf(preview, "Create: %s %s %s (TTL %d)\n", getFormattedDomainName(record.Name, domain), record.Type, record.Content, record.TTL)
+		newRecords = append(newRecords, record)
+	}
+
+	if len(newRecords) == 0 {
+		return unchangedMessage{fmt.Sprintf("%sAll records of the template %q already exist", preview.String(), *bootstrapTemplate)}, nil
+	}
+
+	if !*bootstrapApply {
+		fmt.Fprintf(preview, "Run again with -apply to create %d records", len(newRecords))
+		return successMessage{preview.String()}, nil
+	}
+
+	for index, record := range newRecords {
+		if _, conflictError := resolveConflicts(client, domain, record.Name, record.Type, false); conflictError != nil {
+			return nil, fmt.Errorf("Created %d of %d records. %s", index, len(newRecords), conflictError.Error())
+		}
+
+		changeRecord := &dnsimple.ChangeRecord{
+			Name:  record.Name,
+			Value: record.Content,
+			Type:  record.Type,
+			Ttl:   fmt.Sprintf("%d", record.TTL),
+		}
+
+		if _, createError := client.CreateRecord(domain, changeRecord); createError != nil {
+			return nil, fmt.Errorf("Created %d of %d records. %s failed: %s", index, len(newRecords), getFormattedDomainName(record.Name, domain), createError.Error())
+		}
+	}
+
+	return changeMessage{fmt.Sprintf("%sCreated %d records", preview.String(), len(newRecords)), len(newRecords)}, nil
+}
+
+// getTemplate returns the record template with the given name from the configuration file.
+func (action bootstrapAction) getTemplate(name string) ([]recordTemplate, error) {
+	settings, configError := loadConfig(action.fs, action.decrypter, findConfigFile(action.fs, action.configFilePath))
+	if configError != nil {
+		return nil, configError
+	}
+
+	template, exists := settings.Templates[name]
+	if !exists {
+		var names []string
+		for templateName := range settings.Templates {
+			names = append(names, templateName)
+		}
+
+		sort.Strings(names)
+		return nil, fmt.Errorf("Unknown template %q (available: %s)", name, strings.Join(names, ", "))
+	}
+
+	if len(template) == 0 {
+		return nil, fmt.Errorf("The template %q contains no records", name)
+	}
+
+	return template, nil
+}
+
+// expandRecordTemplate replaces the placeholders of the given template with the
+// given values. An error lists the placeholders without a value.
+func expandRecordTemplate(template []recordTemplate, variables map[string]string) ([]recordTemplate, error) {
+	var missing []string
+	expand := func(text string) string {
+		return templatePlaceholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+			name := strings.Trim(placeholder, "{}")
+			if value, exists := variables[name]; exists {
+				return value
+			}
+
+			if !containsString(missing, name) {
+				missing = append(missing, name)
+			}
+
+			return placeholder
+		})
+	}
+
+	var records []recordTemplate
+	for _, record := range template {
+		records = append(records, recordTemplate{
+			Name:    strings.TrimSpace(expand(record.Name)),
+			Type:    strings.ToUpper(strings.TrimSpace(record.Type)),
+			Content: expand(record.Content),
+			TTL:     record.TTL,
+		})
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("No values supplied for the placeholders %s (e.g. -var %s=...)", strings.Join(missing, ", "), missing[0])
+	}
+
+	return records, nil
+}
+
+// containsTemplateRecord returns true if the given records contain
+// a record with the name, type and content of the given template record.
+func containsTemplateRecord(records []dnsimple.Record, record recordTemplate) bool {
+	for _, existing := range records {
+		if existing.Name == record.Name && existing.RecordType == record.Type && existing.Content == record.Content {
+			return true
+		}
+	}
+
+	return false
+}
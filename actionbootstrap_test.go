@@ -0,0 +1,116 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"strings"
+	"testing"
+)
+
+// getBootstrapTestAction returns a bootstrap action with a "webhost" template for the given records.
+func getBootstrapTestAction(records map[string][]dnsimple.Record) bootstrapAction {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/user/.dee/config.json", []byte(`{
+		"templates": {
+			"webhost": [
+				{"name": "", "type": "A", "content": "{ip}"},
+				{"name": "www", "type": "CNAME", "content": "{domain}", "ttl": 3600},
+				{"name": "", "type": "TXT", "content": "v=spf1 a mx -all"},
+				{"name": "_dmarc", "type": "TXT", "content": "v=DMARC1; p=none; rua=mailto:{dmarc}"}
+			]
+		}
+	}`), 0600)
+
+	return bootstrapAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, fs, configDecrypter{}, "/home/user/.dee/config.json", nil}
+}
+
+// bootstrapAction.Execute should create the records of the template that do not exist yet.
+func Test_bootstrapAction_Apply_MissingRecordsAreCreated(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.net": {
+			{Id: 1, Name: "", RecordType: "TXT", Content: "v=spf1 a mx -all", Ttl: 3600},
+		},
+	}
+
+	action := getBootstrapTestAction(records)
+	arguments := []string{"example.net", "-template", "webhost", "-var", "ip=203.0.113.1,dmarc=dmarc@example.net", "-apply"}
+
+	// act
+	result, err := action.Execute(arguments)
+
+	// assert
+	if err != nil || getChangeSummary(result).Records != 3 {
+		t.Fatalf("bootstrapAction.Execute(%q) should create three records but returned %v (%v)", arguments, result, err)
+	}
+
+	expected := []string{
+		"A 203.0.113.1 600",
+		"TXT v=spf1 a mx -all 3600",
+		"CNAME example.net 3600",
+		"TXT v=DMARC1; p=none; rua=mailto:dmarc@example.net 600",
+	}
+
+	var actual []string
+	for _, record := range records["example.net"] {
+		actual = append(actual, strings.Join([]string{record.RecordType, record.Content, record.StringTtl()}, " "))
+	}
+
+	for _, record := range expected {
+		if !containsString(actual, record) {
+			t.Fail()
+			t.Logf("The records should contain %q: %q", record, actual)
+		}
+	}
+}
+
+// bootstrapAction.Execute should only preview the records if -apply is not given.
+func Test_bootstrapAction_NoApply_RecordsAreNotCreated(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{"example.net": {}}
+	action := getBootstrapTestAction(records)
+	arguments := []string{"-domain", "example.net", "-template", "webhost", "-var", "ip=203.0.113.1,dmarc=dmarc@example.net"}
+
+	// act
+	result, err := action.Execute(arguments)
+
+	// assert
+	if err != nil || !strings.Contains(result.Text(), "Create: www.example.net CNAME example.net (TTL 3600)") || !strings.Contains(result.Text(), "-apply to create 4 records") {
+		t.Fatalf("bootstrapAction.Execute(%q) should preview four records but returned %v (%v)", arguments, result, err)
+	}
+
+	if len(records["example.net"]) != 0 {
+		t.Fail()
+		t.Logf("No records should have been created without -apply")
+	}
+}
+
+// bootstrapAction.Execute should return an error if the arguments or the template are invalid.
+func Test_bootstrapAction_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{"-template", "webhost"},
+		{"example.net"},
+		{"example.net", "-template", "mailhost"},
+		{"example.net", "-template", "webhost", "-var", "ip=203.0.113.1"},
+		{"example.net", "-template", "webhost", "-var", "ip=www.example.net,dmarc=dmarc@example.net"},
+	}
+
+	action := getBootstrapTestAction(map[string][]dnsimple.Record{"example.net": {}})
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := action.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("bootstrapAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	actionNameCAA = "caa"
+
+	caaAuditArguments = flag.NewFlagSet(actionNameCAA+" audit", flag.ContinueOnError)
+	caaAuditAllowed   = caaAuditArguments.String("allowed", "", "Comma-separated list of expected certificate authorities (e.g. letsencrypt.org,digicert.com)")
+	caaAuditFormat    = caaAuditArguments.String("format", "table", "The output format (table, json)")
+)
+
+const (
+	caaStatusOK         = "ok"
+	caaStatusMissing    = "missing"
+	caaStatusUnexpected = "unexpected"
+	caaStatusError      = "error"
+)
+
+type caaAction struct {
+	infoProviderFactory dnsInfoProviderCreator
+}
+
+func (action caaAction) Name() string {
+	return actionNameCAA
+}
+
+func (action caaAction) Description() string {
+	return "Audit the CAA records of all domains"
+}
+
+func (action caaAction) Usage() string {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "  %s audit [arguments ...]\n", actionNameCAA)
+	caaAuditArguments.SetOutput(buf)
+	caaAuditArguments.PrintDefaults()
+
+	return buf.String()
+}
+
+// Execute audits the CAA records of all domains in the account ("audit").
+func (action caaAction) Execute(arguments []string) (message, error) {
+	if len(arguments) == 0 {
+		return nil, fmt.Errorf("No sub command supplied (audit)")
+	}
+
+	switch arguments[0] {
+	case "audit":
+		return action.audit(arguments[1:])
+	}
+
+	return nil, fmt.Errorf("Unknown sub command: %q", arguments[0])
+}
+
+// audit reports which domains lack CAA records or allow
+// certificate authorities that are not in the allowed list.
+func (action caaAction) audit(arguments []string) (message, error) {
+
+	// parse the arguments
+	*caaAuditAllowed = ""
+	*caaAuditFormat = "table"
+	if parseError := caaAuditArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if *caaAuditFormat != "table" && *caaAuditFormat != "json" {
+		return nil, fmt.Errorf("Unknown output format: %q", *caaAuditFormat)
+	}
+
+	var allowedAuthorities []string
+	for _, authority := range strings.Split(*caaAuditAllowed, ",") {
+		if !isEmpty(authority) {
+			allowedAuthorities = append(allowedAuthorities, strings.ToLower(strings.TrimSpace(authority)))
+		}
+	}
+
+	infoProvider, infoProviderError := action.getInfoProvider()
+	if infoProviderError != nil {
+		return nil, fmt.Errorf("No DNS info provider available")
+	}
+
+	domainNames, domainNamesError := infoProvider.GetDomainNames()
+	if domainNamesError != nil {
+		return nil, fmt.Errorf("Unable to retrieve domain names: %s", domainNamesError.Error())
+	}
+
+	var results []caaAuditResult
+	for _, domainName := range domainNames {
+		records, recordsError := infoProvider.GetDomainRecords(domainName)
+		if recordsError != nil {
+			results = append(results, caaAuditResult{Domain: domainName, Status: caaStatusError, Details: recordsError.Error()})
+			continue
+		}
+
+		results = append(results, auditCAARecords(domainName, records, allowedAuthorities))
+	}
+
+	if *caaAuditFormat == "json" {
+		if results == nil {
+			results = []caaAuditResult{}
+		}
+
+		json, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		return successMessage{string(json)}, nil
+	}
+
+	return successMessage{formatCAAAuditResults(results)}, nil
+}
+
+// getInfoProvider returns a DNS info provider instance or an error if the creation of the provider failed.
+func (action caaAction) getInfoProvider() (deens.DNSInfoProvider, error) {
+	if action.infoProviderFactory == nil {
+		return nil, fmt.Errorf("No DNS info provider factory available")
+	}
+
+	return action.infoProviderFactory.CreateInfoProvider()
+}
+
+// caaAuditResult contains the CAA audit result of a single domain.
+type caaAuditResult struct {
+	Domain      string   `json:"domain"`
+	Status      string   `json:"status"`
+	Authorities []string `json:"authorities"`
+	Unexpected  []string `json:"unexpected,omitempty"`
+	Details     string   `json:"details,omitempty"`
+}
+
+// auditCAARecords checks the apex CAA records of the given domain. If allowed
+// authorities are given, every "issue" and "issuewild" value must be one of them.
+func auditCAARecords(domainName string, records []dnsimple.Record, allowedAuthorities []string) caaAuditResult {
+	result := caaAuditResult{Domain: domainName, Status: caaStatusOK, Authorities: []string{}}
+
+	caaRecordFound := false
+	for _, record := range records {
+		if record.Name != "" || record.RecordType != "CAA" {
+			continue
+		}
+
+		caaRecordFound = true
+
+		tag, authority, parseError := parseCAAContent(record.Content)
+		if parseError != nil {
+			result.Status = caaStatusError
+			result.Details = parseError.Error()
+			continue
+		}
+
+		if tag != "issue" && tag != "issuewild" {
+			continue
+		}
+
+		// an empty authority forbids the issuance
+		if authority == "" {
+			continue
+		}
+
+		result.Authorities = append(result.Authorities, authority)
+
+		if len(allowedAuthorities) > 0 && !containsString(allowedAuthorities, authority) {
+			result.Unexpected = append(result.Unexpected, authority)
+		}
+	}
+
+	if !caaRecordFound {
+		result.Status = caaStatusMissing
+		result.Details = "No CAA record found"
+		return result
+	}
+
+	if len(result.Unexpected) > 0 && result.Status == caaStatusOK {
+		result.Status = caaStatusUnexpected
+		result.Details = fmt.Sprintf("Unexpected certificate authorities: %s", strings.Join(result.Unexpected, ", "))
+	}
+
+	return result
+}
+
+// parseCAAContent returns the lower-case tag and the certificate authority
+// domain of the given CAA record content (e.g. `0 issue "letsencrypt.org"`).
+func parseCAAContent(content string) (string, string, error) {
+	fields := strings.SplitN(strings.TrimSpace(content), " ", 3)
+	if len(fields) != 3 {
+		return "", "", fmt.Errorf("Invalid CAA record: %q", content)
+	}
+
+	tag := strings.ToLower(fields[1])
+
+	// strip the parameters (e.g. "letsencrypt.org; accounturi=...")
+	value := strings.Trim(strings.TrimSpace(fields[2]), `"`)
+	authority := strings.ToLower(strings.TrimSpace(strings.SplitN(value, ";", 2)[0]))
+
+	return tag, authority, nil
+}
+
+// formatCAAAuditResults formats the given CAA audit results as a table.
+func formatCAAAuditResults(results []caaAuditResult) string {
+	buf := new(bytes.Buffer)
+
+	// initialize the tabwriter
+	w := new(tabwriter.Writer)
+	minWidth := 0
+	tabWidth := 8
+	padding := 3
+	w.Init(buf, minWidth, tabWidth, padding, ' ', 0)
+
+	fmt.Fprintf(w, "DOMAIN\tSTATUS\tAUTHORITIES\tDETAILS")
+	for _, result := range results {
+		fmt.Fprintf(w, "\n%s\t%s\t%s\t%s", result.Domain, result.Status, strings.Join(result.Authorities, ","), result.Details)
+	}
+
+	w.Flush()
+
+	return buf.String()
+}
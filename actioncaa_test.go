@@ -0,0 +1,200 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"strings"
+	"testing"
+)
+
+// getCAATestInfoProvider returns an info provider with three domains:
+// one without CAA records, one with Let's Encrypt and one with an unknown CA.
+func getCAATestInfoProvider() testDNSInfoProvider {
+	return testDNSInfoProvider{
+		getDomainNamesFunc: func() ([]string, error) {
+			return []string{"example.com", "example.net", "example.org"}, nil
+		},
+		getDomainRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			switch domain {
+			case "example.net":
+				return []dnsimple.Record{
+					{Name: "", RecordType: "CAA", Content: `0 issue "letsencrypt.org"`},
+					{Name: "", RecordType: "CAA", Content: `0 iodef "mailto:security@example.net"`},
+				}, nil
+			case "example.org":
+				return []dnsimple.Record{
+					{Name: "", RecordType: "CAA", Content: `0 issue "letsencrypt.org; accounturi=https://example"`},
+					{Name: "", RecordType: "CAA", Content: `0 issuewild "cheap-ca.example"`},
+				}, nil
+			}
+
+			return []dnsimple.Record{
+				{Name: "www", RecordType: "CAA", Content: `0 issue "letsencrypt.org"`},
+				{Name: "", RecordType: "A", Content: "127.0.0.1"},
+			}, nil
+		},
+	}
+}
+
+func Test_caaAction_Name_CorrectActionNameIsReturned(t *testing.T) {
+
+	// arrange
+	caaAction := caaAction{}
+
+	// act
+	result := caaAction.Name()
+
+	// assert
+	if result != "caa" {
+		t.Fail()
+		t.Logf("caaAction.Name() should have returned %q but returned %q instead.", "caa", result)
+	}
+
+}
+
+func Test_caaAction_Usage_ResultIsNotEmpty(t *testing.T) {
+
+	// arrange
+	caaAction := caaAction{}
+
+	// act
+	result := caaAction.Usage()
+
+	// assert
+	if isEmpty(result) {
+		t.Fail()
+		t.Logf("caaAction.Usage() not be empty.")
+	}
+
+}
+
+// caaAction.Execute should return an error if the arguments are invalid.
+func Test_caaAction_InvalidArguments_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{},
+		{"check"},
+		{"audit", "-format", "xml"},
+		{"audit", "-allow", "letsencrypt.org"},
+	}
+
+	caaAction := caaAction{testInfoProviderFactory{getCAATestInfoProvider(), nil}}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := caaAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("caaAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// caaAction.Execute should return an error if the domain names cannot be fetched.
+func Test_caaAction_Audit_DomainNamesCannotBeFetched_ErrorIsReturned(t *testing.T) {
+	// arrange
+	arguments := []string{"audit"}
+	infoProvider := testDNSInfoProvider{
+		getDomainNamesFunc: func() ([]string, error) {
+			return nil, fmt.Errorf("API error")
+		},
+	}
+
+	caaAction := caaAction{testInfoProviderFactory{infoProvider, nil}}
+
+	// act
+	_, err := caaAction.Execute(arguments)
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("caaAction.Execute(%q) should return an error", arguments)
+	}
+}
+
+// caaAction.Execute should report missing CAA records and unexpected certificate authorities.
+func Test_caaAction_Audit_JSONFormat_StatusIsReportedForEachDomain(t *testing.T) {
+	// arrange
+	arguments := []string{"audit", "-allowed", "letsencrypt.org, digicert.com", "-format", "json"}
+	caaAction := caaAction{testInfoProviderFactory{getCAATestInfoProvider(), nil}}
+
+	// act
+	response, err := caaAction.Execute(arguments)
+	if err != nil {
+		t.Fatalf("caaAction.Execute(%q) should not return an error: %s", arguments, err.Error())
+	}
+
+	// assert
+	var results []caaAuditResult
+	if unmarshalError := json.Unmarshal([]byte(response.Text()), &results); unmarshalError != nil {
+		t.Fatalf("caaAction.Execute(%q) should respond with JSON: %s", arguments, unmarshalError.Error())
+	}
+
+	expectedStatus := map[string]string{
+		"example.com": caaStatusMissing,
+		"example.net": caaStatusOK,
+		"example.org": caaStatusUnexpected,
+	}
+
+	for _, result := range results {
+		if result.Status != expectedStatus[result.Domain] {
+			t.Fail()
+			t.Logf("The CAA status of %q should be %q but was %q", result.Domain, expectedStatus[result.Domain], result.Status)
+		}
+	}
+
+	if len(results) != 3 {
+		t.Fail()
+		t.Logf("caaAction.Execute(%q) should report 3 domains but reported %d", arguments, len(results))
+	}
+}
+
+// caaAction.Execute should print a table with one line per domain.
+func Test_caaAction_Audit_TableFormat_TableContainsAllDomains(t *testing.T) {
+	// arrange
+	arguments := []string{"audit"}
+	caaAction := caaAction{testInfoProviderFactory{getCAATestInfoProvider(), nil}}
+
+	// act
+	response, _ := caaAction.Execute(arguments)
+
+	// assert
+	lines := strings.Split(response.Text(), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[3], "example.org") || !strings.Contains(lines[3], caaStatusOK) {
+		t.Fail()
+		t.Logf("caaAction.Execute(%q) should print a header and three domains without restricting the CAs but printed %q", arguments, response.Text())
+	}
+}
+
+func Test_parseCAAContent(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		content   string
+		tag       string
+		authority string
+	}{
+		{`0 issue "letsencrypt.org"`, "issue", "letsencrypt.org"},
+		{`128 issueWild "DigiCert.com; cansignhttpexchanges=yes"`, "issuewild", "digicert.com"},
+		{`0 issue ";"`, "issue", ""},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		tag, authority, err := parseCAAContent(input.content)
+
+		// assert
+		if err != nil || tag != input.tag || authority != input.authority {
+			t.Fail()
+			t.Logf("parseCAAContent(%q) should return %q and %q but returned %q, %q and %v", input.content, input.tag, input.authority, tag, authority, err)
+		}
+	}
+}
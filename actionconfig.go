@@ -0,0 +1,140 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"strings"
+)
+
+var (
+	actionNameConfig = "config"
+
+	configValidateArguments = flag.NewFlagSet(actionNameConfig+" validate", flag.ContinueOnError)
+	configValidateFile      = configValidateArguments.String("config", "", "The path of the configuration file (default: ~/.dee/config.json)")
+
+	configSchemaArguments = flag.NewFlagSet(actionNameConfig+" schema", flag.ContinueOnError)
+)
+
+type configAction struct {
+	fs                    afero.Fs
+	decrypter             configDecrypter
+	defaultConfigFilePath string
+	getActions            func() []action
+}
+
+func (action configAction) Name() string {
+	return actionNameConfig
+}
+
+func (action configAction) Description() string {
+	return "Validate the configuration file against its schema"
+}
+
+func (action configAction) Usage() string {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "  %s validate [arguments ...]\n", actionNameConfig)
+	configValidateArguments.SetOutput(buf)
+	configValidateArguments.PrintDefaults()
+
+	fmt.Fprintf(buf, "  %s schema\n", actionNameConfig)
+	configSchemaArguments.SetOutput(buf)
+	configSchemaArguments.PrintDefaults()
+
+	return buf.String()
+}
+
+// Execute runs the given config sub command ("validate" or "schema").
+func (action configAction) Execute(arguments []string) (message, error) {
+	if len(arguments) == 0 {
+		return nil, fmt.Errorf("No sub command supplied (validate, schema)")
+	}
+
+	switch arguments[0] {
+	case "validate":
+		return action.validate(arguments[1:])
+
+	case "schema":
+		return action.schema(arguments[1:])
+	}
+
+	return nil, fmt.Errorf("Unknown sub command %q", arguments[0])
+}
+
+// validate checks the configuration file against the schema and reports
+// every problem with its line, column and path.
+func (action configAction) validate(arguments []string) (message, error) {
+
+	// parse the arguments
+	*configValidateFile = ""
+	if parseError := configValidateArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	configFilePath := *configValidateFile
+	if configFilePath == "" {
+		configFilePath = configValidateArguments.Arg(0)
+	}
+
+	if configFilePath == "" {
+		configFilePath = findConfigFile(action.fs, action.defaultConfigFilePath)
+	}
+
+	if action.fs == nil {
+		return nil, fmt.Errorf("No filesystem provided")
+	}
+
+	content, readError := afero.ReadFile(action.fs, configFilePath)
+	if readError != nil {
+		if os.IsNotExist(readError) {
+			return nil, fmt.Errorf("There is no configuration file at %q", configFilePath)
+		}
+
+		return nil, readError
+	}
+
+	content, decryptError := action.decrypter.Decrypt(configFilePath, content)
+	if decryptError != nil {
+		return nil, decryptError
+	}
+
+	schema := getConfigSchema(nil)
+	if action.getActions != nil {
+		schema = getConfigSchema(action.getActions())
+	}
+
+	diagnostics := validateConfigDocument(content, schema)
+	if len(diagnostics) == 0 {
+		return successMessage{fmt.Sprintf("The configuration file %q is valid", configFilePath)}, nil
+	}
+
+	var lines []string
+	for _, diagnostic := range diagnostics {
+		lines = append(lines, configFilePath+":"+diagnostic.String())
+	}
+
+	lines = append(lines, fmt.Sprintf("%d problems found in %q", len(diagnostics), configFilePath))
+	return findingsMessage{strings.Join(lines, "\n")}, nil
+}
+
+// schema prints the JSON schema of the configuration file.
+func (action configAction) schema(arguments []string) (message, error) {
+	if parseError := configSchemaArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	schema, marshalError := json.MarshalIndent(getConfigSchema(nil), "", "  ")
+	if marshalError != nil {
+		return nil, marshalError
+	}
+
+	return successMessage{string(schema)}, nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/spf13/afero"
+	"strings"
+	"testing"
+)
+
+// getTestConfigAction returns a config action for the given configuration file content.
+func getTestConfigAction(content string) configAction {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/user/.dee/config.json", []byte(content), 0600)
+
+	getActions := func() []action {
+		return []action{createOrUpdateAction{}, daemonAction{}}
+	}
+
+	return configAction{fs, configDecrypter{}, "/home/user/.dee/config.json", getActions}
+}
+
+// config validate should accept a valid configuration file.
+func Test_configAction_Validate_ValidConfig_SuccessIsReturned(t *testing.T) {
+	// arrange
+	action := getTestConfigAction(`{
+  "tasks": [{"name": "home", "schedule": "@every 5m", "action": "createorupdate", "arguments": ["-domain", "example.com"]}],
+  "log": {"file": "/var/log/dee.log", "max_size_mb": 10, "retention": "168h"},
+  "mqtt": {"broker": "tcp://homeassistant.local:1883", "retain": true},
+  "ttl_policy": {"dynamic": 60, "commands": {"record create": 300}},
+  "templates": {"webhost": [{"name": "", "type": "A", "content": "{ip}"}]}
+}`)
+
+	// act
+	result, err := action.Execute([]string{"validate"})
+
+	// assert
+	if err != nil {
+		t.Fatalf("config validate should succeed: %s", err.Error())
+	}
+
+	if _, isSuccess := result.(successMessage); !isSuccess {
+		t.Fail()
+		t.Logf("The configuration should be valid but the result is %q", result.Text())
+	}
+}
+
+// config validate should report every problem with its line, column and path.
+func Test_configAction_Validate_InvalidConfig_ProblemsAreReported(t *testing.T) {
+	// arrange
+	action := getTestConfigAction(`{
+  "tasks": [
+    {"schedule": "@every 5x", "action": "createorupdate"},
+    {"schedule": "@daily", "action": "daemon"},
+    {"schedule": "@daily", "action": "unknown"}
+  ],
+  "log": {"max_size_mb": "10"},
+  "mqtt": {"topic": "dee"},
+  "tempaltes": {}
+}`)
+
+	// act
+	result, err := action.Execute([]string{"validate"})
+
+	// assert
+	if err != nil {
+		t.Fatalf("config validate should report the problems instead of failing: %s", err.Error())
+	}
+
+	if _, isFindings := result.(findingsMessage); !isFindings {
+		t.Fail()
+		t.Logf("The result should be a findings message but is %T", result)
+	}
+
+	expected := []string{
+		`/home/user/.dee/config.json:3:18: tasks[0].schedule: Cannot parse schedule "@every 5x"`,
+		`/home/user/.dee/config.json:4:38: tasks[1].action: The action "daemon" cannot be scheduled`,
+		`/home/user/.dee/config.json:5:38: tasks[2].action: Unknown action: "unknown"`,
+		`/home/user/.dee/config.json:7:10: log: The key "file" is required when "max_size_mb" is set`,
+		`/home/user/.dee/config.json:7:26: log.max_size_mb: Expected an integer but found a string ("10")`,
+		`/home/user/.dee/config.json:8:11: mqtt: The key "broker" is required when "topic" is set`,
+		`/home/user/.dee/config.json:9:3: tempaltes: Unknown key "tempaltes"`,
+		`7 problems found`,
+	}
+
+	lines := strings.Split(result.Text(), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("config validate should report %d lines but reported:\n%s", len(expected), result.Text())
+	}
+
+	for index, line := range lines {
+		if !strings.HasPrefix(line, expected[index]) {
+			t.Fail()
+			t.Logf("Line %d should start with %q but is %q", index+1, expected[index], line)
+		}
+	}
+}
+
+// config validate should report syntax errors with their position.
+func Test_configAction_Validate_InvalidJSON_PositionIsReported(t *testing.T) {
+	// arrange
+	action := getTestConfigAction("{\n  \"tasks\": [1,]\n}")
+
+	// act
+	result, err := action.Execute([]string{"validate"})
+
+	// assert
+	if err != nil {
+		t.Fatalf("config validate should report the syntax error instead of failing: %s", err.Error())
+	}
+
+	if !strings.HasPrefix(result.Text(), "/home/user/.dee/config.json:2:15: Invalid JSON") {
+		t.Fail()
+		t.Logf("The syntax error should be reported at line 2, column 15 but the result is %q", result.Text())
+	}
+}
+
+// config schema should print the JSON schema of the configuration file.
+func Test_configAction_Schema_SchemaIsPrinted(t *testing.T) {
+	// arrange
+	action := getTestConfigAction("{}")
+
+	// act
+	result, err := action.Execute([]string{"schema"})
+
+	// assert
+	if err != nil {
+		t.Fatalf("config schema should succeed: %s", err.Error())
+	}
+
+	var schema map[string]interface{}
+	if unmarshalError := json.Unmarshal([]byte(result.Text()), &schema); unmarshalError != nil {
+		t.Fatalf("The schema should be valid JSON: %s", unmarshalError.Error())
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	for _, key := range []string{"tasks", "log", "mqtt", "ttl_policy", "templates", "credentials", "profiles"} {
+		if _, exists := properties[key]; !exists {
+			t.Fail()
+			t.Logf("The schema should describe the %q section", key)
+		}
+	}
+}
+
+// The schema should describe every key of the config type.
+func Test_getConfigSchema_AllConfigKeysAreDescribed(t *testing.T) {
+	// arrange
+	settings := config{
+		Tasks:       []taskConfig{{Name: "a", Schedule: "@daily", Action: "createorupdate", Arguments: []string{"-domain"}}},
+		Log:         logConfig{"/var/log/dee.log", 1, "1h", 1, "1h"},
+		MQTT:        mqttConfig{"tcp://broker:1883", "dee", "dee", "user", "secret", true},
+		TTLPolicy:   ttlPolicy{60, 3600, 60, map[string]int{"record create": 300}},
+		Templates:   map[string][]recordTemplate{"webhost": {{"www", "A", "{ip}", 600}}},
+		Credentials: &credentialsConfig{"john@example.com", "secret"},
+		Profiles:    map[string]profileConfig{"personal": {"config://", []string{"example.com", "*.example.org"}}},
+	}
+
+	content, _ := json.Marshal(settings)
+
+	// act
+	diagnostics := validateConfigDocument(content, getConfigSchema(nil))
+
+	// assert
+	if len(diagnostics) > 0 {
+		t.Fail()
+		t.Logf("A marshalled configuration should be valid but has the problems %v", diagnostics)
+	}
+}
+
+// config should fail without a sub command.
+func Test_configAction_NoSubCommand_ErrorIsReturned(t *testing.T) {
+	// arrange
+	action := getTestConfigAction("{}")
+
+	// act
+	_, err := action.Execute([]string{})
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("config without a sub command should fail")
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"flag"
 	"fmt"
 	"github.com/andreaskoch/dee-ns"
-	"net"
+	"github.com/pearkes/dnsimple"
 	"os"
 )
 
@@ -20,12 +20,23 @@ var (
 	createDomain                 = createAddressRecordArguments.String("domain", "", "Domain (e.g. example.com)")
 	createSubdomain              = createAddressRecordArguments.String("subdomain", "", "Subdomain (e.g. www)")
 	createIP                     = createAddressRecordArguments.String("ip", "", "IP address (e.g. ::1, 127.0.0.1)")
+	createIPSource               = createAddressRecordArguments.String("ip-source", "", "IP source used if no IP address is given (e.g. http, interface:eth0, file:/path, command:/path/to/script)")
+	createIPFromInterface        = createAddressRecordArguments.String("ip-from-interface", "", "Network interface the IP address is taken from (e.g. eth0)")
+	createPreferIPv6             = createAddressRecordArguments.Bool("prefer-ipv6", false, "Prefer the IPv6 address of the network interface")
+	createGlobalOnly             = createAddressRecordArguments.Bool("global-only", false, "Ignore private addresses of the network interface")
 	createTTL                    = createAddressRecordArguments.Int("ttl", defaultTTL, "The time to live in seconds")
+	createType                   = createAddressRecordArguments.String("type", "", "The record type (A or AAAA; default: the type of the IP address)")
+	createReplaceConflicting     = createAddressRecordArguments.Bool("replace-conflicting", false, "Delete records that conflict with the new record (e.g. a CNAME record of the same name)")
+	createExpiresIn              = createAddressRecordArguments.String("expires-in", "", "Create a temporary record that \"gc\" deletes after the given period (e.g. 24h, 7d)")
 )
 
 type createAction struct {
 	dnsEditorFactory dnsEditorCreator
+	clientFactory    dnsClientFactory
 	stdin            *os.File
+	ipProviders      ipProviderRegistry
+	ttlPolicy        ttlPolicyProvider
+	metadata         metadataStore
 }
 
 func (action createAction) Name() string {
@@ -51,7 +62,14 @@ func (action createAction) Execute(arguments []string) (message, error) {
 	*createDomain = ""
 	*createSubdomain = ""
 	*createIP = ""
+	*createIPSource = ""
+	*createIPFromInterface = ""
+	*createPreferIPv6 = false
+	*createGlobalOnly = false
 	*createTTL = defaultTTL
+	*createType = ""
+	*createReplaceConflicting = false
+	*createExpiresIn = ""
 	if parseError := createAddressRecordArguments.Parse(arguments); parseError != nil {
 		return nil, parseError
 	}
@@ -66,20 +84,40 @@ func (action createAction) Execute(arguments []string) (message, error) {
 		return nil, fmt.Errorf("The given TTL cannot be negative")
 	}
 
-	// take ip from stdin
-	if *createIP == "" && stdinHasData(action.stdin) {
-		ipAddressFromStdin := ""
-		fmt.Fscanf(os.Stdin, "%s", &ipAddressFromStdin)
-		createIP = &ipAddressFromStdin
+	ttl, ttlError := applyTTLPolicy(action.ttlPolicy, actionNameCreate, true, *createTTL, arguments)
+	if ttlError != nil {
+		return nil, ttlError
 	}
 
-	if *createIP == "" {
-		return nil, fmt.Errorf("No IP address supplied")
+	// temporary records
+	expiresIn, expiresInError := getExpiresIn(*createExpiresIn, action.metadata)
+	if expiresInError != nil {
+		return nil, expiresInError
 	}
 
-	ip := net.ParseIP(*createIP)
-	if ip == nil {
-		return nil, fmt.Errorf("Cannot parse IP %q", ip)
+	if expiresIn > 0 && action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	// IP address
+	ipSource, ipSourceError := getInterfaceIPSource(*createIPSource, *createIPFromInterface, *createType, *createPreferIPv6, *createGlobalOnly)
+	if ipSourceError != nil {
+		return nil, ipSourceError
+	}
+
+	ip, ipError := getIPAddress(*createIP, ipSource, action.ipProviders, action.stdin)
+	if ipError != nil {
+		return nil, ipError
+	}
+
+	// record type
+	recordType, recordTypeError := getDNSRecordType(*createType, ip)
+	if recordTypeError != nil {
+		return nil, recordTypeError
+	}
+
+	if validationError := validateRecordArguments(*createSubdomain, recordType, ip.String(), ttl, recordArguments{"-subdomain", "-ip", "-ttl"}); validationError != nil {
+		return nil, validationError
 	}
 
 	// create a DNS editor
@@ -89,10 +127,37 @@ func (action createAction) Execute(arguments []string) (message, error) {
 		return nil, fmt.Errorf("Cannot create DNS editor: %s", dnsEditorError.Error())
 	}
 
-	createError := addressRecordCreator.CreateSubdomain(*createDomain, *createSubdomain, *createTTL, ip)
+	// conflicting records
+	var client deens.DNSClient
+	var replaced []dnsimple.Record
+	if action.clientFactory != nil {
+		var clientError error
+		client, clientError = action.clientFactory.CreateClient()
+		if clientError != nil {
+			return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+		}
+
+		var conflictError error
+		replaced, conflictError = resolveConflicts(client, *createDomain, *createSubdomain, recordType, *createReplaceConflicting)
+		if conflictError != nil {
+			return nil, conflictError
+		}
+	}
+
+	createError := addressRecordCreator.CreateSubdomain(*createDomain, *createSubdomain, ttl, ip)
 	if createError != nil {
-		return nil, fmt.Errorf("%s", createError.Error())
+		return nil, getReplacedRecordsError(createError, *createDomain, replaced)
+	}
+
+	text := fmt.Sprintf("Created: %s → %s", getFormattedDomainName(*createSubdomain, *createDomain), ip.String())
+	if expiresIn > 0 {
+		expiry, expiryError := markAddressRecordAsTemporary(client, action.metadata, *createDomain, *createSubdomain, recordType, ip, expiresIn)
+		if expiryError != nil {
+			return nil, fmt.Errorf("%s\n%s", text, expiryError.Error())
+		}
+
+		text += expiry
 	}
 
-	return successMessage{fmt.Sprintf("Created: %s → %s", getFormattedDomainName(*createSubdomain, *createDomain), ip.String())}, nil
+	return addressChangeMessage{changeMessage{text, 1}, ip}, nil
 }
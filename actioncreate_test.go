@@ -6,6 +6,7 @@ package main
 
 import (
 	"fmt"
+	"github.com/pearkes/dnsimple"
 	"net"
 	"strings"
 	"testing"
@@ -148,7 +149,7 @@ func Test_createAction_InvalidArguments_ErrorIsReturned(t *testing.T) {
 
 	editorFactory := testDNSEditorFactory{dnsCreator, nil}
 
-	createAction := createAction{editorFactory, nil}
+	createAction := createAction{editorFactory, nil, nil, nil, nil, nil}
 
 	for _, arguments := range validArgumentsSet {
 
@@ -217,7 +218,7 @@ func Test_createAction_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
 
 	editorFactory := testDNSEditorFactory{dnsCreator, nil}
 
-	createAction := createAction{editorFactory, nil}
+	createAction := createAction{editorFactory, nil, nil, nil, nil, nil}
 
 	for _, arguments := range validArgumentsSet {
 
@@ -250,7 +251,7 @@ func Test_createAction_IPAddressIsInvalid_ErrorIsReturned(t *testing.T) {
 
 	editorFactory := testDNSEditorFactory{dnsCreator, nil}
 
-	createAction := createAction{editorFactory, nil}
+	createAction := createAction{editorFactory, nil, nil, nil, nil, nil}
 
 	for _, invalidIP := range invalidIPs {
 
@@ -332,7 +333,7 @@ func Test_createAction_ValidArguments_NoErrorIsReturned(t *testing.T) {
 
 	editorFactory := testDNSEditorFactory{dnsCreator, nil}
 
-	createAction := createAction{editorFactory, nil}
+	createAction := createAction{editorFactory, nil, nil, nil, nil, nil}
 
 	for _, arguments := range validArgumentsSet {
 
@@ -367,7 +368,7 @@ func Test_createAction_ValidArguments_CreateFails_ErrorIsReturned(t *testing.T)
 
 	editorFactory := testDNSEditorFactory{dnsCreator, nil}
 
-	createAction := createAction{editorFactory, nil}
+	createAction := createAction{editorFactory, nil, nil, nil, nil, nil}
 
 	// act
 	_, err := createAction.Execute(arguments)
@@ -399,7 +400,7 @@ func Test_createAction_ValidArguments_CreateSucceds_SuccessMessageIsReturned(t *
 
 	editorFactory := testDNSEditorFactory{dnsCreator, nil}
 
-	createAction := createAction{editorFactory, nil}
+	createAction := createAction{editorFactory, nil, nil, nil, nil, nil}
 
 	// act
 	response, _ := createAction.Execute(arguments)
@@ -425,7 +426,7 @@ func Test_createAction_ValidArguments_DNSEditorCreationFails_ErrorIsReturned(t *
 
 	editorFactory := testDNSEditorFactory{nil, fmt.Errorf("Unable to create DNS editor")}
 
-	createAction := createAction{editorFactory, nil}
+	createAction := createAction{editorFactory, nil, nil, nil, nil, nil}
 
 	// act
 	_, err := createAction.Execute(arguments)
@@ -457,7 +458,7 @@ func Test_createAction_ValidArguments_CreateSucceds_SuccessMessageContainsTheSub
 
 	editorFactory := testDNSEditorFactory{dnsCreator, nil}
 
-	createAction := createAction{editorFactory, nil}
+	createAction := createAction{editorFactory, nil, nil, nil, nil, nil}
 
 	// act
 	response, _ := createAction.Execute(arguments)
@@ -472,3 +473,182 @@ func Test_createAction_ValidArguments_CreateSucceds_SuccessMessageContainsTheSub
 		t.Logf("createAction.Execute(%q) should respond with a success message that contains the domain, subdomain and ip but responded with %q instead.", arguments, response.Text())
 	}
 }
+
+// createAction.Execute should use the IP address of the given IP source if no IP address is given.
+func Test_createAction_IPSourceIsGiven_IPFromSourceIsUsed(t *testing.T) {
+	// arrange
+	arguments := []string{
+		"-domain",
+		"example.com",
+		"-subdomain",
+		"www",
+		"-ip-source",
+		"test",
+	}
+
+	var createdIP net.IP
+	dnsCreator := &testDNSEditor{
+		createSubdomainFunc: func(domain, subdomain string, timeToLive int, ip net.IP) error {
+			createdIP = ip
+			return nil
+		},
+	}
+
+	editorFactory := testDNSEditorFactory{dnsCreator, nil}
+
+	createAction := createAction{editorFactory, nil, nil, getTestIPProviderRegistry("203.0.113.7"), nil, nil}
+
+	// act
+	_, err := createAction.Execute(arguments)
+
+	// assert
+	if err != nil || createdIP.String() != "203.0.113.7" {
+		t.Fail()
+		t.Logf("createAction.Execute(%q) should create the record with the IP from the IP source but used %s (error: %v)", arguments, createdIP, err)
+	}
+}
+
+// createAction.Execute should not create an address record if a CNAME record with the same name exists.
+func Test_createAction_ConflictingCNAME_ErrorIsReturned(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "www", RecordType: "CNAME", Content: "example.net", Ttl: 600},
+		},
+	}
+
+	created := false
+	dnsCreator := &testDNSEditor{
+		createSubdomainFunc: func(domain, subdomain string, timeToLive int, ip net.IP) error {
+			created = true
+			return nil
+		},
+	}
+
+	createAction := createAction{testDNSEditorFactory{dnsCreator, nil}, testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, nil, nil, nil, nil}
+
+	// act
+	_, err := createAction.Execute([]string{"-domain", "example.com", "-subdomain", "www", "-ip", "127.0.0.1"})
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), "-replace-conflicting") {
+		t.Fail()
+		t.Logf("createAction.Execute should return a conflict error but returned %v", err)
+	}
+
+	if created || len(records["example.com"]) != 1 {
+		t.Fail()
+		t.Logf("createAction.Execute should not have changed any records")
+	}
+}
+
+// createAction.Execute should replace a conflicting CNAME record if -replace-conflicting is given.
+func Test_createAction_ReplaceConflicting_CNAMEIsDeleted(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "www", RecordType: "CNAME", Content: "example.net", Ttl: 600},
+			{Id: 2, Name: "api", RecordType: "CNAME", Content: "example.net", Ttl: 600},
+		},
+	}
+
+	created := false
+	dnsCreator := &testDNSEditor{
+		createSubdomainFunc: func(domain, subdomain string, timeToLive int, ip net.IP) error {
+			created = true
+			return nil
+		},
+	}
+
+	createAction := createAction{testDNSEditorFactory{dnsCreator, nil}, testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, nil, nil, nil, nil}
+
+	// act
+	_, err := createAction.Execute([]string{"-domain", "example.com", "-subdomain", "www", "-ip", "127.0.0.1", "-replace-conflicting"})
+
+	// assert
+	if err != nil {
+		t.Fatalf("createAction.Execute should not return an error: %s", err.Error())
+	}
+
+	if !created || len(records["example.com"]) != 1 || records["example.com"][0].Name != "api" {
+		t.Fail()
+		t.Logf("The conflicting CNAME record should have been replaced but the records are %+v", records["example.com"])
+	}
+}
+
+// createAction.Execute should accept -type AAAA together with an explicit IPv6 address.
+func Test_createAction_TypeAAAAWithIPv6_RecordIsCreated(t *testing.T) {
+	// arrange
+	arguments := []string{"-domain", "example.com", "-subdomain", "www", "-type", "AAAA", "-ip", "2001:db8::1"}
+
+	var createdIP net.IP
+	dnsCreator := &testDNSEditor{
+		createSubdomainFunc: func(domain, subdomain string, timeToLive int, ip net.IP) error {
+			createdIP = ip
+			return nil
+		},
+	}
+
+	createAction := createAction{testDNSEditorFactory{dnsCreator, nil}, nil, nil, nil, nil, nil}
+
+	// act
+	_, err := createAction.Execute(arguments)
+
+	// assert
+	if err != nil || !createdIP.Equal(net.ParseIP("2001:db8::1")) {
+		t.Fail()
+		t.Logf("createAction.Execute(%q) should create the AAAA record but returned %v", arguments, err)
+	}
+}
+
+// If the record cannot be created after the conflicting records were deleted, the error should name them and how to restore them.
+func Test_createAction_ReplaceConflicting_CreateFails_DeletedRecordsAreReported(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "www", RecordType: "CNAME", Content: "example.net", Ttl: 600},
+		},
+	}
+
+	dnsCreator := &testDNSEditor{
+		createSubdomainFunc: func(domain, subdomain string, timeToLive int, ip net.IP) error {
+			return fmt.Errorf("The API is unavailable")
+		},
+	}
+
+	createAction := createAction{testDNSEditorFactory{dnsCreator, nil}, testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, nil, nil, nil, nil}
+
+	// act
+	_, err := createAction.Execute([]string{"-domain", "example.com", "-subdomain", "www", "-ip", "127.0.0.1", "-replace-conflicting"})
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), "www.example.com CNAME example.net") || !strings.Contains(err.Error(), "dee rollback -steps 1 -apply") {
+		t.Fail()
+		t.Logf("createAction.Execute should report the deleted CNAME record and how to restore it but returned %v", err)
+	}
+}
+
+// createAction.Execute should refuse invalid subdomains before the record is created.
+func Test_createAction_InvalidSubdomain_ErrorIsReturned(t *testing.T) {
+	// arrange
+	arguments := []string{"-domain", "example.com", "-subdomain", "my_host", "-ip", "203.0.113.1"}
+
+	created := false
+	dnsCreator := &testDNSEditor{
+		createSubdomainFunc: func(domain, subdomain string, timeToLive int, ip net.IP) error {
+			created = true
+			return nil
+		},
+	}
+
+	createAction := createAction{testDNSEditorFactory{dnsCreator, nil}, nil, nil, nil, nil, nil}
+
+	// act
+	_, err := createAction.Execute(arguments)
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), "-subdomain") || created {
+		t.Fail()
+		t.Logf("createAction.Execute(%q) should refuse the subdomain but returned %v (created: %t)", arguments, err, created)
+	}
+}
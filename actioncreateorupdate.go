@@ -9,6 +9,7 @@ import (
 	"flag"
 	"fmt"
 	"github.com/andreaskoch/dee-ns"
+	"github.com/andreaskoch/dnsimple-cli/pkg/ddns"
 	"net"
 	"os"
 )
@@ -18,15 +19,23 @@ var (
 
 	createOrUpdateAddressRecordArguments = flag.NewFlagSet(actionNameCreateOrUpdate, flag.ContinueOnError)
 	createOrUpdateDomain                 = createOrUpdateAddressRecordArguments.String("domain", "", "Domain (e.g. example.com)")
+	createOrUpdateDomains                = createOrUpdateAddressRecordArguments.String("domains", "", "Comma-separated list of domains or domain patterns (e.g. example.com,example.*)")
 	createOrUpdateSubdomain              = createOrUpdateAddressRecordArguments.String("subdomain", "", "Subdomain (e.g. www)")
 	createOrUpdateIP                     = createOrUpdateAddressRecordArguments.String("ip", "", "IP address (e.g. ::1, 127.0.0.1)")
+	createOrUpdateIPSource               = createOrUpdateAddressRecordArguments.String("ip-source", "", "IP source used if no IP address is given (e.g. http, interface:eth0, file:/path, command:/path/to/script)")
+	createOrUpdateIPFromInterface        = createOrUpdateAddressRecordArguments.String("ip-from-interface", "", "Network interface the IP address is taken from (e.g. eth0)")
+	createOrUpdatePreferIPv6             = createOrUpdateAddressRecordArguments.Bool("prefer-ipv6", false, "Prefer the IPv6 address of the network interface")
+	createOrUpdateGlobalOnly             = createOrUpdateAddressRecordArguments.Bool("global-only", false, "Ignore private addresses of the network interface")
 	createOrUpdateTTL                    = createOrUpdateAddressRecordArguments.Int("ttl", defaultTTL, "The time to live in seconds")
+	createOrUpdateType                   = createOrUpdateAddressRecordArguments.String("type", "", "The record type (A or AAAA; default: the type of the IP address)")
 )
 
 type createOrUpdateAction struct {
 	dnsEditorFactory    dnsEditorCreator
 	infoProviderFactory dnsInfoProviderCreator
 	stdin               *os.File
+	ipProviders         ipProviderRegistry
+	ttlPolicy           ttlPolicyProvider
 }
 
 func (action createOrUpdateAction) Name() string {
@@ -50,40 +59,54 @@ func (action createOrUpdateAction) Execute(arguments []string) (message, error)
 
 	// parse the arguments
 	*createOrUpdateDomain = ""
+	*createOrUpdateDomains = ""
 	*createOrUpdateSubdomain = ""
 	*createOrUpdateIP = ""
+	*createOrUpdateIPSource = ""
+	*createOrUpdateIPFromInterface = ""
+	*createOrUpdatePreferIPv6 = false
+	*createOrUpdateGlobalOnly = false
 	*createOrUpdateTTL = defaultTTL
+	*createOrUpdateType = ""
 	if parseError := createOrUpdateAddressRecordArguments.Parse(arguments); parseError != nil {
 		return nil, parseError
 	}
 
-	// domain
-	if *createOrUpdateDomain == "" {
-		return nil, fmt.Errorf("No domain supplied")
+	// domains
+	domains, domainsError := getTargetDomains(*createOrUpdateDomain, *createOrUpdateDomains, action.infoProviderFactory)
+	if domainsError != nil {
+		return nil, domainsError
 	}
 
-	// subdomain
-	noSubdomainGiven := *createOrUpdateSubdomain == ""
-
 	// TTL
 	if *createOrUpdateTTL < 0 {
 		return nil, fmt.Errorf("The given TTL cannot be negative")
 	}
 
-	// take ip from stdin
-	if *createOrUpdateIP == "" && stdinHasData(action.stdin) {
-		ipAddressFromStdin := ""
-		fmt.Fscanf(os.Stdin, "%s", &ipAddressFromStdin)
-		createIP = &ipAddressFromStdin
+	ttl, ttlError := applyTTLPolicy(action.ttlPolicy, actionNameCreateOrUpdate, true, *createOrUpdateTTL, arguments)
+	if ttlError != nil {
+		return nil, ttlError
+	}
+
+	// IP address
+	ipSource, ipSourceError := getInterfaceIPSource(*createOrUpdateIPSource, *createOrUpdateIPFromInterface, *createOrUpdateType, *createOrUpdatePreferIPv6, *createOrUpdateGlobalOnly)
+	if ipSourceError != nil {
+		return nil, ipSourceError
+	}
+
+	ip, ipError := getIPAddress(*createOrUpdateIP, ipSource, action.ipProviders, action.stdin)
+	if ipError != nil {
+		return nil, ipError
 	}
 
-	if *createOrUpdateIP == "" {
-		return nil, fmt.Errorf("No IP address supplied")
+	// record type
+	dnsRecordType, recordTypeError := getDNSRecordType(*createOrUpdateType, ip)
+	if recordTypeError != nil {
+		return nil, recordTypeError
 	}
 
-	ip := net.ParseIP(*createOrUpdateIP)
-	if ip == nil {
-		return nil, fmt.Errorf("Cannot parse IP %q", ip)
+	if validationError := validateRecordArguments(*createOrUpdateSubdomain, dnsRecordType, ip.String(), ttl, recordArguments{"-subdomain", "-ip", "-ttl"}); validationError != nil {
+		return nil, validationError
 	}
 
 	// create a DNS editor
@@ -99,29 +122,72 @@ func (action createOrUpdateAction) Execute(arguments []string) (message, error)
 		return nil, fmt.Errorf("No DNS info provider available")
 	}
 
-	// determine the record type
-	dnsRecordType := getDNSRecordTypeByIP(ip)
+	return applyToDomains(domains, func(domain string) (message, error) {
+		return action.createOrUpdate(addressRecordEditor, infoProvider, domain, dnsRecordType, ip, ttl)
+	})
+}
+
+// createOrUpdate points the address record of the selected subdomain of the given
+// domain to the given IP with a single pass of the ddns updater. The record is
+// created with the given TTL if it does not exist yet.
+func (action createOrUpdateAction) createOrUpdate(editor deens.DNSRecordEditor, infoProvider deens.DNSInfoProvider, domain, dnsRecordType string, ip net.IP, ttl int) (message, error) {
+	updater := &ddns.Updater{
+		IPProvider: staticIPProvider{ip},
+		DNS:        addressRecordCreator{editor, infoProvider, dnsRecordType},
+		Records:    []ddns.Record{{Domain: domain, Subdomain: *createOrUpdateSubdomain, TTL: ttl}},
+	}
+
+	results, updateError := updater.Update()
+	if updateError != nil {
+		return nil, updateError
+	}
+
+	result := results[0]
+	switch {
+	case result.Err != nil:
+		return nil, fmt.Errorf("%s", result.Err.Error())
+
+	case !result.Changed:
+		return getUnchangedAddressMessage(*createOrUpdateSubdomain, domain, ip), nil
+	}
+
+	return addressChangeMessage{changeMessage{result.String(), 1}, ip}, nil
+}
+
+// staticIPProvider returns the IP address that was determined before the update.
+type staticIPProvider struct {
+	ip net.IP
+}
 
-	_, domainRecordError := infoProvider.GetSubdomainRecord(*createOrUpdateDomain, *createOrUpdateSubdomain, dnsRecordType)
-	if domainRecordError == nil || noSubdomainGiven {
+func (provider staticIPProvider) GetIP() (net.IP, error) {
+	return provider.ip, nil
+}
 
-		// update
-		updateError := addressRecordEditor.UpdateSubdomain(*createOrUpdateDomain, *createOrUpdateSubdomain, ip)
-		if updateError != nil {
-			return nil, fmt.Errorf("%s", updateError.Error())
-		}
+// addressRecordCreator is the DNS backend of the ddns updater for createorupdate.
+// It looks up the record of the selected type before the update so that the
+// updater creates missing subdomain records; the address record of the domain
+// itself is only ever updated.
+type addressRecordCreator struct {
+	editor        deens.DNSRecordEditor
+	infoProvider  deens.DNSInfoProvider
+	dnsRecordType string
+}
 
-		return successMessage{fmt.Sprintf("Updated: %s → %s", getFormattedDomainName(*createOrUpdateSubdomain, *createOrUpdateDomain), ip.String())}, nil
+func (creator addressRecordCreator) CreateSubdomain(domain, subdomain string, timeToLive int, ip net.IP) error {
+	return creator.editor.CreateSubdomain(domain, subdomain, timeToLive, ip)
+}
 
+func (creator addressRecordCreator) UpdateSubdomain(domain, subdomain string, ip net.IP) error {
+	record, recordError := creator.infoProvider.GetSubdomainRecord(domain, subdomain, creator.dnsRecordType)
+	if recordError == nil && ip.Equal(net.ParseIP(record.Content)) {
+		return fmt.Errorf("No update required. IP address did not change (%s).", record.Content)
 	}
 
-	// create
-	createError := addressRecordEditor.CreateSubdomain(*createOrUpdateDomain, *createOrUpdateSubdomain, *createOrUpdateTTL, ip)
-	if createError != nil {
-		return nil, fmt.Errorf("%s", createError.Error())
+	if recordError != nil && subdomain != "" {
+		return fmt.Errorf("No address record of type %q found for %q", creator.dnsRecordType, getFormattedDomainName(subdomain, domain))
 	}
 
-	return successMessage{fmt.Sprintf("Created: %s → %s", getFormattedDomainName(*createOrUpdateSubdomain, *createOrUpdateDomain), ip.String())}, nil
+	return creator.editor.UpdateSubdomain(domain, subdomain, ip)
 }
 
 // getInfoProvider returns a DNS info provider instance or an error if the creation of the provider failed.
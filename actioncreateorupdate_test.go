@@ -160,7 +160,7 @@ func Test_createOrUpdateAction_InvalidArguments_ErrorIsReturned(t *testing.T) {
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil}
+	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil, nil, nil}
 
 	for _, arguments := range validArgumentsSet {
 
@@ -237,7 +237,7 @@ func Test_createOrUpdateAction_InvalidArgumentValues_ErrorIsReturned(t *testing.
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil}
+	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil, nil, nil}
 
 	for _, arguments := range validArgumentsSet {
 
@@ -281,7 +281,7 @@ func Test_createOrUpdateAction_IPAddressIsInvalid_ErrorIsReturned(t *testing.T)
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil}
+	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil, nil, nil}
 
 	for _, invalidIP := range invalidIPs {
 
@@ -374,7 +374,7 @@ func Test_createOrUpdateAction_ValidArguments_NoErrorIsReturned(t *testing.T) {
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil}
+	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil, nil, nil}
 
 	for _, arguments := range validArgumentsSet {
 
@@ -412,7 +412,7 @@ func Test_createOrUpdateAction_ValidArguments_NoInfoProvider_ErrorIsReturned(t *
 
 	editorFactory := testDNSEditorFactory{dnsCreator, nil}
 
-	createOrUpdateAction := createOrUpdateAction{editorFactory, nil, nil}
+	createOrUpdateAction := createOrUpdateAction{editorFactory, nil, nil, nil, nil}
 
 	// act
 	_, err := createOrUpdateAction.Execute(arguments)
@@ -455,7 +455,7 @@ func Test_createOrUpdateAction_ValidArguments_CreateFails_ErrorIsReturned(t *tes
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil}
+	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil, nil, nil}
 
 	// act
 	_, err := createOrUpdateAction.Execute(arguments)
@@ -497,7 +497,7 @@ func Test_createOrUpdateAction_ValidArguments_RecordAlreadyExists_UpdateIsExecut
 		getSubdomainRecordFunc: func(domain, subdomain, recordType string) (dnsimple.Record, error) {
 			return dnsimple.Record{
 				Name:       "www",
-				Content:    "2001:0db8:0000:0042:0000:8a2e:0370:7334",
+				Content:    "2001:0db8:0000:0042:0000:8a2e:0370:7000",
 				RecordType: "AAAA",
 			}, nil
 		},
@@ -505,7 +505,7 @@ func Test_createOrUpdateAction_ValidArguments_RecordAlreadyExists_UpdateIsExecut
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil}
+	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil, nil, nil}
 
 	// act
 	createOrUpdateAction.Execute(arguments)
@@ -548,7 +548,7 @@ func Test_createOrUpdateAction_ValidArguments_CreateSucceds_SuccessMessageIsRetu
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil}
+	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil, nil, nil}
 
 	// act
 	response, _ := createOrUpdateAction.Execute(arguments)
@@ -582,7 +582,7 @@ func Test_createOrUpdateAction_ValidArguments_DNSEditorCreationFails_ErrorIsRetu
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil}
+	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil, nil, nil}
 
 	// act
 	_, err := createOrUpdateAction.Execute(arguments)
@@ -625,7 +625,7 @@ func Test_createOrUpdateAction_ValidArguments_UpdateSucceds_SuccessMessageContai
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil}
+	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil, nil, nil}
 
 	// act
 	response, _ := createOrUpdateAction.Execute(arguments)
@@ -669,7 +669,7 @@ func Test_createOrUpdateAction_ValidArguments_UpdateFails_ErrorIsReturned(t *tes
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil}
+	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil, nil, nil}
 
 	// act
 	_, err := createOrUpdateAction.Execute(arguments)
@@ -712,7 +712,7 @@ func Test_createOrUpdateAction_ValidArguments_CreateSucceds_SuccessMessageContai
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil}
+	createOrUpdateAction := createOrUpdateAction{editorFactory, infoProviderFactory, nil, nil, nil}
 
 	// act
 	response, _ := createOrUpdateAction.Execute(arguments)
@@ -727,3 +727,77 @@ func Test_createOrUpdateAction_ValidArguments_CreateSucceds_SuccessMessageContai
 		t.Logf("createOrUpdateAction.Execute(%q) should respond with a success message that contains the domain, subdomain and ip but responded with %q instead.", arguments, response.Text())
 	}
 }
+
+// createOrUpdateAction.Execute should not update a record that already has the IP address.
+func Test_createOrUpdateAction_ValidArguments_RecordAlreadyMatches_UnchangedMessageIsReturned(t *testing.T) {
+	// arrange
+	arguments := []string{
+		"-domain",
+		"example.com",
+		"-subdomain",
+		"www",
+		"-ip",
+		"2001:0db8:0000:0042:0000:8a2e:0370:7334",
+	}
+
+	dnsEditor := &testDNSEditor{
+		updateSubdomainFunc: func(domain, subdomain string, ip net.IP) error {
+			t.Fail()
+			t.Logf("The record should not have been updated")
+			return nil
+		},
+		createSubdomainFunc: func(domain, subdomain string, timeToLive int, ip net.IP) error {
+			t.Fail()
+			t.Logf("The record should not have been created")
+			return nil
+		},
+	}
+
+	dnsInfoProvider := testDNSInfoProvider{
+		getSubdomainRecordFunc: func(domain, subdomain, recordType string) (dnsimple.Record, error) {
+			return dnsimple.Record{Name: "www", Content: "2001:db8:0:42:0:8a2e:370:7334", RecordType: "AAAA"}, nil
+		},
+	}
+
+	createOrUpdateAction := createOrUpdateAction{testDNSEditorFactory{dnsEditor, nil}, testInfoProviderFactory{dnsInfoProvider, nil}, nil, nil, nil}
+
+	// act
+	response, err := createOrUpdateAction.Execute(arguments)
+
+	// assert
+	if _, isUnchanged := response.(unchangedMessage); err != nil || !isUnchanged {
+		t.Fail()
+		t.Logf("createOrUpdateAction.Execute(%q) should return an unchanged message but returned %#v (%v)", arguments, response, err)
+	}
+}
+
+// createOrUpdateAction.Execute should accept -type AAAA together with an explicit IPv6 address.
+func Test_createOrUpdateAction_TypeAAAAWithIPv6_RecordIsCreated(t *testing.T) {
+	// arrange
+	arguments := []string{"-domain", "example.com", "-subdomain", "www", "-type", "AAAA", "-ip", "2001:db8::1"}
+
+	var createdIP net.IP
+	dnsCreator := &testDNSEditor{
+		createSubdomainFunc: func(domain, subdomain string, timeToLive int, ip net.IP) error {
+			createdIP = ip
+			return nil
+		},
+	}
+
+	dnsInfoProvider := testDNSInfoProvider{
+		getSubdomainRecordFunc: func(domain, subdomain, recordType string) (dnsimple.Record, error) {
+			return dnsimple.Record{}, fmt.Errorf("No %s record found", recordType)
+		},
+	}
+
+	createOrUpdateAction := createOrUpdateAction{testDNSEditorFactory{dnsCreator, nil}, testInfoProviderFactory{dnsInfoProvider, nil}, nil, nil, nil}
+
+	// act
+	_, err := createOrUpdateAction.Execute(arguments)
+
+	// assert
+	if err != nil || !createdIP.Equal(net.ParseIP("2001:db8::1")) {
+		t.Fail()
+		t.Logf("createOrUpdateAction.Execute(%q) should create the AAAA record but returned %v", arguments, err)
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/spf13/afero"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	actionNameDaemon = "daemon"
+
+	daemonArguments = flag.NewFlagSet(actionNameDaemon, flag.ContinueOnError)
+	daemonConfig    = daemonArguments.String("config", "", "The path of the configuration file (default: ~/.dee/config.json)")
+)
+
+// unschedulableActions contains the actions that run until they
+// are stopped and can therefore not be executed by the daemon.
+var unschedulableActions = []string{actionNameDaemon, actionNameFailover, actionNameRotate, actionNameService}
+
+type daemonAction struct {
+	fs                    afero.Fs
+	decrypter             configDecrypter
+	defaultConfigFilePath string
+	getActions            func() []action
+	now                   func() time.Time
+	sleep                 func(duration time.Duration)
+	log                   logger
+
+	// stop stops the daemon after the running tasks have finished
+	// (e.g. when the Windows service is stopped). Without a stop
+	// channel the daemon runs until the process is stopped.
+	stop <-chan bool
+}
+
+func (action daemonAction) Name() string {
+	return actionNameDaemon
+}
+
+func (action daemonAction) Description() string {
+	return "Run the tasks of the configuration file on their schedules"
+}
+
+func (action daemonAction) Usage() string {
+	buf := new(bytes.Buffer)
+	daemonArguments.SetOutput(buf)
+	daemonArguments.PrintDefaults()
+	return buf.String()
+}
+
+// Execute runs the tasks of the configuration file on their
+// schedules until the process or the daemon is stopped.
+func (action daemonAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*daemonConfig = ""
+	if parseError := daemonArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	configFilePath := *daemonConfig
+	if configFilePath == "" {
+		configFilePath = findConfigFile(action.fs, action.defaultConfigFilePath)
+	}
+
+	if action.getActions == nil {
+		return nil, fmt.Errorf("No actions available")
+	}
+
+	settings, configError := loadConfig(action.fs, action.decrypter, configFilePath)
+	if configError != nil {
+		return nil, configError
+	}
+
+	log := action.log
+	if settings.Log.File != "" {
+		logFile, logFileError := newRotatingFileWriter(action.fs, settings.Log)
+		if logFileError != nil {
+			return nil, logFileError
+		}
+
+		defer logFile.Close()
+		log = log.WithOutput(logFile)
+	}
+
+	scheduler, schedulerError := newTaskScheduler(settings.Tasks, action.getActions(), action.now(), log)
+	if schedulerError != nil {
+		return nil, schedulerError
+	}
+
+	if settings.MQTT.Broker != "" {
+		publisher, publisherError := newMQTTPublisher(settings.MQTT)
+		if publisherError != nil {
+			return nil, publisherError
+		}
+
+		scheduler.events = publisher
+		log.Infof("Publishing change events to %s", settings.MQTT.Broker)
+	}
+
+	log.Infof("Scheduled %d tasks from %s", len(scheduler.tasks), configFilePath)
+	for {
+		scheduler.RunDue(action.now())
+		if stopped := action.waitUntil(scheduler.NextRun()); stopped {
+			log.Infof("Stopping after the running tasks have finished")
+			scheduler.Wait()
+			return successMessage{"The daemon stopped"}, nil
+		}
+	}
+}
+
+// waitUntil sleeps until the given time. It returns true
+// if the daemon was stopped in the meantime.
+func (action daemonAction) waitUntil(next time.Time) bool {
+	if action.stop == nil {
+		action.sleep(next.Sub(action.now()))
+		return false
+	}
+
+	timer := time.NewTimer(next.Sub(action.now()))
+	defer timer.Stop()
+
+	select {
+	case <-action.stop:
+		return true
+
+	case <-timer.C:
+		return false
+	}
+}
+
+// newTaskScheduler creates a scheduler for the given tasks. The first
+// runs of the tasks are calculated from the given start time.
+func newTaskScheduler(tasks []taskConfig, actions []action, start time.Time, log logger) (*taskScheduler, error) {
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("No tasks configured")
+	}
+
+	scheduler := &taskScheduler{log: log}
+	for index, task := range tasks {
+		if task.Name == "" {
+			task.Name = fmt.Sprintf("%s (task %d)", task.Action, index+1)
+		}
+
+		if containsString(unschedulableActions, task.Action) {
+			return nil, fmt.Errorf("%s: The action %q cannot be scheduled", task.Name, task.Action)
+		}
+
+		taskAction := getActionByName(task.Action, actions)
+		if taskAction == nil {
+			return nil, fmt.Errorf("%s: Unknown action: %q", task.Name, task.Action)
+		}
+
+		taskSchedule, scheduleError := parseSchedule(task.Schedule)
+		if scheduleError != nil {
+			return nil, fmt.Errorf("%s: %s", task.Name, scheduleError.Error())
+		}
+
+		next := taskSchedule.Next(start)
+		if next.IsZero() {
+			return nil, fmt.Errorf("%s: The schedule %q is never due", task.Name, task.Schedule)
+		}
+
+		scheduler.tasks = append(scheduler.tasks, &scheduledTask{
+			config:   task,
+			schedule: taskSchedule,
+			action:   taskAction,
+			next:     next,
+		})
+	}
+
+	return scheduler, nil
+}
+
+// scheduledTask is a task of the task scheduler.
+type scheduledTask struct {
+	config   taskConfig
+	schedule schedule
+	action   action
+	next     time.Time
+
+	// running is 1 while the task is executed.
+	running int32
+}
+
+// taskScheduler executes actions on their schedules. A task is skipped if
+// its previous run has not finished yet. The actions are executed one at a
+// time because they share their argument flag sets.
+type taskScheduler struct {
+	tasks []*scheduledTask
+	log   logger
+
+	// events receives the change events of the tasks (optional).
+	events eventPublisher
+
+	execution sync.Mutex
+	runs      sync.WaitGroup
+}
+
+// RunDue starts all tasks that are due at the given time
+// and calculates their next runs.
+func (scheduler *taskScheduler) RunDue(now time.Time) {
+	for _, task := range scheduler.tasks {
+		if task.next.After(now) {
+			continue
+		}
+
+		task.next = task.schedule.Next(now)
+
+		if !atomic.CompareAndSwapInt32(&task.running, 0, 1) {
+			scheduler.log.With(logFields{Action: task.config.Action}).Errorf("%s: Skipped because the previous run is still in progress", task.config.Name)
+			continue
+		}
+
+		scheduler.runs.Add(1)
+		go scheduler.run(task)
+	}
+}
+
+// NextRun returns the time the next task is due.
+func (scheduler *taskScheduler) NextRun() time.Time {
+	var next time.Time
+	for _, task := range scheduler.tasks {
+		if task.next.IsZero() {
+			continue
+		}
+
+		if next.IsZero() || task.next.Before(next) {
+			next = task.next
+		}
+	}
+
+	return next
+}
+
+// Wait blocks until all started tasks have finished.
+func (scheduler *taskScheduler) Wait() {
+	scheduler.runs.Wait()
+}
+
+// run executes the action of the given task.
+func (scheduler *taskScheduler) run(task *scheduledTask) {
+	defer scheduler.runs.Done()
+	defer atomic.StoreInt32(&task.running, 0)
+
+	scheduler.execution.Lock()
+	defer scheduler.execution.Unlock()
+
+	start := time.Now()
+	result, err := task.action.Execute(task.config.Arguments)
+
+	log := scheduler.log.With(logFields{
+		Domain:    getArgumentValue(task.config.Arguments, "domain"),
+		Subdomain: getArgumentValue(task.config.Arguments, "subdomain"),
+		Action:    task.config.Action,
+		Duration:  time.Since(start),
+		Error:     err,
+	})
+
+	if err != nil {
+		log.Errorf("%s failed", task.config.Name)
+		return
+	}
+
+	log.Infof("%s: %s", task.config.Name, result.Text())
+
+	if scheduler.events == nil || !getChangeSummary(result).Changed {
+		return
+	}
+
+	if publishError := scheduler.publish(task, result, time.Now()); publishError != nil {
+		log.With(logFields{Error: publishError}).Errorf("%s: Cannot publish the change event", task.config.Name)
+	}
+}
+
+const (
+	eventIPChange     = "ip-change"
+	eventRecordUpdate = "record-update"
+)
+
+// eventPublisher publishes events to a subtopic (e.g. "ip-change").
+type eventPublisher interface {
+	Publish(subtopic string, payload []byte) error
+}
+
+// changeEvent is the payload of the events that are
+// published when a task changed DNS records.
+type changeEvent struct {
+	Event     string    `json:"event"`
+	Task      string    `json:"task"`
+	Action    string    `json:"action"`
+	Domain    string    `json:"domain,omitempty"`
+	Subdomain string    `json:"subdomain,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	Message   string    `json:"message"`
+	Records   int       `json:"records"`
+	Time      time.Time `json:"time"`
+}
+
+// publish sends the change event of the given task result. Results of
+// address actions are published as "ip-change", all others as "record-update".
+func (scheduler *taskScheduler) publish(task *scheduledTask, result message, now time.Time) error {
+	event := changeEvent{
+		Event:     eventRecordUpdate,
+		Task:      task.config.Name,
+		Action:    task.config.Action,
+		Domain:    getArgumentValue(task.config.Arguments, "domain"),
+		Subdomain: getArgumentValue(task.config.Arguments, "subdomain"),
+		Message:   result.Text(),
+		Records:   getChangeSummary(result).Records,
+		Time:      now.UTC(),
+	}
+
+	if addressChange, isAddressChange := result.(addressChangeMessage); isAddressChange {
+		event.Event = eventIPChange
+		event.IP = addressChange.ip.String()
+	}
+
+	payload, marshalError := json.Marshal(event)
+	if marshalError != nil {
+		return marshalError
+	}
+
+	return scheduler.events.Publish(event.Event, payload)
+}
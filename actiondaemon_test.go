@@ -0,0 +1,325 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/spf13/afero"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingTestAction is an action that blocks until its release channel is closed.
+type blockingTestAction struct {
+	name     string
+	started  chan bool
+	release  chan bool
+	executed *int
+}
+
+func (action blockingTestAction) Name() string        { return action.name }
+func (action blockingTestAction) Description() string { return "" }
+func (action blockingTestAction) Usage() string       { return "" }
+
+func (action blockingTestAction) Execute(arguments []string) (message, error) {
+	*action.executed++
+	action.started <- true
+	<-action.release
+	return successMessage{"done"}, nil
+}
+
+func Test_daemonAction_Name_CorrectActionNameIsReturned(t *testing.T) {
+
+	// arrange
+	daemonAction := daemonAction{}
+
+	// act
+	result := daemonAction.Name()
+
+	// assert
+	if result != "daemon" {
+		t.Fail()
+		t.Logf("daemonAction.Name() should have returned %q but returned %q instead.", "daemon", result)
+	}
+
+}
+
+func Test_daemonAction_Usage_ResultIsNotEmpty(t *testing.T) {
+
+	// arrange
+	daemonAction := daemonAction{}
+
+	// act
+	result := daemonAction.Usage()
+
+	// assert
+	if isEmpty(result) {
+		t.Fail()
+		t.Logf("daemonAction.Usage() not be empty.")
+	}
+
+}
+
+// daemonAction.Execute should return an error if the configuration is invalid.
+func Test_daemonAction_InvalidConfig_ErrorIsReturned(t *testing.T) {
+	// arrange
+	configs := []string{
+		`{"tasks": []}`,
+		`{"tasks": [{"schedule": "@every 5m", "action": "unknown"}]}`,
+		`{"tasks": [{"schedule": "@every 5m", "action": "daemon"}]}`,
+		`{"tasks": [{"schedule": "every five minutes", "action": "list"}]}`,
+		`{"tasks": [{"schedule": "0 0 31 2 *", "action": "list"}]}`,
+		`{"tasks": `,
+	}
+
+	getActions := func() []action {
+		return []action{testAction{name: "list"}, daemonAction{}}
+	}
+
+	for _, config := range configs {
+		fs := afero.NewMemMapFs()
+		afero.WriteFile(fs, "/home/user/.dee/config.json", []byte(config), 0600)
+
+		daemonAction := daemonAction{fs, configDecrypter{}, "/home/user/.dee/config.json", getActions, time.Now, nil, logger{}, nil}
+
+		// act
+		_, err := daemonAction.Execute([]string{})
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("daemonAction.Execute() should return an error for the configuration %s", config)
+		}
+	}
+}
+
+// daemonAction.Execute should return an error if the configuration file does not exist.
+func Test_daemonAction_ConfigDoesNotExist_ErrorIsReturned(t *testing.T) {
+	// arrange
+	daemonAction := daemonAction{afero.NewMemMapFs(), configDecrypter{}, "/home/user/.dee/config.json", func() []action { return nil }, time.Now, nil, logger{}, nil}
+
+	// act
+	_, err := daemonAction.Execute([]string{"-config", "/etc/dee.json"})
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), "/etc/dee.json") {
+		t.Fail()
+		t.Logf("daemonAction.Execute() should return an error that names the missing configuration file: %v", err)
+	}
+}
+
+// Tasks should run when they are due and be skipped while their previous run is still in progress.
+func Test_taskScheduler_RunDue_OverlappingRunsAreSkipped(t *testing.T) {
+	// arrange
+	executed := 0
+	blockingAction := blockingTestAction{"update", make(chan bool, 1), make(chan bool), &executed}
+
+	start := time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+	output := new(bytes.Buffer)
+	tasks := []taskConfig{
+		{Name: "update IP", Schedule: "@every 5m", Action: "update"},
+	}
+
+	scheduler, err := newTaskScheduler(tasks, []action{blockingAction}, start, newLogger(output, nil))
+	if err != nil {
+		t.Fatalf("newTaskScheduler returned an error: %s", err.Error())
+	}
+
+	// act
+	scheduler.RunDue(start.Add(time.Minute))
+	scheduler.RunDue(start.Add(5 * time.Minute))
+	<-blockingAction.started
+	scheduler.RunDue(start.Add(10 * time.Minute))
+	close(blockingAction.release)
+	scheduler.Wait()
+
+	// assert
+	if executed != 1 {
+		t.Fail()
+		t.Logf("The task should have been executed once but was executed %d times", executed)
+	}
+
+	if !strings.Contains(output.String(), "update IP: Skipped") {
+		t.Fail()
+		t.Logf("The skipped run should have been logged: %q", output.String())
+	}
+
+	if expected := start.Add(15 * time.Minute); !scheduler.NextRun().Equal(expected) {
+		t.Fail()
+		t.Logf("The next run should be at %s but is at %s", expected, scheduler.NextRun())
+	}
+}
+
+// testEventPublisher records the published events.
+type testEventPublisher struct {
+	subtopics []string
+	payloads  []string
+}
+
+func (publisher *testEventPublisher) Publish(subtopic string, payload []byte) error {
+	publisher.subtopics = append(publisher.subtopics, subtopic)
+	publisher.payloads = append(publisher.payloads, string(payload))
+	return nil
+}
+
+// testMessageAction is an action that returns the given message.
+type testMessageAction struct {
+	name   string
+	result message
+}
+
+func (action testMessageAction) Name() string        { return action.name }
+func (action testMessageAction) Description() string { return "" }
+func (action testMessageAction) Usage() string       { return "" }
+
+func (action testMessageAction) Execute(arguments []string) (message, error) {
+	return action.result, nil
+}
+
+// Tasks that changed records should publish change events; IP changes as "ip-change".
+func Test_taskScheduler_RunDue_ChangeEventsArePublished(t *testing.T) {
+	// arrange
+	actions := []action{
+		testMessageAction{"createorupdate", addressChangeMessage{changeMessage{"Updated: home.example.com → 203.0.113.1", 1}, net.ParseIP("203.0.113.1")}},
+		testMessageAction{"dkim", changeMessage{"Updated: mail._domainkey.example.com (TXT)", 1}},
+		testMessageAction{"list", successMessage{"example.com"}},
+	}
+
+	start := time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+	tasks := []taskConfig{
+		{Name: "update IP", Schedule: "@every 5m", Action: "createorupdate", Arguments: []string{"-domain", "example.com", "-subdomain", "home"}},
+		{Name: "rotate DKIM", Schedule: "@every 10m", Action: "dkim"},
+		{Name: "list", Schedule: "@every 5m", Action: "list"},
+	}
+
+	scheduler, err := newTaskScheduler(tasks, actions, start, newLogger(new(bytes.Buffer), nil))
+	if err != nil {
+		t.Fatalf("newTaskScheduler returned an error: %s", err.Error())
+	}
+
+	publisher := &testEventPublisher{}
+	scheduler.events = publisher
+
+	// act
+	scheduler.RunDue(start.Add(10 * time.Minute))
+	scheduler.Wait()
+
+	// assert
+	sort.Strings(publisher.subtopics)
+	if strings.Join(publisher.subtopics, ",") != "ip-change,record-update" {
+		t.Fail()
+		t.Logf("An ip-change and a record-update event should have been published but were: %v", publisher.subtopics)
+	}
+
+	for _, payload := range publisher.payloads {
+		if !strings.Contains(payload, `"event":"ip-change"`) {
+			continue
+		}
+
+		if !strings.Contains(payload, `"ip":"203.0.113.1"`) || !strings.Contains(payload, `"subdomain":"home"`) {
+			t.Fail()
+			t.Logf("The ip-change event should contain the IP address and subdomain: %s", payload)
+		}
+	}
+}
+
+// Tasks whose records already matched should be logged as healthy runs without publishing events.
+func Test_taskScheduler_RunDue_UnchangedResult_IsLoggedAsSuccess(t *testing.T) {
+	// arrange
+	actions := []action{
+		testMessageAction{"createorupdate", unchangedMessage{"Unchanged: home.example.com → 203.0.113.1"}},
+	}
+
+	start := time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+	tasks := []taskConfig{
+		{Name: "update IP", Schedule: "@every 5m", Action: "createorupdate"},
+	}
+
+	output := new(bytes.Buffer)
+	scheduler, err := newTaskScheduler(tasks, actions, start, newLogger(output, nil))
+	if err != nil {
+		t.Fatalf("newTaskScheduler returned an error: %s", err.Error())
+	}
+
+	publisher := &testEventPublisher{}
+	scheduler.events = publisher
+
+	// act
+	scheduler.RunDue(start.Add(5 * time.Minute))
+	scheduler.Wait()
+
+	// assert
+	if !strings.Contains(output.String(), "update IP: Unchanged: home.example.com") || strings.Contains(output.String(), "ERROR") {
+		t.Fail()
+		t.Logf("The unchanged run should have been logged as success: %q", output.String())
+	}
+
+	if len(publisher.subtopics) > 0 {
+		t.Fail()
+		t.Logf("No event should have been published but were: %v", publisher.subtopics)
+	}
+}
+
+// A stopped daemon should return only after the running task has finished.
+func Test_daemonAction_Stopped_RunningTaskIsFinished(t *testing.T) {
+	// arrange
+	executed := 0
+	blockingAction := blockingTestAction{"update", make(chan bool, 1), make(chan bool), &executed}
+	getActions := func() []action {
+		return []action{blockingAction}
+	}
+
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/user/.dee/config.json", []byte(`{"tasks": [{"schedule": "@every 5m", "action": "update"}]}`), 0600)
+
+	// the task is due at the first run of the scheduler
+	start := time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+	calls := 0
+	now := func() time.Time {
+		calls++
+		if calls == 1 {
+			return start
+		}
+
+		return start.Add(10 * time.Minute)
+	}
+
+	stop := make(chan bool)
+	daemonAction := daemonAction{fs, configDecrypter{}, "/home/user/.dee/config.json", getActions, now, nil, logger{}, stop}
+
+	// act
+	results := make(chan message, 1)
+	go func() {
+		result, _ := daemonAction.Execute([]string{})
+		results <- result
+	}()
+
+	<-blockingAction.started
+	close(stop)
+
+	// assert
+	select {
+	case <-results:
+		t.Fatalf("daemonAction.Execute should not return while a task is running")
+
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	blockingAction.release <- true
+
+	select {
+	case result := <-results:
+		if _, isSuccess := result.(successMessage); !isSuccess {
+			t.Fail()
+			t.Logf("daemonAction.Execute should return a success message after it was stopped but returned %#v", result)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatalf("daemonAction.Execute should return after the running task has finished")
+	}
+}
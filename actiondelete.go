@@ -73,5 +73,5 @@ func (action deleteAction) Execute(arguments []string) (message, error) {
 		return nil, fmt.Errorf("%s", deleteError.Error())
 	}
 
-	return successMessage{fmt.Sprintf("Deleted: %s (%s)", getFormattedDomainName(*deleteSubdomain, *deleteDomain), *deleteRecordType)}, nil
+	return changeMessage{fmt.Sprintf("Deleted: %s (%s)", getFormattedDomainName(*deleteSubdomain, *deleteDomain), *deleteRecordType), 1}, nil
 }
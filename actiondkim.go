@@ -0,0 +1,259 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"github.com/spf13/afero"
+	"strings"
+)
+
+var (
+	actionNameDKIM = "dkim"
+
+	dkimSetArguments = flag.NewFlagSet(actionNameDKIM+" set", flag.ContinueOnError)
+	dkimSetDomain    = dkimSetArguments.String("domain", "", "Domain (e.g. example.com)")
+	dkimSetSelector  = dkimSetArguments.String("selector", "", "DKIM selector (e.g. mail)")
+	dkimSetPublicKey = dkimSetArguments.String("pubkey", "", "Path to the PEM-encoded DKIM public key (e.g. ./dkim.pub)")
+	dkimSetTTL       = dkimSetArguments.Int("ttl", defaultTTL, "The time to live in seconds")
+
+	dkimCheckArguments = flag.NewFlagSet(actionNameDKIM+" check", flag.ContinueOnError)
+	dkimCheckDomain    = dkimCheckArguments.String("domain", "", "Domain (e.g. example.com)")
+	dkimCheckSelector  = dkimCheckArguments.String("selector", "", "DKIM selector (e.g. mail)")
+	dkimCheckPublicKey = dkimCheckArguments.String("pubkey", "", "Path to the PEM-encoded DKIM public key (e.g. ./dkim.pub)")
+)
+
+type dkimAction struct {
+	clientFactory dnsClientFactory
+	fs            afero.Fs
+	lookupTXT     func(name string) ([]string, error)
+	ttlPolicy     ttlPolicyProvider
+}
+
+func (action dkimAction) Name() string {
+	return actionNameDKIM
+}
+
+func (action dkimAction) Description() string {
+	return "Publish or check the DKIM public key of a domain"
+}
+
+func (action dkimAction) Usage() string {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "  %s set [arguments ...]\n", actionNameDKIM)
+	dkimSetArguments.SetOutput(buf)
+	dkimSetArguments.PrintDefaults()
+
+	fmt.Fprintf(buf, "\n  %s check [arguments ...]\n", actionNameDKIM)
+	dkimCheckArguments.SetOutput(buf)
+	dkimCheckArguments.PrintDefaults()
+
+	return buf.String()
+}
+
+// Execute publishes the DKIM TXT record ("set") or verifies that the
+// served DKIM key matches the given public key file ("check").
+func (action dkimAction) Execute(arguments []string) (message, error) {
+	if len(arguments) == 0 {
+		return nil, fmt.Errorf("No sub command supplied (set, check)")
+	}
+
+	switch arguments[0] {
+	case "set":
+		return action.set(arguments[1:])
+	case "check":
+		return action.check(arguments[1:])
+	}
+
+	return nil, fmt.Errorf("Unknown sub command: %q", arguments[0])
+}
+
+// set creates or updates the selector._domainkey TXT record.
+func (action dkimAction) set(arguments []string) (message, error) {
+
+	// parse the arguments
+	*dkimSetDomain = ""
+	*dkimSetSelector = ""
+	*dkimSetPublicKey = ""
+	*dkimSetTTL = defaultTTL
+	if parseError := dkimSetArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if *dkimSetDomain == "" {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	if *dkimSetSelector == "" {
+		return nil, fmt.Errorf("No selector supplied")
+	}
+
+	if *dkimSetTTL < 0 {
+		return nil, fmt.Errorf("The given TTL cannot be negative")
+	}
+
+	publicKey, keyError := action.readPublicKey(*dkimSetPublicKey)
+	if keyError != nil {
+		return nil, keyError
+	}
+
+	ttl, ttlError := applyTTLPolicy(action.ttlPolicy, actionNameDKIM+" set", false, *dkimSetTTL, arguments)
+	if ttlError != nil {
+		return nil, ttlError
+	}
+
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	recordName := getDKIMRecordName(*dkimSetSelector)
+	created, setError := setRecord(client, *dkimSetDomain, recordName, "TXT", formatTXTContent(publicKey.String()), ttl)
+	if setError != nil {
+		return nil, fmt.Errorf("%s", setError.Error())
+	}
+
+	if created {
+		return changeMessage{fmt.Sprintf("Created: %s (TXT)", getFormattedDomainName(recordName, *dkimSetDomain)), 1}, nil
+	}
+
+	return changeMessage{fmt.Sprintf("Updated: %s (TXT)", getFormattedDomainName(recordName, *dkimSetDomain)), 1}, nil
+}
+
+// check compares the DKIM key served via DNS with the given public key file.
+func (action dkimAction) check(arguments []string) (message, error) {
+
+	// parse the arguments
+	*dkimCheckDomain = ""
+	*dkimCheckSelector = ""
+	*dkimCheckPublicKey = ""
+	if parseError := dkimCheckArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if *dkimCheckDomain == "" {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	if *dkimCheckSelector == "" {
+		return nil, fmt.Errorf("No selector supplied")
+	}
+
+	publicKey, keyError := action.readPublicKey(*dkimCheckPublicKey)
+	if keyError != nil {
+		return nil, keyError
+	}
+
+	if action.lookupTXT == nil {
+		return nil, fmt.Errorf("No DNS resolver available")
+	}
+
+	hostname := getFormattedDomainName(getDKIMRecordName(*dkimCheckSelector), *dkimCheckDomain)
+	servedRecords, lookupError := action.lookupTXT(hostname)
+	if lookupError != nil {
+		return nil, fmt.Errorf("Unable to resolve %s: %s", hostname, lookupError.Error())
+	}
+
+	for _, servedRecord := range servedRecords {
+		tags := parseDKIMTags(servedRecord)
+		if tags["p"] == publicKey.data {
+			return successMessage{fmt.Sprintf("OK: %s serves the given DKIM key", hostname)}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("The DKIM key served by %s does not match %q", hostname, *dkimCheckPublicKey)
+}
+
+// readPublicKey reads the DKIM public key from the given file.
+func (action dkimAction) readPublicKey(filename string) (dkimPublicKey, error) {
+	if filename == "" {
+		return dkimPublicKey{}, fmt.Errorf("No public key file supplied")
+	}
+
+	if action.fs == nil {
+		return dkimPublicKey{}, fmt.Errorf("No filesystem provided")
+	}
+
+	content, readError := afero.ReadFile(action.fs, filename)
+	if readError != nil {
+		return dkimPublicKey{}, fmt.Errorf("Unable to read public key file: %s", readError.Error())
+	}
+
+	return parseDKIMPublicKey(content)
+}
+
+// dkimPublicKey contains the key type and the base64-encoded
+// key data of a DKIM public key.
+type dkimPublicKey struct {
+	keyType string
+	data    string
+}
+
+// String returns the DKIM TXT record value for the current key
+// (e.g. "v=DKIM1; k=rsa; p=MIGfMA0...").
+func (key dkimPublicKey) String() string {
+	return fmt.Sprintf("v=DKIM1; k=%s; p=%s", key.keyType, key.data)
+}
+
+// parseDKIMPublicKey parses a PEM-encoded public key. Content without
+// a PEM block is treated as the base64-encoded DER key.
+func parseDKIMPublicKey(content []byte) (dkimPublicKey, error) {
+	var der []byte
+	if block, _ := pem.Decode(content); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, decodeError := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(content)), ""))
+		if decodeError != nil {
+			return dkimPublicKey{}, fmt.Errorf("The public key is neither PEM nor base64 encoded")
+		}
+
+		der = decoded
+	}
+
+	publicKey, parseError := x509.ParsePKIXPublicKey(der)
+	if parseError != nil {
+		return dkimPublicKey{}, fmt.Errorf("Unable to parse public key: %s", parseError.Error())
+	}
+
+	if _, isRSA := publicKey.(*rsa.PublicKey); !isRSA {
+		return dkimPublicKey{}, fmt.Errorf("Only RSA keys are supported")
+	}
+
+	return dkimPublicKey{"rsa", base64.StdEncoding.EncodeToString(der)}, nil
+}
+
+// parseDKIMTags returns the tag/value pairs of the given DKIM record
+// (e.g. "v=DKIM1; k=rsa; p=..." → {"v": "DKIM1", "k": "rsa", "p": "..."}).
+func parseDKIMTags(record string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(parseTXTContent(record), ";") {
+		keyValue := strings.SplitN(tag, "=", 2)
+		if len(keyValue) != 2 {
+			continue
+		}
+
+		// whitespace is allowed anywhere in the tag values
+		value := strings.Join(strings.Fields(keyValue[1]), "")
+		tags[strings.TrimSpace(keyValue[0])] = value
+	}
+
+	return tags
+}
+
+// getDKIMRecordName returns the record name for the given DKIM selector.
+func getDKIMRecordName(selector string) string {
+	return selector + "._domainkey"
+}
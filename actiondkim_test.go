@@ -0,0 +1,270 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"strings"
+	"testing"
+)
+
+// getDKIMTestFilesystem returns a filesystem that contains a
+// PEM-encoded RSA public key at "dkim.pub".
+func getDKIMTestFilesystem(t *testing.T) (afero.Fs, dkimPublicKey) {
+	privateKey, keyError := rsa.GenerateKey(rand.Reader, 2048)
+	if keyError != nil {
+		t.Fatal(keyError)
+	}
+
+	der, marshalError := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if marshalError != nil {
+		t.Fatal(marshalError)
+	}
+
+	content := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "dkim.pub", content, 0600)
+
+	publicKey, parseError := parseDKIMPublicKey(content)
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	return fs, publicKey
+}
+
+func Test_dkimAction_Name_CorrectActionNameIsReturned(t *testing.T) {
+
+	// arrange
+	dkimAction := dkimAction{}
+
+	// act
+	result := dkimAction.Name()
+
+	// assert
+	if result != "dkim" {
+		t.Fail()
+		t.Logf("dkimAction.Name() should have returned %q but returned %q instead.", "dkim", result)
+	}
+
+}
+
+func Test_dkimAction_Usage_ResultContainsAllSubCommands(t *testing.T) {
+
+	// arrange
+	dkimAction := dkimAction{}
+
+	// act
+	result := dkimAction.Usage()
+
+	// assert
+	if !strings.Contains(result, "dkim set") || !strings.Contains(result, "dkim check") {
+		t.Fail()
+		t.Logf("dkimAction.Usage() should describe the set and check sub commands but returned %q.", result)
+	}
+
+}
+
+// dkimAction.Execute should return an error if no or an unknown sub command is given.
+func Test_dkimAction_InvalidSubCommand_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{},
+		{"get", "-domain", "example.com"},
+		{"-domain", "example.com", "set"},
+	}
+
+	dkimAction := dkimAction{}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := dkimAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("dkimAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// dkimAction.Execute("set", ...) should return an error if the argument values are invalid.
+func Test_dkimAction_Set_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
+	// arrange
+	fs, _ := getDKIMTestFilesystem(t)
+	argumentsSet := [][]string{
+		{"set", "-domain", "", "-selector", "mail", "-pubkey", "dkim.pub"},
+		{"set", "-domain", "example.com", "-selector", "", "-pubkey", "dkim.pub"},
+		{"set", "-domain", "example.com", "-selector", "mail", "-pubkey", ""},
+		{"set", "-domain", "example.com", "-selector", "mail", "-pubkey", "missing.pub"},
+		{"set", "-domain", "example.com", "-selector", "mail", "-pubkey", "dkim.pub", "-ttl", "-1"},
+	}
+
+	client := testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return nil, nil
+		},
+		createRecordFunc: func(domain string, opts *dnsimple.ChangeRecord) (string, error) {
+			return "1", nil
+		},
+	}
+
+	dkimAction := dkimAction{testDNSClientFactory{client, nil}, fs, nil, nil}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := dkimAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("dkimAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// dkimAction.Execute("set", ...) should create a split TXT record below _domainkey.
+func Test_dkimAction_Set_NoRecordExists_SplitTXTRecordIsCreated(t *testing.T) {
+	// arrange
+	fs, publicKey := getDKIMTestFilesystem(t)
+	arguments := []string{"set", "-domain", "example.com", "-selector", "mail", "-pubkey", "dkim.pub"}
+
+	var createdRecord *dnsimple.ChangeRecord
+	client := testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return nil, nil
+		},
+		createRecordFunc: func(domain string, opts *dnsimple.ChangeRecord) (string, error) {
+			createdRecord = opts
+			return "1", nil
+		},
+	}
+
+	dkimAction := dkimAction{testDNSClientFactory{client, nil}, fs, nil, nil}
+
+	// act
+	response, err := dkimAction.Execute(arguments)
+
+	// assert
+	if err != nil {
+		t.Fatalf("dkimAction.Execute(%q) should not return an error: %s", arguments, err.Error())
+	}
+
+	if createdRecord == nil || createdRecord.Name != "mail._domainkey" || createdRecord.Type != "TXT" {
+		t.Fatalf("dkimAction.Execute(%q) should have created a TXT record for mail._domainkey but created %#v", arguments, createdRecord)
+	}
+
+	if !strings.Contains(createdRecord.Value, `" "`) || parseTXTContent(createdRecord.Value) != publicKey.String() {
+		t.Fail()
+		t.Logf("dkimAction.Execute(%q) should have split the DKIM record into multiple strings but created %q", arguments, createdRecord.Value)
+	}
+
+	if !strings.Contains(response.Text(), "mail._domainkey.example.com") {
+		t.Fail()
+		t.Logf("dkimAction.Execute(%q) should respond with the record name but responded with %q", arguments, response.Text())
+	}
+}
+
+// dkimAction.Execute("set", ...) should update an existing DKIM record.
+func Test_dkimAction_Set_RecordExists_RecordIsUpdated(t *testing.T) {
+	// arrange
+	fs, _ := getDKIMTestFilesystem(t)
+	arguments := []string{"set", "-domain", "example.com", "-selector", "mail", "-pubkey", "dkim.pub"}
+
+	updatedRecordID := ""
+	client := testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{
+				{Id: 17, Name: "mail._domainkey", RecordType: "TXT", Content: "v=DKIM1; k=rsa; p=old"},
+			}, nil
+		},
+		updateRecordFunc: func(domain string, id string, opts *dnsimple.ChangeRecord) (string, error) {
+			updatedRecordID = id
+			return id, nil
+		},
+	}
+
+	dkimAction := dkimAction{testDNSClientFactory{client, nil}, fs, nil, nil}
+
+	// act
+	_, err := dkimAction.Execute(arguments)
+
+	// assert
+	if err != nil || updatedRecordID != "17" {
+		t.Fail()
+		t.Logf("dkimAction.Execute(%q) should have updated record 17 (updated: %q, error: %v)", arguments, updatedRecordID, err)
+	}
+}
+
+// dkimAction.Execute("check", ...) should succeed if the served key matches the key file.
+func Test_dkimAction_Check_ServedKeyMatches_SuccessMessageIsReturned(t *testing.T) {
+	// arrange
+	fs, publicKey := getDKIMTestFilesystem(t)
+	arguments := []string{"check", "-domain", "example.com", "-selector", "mail", "-pubkey", "dkim.pub"}
+
+	lookupTXT := func(name string) ([]string, error) {
+		if name != "mail._domainkey.example.com" {
+			return nil, fmt.Errorf("no such host")
+		}
+
+		return []string{publicKey.String()}, nil
+	}
+
+	dkimAction := dkimAction{nil, fs, lookupTXT, nil}
+
+	// act
+	_, err := dkimAction.Execute(arguments)
+
+	// assert
+	if err != nil {
+		t.Fail()
+		t.Logf("dkimAction.Execute(%q) should not return an error: %s", arguments, err.Error())
+	}
+}
+
+// dkimAction.Execute("check", ...) should return an error if the served key differs from the key file.
+func Test_dkimAction_Check_ServedKeyDiffers_ErrorIsReturned(t *testing.T) {
+	// arrange
+	fs, _ := getDKIMTestFilesystem(t)
+	arguments := []string{"check", "-domain", "example.com", "-selector", "mail", "-pubkey", "dkim.pub"}
+
+	lookupTXT := func(name string) ([]string, error) {
+		return []string{"v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQC"}, nil
+	}
+
+	dkimAction := dkimAction{nil, fs, lookupTXT, nil}
+
+	// act
+	_, err := dkimAction.Execute(arguments)
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("dkimAction.Execute(%q) should return an error because the served key differs", arguments)
+	}
+}
+
+func Test_parseDKIMTags_WhitespaceInValues_WhitespaceIsRemoved(t *testing.T) {
+	// arrange
+	record := "v=DKIM1; k=rsa;\n p=MIGf MA0G"
+
+	// act
+	tags := parseDKIMTags(record)
+
+	// assert
+	if tags["v"] != "DKIM1" || tags["k"] != "rsa" || tags["p"] != "MIGfMA0G" {
+		t.Fail()
+		t.Logf("parseDKIMTags(%q) returned %#v", record, tags)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	actionNameDomains = "domains"
+
+	domainsExpiringArguments    = flag.NewFlagSet(actionNameDomains+" expiring", flag.ContinueOnError)
+	domainsExpiringWithin       = domainsExpiringArguments.String("within", "30d", "The period in which a domain or certificate expires (e.g. 60d, 12h)")
+	domainsExpiringCertificates = domainsExpiringArguments.Bool("certificates", false, "Also check the TLS certificates served on port 443 of the domains")
+	domainsExpiringFormat       = domainsExpiringArguments.String("format", "table", "The output format (table, json)")
+)
+
+type domainsAction struct {
+	clientFactory dnsClientFactory
+	dialTLS       func(address, serverName string) ([]*x509.Certificate, error)
+	now           func() time.Time
+}
+
+func (action domainsAction) Name() string {
+	return actionNameDomains
+}
+
+func (action domainsAction) Description() string {
+	return "Report domains and certificates that are about to expire"
+}
+
+func (action domainsAction) Usage() string {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "  %s expiring [arguments ...]\n", actionNameDomains)
+	domainsExpiringArguments.SetOutput(buf)
+	domainsExpiringArguments.PrintDefaults()
+
+	return buf.String()
+}
+
+// Execute runs the given domains sub command ("expiring").
+func (action domainsAction) Execute(arguments []string) (message, error) {
+	if len(arguments) == 0 {
+		return nil, fmt.Errorf("No sub command supplied (expiring)")
+	}
+
+	switch arguments[0] {
+	case "expiring":
+		return action.expiring(arguments[1:])
+	}
+
+	return nil, fmt.Errorf("Unknown sub command %q", arguments[0])
+}
+
+// expiration is a domain registration or a certificate that expires soon.
+type expiration struct {
+	Domain    string    `json:"domain"`
+	Kind      string    `json:"kind"`
+	ExpiresOn time.Time `json:"expires_on"`
+	Days      int       `json:"days"`
+}
+
+// expirationReport is the JSON output of domains expiring.
+type expirationReport struct {
+	Expirations []expiration `json:"expirations"`
+	Problems    []string     `json:"problems"`
+}
+
+// expiring lists the domains (and certificates) of the account
+// that expire within the given period.
+func (action domainsAction) expiring(arguments []string) (message, error) {
+
+	// parse the arguments
+	*domainsExpiringWithin = "30d"
+	*domainsExpiringCertificates = false
+	*domainsExpiringFormat = "table"
+	if parseError := domainsExpiringArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	within, withinError := parsePeriod(*domainsExpiringWithin)
+	if withinError != nil {
+		return nil, withinError
+	}
+
+	if *domainsExpiringFormat != "table" && *domainsExpiringFormat != "json" {
+		return nil, fmt.Errorf("Unknown output format: %q", *domainsExpiringFormat)
+	}
+
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	domains, domainsError := client.GetDomains()
+	if domainsError != nil {
+		return nil, fmt.Errorf("Unable to retrieve domains: %s", domainsError.Error())
+	}
+
+	now := action.now()
+	deadline := now.Add(within)
+
+	expirations := []expiration{}
+	problems := []string{}
+	for _, domain := range domains {
+
+		// domains that are not registered with DNSimple have no expiry date
+		if domain.ExpiresOn != "" {
+			expiresOn, parseError := time.Parse("2006-01-02", domain.ExpiresOn)
+			if parseError != nil {
+				problems = append(problems, fmt.Sprintf("%s: cannot parse the expiry date %q", domain.Name, domain.ExpiresOn))
+			} else if expiresOn.Before(deadline) {
+				expirations = append(expirations, newExpiration(domain.Name, "domain", expiresOn, now))
+			}
+		}
+
+		if !*domainsExpiringCertificates || action.dialTLS == nil {
+			continue
+		}
+
+		certificates, dialError := action.dialTLS(net.JoinHostPort(domain.Name, "443"), domain.Name)
+		if dialError != nil || len(certificates) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: cannot read the certificate: %v", domain.Name, dialError))
+			continue
+		}
+
+		if notAfter := certificates[0].NotAfter; notAfter.Before(deadline) {
+			expirations = append(expirations, newExpiration(domain.Name, "certificate", notAfter, now))
+		}
+	}
+
+	sort.SliceStable(expirations, func(i, j int) bool {
+		return expirations[i].ExpiresOn.Before(expirations[j].ExpiresOn)
+	})
+
+	text := ""
+	if *domainsExpiringFormat == "json" {
+		json, err := json.MarshalIndent(expirationReport{expirations, problems}, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		text = string(json)
+	} else {
+		text = formatExpirations(expirations, *domainsExpiringWithin)
+		if len(problems) > 0 {
+			text += "\n" + strings.Join(problems, "\n")
+		}
+	}
+
+	if len(expirations) > 0 {
+		return findingsMessage{text}, nil
+	}
+
+	return successMessage{text}, nil
+}
+
+// newExpiration returns the expiration of the given kind and date.
+func newExpiration(domain, kind string, expiresOn, now time.Time) expiration {
+	return expiration{domain, kind, expiresOn, int(expiresOn.Sub(now).Hours() / 24)}
+}
+
+// formatExpirations returns the given expirations as a table.
+func formatExpirations(expirations []expiration, within string) string {
+	if len(expirations) == 0 {
+		return fmt.Sprintf("Nothing expires within %s", within)
+	}
+
+	buf := new(bytes.Buffer)
+	w := new(tabwriter.Writer)
+	w.Init(buf, 0, 8, 3, ' ', 0)
+
+	for index, expiration := range expirations {
+		description := fmt.Sprintf("in %d days", expiration.Days)
+		if expiration.Days < 0 {
+			description = "expired"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s", expiration.Domain, expiration.Kind, expiration.ExpiresOn.Format("2006-01-02"), description)
+		if index < len(expirations)-1 {
+			fmt.Fprintf(w, "\n")
+		}
+	}
+
+	w.Flush()
+	return buf.String()
+}
+
+// parsePeriod parses a period in days (e.g. "60d") or a duration (e.g. "12h").
+func parsePeriod(text string) (time.Duration, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasSuffix(text, "d") {
+		days, parseError := strconv.Atoi(strings.TrimSuffix(text, "d"))
+		if parseError != nil || days < 0 {
+			return 0, fmt.Errorf("Invalid period %q (e.g. 60d)", text)
+		}
+
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	duration, parseError := time.ParseDuration(text)
+	if parseError != nil || duration < 0 {
+		return 0, fmt.Errorf("Invalid period %q (e.g. 60d)", text)
+	}
+
+	return duration, nil
+}
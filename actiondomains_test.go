@@ -0,0 +1,167 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getDomainsTestAction returns a domains action for an account with three
+// domains; the certificate of example.org expires on 2016-03-20.
+func getDomainsTestAction() domainsAction {
+	client := testDNSClient{
+		getDomainsFunc: func() ([]dnsimple.Domain, error) {
+			return []dnsimple.Domain{
+				{Name: "example.com", ExpiresOn: "2016-03-10"},
+				{Name: "example.net", ExpiresOn: "2016-12-01"},
+				{Name: "example.org"},
+			}, nil
+		},
+	}
+
+	dialTLS := func(address, serverName string) ([]*x509.Certificate, error) {
+		if serverName != "example.org" {
+			return []*x509.Certificate{{NotAfter: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)}}, nil
+		}
+
+		return []*x509.Certificate{{NotAfter: time.Date(2016, 3, 20, 0, 0, 0, 0, time.UTC)}}, nil
+	}
+
+	now := func() time.Time {
+		return time.Date(2016, 3, 4, 0, 0, 0, 0, time.UTC)
+	}
+
+	return domainsAction{testDNSClientFactory{client, nil}, dialTLS, now}
+}
+
+// domains expiring should list the domains and certificates that expire within the given period.
+func Test_domainsAction_Expiring_ExpiringDomainsAreListed(t *testing.T) {
+	// arrange
+	action := getDomainsTestAction()
+	arguments := []string{"expiring", "-within", "30d", "-certificates"}
+
+	// act
+	result, err := action.Execute(arguments)
+
+	// assert
+	if err != nil {
+		t.Fatalf("domainsAction.Execute(%q) returned an error: %s", arguments, err.Error())
+	}
+
+	if _, isFindings := result.(findingsMessage); !isFindings {
+		t.Fail()
+		t.Logf("domainsAction.Execute(%q) should return a findings message", arguments)
+	}
+
+	lines := strings.Split(result.Text(), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "example.com   domain        2016-03-10   in 6 days") || !strings.Contains(lines[1], "example.org   certificate") {
+		t.Fail()
+		t.Logf("domainsAction.Execute(%q) should list example.com and the certificate of example.org:\n%s", arguments, result.Text())
+	}
+}
+
+// domains expiring should return a success message if nothing expires within the period.
+func Test_domainsAction_Expiring_NothingExpires_SuccessIsReturned(t *testing.T) {
+	// arrange
+	action := getDomainsTestAction()
+	arguments := []string{"expiring", "-within", "48h", "-format", "json"}
+
+	// act
+	result, err := action.Execute(arguments)
+
+	// assert
+	if _, isSuccess := result.(successMessage); err != nil || !isSuccess || strings.Join(strings.Fields(result.Text()), "") != `{"expirations":[],"problems":[]}` {
+		t.Fail()
+		t.Logf("domainsAction.Execute(%q) should return an empty JSON report but returned %v (%v)", arguments, result, err)
+	}
+}
+
+// The JSON output should include the domains that could not be checked.
+func Test_domainsAction_Expiring_JSON_ProblemsAreIncluded(t *testing.T) {
+	// arrange
+	action := getDomainsTestAction()
+	action.dialTLS = func(address, serverName string) ([]*x509.Certificate, error) {
+		return nil, fmt.Errorf("i/o timeout")
+	}
+
+	arguments := []string{"expiring", "-within", "30d", "-certificates", "-format", "json"}
+
+	// act
+	result, err := action.Execute(arguments)
+
+	// assert
+	if err != nil {
+		t.Fatalf("domainsAction.Execute(%q) returned an error: %s", arguments, err.Error())
+	}
+
+	var report expirationReport
+	if decodeError := json.Unmarshal([]byte(result.Text()), &report); decodeError != nil {
+		t.Fatalf("domainsAction.Execute(%q) should return JSON: %s", arguments, decodeError.Error())
+	}
+
+	if len(report.Expirations) != 1 || len(report.Problems) != 3 || !strings.Contains(report.Problems[0], "i/o timeout") {
+		t.Fail()
+		t.Logf("The report should contain the expiring domain and the unreadable certificates: %+v", report)
+	}
+}
+
+// domainsAction.Execute should return an error if the arguments are invalid.
+func Test_domainsAction_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{},
+		{"renew"},
+		{"expiring", "-within", "60 days"},
+		{"expiring", "-within", "-1d"},
+		{"expiring", "-format", "xml"},
+	}
+
+	action := getDomainsTestAction()
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := action.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("domainsAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// parsePeriod should accept days and durations.
+func Test_parsePeriod(t *testing.T) {
+	// arrange
+	inputs := map[string]time.Duration{
+		"60d": 60 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+		"0d":  0,
+	}
+
+	for text, expected := range inputs {
+
+		// act
+		result, err := parsePeriod(text)
+
+		// assert
+		if err != nil || result != expected {
+			t.Fail()
+			t.Logf("parsePeriod(%q) returned %s (%v) but should have returned %s", text, result, err, expected)
+		}
+	}
+
+	if _, err := parsePeriod("d"); err == nil {
+		t.Fail()
+		t.Logf("parsePeriod(%q) should return an error", "d")
+	}
+}
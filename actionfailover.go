@@ -0,0 +1,274 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// probeTimeout is the time a health check may take.
+const probeTimeout = 5 * time.Second
+
+var (
+	actionNameFailover = "failover"
+
+	failoverArguments = flag.NewFlagSet(actionNameFailover, flag.ContinueOnError)
+	failoverDomain    = failoverArguments.String("domain", "", "Domain (e.g. example.com)")
+	failoverSubdomain = failoverArguments.String("subdomain", "", "Subdomain (e.g. www)")
+	failoverPrimary   = failoverArguments.String("primary", "", "The IP address of the primary endpoint (e.g. 203.0.113.10)")
+	failoverBackup    = failoverArguments.String("backup", "", "The IP address of the backup endpoint (e.g. 198.51.100.20)")
+	failoverProbe     = failoverArguments.String("probe", "", "The health check of the primary endpoint (e.g. tcp://203.0.113.10:443, https://203.0.113.10/health)")
+	failoverInterval  = failoverArguments.Duration("interval", 30*time.Second, "The time between two health checks")
+	failoverThreshold = failoverArguments.Int("threshold", 3, "The number of consecutive failed or successful health checks before the record is switched")
+	failoverTTL       = failoverArguments.Int("ttl", 60, "The time to live in seconds")
+)
+
+type failoverAction struct {
+	clientFactory dnsClientFactory
+	probe         func(target string, timeout time.Duration) error
+	sleep         func(duration time.Duration)
+	log           logger
+	ttlPolicy     ttlPolicyProvider
+}
+
+func (action failoverAction) Name() string {
+	return actionNameFailover
+}
+
+func (action failoverAction) Description() string {
+	return "Switch an address record to a backup IP while the primary endpoint is down"
+}
+
+func (action failoverAction) Usage() string {
+	buf := new(bytes.Buffer)
+	failoverArguments.SetOutput(buf)
+	failoverArguments.PrintDefaults()
+	return buf.String()
+}
+
+// Execute health-checks the primary endpoint until the process is stopped
+// and points the address record to the backup IP while the primary is down.
+func (action failoverAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*failoverDomain = ""
+	*failoverSubdomain = ""
+	*failoverPrimary = ""
+	*failoverBackup = ""
+	*failoverProbe = ""
+	*failoverInterval = 30 * time.Second
+	*failoverThreshold = 3
+	*failoverTTL = 60
+	if parseError := failoverArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if *failoverDomain == "" {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	primaryIP := net.ParseIP(*failoverPrimary)
+	if primaryIP == nil {
+		return nil, fmt.Errorf("Cannot parse primary IP %q", *failoverPrimary)
+	}
+
+	backupIP := net.ParseIP(*failoverBackup)
+	if backupIP == nil {
+		return nil, fmt.Errorf("Cannot parse backup IP %q", *failoverBackup)
+	}
+
+	if getDNSRecordTypeByIP(primaryIP) != getDNSRecordTypeByIP(backupIP) {
+		return nil, fmt.Errorf("The primary and the backup IP must be of the same address family")
+	}
+
+	if validationError := validateProbeTarget(*failoverProbe); validationError != nil {
+		return nil, validationError
+	}
+
+	if *failoverInterval <= 0 {
+		return nil, fmt.Errorf("The interval must be positive")
+	}
+
+	if *failoverThreshold < 1 {
+		return nil, fmt.Errorf("The threshold must be at least 1")
+	}
+
+	if *failoverTTL < 0 {
+		return nil, fmt.Errorf("The given TTL cannot be negative")
+	}
+
+	// the short TTL of the failover record is kept unless it is below the minimum of the policy
+	ttl, ttlError := applyRecordTTLPolicy(action.ttlPolicy, actionNameFailover, true, *failoverTTL)
+	if ttlError != nil {
+		return nil, ttlError
+	}
+
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	probeTarget := *failoverProbe
+	monitor := &failoverMonitor{
+		client:    client,
+		domain:    *failoverDomain,
+		subdomain: *failoverSubdomain,
+		primaryIP: primaryIP,
+		backupIP:  backupIP,
+		ttl:       ttl,
+		threshold: *failoverThreshold,
+		probe:     func() error { return action.probe(probeTarget, probeTimeout) },
+		log:       action.log.With(logFields{Domain: *failoverDomain, Subdomain: *failoverSubdomain, Action: actionNameFailover}),
+	}
+
+	if initError := monitor.Init(); initError != nil {
+		return nil, initError
+	}
+
+	monitor.log.Infof("Monitoring %s for %s", probeTarget, getFormattedDomainName(monitor.subdomain, monitor.domain))
+	for {
+		if checkError := monitor.Check(); checkError != nil {
+			monitor.log.With(logFields{Error: checkError}).Errorf("Check failed")
+		}
+
+		action.sleep(*failoverInterval)
+	}
+}
+
+// failoverMonitor switches an address record between a
+// primary and a backup IP based on the health checks.
+type failoverMonitor struct {
+	client    deens.DNSClient
+	domain    string
+	subdomain string
+	primaryIP net.IP
+	backupIP  net.IP
+	ttl       int
+	threshold int
+	probe     func() error
+	log       logger
+
+	// active is the IP the record currently points to (nil if unknown).
+	active net.IP
+
+	failures  int
+	successes int
+}
+
+// Init reads the IP the address record currently points to.
+func (monitor *failoverMonitor) Init() error {
+	record, exists, err := findRecord(monitor.client, monitor.domain, monitor.subdomain, getDNSRecordTypeByIP(monitor.primaryIP))
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		monitor.active = net.ParseIP(record.Content)
+	}
+
+	return nil
+}
+
+// Check runs a single health check and updates the address record if the
+// primary endpoint failed or recovered the given number of times in a row.
+func (monitor *failoverMonitor) Check() error {
+	probeError := monitor.probe()
+	if probeError != nil {
+		monitor.failures++
+		monitor.successes = 0
+		monitor.log.With(logFields{Error: probeError}).Errorf("Health check failed (%d/%d)", monitor.failures, monitor.threshold)
+	} else {
+		monitor.successes++
+		monitor.failures = 0
+	}
+
+	desired := monitor.active
+	switch {
+	case monitor.failures >= monitor.threshold:
+		desired = monitor.backupIP
+	case monitor.successes >= monitor.threshold:
+		desired = monitor.primaryIP
+	case desired == nil && probeError == nil:
+		desired = monitor.primaryIP
+	case desired == nil:
+		desired = monitor.backupIP
+	}
+
+	if desired.Equal(monitor.active) {
+		return nil
+	}
+
+	recordType := getDNSRecordTypeByIP(desired)
+	if _, err := setRecord(monitor.client, monitor.domain, monitor.subdomain, recordType, desired.String(), monitor.ttl); err != nil {
+		return fmt.Errorf("Unable to point %s to %s: %s", getFormattedDomainName(monitor.subdomain, monitor.domain), desired, err.Error())
+	}
+
+	monitor.log.Infof("Switched %s to %s", getFormattedDomainName(monitor.subdomain, monitor.domain), desired)
+	monitor.active = desired
+	return nil
+}
+
+// validateProbeTarget returns an error if the given health
+// check is neither a TCP address nor a HTTP(S) URL.
+func validateProbeTarget(target string) error {
+	if target == "" {
+		return fmt.Errorf("No probe supplied")
+	}
+
+	targetURL, parseError := url.Parse(target)
+	if parseError != nil || targetURL.Host == "" {
+		return fmt.Errorf("Cannot parse probe %q (e.g. tcp://203.0.113.10:443)", target)
+	}
+
+	switch targetURL.Scheme {
+	case "tcp", "http", "https":
+		return nil
+	}
+
+	return fmt.Errorf("Unsupported probe %q (supported: tcp, http, https)", targetURL.Scheme)
+}
+
+// probeEndpoint connects to the given TCP address (tcp://host:port) or
+// requests the given URL and returns an error if the endpoint is unhealthy.
+func probeEndpoint(target string, timeout time.Duration) error {
+	targetURL, parseError := url.Parse(target)
+	if parseError != nil {
+		return parseError
+	}
+
+	if targetURL.Scheme == "tcp" {
+		connection, dialError := net.DialTimeout("tcp", targetURL.Host, timeout)
+		if dialError != nil {
+			return dialError
+		}
+
+		return connection.Close()
+	}
+
+	client := &http.Client{Timeout: timeout}
+	response, responseError := client.Get(target)
+	if responseError != nil {
+		return responseError
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		return fmt.Errorf("%s responded with %s", target, response.Status)
+	}
+
+	return nil
+}
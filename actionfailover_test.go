@@ -0,0 +1,159 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"net"
+	"testing"
+)
+
+// getFailoverTestClient returns a DNS client with a single A record
+// for www.example.com that stores the content of updated records.
+func getFailoverTestClient(content *string) testDNSClient {
+	return testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{
+				{Id: 1, Name: "www", RecordType: "A", Content: *content},
+			}, nil
+		},
+		updateRecordFunc: func(domain string, id string, opts *dnsimple.ChangeRecord) (string, error) {
+			*content = opts.Value
+			return id, nil
+		},
+	}
+}
+
+func Test_failoverAction_Name_CorrectActionNameIsReturned(t *testing.T) {
+
+	// arrange
+	failoverAction := failoverAction{}
+
+	// act
+	result := failoverAction.Name()
+
+	// assert
+	if result != "failover" {
+		t.Fail()
+		t.Logf("failoverAction.Name() should have returned %q but returned %q instead.", "failover", result)
+	}
+
+}
+
+func Test_failoverAction_Usage_ResultIsNotEmpty(t *testing.T) {
+
+	// arrange
+	failoverAction := failoverAction{}
+
+	// act
+	result := failoverAction.Usage()
+
+	// assert
+	if isEmpty(result) {
+		t.Fail()
+		t.Logf("failoverAction.Usage() not be empty.")
+	}
+
+}
+
+// failoverAction.Execute should return an error if the argument values are invalid.
+func Test_failoverAction_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{},
+		{"-domain", "example.com", "-primary", "203.0.113.10", "-backup", "198.51.100.20"},
+		{"-domain", "example.com", "-primary", "203.0.113.10", "-backup", "2001:db8::1", "-probe", "tcp://203.0.113.10:443"},
+		{"-domain", "example.com", "-primary", "203.0.113.10", "-backup", "198.51.100.20", "-probe", "icmp://203.0.113.10"},
+		{"-domain", "example.com", "-primary", "203.0.113.10", "-backup", "198.51.100.20", "-probe", "tcp://203.0.113.10:443", "-threshold", "0"},
+		{"-domain", "example.com", "-primary", "203.0.113.10", "-backup", "198.51.100.20", "-probe", "tcp://203.0.113.10:443", "-interval", "0s"},
+	}
+
+	failoverAction := failoverAction{testDNSClientFactory{}, nil, nil, logger{}, nil}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := failoverAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("failoverAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// The record should only be switched after the given number of failed or successful checks.
+func Test_failoverMonitor_Check_RecordIsSwitchedAfterThreshold(t *testing.T) {
+	// arrange
+	content := "203.0.113.10"
+
+	var probeError error
+	monitor := &failoverMonitor{
+		client:    getFailoverTestClient(&content),
+		domain:    "example.com",
+		subdomain: "www",
+		primaryIP: net.ParseIP("203.0.113.10"),
+		backupIP:  net.ParseIP("198.51.100.20"),
+		ttl:       60,
+		threshold: 2,
+		probe:     func() error { return probeError },
+	}
+
+	monitor.Init()
+
+	steps := []struct {
+		probeError error
+		expected   string
+	}{
+		{fmt.Errorf("connection refused"), "203.0.113.10"},
+		{fmt.Errorf("connection refused"), "198.51.100.20"},
+		{nil, "198.51.100.20"},
+		{fmt.Errorf("connection refused"), "198.51.100.20"},
+		{nil, "198.51.100.20"},
+		{nil, "203.0.113.10"},
+	}
+
+	for index, step := range steps {
+		probeError = step.probeError
+
+		// act
+		err := monitor.Check()
+
+		// assert
+		if err != nil || content != step.expected {
+			t.Fail()
+			t.Logf("After check %d the record should point to %s but points to %s (error: %v)", index+1, step.expected, content, err)
+		}
+	}
+}
+
+// The probe target must be a TCP address or a HTTP(S) URL.
+func Test_validateProbeTarget(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		target      string
+		expectError bool
+	}{
+		{"tcp://203.0.113.10:443", false},
+		{"https://203.0.113.10/health", false},
+		{"203.0.113.10:443", true},
+		{"udp://203.0.113.10:53", true},
+		{"", true},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		err := validateProbeTarget(input.target)
+
+		// assert
+		if (err != nil) != input.expectError {
+			t.Fail()
+			t.Logf("validateProbeTarget(%q) should return an error: %t (error: %v)", input.target, input.expectError, err)
+		}
+	}
+}
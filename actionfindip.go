@@ -0,0 +1,164 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"net"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	actionNameFindIP = "find-ip"
+
+	findIPArguments = flag.NewFlagSet(actionNameFindIP, flag.ContinueOnError)
+	findIPDomains   = findIPArguments.String("domains", "", "Only search the given domains or domain patterns (default: all domains of the account)")
+	findIPFormat    = findIPArguments.String("format", "table", "The output format (table, json)")
+)
+
+type findIPAction struct {
+	infoProviderFactory dnsInfoProviderCreator
+}
+
+func (action findIPAction) Name() string {
+	return actionNameFindIP
+}
+
+func (action findIPAction) Description() string {
+	return "List all records of the account that point to an IP address or hostname"
+}
+
+func (action findIPAction) Usage() string {
+	buf := new(bytes.Buffer)
+	findIPArguments.SetOutput(buf)
+	findIPArguments.PrintDefaults()
+	return buf.String()
+}
+
+// foundRecord is a record that points to the searched IP address or hostname.
+type foundRecord struct {
+	Domain string `json:"domain"`
+	apiRecord
+}
+
+// Execute searches the records of all domains for the IP
+// address or hostname given as the first positional argument.
+func (action findIPAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*findIPDomains = ""
+	*findIPFormat = "table"
+	if parseError := findIPArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	target := strings.TrimSpace(findIPArguments.Arg(0))
+	if target == "" {
+		return nil, fmt.Errorf("No IP address or hostname supplied")
+	}
+
+	if *findIPFormat != "table" && *findIPFormat != "json" {
+		return nil, fmt.Errorf("Unknown output format: %q", *findIPFormat)
+	}
+
+	if action.infoProviderFactory == nil {
+		return nil, fmt.Errorf("No DNS info provider factory available")
+	}
+
+	domainList := *findIPDomains
+	if domainList == "" {
+		domainList = "*"
+	}
+
+	domains, domainsError := getTargetDomains("", domainList, action.infoProviderFactory)
+	if domainsError != nil {
+		return nil, domainsError
+	}
+
+	infoProvider, infoProviderError := action.infoProviderFactory.CreateInfoProvider()
+	if infoProviderError != nil {
+		return nil, fmt.Errorf("No DNS info provider available")
+	}
+
+	found := []foundRecord{}
+	for _, domain := range domains {
+		records, recordsError := infoProvider.GetDomainRecords(domain)
+		if recordsError != nil {
+			return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", domain, recordsError.Error())
+		}
+
+		for _, record := range records {
+			if recordPointsTo(record, target) {
+				found = append(found, foundRecord{domain, apiRecord{record.Id, record.Name, record.RecordType, record.Content, record.Ttl}})
+			}
+		}
+	}
+
+	if *findIPFormat == "json" {
+		json, err := json.MarshalIndent(found, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		return successMessage{string(json)}, nil
+	}
+
+	if len(found) == 0 {
+		return successMessage{fmt.Sprintf("No records of %d domains point to %s", len(domains), target)}, nil
+	}
+
+	buf := new(bytes.Buffer)
+	w := new(tabwriter.Writer)
+	w.Init(buf, 0, 8, 3, ' ', 0)
+
+	for index, record := range found {
+		fmt.Fprintf(w, "%s\t%s\t%s\tID %d", getFormattedDomainName(record.Name, record.Domain), record.Type, record.Content, record.ID)
+		if index < len(found)-1 {
+			fmt.Fprintf(w, "\n")
+		}
+	}
+
+	w.Flush()
+	return successMessage{buf.String()}, nil
+}
+
+// recordPointsTo returns true if the given record refers to the given IP address
+// or hostname: address records with the same IP, records whose target is the
+// hostname (e.g. CNAME, MX, SRV) and texts that mention the IP (e.g. "ip4:203.0.113.1" in SPF records).
+func recordPointsTo(record dnsimple.Record, target string) bool {
+	if ip := net.ParseIP(target); ip != nil {
+		if record.RecordType == "A" || record.RecordType == "AAAA" {
+			return ip.Equal(net.ParseIP(strings.TrimSpace(record.Content)))
+		}
+
+		for _, token := range strings.FieldsFunc(record.Content, isContentSeparator) {
+			if ip.Equal(net.ParseIP(strings.TrimPrefix(strings.TrimPrefix(token, "ip4:"), "ip6:"))) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	hostname := strings.ToLower(strings.TrimSuffix(target, "."))
+	for _, token := range strings.Fields(record.Content) {
+		if strings.ToLower(strings.TrimSuffix(token, ".")) == hostname {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isContentSeparator returns true for the characters that separate
+// the values of a record content (e.g. the strings of a TXT record).
+func isContentSeparator(character rune) bool {
+	return character == ' ' || character == '"' || character == ','
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/pearkes/dnsimple"
+	"strings"
+	"testing"
+)
+
+// getFindIPTestInfoProviderFactory returns an info provider factory for an account with two domains.
+func getFindIPTestInfoProviderFactory() testInfoProviderFactory {
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "www", RecordType: "A", Content: "203.0.113.1"},
+			{Id: 2, Name: "", RecordType: "TXT", Content: "v=spf1 ip4:203.0.113.1 -all"},
+			{Id: 3, Name: "", RecordType: "MX", Content: "server1.example.net"},
+		},
+		"example.net": {
+			{Id: 4, Name: "server1", RecordType: "A", Content: "203.0.113.10"},
+			{Id: 5, Name: "app", RecordType: "CNAME", Content: "server1.example.net."},
+		},
+	}
+
+	return testInfoProviderFactory{testDNSInfoProvider{
+		getDomainNamesFunc: func() ([]string, error) {
+			return []string{"example.com", "example.net"}, nil
+		},
+		getDomainRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return records[domain], nil
+		},
+	}, nil}
+}
+
+// findIPAction.Execute should list the records of all domains that point to the given IP or hostname.
+func Test_findIPAction_MatchingRecords_RecordsAreListed(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		arguments []string
+		expected  []string
+	}{
+		{[]string{"203.0.113.1"}, []string{"www.example.com", "ID 2"}},
+		{[]string{"server1.example.net"}, []string{"ID 3", "app.example.net"}},
+		{[]string{"-format", "json", "203.0.113.10"}, []string{`"domain": "example.net"`, `"id": 4`}},
+	}
+
+	action := findIPAction{getFindIPTestInfoProviderFactory()}
+
+	for _, input := range inputs {
+
+		// act
+		result, err := action.Execute(input.arguments)
+
+		// assert
+		if err != nil {
+			t.Fatalf("findIPAction.Execute(%q) returned an error: %s", input.arguments, err.Error())
+		}
+
+		for _, expected := range input.expected {
+			if !strings.Contains(result.Text(), expected) {
+				t.Fail()
+				t.Logf("findIPAction.Execute(%q) should contain %q:\n%s", input.arguments, expected, result.Text())
+			}
+		}
+	}
+}
+
+// recordPointsTo should not match IPs that only share a prefix.
+func Test_recordPointsTo_SimilarIP_ResultIsFalse(t *testing.T) {
+	// arrange
+	records := []dnsimple.Record{
+		{RecordType: "A", Content: "203.0.113.10"},
+		{RecordType: "TXT", Content: "v=spf1 ip4:203.0.113.10 -all"},
+		{RecordType: "CNAME", Content: "203.0.113.1.example.com"},
+	}
+
+	for _, record := range records {
+
+		// act
+		result := recordPointsTo(record, "203.0.113.1")
+
+		// assert
+		if result {
+			t.Fail()
+			t.Logf("recordPointsTo(%#v, %q) should return false", record, "203.0.113.1")
+		}
+	}
+}
+
+// findIPAction.Execute should return an error if no IP address or hostname is given.
+func Test_findIPAction_NoTarget_ErrorIsReturned(t *testing.T) {
+	// arrange
+	action := findIPAction{getFindIPTestInfoProviderFactory()}
+
+	// act
+	_, err := action.Execute([]string{"-format", "json"})
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("findIPAction.Execute should return an error if no IP address or hostname is given")
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	actionNameGC = "gc"
+
+	gcArguments = flag.NewFlagSet(actionNameGC, flag.ContinueOnError)
+	gcApply     = gcArguments.Bool("apply", false, "Delete the expired records instead of only previewing them")
+)
+
+type gcAction struct {
+	clientFactory dnsClientFactory
+	metadata      metadataStore
+	now           func() time.Time
+}
+
+func (action gcAction) Name() string {
+	return actionNameGC
+}
+
+func (action gcAction) Description() string {
+	return "Delete the temporary records that have expired"
+}
+
+func (action gcAction) Usage() string {
+	buf := new(bytes.Buffer)
+	gcArguments.SetOutput(buf)
+	gcArguments.PrintDefaults()
+	return buf.String()
+}
+
+// Execute previews or deletes the records that were created with
+// -expires-in and whose expiry time has passed.
+func (action gcAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*gcApply = false
+	if parseError := gcArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if action.metadata == nil {
+		return nil, fmt.Errorf("No metadata store available")
+	}
+
+	all, metadataError := action.metadata.GetAllMetadata()
+	if metadataError != nil {
+		return nil, metadataError
+	}
+
+	now := action.now()
+	expired := make(map[string][]recordMetadata)
+	var domains []string
+	for _, metadata := range all {
+		if metadata.ExpiresAt == nil || metadata.ExpiresAt.After(now) {
+			continue
+		}
+
+		if _, exists := expired[metadata.Domain]; !exists {
+			domains = append(domains, metadata.Domain)
+		}
+
+		expired[metadata.Domain] = append(expired[metadata.Domain], metadata)
+	}
+
+	if len(domains) == 0 {
+		return unchangedMessage{"No temporary records have expired"}, nil
+	}
+
+	sort.Strings(domains)
+
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	preview := new(bytes.Buffer)
+	var deletions []recordMetadata
+	for _, domain := range domains {
+		records, recordsError := client.GetRecords(domain)
+		if recordsError != nil {
+			return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", domain, recordsError.Error())
+		}
+
+		recordsByID := make(map[int64]dnsimple.Record)
+		for _, record := range records {
+			recordsByID[record.Id] = record
+		}
+
+		for _, metadata := range expired[domain] {
+			record, exists := recordsByID[metadata.RecordID]
+			if !exists {
+				// the record was deleted in the meantime
+				fmt.Fprintf(preview, "Gone: record %d of %s\n", metadata.RecordID, domain)
+				if *gcApply {
+					if forgetError := action.forget(metadata); forgetError != nil {
+						return nil, forgetError
+					}
+				}
+
+				continue
+			}
+
+			fmt.Fprintf(preview, "Delete: %s %s %s (expired %s)\n", getFormattedDomainName(record.Name, domain), record.RecordType, record.Content, metadata.ExpiresAt.Format(time.RFC3339))
+			deletions = append(deletions, metadata)
+		}
+	}
+
+	if len(deletions) == 0 {
+		return unchangedMessage{preview.String() + "No temporary records have expired"}, nil
+	}
+
+	if !*gcApply {
+		fmt.Fprintf(preview, "Run again with -apply to delete %d records", len(deletions))
+		return successMessage{preview.String()}, nil
+	}
+
+	for index, metadata := range deletions {
+		if deleteError := client.DestroyRecord(metadata.Domain, fmt.Sprintf("%d", metadata.RecordID)); deleteError != nil {
+			return nil, fmt.Errorf("%sDeleted %d of %d records. Record %d of %s failed: %s", preview.String(), index, len(deletions), metadata.RecordID, metadata.Domain, deleteError.Error())
+		}
+
+		if forgetError := action.forget(metadata); forgetError != nil {
+			return nil, forgetError
+		}
+	}
+
+	return changeMessage{fmt.Sprintf("%sDeleted %d expired records", preview.String(), len(deletions)), len(deletions)}, nil
+}
+
+// forget removes the metadata of the given deleted record.
+func (action gcAction) forget(metadata recordMetadata) error {
+	return action.metadata.SetMetadata(recordMetadata{Domain: metadata.Domain, RecordID: metadata.RecordID})
+}
+
+// getExpiresIn parses the given -expires-in period. An empty period means
+// that the record is not temporary.
+func getExpiresIn(period string, store metadataStore) (time.Duration, error) {
+	if period == "" {
+		return 0, nil
+	}
+
+	expiresIn, parseError := parsePeriod(period)
+	if parseError != nil {
+		return 0, parseError
+	}
+
+	if expiresIn <= 0 {
+		return 0, fmt.Errorf("Invalid -expires-in %q: the period must be positive", period)
+	}
+
+	if store == nil {
+		return 0, fmt.Errorf("No metadata store available for temporary records")
+	}
+
+	return expiresIn, nil
+}
+
+// markRecordAsTemporary records the expiry time of the record with the given
+// ID in the state file and returns a description of it (e.g. " (expires 2016-03-05T10:00:00Z)").
+func markRecordAsTemporary(store metadataStore, domain, recordID string, expiresIn time.Duration) (string, error) {
+	id, parseError := strconv.ParseInt(recordID, 10, 64)
+	if parseError != nil {
+		return "", fmt.Errorf("Cannot mark the record as temporary: invalid record ID %q", recordID)
+	}
+
+	expiresAt := time.Now().Add(expiresIn).UTC().Truncate(time.Second)
+	if expiryError := setRecordExpiry(store, domain, id, expiresAt); expiryError != nil {
+		return "", fmt.Errorf("Cannot mark the record as temporary: %s", expiryError.Error())
+	}
+
+	return fmt.Sprintf(" (expires %s)", expiresAt.Format(time.RFC3339)), nil
+}
+
+// markAddressRecordAsTemporary looks up the ID of the given new address
+// record and records its expiry time in the state file.
+func markAddressRecordAsTemporary(client deens.DNSClient, store metadataStore, domain, subdomain, recordType string, ip net.IP, expiresIn time.Duration) (string, error) {
+	records, recordsError := client.GetRecords(domain)
+	if recordsError != nil {
+		return "", fmt.Errorf("Cannot mark the record as temporary: %s", recordsError.Error())
+	}
+
+	for _, record := range records {
+		if record.Name == subdomain && record.RecordType == recordType && ip.Equal(net.ParseIP(record.Content)) {
+			return markRecordAsTemporary(store, domain, fmt.Sprintf("%d", record.Id), expiresIn)
+		}
+	}
+
+	return "", fmt.Errorf("Cannot mark the record as temporary: the new record was not found")
+}
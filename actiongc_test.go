@@ -0,0 +1,177 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getGCTestTime() time.Time {
+	return time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+}
+
+// getGCTestState returns records and a state file with an expired
+// record (1), a record that has not expired yet (2) and an expired
+// record that was already deleted (3).
+func getGCTestState() (map[string][]dnsimple.Record, filesystemMetadataStore) {
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "feature-x.preview", RecordType: "A", Content: "203.0.113.1", Ttl: 60},
+			{Id: 2, Name: "feature-y.preview", RecordType: "A", Content: "203.0.113.2", Ttl: 60},
+			{Id: 4, Name: "www", RecordType: "A", Content: "203.0.113.4", Ttl: 3600},
+		},
+	}
+
+	expired, valid := getGCTestTime().Add(-time.Hour), getGCTestTime().Add(time.Hour)
+	metadata := filesystemMetadataStore{afero.NewMemMapFs(), "/state.json"}
+	setRecordExpiry(metadata, "example.com", 1, expired)
+	setRecordExpiry(metadata, "example.com", 2, valid)
+	setRecordExpiry(metadata, "example.com", 3, expired)
+
+	return records, metadata
+}
+
+// gcAction.Execute should only preview the expired records without -apply.
+func Test_gcAction_NoApply_RecordsAreNotDeleted(t *testing.T) {
+	// arrange
+	records, metadata := getGCTestState()
+	action := gcAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, metadata, getGCTestTime}
+
+	// act
+	result, err := action.Execute(nil)
+
+	// assert
+	if err != nil || len(records["example.com"]) != 3 {
+		t.Fatalf("gcAction.Execute should not delete records without -apply (%v)", err)
+	}
+
+	if !strings.Contains(result.Text(), "Delete: feature-x.preview.example.com A 203.0.113.1") || !strings.Contains(result.Text(), "-apply") {
+		t.Fail()
+		t.Logf("The preview should list the expired record: %q", result.Text())
+	}
+}
+
+// gcAction.Execute should delete the expired records and forget their metadata.
+func Test_gcAction_Apply_ExpiredRecordsAreDeleted(t *testing.T) {
+	// arrange
+	records, metadata := getGCTestState()
+	action := gcAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, metadata, getGCTestTime}
+
+	// act
+	result, err := action.Execute([]string{"-apply"})
+
+	// assert
+	if err != nil || getChangeSummary(result).Records != 1 {
+		t.Fatalf("gcAction.Execute should delete one record but returned %v (%v)", result, err)
+	}
+
+	if len(records["example.com"]) != 2 || records["example.com"][0].Id != 2 {
+		t.Fail()
+		t.Logf("Only the expired record should have been deleted: %#v", records["example.com"])
+	}
+
+	remaining, _ := metadata.GetAllMetadata()
+	if len(remaining) != 1 || remaining[0].RecordID != 2 {
+		t.Fail()
+		t.Logf("Only the metadata of the record that has not expired should remain: %#v", remaining)
+	}
+}
+
+// gcAction.Execute should return an unchanged message if no record has expired.
+func Test_gcAction_NothingExpired_UnchangedMessageIsReturned(t *testing.T) {
+	// arrange
+	records, metadata := getGCTestState()
+	earlier := func() time.Time { return getGCTestTime().Add(-2 * time.Hour) }
+	action := gcAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, metadata, earlier}
+
+	// act
+	result, err := action.Execute([]string{"-apply"})
+
+	// assert
+	if _, isUnchanged := result.(unchangedMessage); err != nil || !isUnchanged {
+		t.Fail()
+		t.Logf("gcAction.Execute should return an unchanged message but returned %v (%v)", result, err)
+	}
+}
+
+// recordAction.Execute should record the expiry time of temporary records.
+func Test_recordAction_CreateWithExpiresIn_ExpiryIsRecorded(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{}
+	metadata := filesystemMetadataStore{afero.NewMemMapFs(), "/state.json"}
+	recordAction := recordAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, metadata, nil, nil}
+	arguments := []string{"create", "-domain", "example.com", "-subdomain", "demo", "-type", "TXT", "-content", "preview", "-expires-in", "24h"}
+
+	// act
+	_, err := recordAction.Execute(arguments)
+
+	// assert
+	if err != nil || len(records["example.com"]) != 1 {
+		t.Fatalf("recordAction.Execute(%q) should create the record (%v)", arguments, err)
+	}
+
+	stored, _ := metadata.GetMetadata("example.com")
+	expiresAt := stored[records["example.com"][0].Id].ExpiresAt
+	if expiresAt == nil || expiresAt.Before(time.Now().Add(23*time.Hour)) || expiresAt.After(time.Now().Add(25*time.Hour)) {
+		t.Fail()
+		t.Logf("The record should expire in 24 hours: %v", expiresAt)
+	}
+}
+
+// createAction.Execute should look up the new address record and record its expiry time.
+func Test_createAction_CreateWithExpiresIn_ExpiryIsRecorded(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{}
+	client := newInMemoryTestDNSClient(records)
+	editor := &testDNSEditor{
+		createSubdomainFunc: func(domain, subdomain string, timeToLive int, ip net.IP) error {
+			_, err := client.CreateRecord(domain, &dnsimple.ChangeRecord{Name: subdomain, Type: "A", Value: ip.String(), Ttl: "60"})
+			return err
+		},
+	}
+
+	metadata := filesystemMetadataStore{afero.NewMemMapFs(), "/state.json"}
+	createAction := createAction{testDNSEditorFactory{editor, nil}, testDNSClientFactory{client, nil}, nil, nil, nil, metadata}
+
+	// act
+	result, err := createAction.Execute([]string{"-domain", "example.com", "-subdomain", "demo", "-ip", "203.0.113.1", "-expires-in", "7d"})
+
+	// assert
+	if err != nil {
+		t.Fatalf("createAction.Execute returned an error: %s", err.Error())
+	}
+
+	stored, _ := metadata.GetMetadata("example.com")
+	if len(records["example.com"]) != 1 || stored[records["example.com"][0].Id].ExpiresAt == nil || !strings.Contains(result.Text(), "expires") {
+		t.Fail()
+		t.Logf("The new record should be marked as temporary: %q, %#v", result.Text(), stored)
+	}
+}
+
+// The -expires-in argument should be validated before any record is created.
+func Test_recordAction_InvalidExpiresIn_ErrorIsReturned(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{}
+	metadata := filesystemMetadataStore{afero.NewMemMapFs(), "/state.json"}
+	recordAction := recordAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, metadata, nil, nil}
+
+	for _, expiresIn := range []string{"soon", "0h", "-2h"} {
+		arguments := []string{"create", "-domain", "example.com", "-type", "TXT", "-content", "x", "-expires-in", expiresIn}
+
+		// act
+		_, err := recordAction.Execute(arguments)
+
+		// assert
+		if err == nil || len(records["example.com"]) != 0 {
+			t.Fail()
+			t.Logf("recordAction.Execute(%q) should return an error and not create a record", arguments)
+		}
+	}
+}
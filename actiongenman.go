@@ -0,0 +1,179 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/spf13/afero"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	actionNameGenMan = "gen-man"
+
+	genManArguments = flag.NewFlagSet(actionNameGenMan, flag.ContinueOnError)
+	genManOutput    = genManArguments.String("output", ".", "The directory the man pages are written to")
+)
+
+type genManAction struct {
+	fs             afero.Fs
+	executableName string
+	version        string
+	getActions     func() []action
+}
+
+func (action genManAction) Name() string {
+	return actionNameGenMan
+}
+
+func (action genManAction) Description() string {
+	return "Generate man pages for all actions"
+}
+
+func (action genManAction) Usage() string {
+	buf := new(bytes.Buffer)
+	genManArguments.SetOutput(buf)
+	genManArguments.PrintDefaults()
+	return buf.String()
+}
+
+// Execute writes a section 1 man page for the executable and
+// one for each available action into the given output directory.
+func (action genManAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*genManOutput = "."
+	if parseError := genManArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if isEmpty(*genManOutput) {
+		return nil, fmt.Errorf("No output directory supplied")
+	}
+
+	if action.fs == nil {
+		return nil, fmt.Errorf("No filesystem provided")
+	}
+
+	if action.getActions == nil {
+		return nil, fmt.Errorf("No actions available")
+	}
+
+	if createFolderError := action.fs.MkdirAll(*genManOutput, 0755); createFolderError != nil {
+		return nil, fmt.Errorf("Unable to create %q: %s", *genManOutput, createFolderError.Error())
+	}
+
+	pages := map[string]string{
+		action.executableName + ".1": action.getMainPage(),
+	}
+
+	for _, availableAction := range action.getActions() {
+		pages[action.executableName+"-"+availableAction.Name()+".1"] = action.getActionPage(availableAction)
+	}
+
+	for filename, content := range pages {
+		filePath := filepath.Join(*genManOutput, filename)
+		if writeError := afero.WriteFile(action.fs, filePath, []byte(content), 0644); writeError != nil {
+			return nil, fmt.Errorf("Unable to write %q: %s", filePath, writeError.Error())
+		}
+	}
+
+	return successMessage{fmt.Sprintf("Generated %d man pages in %s", len(pages), *genManOutput)}, nil
+}
+
+// getMainPage returns the man page of the executable itself.
+func (action genManAction) getMainPage() string {
+	buf := new(bytes.Buffer)
+
+	action.writeHeader(buf, action.executableName, "updates DNS records via DNSimple")
+
+	fmt.Fprintf(buf, ".SH SYNOPSIS\n")
+	fmt.Fprintf(buf, ".B %s\n", escapeRoff(action.executableName))
+	fmt.Fprintf(buf, "[\\fIoptions\\fR] \\fIaction\\fR [\\fIarguments\\fR ...]\n")
+
+	fmt.Fprintf(buf, ".SH OPTIONS\n")
+	options := new(bytes.Buffer)
+	flag.CommandLine.SetOutput(options)
+	flag.CommandLine.PrintDefaults()
+	writeRoffFlags(buf, options.String())
+
+	fmt.Fprintf(buf, ".SH ACTIONS\n")
+	var seeAlso []string
+	for _, availableAction := range action.getActions() {
+		fmt.Fprintf(buf, ".TP\n.B %s\n%s\n", escapeRoff(availableAction.Name()), escapeRoff(availableAction.Description()))
+		seeAlso = append(seeAlso, fmt.Sprintf(".BR %s-%s (1)", escapeRoff(action.executableName), escapeRoff(availableAction.Name())))
+	}
+
+	fmt.Fprintf(buf, ".SH SEE ALSO\n")
+	fmt.Fprintf(buf, "%s\n", strings.Join(seeAlso, ",\n"))
+
+	return buf.String()
+}
+
+// getActionPage returns the man page of the given action.
+func (action genManAction) getActionPage(availableAction action) string {
+	buf := new(bytes.Buffer)
+
+	action.writeHeader(buf, action.executableName+"-"+availableAction.Name(), availableAction.Description())
+
+	fmt.Fprintf(buf, ".SH SYNOPSIS\n")
+	fmt.Fprintf(buf, ".B %s %s\n", escapeRoff(action.executableName), escapeRoff(availableAction.Name()))
+	fmt.Fprintf(buf, "[\\fIarguments\\fR ...]\n")
+
+	fmt.Fprintf(buf, ".SH DESCRIPTION\n")
+	fmt.Fprintf(buf, "%s\n", escapeRoff(availableAction.Description()))
+
+	fmt.Fprintf(buf, ".SH ARGUMENTS\n")
+	writeRoffFlags(buf, availableAction.Usage())
+
+	fmt.Fprintf(buf, ".SH SEE ALSO\n")
+	fmt.Fprintf(buf, ".BR %s (1)\n", escapeRoff(action.executableName))
+
+	return buf.String()
+}
+
+// writeHeader writes the title and name sections of a man page.
+func (action genManAction) writeHeader(buf *bytes.Buffer, name, description string) {
+	fmt.Fprintf(buf, ".TH %q 1 \"\" %q \"User Commands\"\n", strings.ToUpper(name), action.executableName+" "+action.version)
+	fmt.Fprintf(buf, ".SH NAME\n")
+	fmt.Fprintf(buf, "%s \\- %s\n", escapeRoff(name), escapeRoff(description))
+}
+
+// writeRoffFlags converts the output of flag.PrintDefaults into roff
+// paragraphs. Lines that neither describe a flag nor its usage (e.g.
+// the sub command headings of an action) become subsection headings.
+func writeRoffFlags(buf *bytes.Buffer, usage string) {
+	for _, line := range strings.Split(usage, "\n") {
+		trimmedLine := strings.TrimSpace(line)
+		switch {
+		case trimmedLine == "":
+			continue
+
+		case strings.HasPrefix(trimmedLine, "-"):
+			fmt.Fprintf(buf, ".TP\n.B %s\n", escapeRoff(trimmedLine))
+
+		case strings.HasPrefix(line, "    \t") || strings.HasPrefix(line, "\t"):
+			fmt.Fprintf(buf, "%s\n", escapeRoff(trimmedLine))
+
+		default:
+			fmt.Fprintf(buf, ".SS %s\n", escapeRoff(trimmedLine))
+		}
+	}
+}
+
+// escapeRoff escapes the given text so that roff prints it literally.
+func escapeRoff(text string) string {
+	text = strings.Replace(text, `\`, `\e`, -1)
+	text = strings.Replace(text, "-", `\-`, -1)
+
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = `\&` + text
+	}
+
+	return text
+}
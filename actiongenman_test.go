@@ -0,0 +1,154 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/spf13/afero"
+	"strings"
+	"testing"
+)
+
+// getGenManTestActions returns a list of actions used for testing the man page generation.
+func getGenManTestActions() []action {
+	return []action{
+		testAction{
+			name:        "login",
+			description: "Save credentials",
+			usage:       "  -email string\n    \tThe e-mail address\n",
+		},
+		testAction{
+			name:        "dkim",
+			description: "Publish DKIM keys",
+			usage:       "  dkim set [arguments ...]\n  -domain string\n    \tDomain (e.g. example.com)\n",
+		},
+	}
+}
+
+func Test_genManAction_Name_CorrectActionNameIsReturned(t *testing.T) {
+
+	// arrange
+	genManAction := genManAction{}
+
+	// act
+	result := genManAction.Name()
+
+	// assert
+	if result != "gen-man" {
+		t.Fail()
+		t.Logf("genManAction.Name() should have returned %q but returned %q instead.", "gen-man", result)
+	}
+
+}
+
+func Test_genManAction_Usage_ResultIsNotEmpty(t *testing.T) {
+
+	// arrange
+	genManAction := genManAction{}
+
+	// act
+	result := genManAction.Usage()
+
+	// assert
+	if isEmpty(result) {
+		t.Fail()
+		t.Logf("genManAction.Usage() not be empty.")
+	}
+
+}
+
+// genManAction.Execute should return an error if the arguments are invalid.
+func Test_genManAction_InvalidArguments_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{"-out", "man"},
+		{"-output", ""},
+	}
+
+	genManAction := genManAction{afero.NewMemMapFs(), "dee", "v1", getGenManTestActions}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := genManAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("genManAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// genManAction.Execute should write one man page for the executable and one per action.
+func Test_genManAction_ValidArguments_ManPagesAreWritten(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	arguments := []string{"-output", "man/man1"}
+
+	genManAction := genManAction{fs, "dee", "v1", getGenManTestActions}
+
+	// act
+	_, err := genManAction.Execute(arguments)
+
+	// assert
+	if err != nil {
+		t.Fatalf("genManAction.Execute(%q) should not return an error: %s", arguments, err.Error())
+	}
+
+	for _, filename := range []string{"man/man1/dee.1", "man/man1/dee-login.1", "man/man1/dee-dkim.1"} {
+		content, readError := afero.ReadFile(fs, filename)
+		if readError != nil || !strings.HasPrefix(string(content), ".TH") {
+			t.Fail()
+			t.Logf("genManAction.Execute(%q) should have written the man page %q", arguments, filename)
+		}
+	}
+}
+
+// The action man page should contain a paragraph for each flag and a subsection for each sub command.
+func Test_genManAction_GetActionPage_FlagsAndSubCommandsAreConverted(t *testing.T) {
+	// arrange
+	genManAction := genManAction{nil, "dee", "v1", getGenManTestActions}
+
+	// act
+	result := genManAction.getActionPage(getGenManTestActions()[1])
+
+	// assert
+	expectedFragments := []string{
+		".SH NAME\ndee\\-dkim \\- Publish DKIM keys\n",
+		".SS dkim set [arguments ...]\n",
+		".TP\n.B \\-domain string\nDomain (e.g. example.com)\n",
+	}
+
+	for _, expectedFragment := range expectedFragments {
+		if !strings.Contains(result, expectedFragment) {
+			t.Fail()
+			t.Logf("genManAction.getActionPage() should contain %q but returned %q", expectedFragment, result)
+		}
+	}
+}
+
+func Test_escapeRoff(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		text     string
+		expected string
+	}{
+		{"-domain", `\-domain`},
+		{`C:\dee`, `C:\edee`},
+		{".hidden", `\&.hidden`},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		result := escapeRoff(input.text)
+
+		// assert
+		if result != input.expected {
+			t.Fail()
+			t.Logf("escapeRoff(%q) should return %q but returned %q", input.text, input.expected, result)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	actionNameLint = "lint"
+
+	lintArguments = flag.NewFlagSet(actionNameLint, flag.ContinueOnError)
+	lintDomain    = lintArguments.String("domain", "", "Domain (e.g. example.com)")
+	lintFormat    = lintArguments.String("format", "table", "The output format (table, json)")
+)
+
+// maximumReasonableTTL defines the largest TTL in seconds that is not reported as absurd (one week).
+const maximumReasonableTTL = 604800
+
+const (
+	lintCheckCNAMEConflict = "cname-conflict"
+	lintCheckDanglingCNAME = "dangling-cname"
+	lintCheckMissingMX     = "missing-mx"
+	lintCheckDuplicate     = "duplicate"
+	lintCheckTTL           = "ttl"
+)
+
+type lintAction struct {
+	infoProviderFactory dnsInfoProviderCreator
+	lookupHost          func(host string) ([]string, error)
+}
+
+func (action lintAction) Name() string {
+	return actionNameLint
+}
+
+func (action lintAction) Description() string {
+	return "Check the records of a domain for common problems"
+}
+
+func (action lintAction) Usage() string {
+	buf := new(bytes.Buffer)
+	lintArguments.SetOutput(buf)
+	lintArguments.PrintDefaults()
+	return buf.String()
+}
+
+// Execute checks the live records of the given domain. The domain can
+// either be passed with -domain or as the first positional argument.
+func (action lintAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*lintDomain = ""
+	*lintFormat = "table"
+	if parseError := lintArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	domain := *lintDomain
+	if domain == "" {
+		domain = lintArguments.Arg(0)
+	}
+
+	if isEmpty(domain) {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	if *lintFormat != "table" && *lintFormat != "json" {
+		return nil, fmt.Errorf("Unknown output format: %q", *lintFormat)
+	}
+
+	infoProvider, infoProviderError := action.getInfoProvider()
+	if infoProviderError != nil {
+		return nil, fmt.Errorf("No DNS info provider available")
+	}
+
+	records, recordsError := infoProvider.GetDomainRecords(domain)
+	if recordsError != nil {
+		return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", domain, recordsError.Error())
+	}
+
+	problems := lintRecords(domain, records, action.lookupHost)
+
+	if *lintFormat == "json" {
+		if problems == nil {
+			problems = []lintProblem{}
+		}
+
+		json, err := json.MarshalIndent(problems, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		return successMessage{string(json)}, nil
+	}
+
+	if len(problems) == 0 {
+		return successMessage{fmt.Sprintf("No problems found in %s", domain)}, nil
+	}
+
+	return successMessage{formatLintProblems(problems)}, nil
+}
+
+// getInfoProvider returns a DNS info provider instance or an error if the creation of the provider failed.
+func (action lintAction) getInfoProvider() (deens.DNSInfoProvider, error) {
+	if action.infoProviderFactory == nil {
+		return nil, fmt.Errorf("No DNS info provider factory available")
+	}
+
+	return action.infoProviderFactory.CreateInfoProvider()
+}
+
+// lintProblem describes a single problem found in a zone.
+type lintProblem struct {
+	Name    string `json:"name"`
+	Check   string `json:"check"`
+	Details string `json:"details"`
+}
+
+// lintRecords checks the given records of a domain for CNAME conflicts,
+// dangling CNAME targets, SPF records without MX records, duplicate
+// records and absurd TTLs. The problems are sorted by name.
+func lintRecords(domain string, records []dnsimple.Record, lookupHost func(host string) ([]string, error)) []lintProblem {
+	var problems []lintProblem
+
+	recordsByName := make(map[string][]dnsimple.Record)
+	for _, record := range records {
+		recordsByName[record.Name] = append(recordsByName[record.Name], record)
+	}
+
+	for name, nameRecords := range recordsByName {
+		displayName := getFormattedDomainName(name, domain)
+		types := make(map[string]bool)
+		contents := make(map[string]bool)
+		hasSPF := false
+
+		for _, record := range nameRecords {
+			types[record.RecordType] = true
+
+			key := record.RecordType + " " + record.Content
+			if contents[key] {
+				problems = append(problems, lintProblem{displayName, lintCheckDuplicate, fmt.Sprintf("Duplicate %s record %q", record.RecordType, record.Content)})
+			}
+
+			contents[key] = true
+
+			if record.Ttl < minimumTTL || record.Ttl > maximumReasonableTTL {
+				problems = append(problems, lintProblem{displayName, lintCheckTTL, fmt.Sprintf("The TTL of the %s record is %d seconds (expected %d to %d)", record.RecordType, record.Ttl, minimumTTL, maximumReasonableTTL)})
+			}
+
+			if record.RecordType == "TXT" || record.RecordType == "SPF" {
+				spf := parseTXTContent(record.Content)
+				if strings.HasPrefix(spf, "v=spf1") && strings.TrimSpace(strings.TrimPrefix(spf, "v=spf1")) != "-all" {
+					hasSPF = true
+				}
+			}
+
+			if record.RecordType == "CNAME" && isDanglingTarget(domain, record.Content, recordsByName, lookupHost) {
+				problems = append(problems, lintProblem{displayName, lintCheckDanglingCNAME, fmt.Sprintf("The CNAME target %q does not resolve", record.Content)})
+			}
+		}
+
+		if types["CNAME"] && len(nameRecords) > 1 {
+			var otherTypes []string
+			for recordType := range types {
+				if recordType != "CNAME" {
+					otherTypes = append(otherTypes, recordType)
+				}
+			}
+
+			sort.Strings(otherTypes)
+
+			details := "Multiple CNAME records"
+			if len(otherTypes) > 0 {
+				details = fmt.Sprintf("The CNAME record coexists with %s records", strings.Join(otherTypes, ", "))
+			}
+
+			problems = append(problems, lintProblem{displayName, lintCheckCNAMEConflict, details})
+		}
+
+		if hasSPF && !types["MX"] {
+			problems = append(problems, lintProblem{displayName, lintCheckMissingMX, "The name has an SPF policy but no MX record"})
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Name != problems[j].Name {
+			return problems[i].Name < problems[j].Name
+		}
+
+		return problems[i].Check < problems[j].Check
+	})
+
+	return problems
+}
+
+// isDanglingTarget returns true if the given CNAME target does not exist.
+// Targets inside the zone are looked up in the zone records, all others
+// are resolved with the given lookup function.
+func isDanglingTarget(domain, target string, recordsByName map[string][]dnsimple.Record, lookupHost func(host string) ([]string, error)) bool {
+	target = strings.ToLower(strings.TrimSuffix(target, "."))
+
+	if target == domain {
+		_, exists := recordsByName[""]
+		return !exists
+	}
+
+	if strings.HasSuffix(target, "."+domain) {
+		_, exists := recordsByName[strings.TrimSuffix(target, "."+domain)]
+		return !exists
+	}
+
+	if lookupHost == nil {
+		return false
+	}
+
+	addresses, lookupError := lookupHost(target)
+	return lookupError != nil || len(addresses) == 0
+}
+
+// formatLintProblems formats the given problems as a table.
+func formatLintProblems(problems []lintProblem) string {
+	buf := new(bytes.Buffer)
+
+	// initialize the tabwriter
+	w := new(tabwriter.Writer)
+	minWidth := 0
+	tabWidth := 8
+	padding := 3
+	w.Init(buf, minWidth, tabWidth, padding, ' ', 0)
+
+	fmt.Fprintf(w, "NAME\tCHECK\tDETAILS")
+	for _, problem := range problems {
+		fmt.Fprintf(w, "\n%s\t%s\t%s", problem.Name, problem.Check, problem.Details)
+	}
+
+	w.Flush()
+
+	return buf.String()
+}
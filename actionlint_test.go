@@ -0,0 +1,156 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"testing"
+)
+
+// getLintTestInfoProvider returns an info provider that returns the given records.
+func getLintTestInfoProvider(records []dnsimple.Record) testDNSInfoProvider {
+	return testDNSInfoProvider{
+		getDomainRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return records, nil
+		},
+	}
+}
+
+// testLookupHost resolves only "cdn.example.net".
+func testLookupHost(host string) ([]string, error) {
+	if host == "cdn.example.net" {
+		return []string{"203.0.113.1"}, nil
+	}
+
+	return nil, fmt.Errorf("no such host")
+}
+
+func Test_lintAction_Name_CorrectActionNameIsReturned(t *testing.T) {
+
+	// arrange
+	lintAction := lintAction{}
+
+	// act
+	result := lintAction.Name()
+
+	// assert
+	if result != "lint" {
+		t.Fail()
+		t.Logf("lintAction.Name() should have returned %q but returned %q instead.", "lint", result)
+	}
+
+}
+
+func Test_lintAction_Usage_ResultIsNotEmpty(t *testing.T) {
+
+	// arrange
+	lintAction := lintAction{}
+
+	// act
+	result := lintAction.Usage()
+
+	// assert
+	if isEmpty(result) {
+		t.Fail()
+		t.Logf("lintAction.Usage() not be empty.")
+	}
+
+}
+
+// lintAction.Execute should return an error if the arguments are invalid.
+func Test_lintAction_InvalidArguments_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{},
+		{"-domain", " "},
+		{"-format", "xml", "example.com"},
+	}
+
+	lintAction := lintAction{testInfoProviderFactory{getLintTestInfoProvider(nil), nil}, testLookupHost}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := lintAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("lintAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// lintAction.Execute should report all problems of the zone.
+func Test_lintAction_ZoneWithProblems_ProblemsAreReported(t *testing.T) {
+	// arrange
+	records := []dnsimple.Record{
+		{Name: "", RecordType: "TXT", Content: "v=spf1 include:_spf.example.net ~all", Ttl: 3600},
+		{Name: "www", RecordType: "CNAME", Content: "example.com", Ttl: 3600},
+		{Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 3600},
+		{Name: "cdn", RecordType: "CNAME", Content: "cdn.example.net", Ttl: 3600},
+		{Name: "old", RecordType: "CNAME", Content: "gone.example.net", Ttl: 3600},
+		{Name: "shop", RecordType: "CNAME", Content: "missing.example.com", Ttl: 3600},
+		{Name: "api", RecordType: "A", Content: "203.0.113.2", Ttl: 600},
+		{Name: "api", RecordType: "A", Content: "203.0.113.2", Ttl: 600},
+		{Name: "slow", RecordType: "A", Content: "203.0.113.3", Ttl: 2592000},
+	}
+
+	lintAction := lintAction{testInfoProviderFactory{getLintTestInfoProvider(records), nil}, testLookupHost}
+
+	// act
+	result, err := lintAction.Execute([]string{"-format", "json", "example.com"})
+
+	// assert
+	if err != nil {
+		t.Fatalf("lintAction.Execute should not return an error: %s", err.Error())
+	}
+
+	var problems []lintProblem
+	json.Unmarshal([]byte(result.Text()), &problems)
+
+	expected := []lintProblem{
+		{"api.example.com", lintCheckDuplicate, `Duplicate A record "203.0.113.2"`},
+		{"example.com", lintCheckMissingMX, "The name has an SPF policy but no MX record"},
+		{"old.example.com", lintCheckDanglingCNAME, `The CNAME target "gone.example.net" does not resolve`},
+		{"shop.example.com", lintCheckDanglingCNAME, `The CNAME target "missing.example.com" does not resolve`},
+		{"slow.example.com", lintCheckTTL, "The TTL of the A record is 2592000 seconds (expected 60 to 604800)"},
+		{"www.example.com", lintCheckCNAMEConflict, "The CNAME record coexists with A records"},
+	}
+
+	if len(problems) != len(expected) {
+		t.Fatalf("lintAction.Execute should have reported %d problems but reported %d: %s", len(expected), len(problems), result.Text())
+	}
+
+	for index := range expected {
+		if problems[index] != expected[index] {
+			t.Fail()
+			t.Logf("Problem %d should be %+v but was %+v", index, expected[index], problems[index])
+		}
+	}
+}
+
+// lintAction.Execute should not report problems for a clean zone.
+func Test_lintAction_CleanZone_NoProblemsAreReported(t *testing.T) {
+	// arrange
+	records := []dnsimple.Record{
+		{Name: "", RecordType: "TXT", Content: "v=spf1 -all", Ttl: 3600},
+		{Name: "", RecordType: "A", Content: "203.0.113.1", Ttl: 3600},
+		{Name: "www", RecordType: "CNAME", Content: "example.com", Ttl: 3600},
+	}
+
+	lintAction := lintAction{testInfoProviderFactory{getLintTestInfoProvider(records), nil}, testLookupHost}
+
+	// act
+	result, err := lintAction.Execute([]string{"-domain", "example.com"})
+
+	// assert
+	if err != nil || result.Text() != "No problems found in example.com" {
+		t.Fail()
+		t.Logf("lintAction.Execute should not report any problems but returned %q (error: %v)", result, err)
+	}
+}
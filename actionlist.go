@@ -6,6 +6,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/andreaskoch/dee-ns"
@@ -17,13 +18,18 @@ import (
 var (
 	actionNameList = "list"
 
-	listArguments = flag.NewFlagSet(actionNameList, flag.ContinueOnError)
-	listDomain    = listArguments.String("domain", "", "Domain (optional")
-	listSubdomain = listArguments.String("subdomain", "", "Subdomain (optional)")
+	listArguments  = flag.NewFlagSet(actionNameList, flag.ContinueOnError)
+	listDomain     = listArguments.String("domain", "", "Domain (optional")
+	listSubdomain  = listArguments.String("subdomain", "", "Subdomain (optional)")
+	listFormat     = listArguments.String("format", "table", "The output format (table, json)")
+	listLabel      = listArguments.String("label", "", "Only list records with the given labels (e.g. env=prod,team=web)")
+	listProvenance = listArguments.Bool("provenance", false, "Show when and from which profile and host dee created and last changed the records")
 )
 
 type listAction struct {
 	infoProviderFactory dnsInfoProviderCreator
+	metadata            metadataStore
+	journal             changeJournal
 }
 
 func (action listAction) Name() string {
@@ -48,11 +54,27 @@ func (action listAction) Execute(arguments []string) (message, error) {
 	// parse the arguments
 	*listDomain = ""
 	*listSubdomain = ""
+	*listFormat = "table"
+	*listLabel = ""
+	*listProvenance = false
 
 	if parseError := listArguments.Parse(arguments); parseError != nil {
 		return nil, parseError
 	}
 
+	if *listFormat != "table" && *listFormat != "json" {
+		return nil, fmt.Errorf("Unknown output format: %q", *listFormat)
+	}
+
+	selector, labelError := parseLabels(*listLabel)
+	if labelError != nil {
+		return nil, labelError
+	}
+
+	if len(selector) > 0 && isEmpty(*listDomain) {
+		return nil, fmt.Errorf("The -label filter requires a domain")
+	}
+
 	infoProvider, infoProviderError := action.getInfoProvider()
 	if infoProviderError != nil {
 		return nil, fmt.Errorf("No DNS info provider available")
@@ -68,7 +90,7 @@ func (action listAction) Execute(arguments []string) (message, error) {
 			return nil, fmt.Errorf("Unable to fetch DNS records for subdomain %s.%s", *listSubdomain, *listDomain)
 		}
 
-		return successMessage{formatDNSRecords(records, *listDomain)}, nil
+		return action.getRecordListMessage(records, *listDomain, selector)
 	}
 
 	// case 3: get all subdomains
@@ -78,7 +100,7 @@ func (action listAction) Execute(arguments []string) (message, error) {
 			return nil, fmt.Errorf("Unable to fetch DNS records for domain %s", *listDomain)
 		}
 
-		return successMessage{formatDNSRecords(records, *listDomain)}, nil
+		return action.getRecordListMessage(records, *listDomain, selector)
 	}
 
 	// case 1: get all domain names
@@ -87,9 +109,97 @@ func (action listAction) Execute(arguments []string) (message, error) {
 		return nil, fmt.Errorf("Unable to retrieve domain names: %s", err.Error())
 	}
 
+	if *listFormat == "json" {
+		if names == nil {
+			names = []string{}
+		}
+
+		json, err := json.MarshalIndent(names, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+
+		return successMessage{string(json)}, nil
+	}
+
 	return successMessage{strings.Join(names, "\n")}, nil
 }
 
+// listedRecord is the JSON representation of a listed DNS record.
+type listedRecord struct {
+	apiRecord
+	Labels     map[string]string `json:"labels,omitempty"`
+	Note       string            `json:"note,omitempty"`
+	Provenance *recordProvenance `json:"provenance,omitempty"`
+}
+
+// getRecordListMessage returns the records that match the given label selector in
+// the selected output format. The JSON output contains the record IDs (e.g. for
+// "dee record update -id"), the labels and notes and the provenance of the records.
+func (action listAction) getRecordListMessage(records []dnsimple.Record, domainName string, selector map[string]string) (message, error) {
+	var metadata map[int64]recordMetadata
+	if action.metadata != nil {
+		domainMetadata, metadataError := action.metadata.GetMetadata(domainName)
+		if metadataError != nil {
+			return nil, metadataError
+		}
+
+		metadata = domainMetadata
+	} else if len(selector) > 0 {
+		return nil, fmt.Errorf("No metadata store available")
+	}
+
+	var matchingRecords []dnsimple.Record
+	for _, record := range records {
+		if matchesLabels(metadata[record.Id], selector) {
+			matchingRecords = append(matchingRecords, record)
+		}
+	}
+
+	var provenance map[string]recordProvenance
+	if action.journal != nil && (*listFormat == "json" || *listProvenance) {
+		entries, journalError := action.journal.GetEntries()
+		if journalError != nil {
+			return nil, journalError
+		}
+
+		provenance = getRecordProvenance(entries, domainName)
+	} else if *listProvenance {
+		return nil, fmt.Errorf("No change journal available")
+	}
+
+	if *listFormat != "json" {
+		if *listProvenance {
+			return successMessage{formatDNSRecordsWithProvenance(matchingRecords, domainName, provenance)}, nil
+		}
+
+		return successMessage{formatDNSRecords(matchingRecords, domainName)}, nil
+	}
+
+	result := []listedRecord{}
+	for _, record := range matchingRecords {
+		listed := listedRecord{
+			apiRecord{record.Id, record.Name, record.RecordType, record.Content, record.Ttl},
+			metadata[record.Id].Labels,
+			metadata[record.Id].Note,
+			nil,
+		}
+
+		if known, isKnown := provenance[record.StringId()]; isKnown {
+			listed.Provenance = &known
+		}
+
+		result = append(result, listed)
+	}
+
+	json, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return successMessage{string(json)}, nil
+}
+
 // getInfoProvider returns a DNS info provider instance or an error if the creation of the provider failed.
 func (action listAction) getInfoProvider() (deens.DNSInfoProvider, error) {
 	if action.infoProviderFactory == nil {
@@ -101,6 +211,24 @@ func (action listAction) getInfoProvider() (deens.DNSInfoProvider, error) {
 
 // formatDNSRecords takes a list of DNS records and formats them as a table.
 func formatDNSRecords(records []dnsimple.Record, domainName string) string {
+	return formatDNSRecordTable(records, domainName, nil)
+}
+
+// formatDNSRecordsWithProvenance formats the given DNS records as a table
+// with a column that contains the provenance of the records.
+func formatDNSRecordsWithProvenance(records []dnsimple.Record, domainName string, provenance map[string]recordProvenance) string {
+	return formatDNSRecordTable(records, domainName, func(record dnsimple.Record) string {
+		if known, isKnown := provenance[record.StringId()]; isKnown {
+			return known.String()
+		}
+
+		return "-"
+	})
+}
+
+// formatDNSRecordTable formats the given DNS records as a table. If
+// a column function is given its result is appended to every row.
+func formatDNSRecordTable(records []dnsimple.Record, domainName string, column func(record dnsimple.Record) string) string {
 	buf := new(bytes.Buffer)
 
 	// initialize the tabwriter
@@ -119,6 +247,9 @@ func formatDNSRecords(records []dnsimple.Record, domainName string) string {
 		}
 
 		fmt.Fprintf(w, "%s\t%s\t%s", domainName, record.RecordType, record.Content)
+		if column != nil {
+			fmt.Fprintf(w, "\t%s", column(record))
+		}
 
 		// append newline if we are not
 		// formatting the last record
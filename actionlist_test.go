@@ -5,10 +5,13 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
 	"strings"
 	"testing"
+	"time"
 )
 
 // testDNSInfoProvider is a DNS info-provider used for testing.
@@ -101,7 +104,7 @@ func Test_listAction_InvalidArguments_ErrorIsReturned(t *testing.T) {
 
 		infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-		list := listAction{infoProviderFactory}
+		list := listAction{infoProviderFactory, nil, nil}
 
 		// act
 		_, err := list.Execute(arguments)
@@ -167,7 +170,7 @@ func Test_listAction_DomainAndSubDomainAreSet_SubdomainRecordsArePrinted(t *test
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	list := listAction{infoProviderFactory}
+	list := listAction{infoProviderFactory, nil, nil}
 
 	// act
 	result, _ := list.Execute(arguments)
@@ -197,7 +200,7 @@ func Test_listAction_DomainAndSubDomainAreSet_InfoProviderReturnsError_ErrorIsRe
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	list := listAction{infoProviderFactory}
+	list := listAction{infoProviderFactory, nil, nil}
 
 	// act
 	_, err := list.Execute(arguments)
@@ -238,7 +241,7 @@ func Test_listAction_DomainSet_DNSRecordsArePrinted(t *testing.T) {
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	list := listAction{infoProviderFactory}
+	list := listAction{infoProviderFactory, nil, nil}
 
 	// act
 	result, _ := list.Execute(arguments)
@@ -266,7 +269,7 @@ func Test_listAction_DomainSet_InfoProviderReturnsError_ErrorIsReturned(t *testi
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	list := listAction{infoProviderFactory}
+	list := listAction{infoProviderFactory, nil, nil}
 
 	// act
 	_, err := list.Execute(arguments)
@@ -294,7 +297,7 @@ func Test_listAction_NoArguments_DomainsArePrinted(t *testing.T) {
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	list := listAction{infoProviderFactory}
+	list := listAction{infoProviderFactory, nil, nil}
 
 	// act
 	result, _ := list.Execute(arguments)
@@ -319,7 +322,7 @@ func Test_listAction_NoArguments_InfoProviderReturnsError_ErrorIsReturned(t *tes
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	list := listAction{infoProviderFactory}
+	list := listAction{infoProviderFactory, nil, nil}
 
 	// act
 	_, err := list.Execute(arguments)
@@ -397,7 +400,7 @@ func Test_listAction_OnlyDomainIsSet_DomainRecordsArePrinted(t *testing.T) {
 
 	infoProviderFactory := testInfoProviderFactory{dnsInfoProvider, nil}
 
-	list := listAction{infoProviderFactory}
+	list := listAction{infoProviderFactory, nil, nil}
 
 	// act
 	result, _ := list.Execute(arguments)
@@ -496,3 +499,143 @@ func Test_formatDNSRecords_ResultDoesNotEndWithNewline(t *testing.T) {
 		t.Logf("formatDNSRecords(%q, %q) should not end with a newline character", records, domain)
 	}
 }
+
+// The JSON output of the records should contain the record IDs.
+func Test_listAction_JSONFormat_RecordIDsArePrinted(t *testing.T) {
+	// arrange
+	arguments := []string{
+		"-domain",
+		"example.com",
+		"-format",
+		"json",
+	}
+
+	dnsInfoProvider := testDNSInfoProvider{
+		getDomainRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{
+				{Id: 12345, Name: "www", Content: "10.0.2.1", RecordType: "A", Ttl: 600},
+			}, nil
+		},
+	}
+
+	list := listAction{testInfoProviderFactory{dnsInfoProvider, nil}, nil, nil}
+
+	// act
+	result, err := list.Execute(arguments)
+
+	// assert
+	if err != nil || !strings.Contains(result.Text(), `"id": 12345`) {
+		t.Fail()
+		t.Logf("list.Execute(%q) should print the record IDs as JSON: %v", arguments, err)
+	}
+}
+
+// The list action should only print the records with the given labels.
+func Test_listAction_LabelFilter_OnlyLabeledRecordsArePrinted(t *testing.T) {
+	// arrange
+	arguments := []string{
+		"-domain",
+		"example.com",
+		"-label",
+		"env=prod",
+	}
+
+	dnsInfoProvider := testDNSInfoProvider{
+		getDomainRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{
+				{Id: 1, Name: "www", Content: "10.0.2.1", RecordType: "A", Ttl: 600},
+				{Id: 2, Name: "dev", Content: "10.0.2.2", RecordType: "A", Ttl: 600},
+			}, nil
+		},
+	}
+
+	metadata := filesystemMetadataStore{afero.NewMemMapFs(), "/state.json"}
+	metadata.SetMetadata(recordMetadata{Domain: "example.com", RecordID: 1, Labels: map[string]string{"env": "prod"}})
+	metadata.SetMetadata(recordMetadata{Domain: "example.com", RecordID: 2, Labels: map[string]string{"env": "dev"}})
+
+	list := listAction{testInfoProviderFactory{dnsInfoProvider, nil}, metadata, nil}
+
+	// act
+	result, err := list.Execute(arguments)
+
+	// assert
+	if err != nil || !strings.Contains(result.Text(), "10.0.2.1") || strings.Contains(result.Text(), "10.0.2.2") {
+		t.Fail()
+		t.Logf("list.Execute(%q) should only print the record labeled env=prod: %v", arguments, err)
+	}
+}
+
+// The list action should show who created and last changed the records.
+func Test_listAction_Provenance_JournalEntriesAreShown(t *testing.T) {
+	// arrange
+	dnsInfoProvider := testDNSInfoProvider{
+		getDomainRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{
+				{Id: 1, Name: "www", Content: "10.0.2.1", RecordType: "A", Ttl: 600},
+				{Id: 2, Name: "home", Content: "10.0.2.2", RecordType: "A", Ttl: 600},
+				{Id: 3, Name: "mail", Content: "10.0.2.3", RecordType: "A", Ttl: 600},
+			}, nil
+		},
+	}
+
+	created := time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+	journal := filesystemJournal{afero.NewMemMapFs(), "/journal.json"}
+	journal.Append(journalEntry{Time: created, Domain: "example.com", Operation: journalOperationCreate, RecordID: "2", Profile: "personal", Host: "nas"})
+	journal.Append(journalEntry{Time: created.Add(time.Hour), Domain: "example.com", Operation: journalOperationUpdate, RecordID: "2", Host: "router"})
+	journal.Append(journalEntry{Time: created, Domain: "example.org", Operation: journalOperationCreate, RecordID: "1", Host: "nas"})
+	journal.Append(journalEntry{Time: created, Domain: "example.com", Operation: journalOperationCreate, RecordID: "3", Host: "nas"})
+	journal.Append(journalEntry{Time: created, Domain: "example.com", Operation: journalOperationDelete, RecordID: "3", Host: "nas"})
+
+	list := listAction{testInfoProviderFactory{dnsInfoProvider, nil}, nil, journal}
+
+	// act
+	result, err := list.Execute([]string{"-domain", "example.com", "-format", "json"})
+
+	// assert
+	if err != nil {
+		t.Fatalf("list.Execute should succeed: %s", err.Error())
+	}
+
+	var records []listedRecord
+	json.Unmarshal([]byte(result.Text()), &records)
+
+	if len(records) != 3 || records[0].Provenance != nil || records[2].Provenance != nil {
+		t.Fail()
+		t.Logf("Only the record that was changed by dee should have a provenance: %s", result.Text())
+	}
+
+	if provenance := records[1].Provenance; provenance == nil || provenance.CreatedBy != "personal@nas" || provenance.UpdatedBy != "router" || !provenance.UpdatedAt.Equal(created.Add(time.Hour)) {
+		t.Fail()
+		t.Logf("The record should have been created by personal@nas and updated by router: %s", result.Text())
+	}
+}
+
+// The table should only contain the provenance column if -provenance is given.
+func Test_listAction_ProvenanceFlag_ColumnIsAdded(t *testing.T) {
+	// arrange
+	dnsInfoProvider := testDNSInfoProvider{
+		getDomainRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{{Id: 1, Name: "www", Content: "10.0.2.1", RecordType: "A", Ttl: 600}}, nil
+		},
+	}
+
+	journal := filesystemJournal{afero.NewMemMapFs(), "/journal.json"}
+	journal.Append(journalEntry{Time: time.Now(), Domain: "example.com", Operation: journalOperationCreate, RecordID: "1", Profile: "personal", Host: "nas"})
+
+	list := listAction{testInfoProviderFactory{dnsInfoProvider, nil}, nil, journal}
+
+	// act
+	plain, _ := list.Execute([]string{"-domain", "example.com"})
+	annotated, err := list.Execute([]string{"-domain", "example.com", "-provenance"})
+
+	// assert
+	if strings.Contains(plain.Text(), "personal@nas") {
+		t.Fail()
+		t.Logf("The table should not contain the provenance without -provenance: %q", plain.Text())
+	}
+
+	if err != nil || !strings.Contains(annotated.Text(), "by personal@nas") {
+		t.Fail()
+		t.Logf("The table should contain the provenance with -provenance: %q (error: %v)", annotated.Text(), err)
+	}
+}
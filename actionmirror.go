@@ -0,0 +1,114 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var (
+	actionNameMirror = "mirror"
+
+	mirrorArguments = flag.NewFlagSet(actionNameMirror, flag.ContinueOnError)
+	mirrorDomain    = mirrorArguments.String("domain", "", "Domain (e.g. example.com)")
+	mirrorDomains   = mirrorArguments.String("domains", "", "Comma-separated list of domains or domain patterns (e.g. example.com,example.*)")
+	mirrorTo        = mirrorArguments.String("to", "", "The mirror target (e.g. zonefile:/var/named, command:/usr/local/bin/push-zone)")
+)
+
+type mirrorAction struct {
+	infoProviderFactory dnsInfoProviderCreator
+	secondaryProviders  secondaryProviderRegistry
+}
+
+func (action mirrorAction) Name() string {
+	return actionNameMirror
+}
+
+func (action mirrorAction) Description() string {
+	return "Copy the zones of your domains to a secondary DNS provider"
+}
+
+func (action mirrorAction) Usage() string {
+	buf := new(bytes.Buffer)
+	mirrorArguments.SetOutput(buf)
+	mirrorArguments.PrintDefaults()
+	return buf.String()
+}
+
+// Execute pushes the current records of the given domains to the given mirror target.
+func (action mirrorAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*mirrorDomain = ""
+	*mirrorDomains = ""
+	*mirrorTo = ""
+	if parseError := mirrorArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	domains, domainsError := getTargetDomains(*mirrorDomain, *mirrorDomains, action.infoProviderFactory)
+	if domainsError != nil {
+		return nil, domainsError
+	}
+
+	if isEmpty(*mirrorTo) {
+		return nil, fmt.Errorf("No mirror target supplied")
+	}
+
+	if action.secondaryProviders == nil {
+		return nil, fmt.Errorf("No mirror targets available")
+	}
+
+	provider, providerError := action.secondaryProviders.GetProvider(*mirrorTo)
+	if providerError != nil {
+		return nil, providerError
+	}
+
+	if action.infoProviderFactory == nil {
+		return nil, fmt.Errorf("No DNS info provider factory available")
+	}
+
+	infoProvider, infoProviderError := action.infoProviderFactory.CreateInfoProvider()
+	if infoProviderError != nil {
+		return nil, fmt.Errorf("No DNS info provider available")
+	}
+
+	return applyToDomains(domains, func(domain string) (message, error) {
+		records, recordsError := infoProvider.GetDomainRecords(domain)
+		if recordsError != nil {
+			return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", domain, recordsError.Error())
+		}
+
+		zone, skipped := formatZoneFile(domain, records)
+
+		changed, pushError := provider.PushZone(domain, zone)
+		if pushError != nil {
+			return nil, fmt.Errorf("Cannot mirror %s to %s: %s", domain, *mirrorTo, pushError.Error())
+		}
+
+		text := fmt.Sprintf("Mirrored: %s → %s (%d records)", domain, *mirrorTo, len(records)-len(skipped))
+		if !changed {
+			text = fmt.Sprintf("Unchanged: %s → %s is up to date", domain, *mirrorTo)
+		}
+
+		if len(skipped) > 0 {
+			var descriptions []string
+			for _, record := range skipped {
+				descriptions = append(descriptions, fmt.Sprintf("%s %s", record.RecordType, getFormattedDomainName(record.Name, domain)))
+			}
+
+			text += fmt.Sprintf("\nSkipped records without zone file equivalent: %s", strings.Join(descriptions, ", "))
+		}
+
+		if !changed {
+			return unchangedMessage{text}, nil
+		}
+
+		return changeMessage{text, 1}, nil
+	})
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"testing"
+)
+
+// getMirrorTestInfoProviderFactory returns an info provider factory for an account with two domains.
+func getMirrorTestInfoProviderFactory() testInfoProviderFactory {
+	return testInfoProviderFactory{testDNSInfoProvider{
+		getDomainNamesFunc: func() ([]string, error) {
+			return []string{"example.com", "example.net"}, nil
+		},
+		getDomainRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{
+				{Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 600},
+			}, nil
+		},
+	}, nil}
+}
+
+// mirrorAction.Execute should write the zones of all selected domains and report unchanged zones.
+func Test_mirrorAction_ZoneFileTarget_ZonesAreWritten(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	mirror := mirrorAction{getMirrorTestInfoProviderFactory(), newSecondaryProviderRegistry(fs)}
+	arguments := []string{"-domains", "example.*", "-to", "zonefile:/var/named"}
+
+	// act
+	first, firstError := mirror.Execute(arguments)
+	second, secondError := mirror.Execute(arguments)
+
+	// assert
+	if firstError != nil || getChangeSummary(first).Records != 2 {
+		t.Fatalf("mirror.Execute(%q) should mirror two zones but returned %v (%v)", arguments, first, firstError)
+	}
+
+	if _, isUnchanged := second.(unchangedMessage); secondError != nil || !isUnchanged {
+		t.Fail()
+		t.Logf("The second mirror.Execute(%q) should not change anything but returned %v (%v)", arguments, second, secondError)
+	}
+
+	if exists, _ := afero.Exists(fs, "/var/named/example.net.zone"); !exists {
+		t.Fail()
+		t.Logf("The zone file of example.net should have been written")
+	}
+}
+
+// mirrorAction.Execute should return an error if the arguments are invalid.
+func Test_mirrorAction_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{"-to", "zonefile:/var/named"},
+		{"-domain", "example.com"},
+		{"-domain", "example.com", "-to", "unknown:/var/named"},
+	}
+
+	mirror := mirrorAction{getMirrorTestInfoProviderFactory(), newSecondaryProviderRegistry(afero.NewMemMapFs())}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := mirror.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("mirror.Execute(%q) should return an error", arguments)
+		}
+	}
+}
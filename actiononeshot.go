@@ -0,0 +1,338 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/afero"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	actionNameOneshot = "oneshot"
+
+	// defaultOneshotNameservers are the authoritative name servers of DNSimple.
+	defaultOneshotNameservers = []string{"ns1.dnsimple.com", "ns2.dnsimple-edge.net", "ns3.dnsimple.com", "ns4.dnsimple-edge.org"}
+
+	// oneshotPollInterval is the time between two propagation checks.
+	oneshotPollInterval = 5 * time.Second
+)
+
+// oneshotSettings contains the settings of the oneshot action.
+type oneshotSettings struct {
+	Domain      string
+	Subdomain   string
+	IP          string
+	IPSource    string
+	Type        string
+	TTL         int
+	Wait        time.Duration
+	Nameservers []string
+	ResultFile  string
+}
+
+// oneshotResult is the JSON result that is written to DEE_RESULT_FILE.
+type oneshotResult struct {
+	Status     string    `json:"status"`
+	ExitCode   int       `json:"exit_code"`
+	Domain     string    `json:"domain,omitempty"`
+	Subdomain  string    `json:"subdomain,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Propagated *bool     `json:"propagated,omitempty"`
+	Time       time.Time `json:"time"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+type oneshotAction struct {
+	getActions  func() []action
+	ipProviders ipProviderRegistry
+	getenv      func(key string) string
+	fs          afero.Fs
+
+	// lookupHost returns the addresses of the given host name
+	// from the given name server.
+	lookupHost func(nameserver, host string) ([]string, error)
+
+	now   func() time.Time
+	sleep func(duration time.Duration)
+}
+
+func (action oneshotAction) Name() string {
+	return actionNameOneshot
+}
+
+func (action oneshotAction) Description() string {
+	return "Create or update an address record with the settings of the environment (e.g. in init containers or Jobs)"
+}
+
+func (action oneshotAction) Usage() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "  %s (all settings are read from the environment)\n", actionNameOneshot)
+	fmt.Fprintf(buf, "    DEE_DOMAIN          Domain (e.g. example.com)\n")
+	fmt.Fprintf(buf, "    DEE_SUBDOMAIN       Subdomain (e.g. www)\n")
+	fmt.Fprintf(buf, "    DEE_IP              IP address (e.g. ::1, 127.0.0.1)\n")
+	fmt.Fprintf(buf, "    DEE_IP_SOURCE       IP source used if no IP address is given (e.g. http, interface:eth0)\n")
+	fmt.Fprintf(buf, "    DEE_TYPE            The record type (A or AAAA; default: the type of the IP address)\n")
+	fmt.Fprintf(buf, "    DEE_TTL             The time to live in seconds (default: %d)\n", defaultTTL)
+	fmt.Fprintf(buf, "    DEE_WAIT            Wait up to this duration until the name servers return the IP address (e.g. 2m)\n")
+	fmt.Fprintf(buf, "    DEE_NAMESERVERS     Comma-separated list of the name servers that are checked (default: %s)\n", strings.Join(defaultOneshotNameservers, ","))
+	fmt.Fprintf(buf, "    DEE_RESULT_FILE     The path of the JSON result file (e.g. /dev/termination-log)\n")
+	return buf.String()
+}
+
+// Execute creates or updates the address record that is described by the
+// environment variables, waits for the propagation if DEE_WAIT is set and
+// writes the result to DEE_RESULT_FILE. Failures are returned as exitCodeErrors.
+func (action oneshotAction) Execute(arguments []string) (message, error) {
+	startTime := action.now()
+
+	settings, settingsError := getOneshotSettings(action.getenv)
+	if settingsError != nil {
+		return action.finish(settings, startTime, nil, exitCodeError{settingsError, exitCodeInvalidSettings})
+	}
+
+	if len(arguments) > 0 {
+		return action.finish(settings, startTime, nil, exitCodeError{fmt.Errorf("The %s action takes no arguments (got %q)", actionNameOneshot, arguments), exitCodeInvalidSettings})
+	}
+
+	// IP address
+	ip, ipError := getIPAddress(settings.IP, settings.IPSource, action.ipProviders, nil)
+	if ipError != nil {
+		return action.finish(settings, startTime, nil, exitCodeError{ipError, exitCodeIPUnavailable})
+	}
+
+	settings.IP = ip.String()
+
+	// change
+	if action.getActions == nil {
+		return action.finish(settings, startTime, nil, exitCodeError{fmt.Errorf("The %s action is not available", actionNameCreateOrUpdate), exitCodeChangeFailed})
+	}
+
+	createOrUpdate := getActionByName(actionNameCreateOrUpdate, action.getActions())
+	if createOrUpdate == nil {
+		return action.finish(settings, startTime, nil, exitCodeError{fmt.Errorf("The %s action is not available", actionNameCreateOrUpdate), exitCodeChangeFailed})
+	}
+
+	changeArguments := []string{"-domain", settings.Domain, "-subdomain", settings.Subdomain, "-ip", settings.IP, "-ttl", strconv.Itoa(settings.TTL)}
+	if settings.Type != "" {
+		changeArguments = append(changeArguments, "-type", settings.Type)
+	}
+
+	result, changeError := createOrUpdate.Execute(changeArguments)
+	if changeError != nil {
+		return action.finish(settings, startTime, nil, exitCodeError{changeError, exitCodeChangeFailed})
+	}
+
+	// an unchanged record is the expected result of every restart of an
+	// init container, so it must not end with the exit code 3
+	if unchanged, isUnchanged := result.(unchangedMessage); isUnchanged {
+		result = oneshotUnchangedMessage{unchanged.text}
+	}
+
+	// propagation
+	if settings.Wait > 0 {
+		propagationError := action.waitForPropagation(getFormattedDomainName(settings.Subdomain, settings.Domain), ip, settings)
+		if propagationError != nil {
+			return action.finish(settings, startTime, result, exitCodeError{propagationError, exitCodePropagationTimeout})
+		}
+	}
+
+	return action.finish(settings, startTime, result, nil)
+}
+
+// waitForPropagation polls the name servers until all of them return the given IP
+// for the given host name. An error is returned if the wait time has passed.
+func (action oneshotAction) waitForPropagation(host string, ip net.IP, settings oneshotSettings) error {
+	if action.lookupHost == nil {
+		return fmt.Errorf("No DNS resolver available")
+	}
+
+	deadline := action.now().Add(settings.Wait)
+	for {
+		pending := getPendingNameservers(host, ip, settings.Nameservers, action.lookupHost)
+		if len(pending) == 0 {
+			return nil
+		}
+
+		if !action.now().Add(oneshotPollInterval).Before(deadline) {
+			return fmt.Errorf("%s was not propagated to %s within %s", host, strings.Join(pending, ", "), settings.Wait)
+		}
+
+		action.sleep(oneshotPollInterval)
+	}
+}
+
+// finish writes the result file and returns the given message or error.
+func (action oneshotAction) finish(settings oneshotSettings, startTime time.Time, result message, err error) (message, error) {
+	if settings.ResultFile == "" {
+		return result, err
+	}
+
+	resultFileError := action.writeResult(settings, startTime, result, err)
+	if resultFileError != nil && err == nil {
+		return nil, resultFileError
+	}
+
+	return result, err
+}
+
+// writeResult writes the JSON result of the oneshot action to the result file.
+func (action oneshotAction) writeResult(settings oneshotSettings, startTime time.Time, result message, err error) error {
+	endTime := action.now()
+	oneshot := oneshotResult{
+		Status:     "changed",
+		ExitCode:   0,
+		Domain:     settings.Domain,
+		Subdomain:  settings.Subdomain,
+		IP:         settings.IP,
+		Time:       endTime.UTC(),
+		DurationMs: int64(endTime.Sub(startTime) / time.Millisecond),
+	}
+
+	if result != nil {
+		oneshot.Message = result.Text()
+		oneshot.ExitCode = getExitCode(result)
+		if _, isUnchanged := result.(oneshotUnchangedMessage); isUnchanged {
+			oneshot.Status = "unchanged"
+		}
+	}
+
+	if settings.Wait > 0 && result != nil {
+		propagated := err == nil
+		oneshot.Propagated = &propagated
+	}
+
+	if err != nil {
+		oneshot.Status = "failed"
+		oneshot.ExitCode = getErrorExitCode(err)
+		oneshot.Error = err.Error()
+	}
+
+	content, encodeError := json.MarshalIndent(oneshot, "", "  ")
+	if encodeError != nil {
+		return fmt.Errorf("Cannot encode the result: %s", encodeError.Error())
+	}
+
+	if action.fs == nil {
+		return fmt.Errorf("No filesystem available")
+	}
+
+	if writeError := afero.WriteFile(action.fs, settings.ResultFile, append(content, '\n'), 0644); writeError != nil {
+		return fmt.Errorf("Cannot write the result to %q: %s", settings.ResultFile, writeError.Error())
+	}
+
+	return nil
+}
+
+// oneshotUnchangedMessage is the successful result (exit code 0)
+// of a oneshot run whose record already had the IP address.
+type oneshotUnchangedMessage struct {
+	text string
+}
+
+// Text returns the text of the current message.
+func (m oneshotUnchangedMessage) Text() string {
+	return m.text
+}
+
+// getOneshotSettings reads the settings of the oneshot action from the environment.
+func getOneshotSettings(getenv func(key string) string) (oneshotSettings, error) {
+	settings := oneshotSettings{
+		Domain:      strings.TrimSpace(getenv("DEE_DOMAIN")),
+		Subdomain:   strings.TrimSpace(getenv("DEE_SUBDOMAIN")),
+		IP:          strings.TrimSpace(getenv("DEE_IP")),
+		IPSource:    strings.TrimSpace(getenv("DEE_IP_SOURCE")),
+		Type:        strings.TrimSpace(getenv("DEE_TYPE")),
+		TTL:         defaultTTL,
+		Nameservers: defaultOneshotNameservers,
+		ResultFile:  strings.TrimSpace(getenv("DEE_RESULT_FILE")),
+	}
+
+	if settings.Domain == "" {
+		return settings, fmt.Errorf("No domain supplied (DEE_DOMAIN)")
+	}
+
+	if settings.IP == "" && settings.IPSource == "" {
+		return settings, fmt.Errorf("No IP address supplied (DEE_IP or DEE_IP_SOURCE)")
+	}
+
+	if ttl := strings.TrimSpace(getenv("DEE_TTL")); ttl != "" {
+		parsedTTL, ttlError := strconv.Atoi(ttl)
+		if ttlError != nil || parsedTTL < 0 {
+			return settings, fmt.Errorf("Invalid TTL %q (DEE_TTL)", ttl)
+		}
+
+		settings.TTL = parsedTTL
+	}
+
+	if wait := strings.TrimSpace(getenv("DEE_WAIT")); wait != "" {
+		parsedWait, waitError := time.ParseDuration(wait)
+		if waitError != nil || parsedWait < 0 {
+			return settings, fmt.Errorf("Invalid wait time %q (DEE_WAIT)", wait)
+		}
+
+		settings.Wait = parsedWait
+	}
+
+	if nameservers := strings.TrimSpace(getenv("DEE_NAMESERVERS")); nameservers != "" {
+		settings.Nameservers = nil
+		for _, nameserver := range strings.Split(nameservers, ",") {
+			if nameserver = strings.TrimSpace(nameserver); nameserver != "" {
+				settings.Nameservers = append(settings.Nameservers, nameserver)
+			}
+		}
+	}
+
+	return settings, nil
+}
+
+// getPendingNameservers returns the name servers that
+// do not return the given IP for the given host name yet.
+func getPendingNameservers(host string, ip net.IP, nameservers []string, lookupHost func(nameserver, host string) ([]string, error)) []string {
+	var pending []string
+	for _, nameserver := range nameservers {
+		addresses, lookupError := lookupHost(nameserver, host)
+		if lookupError != nil || !containsIP(addresses, ip) {
+			pending = append(pending, nameserver)
+		}
+	}
+
+	return pending
+}
+
+// containsIP returns true if the given addresses contain the given IP.
+func containsIP(addresses []string, ip net.IP) bool {
+	for _, address := range addresses {
+		if ip.Equal(net.ParseIP(address)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookupHostAtNameserver resolves the given host name with the given name server.
+func lookupHostAtNameserver(nameserver, host string) ([]string, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialer := net.Dialer{Timeout: 5 * time.Second}
+			return dialer.DialContext(ctx, network, net.JoinHostPort(nameserver, "53"))
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return resolver.LookupHost(ctx, host)
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/afero"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingTestAction is an action that records its arguments and returns the given result.
+type recordingTestAction struct {
+	name      string
+	arguments *[]string
+	result    message
+	err       error
+}
+
+func (action recordingTestAction) Name() string        { return action.name }
+func (action recordingTestAction) Description() string { return "" }
+func (action recordingTestAction) Usage() string       { return "" }
+
+func (action recordingTestAction) Execute(arguments []string) (message, error) {
+	*action.arguments = arguments
+	return action.result, action.err
+}
+
+// getTestOneshotAction returns a oneshot action for the given environment that
+// changes the records with the given action and a clock that advances when it sleeps.
+func getTestOneshotAction(environment map[string]string, createOrUpdate action, lookupHost func(nameserver, host string) ([]string, error)) (oneshotAction, afero.Fs) {
+	fs := afero.NewMemMapFs()
+	clock := time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+
+	action := oneshotAction{
+		getActions:  func() []action { return []action{createOrUpdate} },
+		ipProviders: newIPProviderRegistry(fs),
+		getenv:      getTestEnvironment(environment),
+		fs:          fs,
+		lookupHost:  lookupHost,
+		now:         func() time.Time { return clock },
+		sleep:       func(duration time.Duration) { clock = clock.Add(duration) },
+	}
+
+	return action, fs
+}
+
+// readTestOneshotResult reads the result file of the oneshot action.
+func readTestOneshotResult(t *testing.T, fs afero.Fs) oneshotResult {
+	content, readError := afero.ReadFile(fs, "/results/dee.json")
+	if readError != nil {
+		t.Fatalf("The result file should have been written: %s", readError.Error())
+	}
+
+	var result oneshotResult
+	if decodeError := json.Unmarshal(content, &result); decodeError != nil {
+		t.Fatalf("The result file should contain JSON: %s", decodeError.Error())
+	}
+
+	return result
+}
+
+// The record should be changed with the settings of the environment and the result should be written.
+func Test_oneshotAction_ValidEnvironment_RecordIsChangedAndResultIsWritten(t *testing.T) {
+	// arrange
+	var arguments []string
+	createOrUpdate := recordingTestAction{"createorupdate", &arguments, addressChangeMessage{changeMessage{"Updated: home.example.com → 203.0.113.1", 1}, net.ParseIP("203.0.113.1")}, nil}
+	environment := map[string]string{"DEE_DOMAIN": "example.com", "DEE_SUBDOMAIN": "home", "DEE_IP": "203.0.113.1", "DEE_TTL": "60", "DEE_RESULT_FILE": "/results/dee.json"}
+	action, fs := getTestOneshotAction(environment, createOrUpdate, nil)
+
+	// act
+	_, err := action.Execute(nil)
+
+	// assert
+	if err != nil {
+		t.Fatalf("Execute should succeed: %s", err.Error())
+	}
+
+	if strings.Join(arguments, " ") != "-domain example.com -subdomain home -ip 203.0.113.1 -ttl 60" {
+		t.Fail()
+		t.Logf("createorupdate should be executed with the settings of the environment but was executed with %q", arguments)
+	}
+
+	result := readTestOneshotResult(t, fs)
+	if result.Status != "changed" || result.ExitCode != 0 || result.IP != "203.0.113.1" || result.Propagated != nil {
+		t.Fail()
+		t.Logf("The result should report the change but is %+v", result)
+	}
+}
+
+// The failures should be returned with their exit code and written to the result file.
+func Test_oneshotAction_Failures_ExitCodesAreGranular(t *testing.T) {
+	inputs := []struct {
+		environment map[string]string
+		changeError error
+		expected    int
+	}{
+		{map[string]string{"DEE_IP": "203.0.113.1"}, nil, exitCodeInvalidSettings},
+		{map[string]string{"DEE_DOMAIN": "example.com", "DEE_IP": "203.0.113.1", "DEE_WAIT": "soon"}, nil, exitCodeInvalidSettings},
+		{map[string]string{"DEE_DOMAIN": "example.com", "DEE_IP_SOURCE": "file:/missing"}, nil, exitCodeIPUnavailable},
+		{map[string]string{"DEE_DOMAIN": "example.com", "DEE_IP": "203.0.113.1"}, fmt.Errorf("The API is unavailable"), exitCodeChangeFailed},
+	}
+
+	for _, input := range inputs {
+		// arrange
+		var arguments []string
+		input.environment["DEE_RESULT_FILE"] = "/results/dee.json"
+		action, fs := getTestOneshotAction(input.environment, recordingTestAction{"createorupdate", &arguments, nil, input.changeError}, nil)
+
+		// act
+		_, err := action.Execute(nil)
+
+		// assert
+		if err == nil || getErrorExitCode(err) != input.expected {
+			t.Fail()
+			t.Logf("Execute should fail with the exit code %d for %v but returned %v", input.expected, input.environment, err)
+			continue
+		}
+
+		result := readTestOneshotResult(t, fs)
+		if result.Status != "failed" || result.ExitCode != input.expected || result.Error == "" {
+			t.Fail()
+			t.Logf("The result should report the failure with the exit code %d but is %+v", input.expected, result)
+		}
+	}
+}
+
+// The action should wait until all name servers return the new IP address.
+func Test_oneshotAction_Wait_NameserversArePolledUntilPropagated(t *testing.T) {
+	// arrange
+	var arguments []string
+	lookups := 0
+	lookupHost := func(nameserver, host string) ([]string, error) {
+		lookups++
+		if host != "home.example.com" || lookups < 4 {
+			return []string{"198.51.100.7"}, nil
+		}
+
+		return []string{"203.0.113.1"}, nil
+	}
+
+	createOrUpdate := recordingTestAction{"createorupdate", &arguments, unchangedMessage{"Unchanged: home.example.com → 203.0.113.1"}, nil}
+	environment := map[string]string{"DEE_DOMAIN": "example.com", "DEE_SUBDOMAIN": "home", "DEE_IP": "203.0.113.1", "DEE_WAIT": "1m", "DEE_NAMESERVERS": "ns1.example.net, ns2.example.net", "DEE_RESULT_FILE": "/results/dee.json"}
+	action, fs := getTestOneshotAction(environment, createOrUpdate, lookupHost)
+
+	// act
+	_, err := action.Execute(nil)
+
+	// assert
+	if err != nil {
+		t.Fatalf("Execute should succeed: %s", err.Error())
+	}
+
+	result := readTestOneshotResult(t, fs)
+	if result.Status != "unchanged" || result.ExitCode != 0 || result.Propagated == nil || !*result.Propagated || result.DurationMs != 10000 {
+		t.Fail()
+		t.Logf("The result should report the propagation after two polls but is %+v", result)
+	}
+}
+
+// The action should fail if the name servers do not return the new IP address in time.
+func Test_oneshotAction_Wait_NotPropagated_TimeoutIsReturned(t *testing.T) {
+	// arrange
+	var arguments []string
+	lookupHost := func(nameserver, host string) ([]string, error) {
+		return []string{"198.51.100.7"}, nil
+	}
+
+	createOrUpdate := recordingTestAction{"createorupdate", &arguments, successMessage{"Created: example.com → 203.0.113.1"}, nil}
+	environment := map[string]string{"DEE_DOMAIN": "example.com", "DEE_IP": "203.0.113.1", "DEE_WAIT": "30s", "DEE_NAMESERVERS": "ns1.example.net"}
+	action, _ := getTestOneshotAction(environment, createOrUpdate, lookupHost)
+
+	// act
+	_, err := action.Execute(nil)
+
+	// assert
+	if err == nil || getErrorExitCode(err) != exitCodePropagationTimeout || !strings.Contains(err.Error(), "ns1.example.net") {
+		t.Fail()
+		t.Logf("Execute should fail with the exit code %d but returned %v", exitCodePropagationTimeout, err)
+	}
+}
+
+// A record that already has the IP address (e.g. after the restart of an init container) should not fail the run.
+func Test_oneshotAction_RecordIsCurrent_ExitCodeIsZero(t *testing.T) {
+	// arrange
+	var arguments []string
+	createOrUpdate := recordingTestAction{"createorupdate", &arguments, unchangedMessage{"Unchanged: home.example.com → 203.0.113.1"}, nil}
+	environment := map[string]string{"DEE_DOMAIN": "example.com", "DEE_SUBDOMAIN": "home", "DEE_IP": "203.0.113.1", "DEE_RESULT_FILE": "/results/dee.json"}
+	action, fs := getTestOneshotAction(environment, createOrUpdate, nil)
+
+	// act
+	response, err := action.Execute(nil)
+
+	// assert
+	if err != nil || getExitCode(response) != 0 {
+		t.Fail()
+		t.Logf("Execute should succeed with the exit code 0 but returned %#v (error: %v)", response, err)
+	}
+
+	result := readTestOneshotResult(t, fs)
+	if result.Status != "unchanged" || result.ExitCode != 0 {
+		t.Fail()
+		t.Logf("The result should report the unchanged record with the exit code 0 but is %+v", result)
+	}
+}
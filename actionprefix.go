@@ -0,0 +1,230 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"net"
+	"os"
+	"strings"
+)
+
+var (
+	actionNamePrefix = "prefix"
+
+	prefixArguments       = flag.NewFlagSet(actionNamePrefix, flag.ContinueOnError)
+	prefixDomain          = prefixArguments.String("domain", "", "Domain (e.g. example.com)")
+	prefixDomains         = prefixArguments.String("domains", "", "Comma-separated list of domains or domain patterns (e.g. example.com,example.*)")
+	prefixSubdomains      = prefixArguments.String("subdomains", "", "Comma-separated list of the subdomains whose AAAA records follow the prefix (e.g. home,nas,@ for the root domain)")
+	prefixLength          = prefixArguments.Int("prefix-length", 56, "The length of the delegated IPv6 prefix in bits (e.g. 48, 56, 64)")
+	prefixIP              = prefixArguments.String("ip", "", "An IPv6 address of the new prefix (e.g. 2001:db8:2::1)")
+	prefixIPSource        = prefixArguments.String("ip-source", "", "IP source used if no IP address is given (e.g. interface:eth0,prefer-ipv6)")
+	prefixIPFromInterface = prefixArguments.String("ip-from-interface", "", "Network interface the global IPv6 address is taken from (e.g. eth0)")
+)
+
+type prefixAction struct {
+	clientFactory       dnsClientFactory
+	infoProviderFactory dnsInfoProviderCreator
+	stdin               *os.File
+	ipProviders         ipProviderRegistry
+}
+
+func (action prefixAction) Name() string {
+	return actionNamePrefix
+}
+
+func (action prefixAction) Description() string {
+	return "Move the AAAA records of a delegated IPv6 prefix to a new prefix"
+}
+
+func (action prefixAction) Usage() string {
+	buf := new(bytes.Buffer)
+	prefixArguments.SetOutput(buf)
+	prefixArguments.PrintDefaults()
+	return buf.String()
+}
+
+// Execute detects the current IPv6 prefix and points the AAAA records of the
+// given subdomains to it. Every record keeps its host suffix (interface identifier).
+func (action prefixAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*prefixDomain = ""
+	*prefixDomains = ""
+	*prefixSubdomains = ""
+	*prefixLength = 56
+	*prefixIP = ""
+	*prefixIPSource = ""
+	*prefixIPFromInterface = ""
+	if parseError := prefixArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	subdomains := getPrefixSubdomains(*prefixSubdomains)
+	if len(subdomains) == 0 {
+		return nil, fmt.Errorf("No subdomains supplied (e.g. -subdomains home,nas)")
+	}
+
+	if *prefixLength < 1 || *prefixLength > 127 {
+		return nil, fmt.Errorf("Invalid -prefix-length %d: the length must be between 1 and 127 bits", *prefixLength)
+	}
+
+	// domains
+	domains, domainsError := getTargetDomains(*prefixDomain, *prefixDomains, action.infoProviderFactory)
+	if domainsError != nil {
+		return nil, domainsError
+	}
+
+	// the new prefix (private addresses of the interface, e.g. in fd00::/8, are ignored)
+	ipSource, ipSourceError := getInterfaceIPSource(*prefixIPSource, *prefixIPFromInterface, "AAAA", false, *prefixIPFromInterface != "")
+	if ipSourceError != nil {
+		return nil, ipSourceError
+	}
+
+	ip, ipError := getIPAddress(*prefixIP, ipSource, action.ipProviders, action.stdin)
+	if ipError != nil {
+		return nil, ipError
+	}
+
+	if ip.To4() != nil {
+		return nil, fmt.Errorf("%s is not an IPv6 address", ip.String())
+	}
+
+	// all records are moved to the prefix, so a private or
+	// link-local prefix must never be published
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return nil, fmt.Errorf("%s is not a global IPv6 address", ip.String())
+	}
+
+	prefix := &net.IPNet{IP: ip.Mask(net.CIDRMask(*prefixLength, 128)), Mask: net.CIDRMask(*prefixLength, 128)}
+
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	return applyToDomains(domains, func(domain string) (message, error) {
+		records, recordsError := client.GetRecords(domain)
+		if recordsError != nil {
+			return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", domain, recordsError.Error())
+		}
+
+		changes, changesError := getPrefixChanges(records, subdomains, prefix)
+		if changesError != nil {
+			return nil, changesError
+		}
+
+		if len(changes) == 0 {
+			return unchangedMessage{fmt.Sprintf("Unchanged: the AAAA records of %s are in %s", domain, prefix.String())}, nil
+		}
+
+		var lines []string
+		for _, change := range changes {
+			id := fmt.Sprintf("%d", change.Previous.Id)
+			if _, updateError := client.UpdateRecord(domain, id, &dnsimple.ChangeRecord{Value: change.Current.Content}); updateError != nil {
+				return nil, fmt.Errorf("%sUpdating %s failed: %s", formatPrefixLines(lines), getFormattedDomainName(change.Current.Name, domain), updateError.Error())
+			}
+
+			lines = append(lines, "Updated: "+strings.TrimPrefix(change.String(domain), recordChangeChanged+": "))
+		}
+
+		return changeMessage{strings.Join(lines, "\n"), len(changes)}, nil
+	})
+}
+
+// getPrefixSubdomains returns the subdomains of the given comma-separated
+// list. The root domain can be given as "@".
+func getPrefixSubdomains(list string) []string {
+	var subdomains []string
+	for _, subdomain := range strings.Split(list, ",") {
+		subdomain = strings.TrimSpace(subdomain)
+		if subdomain == "" {
+			continue
+		}
+
+		if subdomain == "@" {
+			subdomain = ""
+		}
+
+		subdomains = append(subdomains, subdomain)
+	}
+
+	return subdomains
+}
+
+// getPrefixChanges returns the AAAA records of the given subdomains whose address
+// is not in the given prefix, with the address moved to the prefix. An error is
+// returned if one of the subdomains has no AAAA record.
+func getPrefixChanges(records []dnsimple.Record, subdomains []string, prefix *net.IPNet) ([]recordChange, error) {
+	var changes []recordChange
+	var missing []string
+
+	for _, subdomain := range subdomains {
+		found := false
+		for _, record := range records {
+			if record.RecordType != "AAAA" || record.Name != subdomain {
+				continue
+			}
+
+			found = true
+			address := net.ParseIP(record.Content)
+			if address == nil {
+				return nil, fmt.Errorf("The AAAA record %d contains no IPv6 address: %q", record.Id, record.Content)
+			}
+
+			moved := replaceIPv6Prefix(address, prefix)
+			if moved.Equal(address) {
+				continue
+			}
+
+			updated := record
+			updated.Content = moved.String()
+			changes = append(changes, recordChange{Kind: recordChangeChanged, Previous: record, Current: updated})
+		}
+
+		if !found {
+			if subdomain == "" {
+				subdomain = "@"
+			}
+
+			missing = append(missing, subdomain)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("No AAAA records found for %s", strings.Join(missing, ", "))
+	}
+
+	return changes, nil
+}
+
+// replaceIPv6Prefix returns the given address with the network bits of the
+// given prefix and its own host bits (e.g. 2001:db8:1::10 in 2001:db8:2::/56
+// becomes 2001:db8:2::10).
+func replaceIPv6Prefix(address net.IP, prefix *net.IPNet) net.IP {
+	address, network := address.To16(), prefix.IP.To16()
+	moved := make(net.IP, net.IPv6len)
+	for index := range moved {
+		moved[index] = network[index] | (address[index] &^ prefix.Mask[index])
+	}
+
+	return moved
+}
+
+// formatPrefixLines returns the given lines followed by a line break.
+func formatPrefixLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
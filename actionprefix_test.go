@@ -0,0 +1,131 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/pearkes/dnsimple"
+	"net"
+	"strings"
+	"testing"
+)
+
+// getPrefixTestRecords returns the records of a home network in the prefix 2001:db8:1::/56.
+func getPrefixTestRecords() map[string][]dnsimple.Record {
+	return map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "home", RecordType: "AAAA", Content: "2001:db8:1:0:21a:2bff:fe3c:4d5e", Ttl: 60},
+			{Id: 2, Name: "nas", RecordType: "AAAA", Content: "2001:db8:1:10::20", Ttl: 60},
+			{Id: 3, Name: "nas", RecordType: "A", Content: "203.0.113.1", Ttl: 60},
+			{Id: 4, Name: "www", RecordType: "AAAA", Content: "2001:db8:ffff::1", Ttl: 3600},
+		},
+	}
+}
+
+// prefixAction.Execute should move the AAAA records of the given subdomains to the new
+// prefix and keep their host suffixes; other records should not be changed.
+func Test_prefixAction_NewPrefix_RecordsKeepTheirSuffix(t *testing.T) {
+	// arrange
+	records := getPrefixTestRecords()
+	action := prefixAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, nil, nil, nil}
+	arguments := []string{"-domain", "example.com", "-subdomains", "home,nas", "-ip", "2001:db8:2:0:21a:2bff:fe3c:4d5e"}
+
+	// act
+	result, err := action.Execute(arguments)
+
+	// assert
+	if err != nil || getChangeSummary(result).Records != 2 {
+		t.Fatalf("prefixAction.Execute(%q) should update two records but returned %v (%v)", arguments, result, err)
+	}
+
+	expected := []string{"2001:db8:2:0:21a:2bff:fe3c:4d5e", "2001:db8:2:10::20", "203.0.113.1", "2001:db8:ffff::1"}
+	for index, record := range records["example.com"] {
+		if record.Content != expected[index] {
+			t.Fail()
+			t.Logf("The content of record %d should be %q but is %q", record.Id, expected[index], record.Content)
+		}
+	}
+
+	if !strings.Contains(result.Text(), "nas.example.com AAAA 2001:db8:1:10::20 → 2001:db8:2:10::20") {
+		t.Fail()
+		t.Logf("The result should list the changed records: %q", result.Text())
+	}
+}
+
+// prefixAction.Execute should return an unchanged message if the records are already in the prefix.
+func Test_prefixAction_SamePrefix_UnchangedMessageIsReturned(t *testing.T) {
+	// arrange
+	action := prefixAction{testDNSClientFactory{newInMemoryTestDNSClient(getPrefixTestRecords()), nil}, nil, nil, nil}
+	arguments := []string{"-domain", "example.com", "-subdomains", "home,nas", "-ip", "2001:db8:1:20::1"}
+
+	// act
+	result, err := action.Execute(arguments)
+
+	// assert
+	if _, isUnchanged := result.(unchangedMessage); err != nil || !isUnchanged {
+		t.Fail()
+		t.Logf("prefixAction.Execute(%q) should return an unchanged message but returned %v (%v)", arguments, result, err)
+	}
+}
+
+// prefixAction.Execute should return an error for invalid arguments and missing records.
+func Test_prefixAction_InvalidArguments_ErrorIsReturned(t *testing.T) {
+	inputs := [][]string{
+		{"-domain", "example.com", "-ip", "2001:db8:2::1"},
+		{"-domain", "example.com", "-subdomains", "home", "-ip", "203.0.113.2"},
+		{"-domain", "example.com", "-subdomains", "home", "-ip", "2001:db8:2::1", "-prefix-length", "128"},
+		{"-domain", "example.com", "-subdomains", "home,printer", "-ip", "2001:db8:2::1"},
+		{"-subdomains", "home", "-ip", "2001:db8:2::1"},
+		{"-domain", "example.com", "-subdomains", "home", "-ip", "fd00:1:2::1"},
+		{"-domain", "example.com", "-subdomains", "home", "-ip", "fe80::1"},
+	}
+
+	for _, arguments := range inputs {
+		// arrange
+		records := getPrefixTestRecords()
+		action := prefixAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, nil, nil, nil}
+
+		// act
+		_, err := action.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("prefixAction.Execute(%q) should return an error", arguments)
+		}
+
+		if records["example.com"][0].Content != "2001:db8:1:0:21a:2bff:fe3c:4d5e" {
+			t.Fail()
+			t.Logf("prefixAction.Execute(%q) should not change any record", arguments)
+		}
+	}
+}
+
+// replaceIPv6Prefix should combine the network bits of the prefix with the host bits of the address.
+func Test_replaceIPv6Prefix(t *testing.T) {
+	inputs := []struct {
+		address  string
+		prefix   string
+		expected string
+	}{
+		{"2001:db8:1::10", "2001:db8:2::/56", "2001:db8:2::10"},
+		{"2001:db8:1:ab::10", "2001:db8:2:ff00::/56", "2001:db8:2:ffab::10"},
+		{"2001:db8:1:ab::10", "2001:db8:2:cd::/64", "2001:db8:2:cd::10"},
+		{"2001:db8:1:ab::10", "2a00:1:2::/48", "2a00:1:2:ab::10"},
+	}
+
+	for _, input := range inputs {
+		// arrange
+		_, prefix, _ := net.ParseCIDR(input.prefix)
+
+		// act
+		result := replaceIPv6Prefix(net.ParseIP(input.address), prefix)
+
+		// assert
+		if result.String() != input.expected {
+			t.Fail()
+			t.Logf("replaceIPv6Prefix(%q, %q) returned %q instead of %q", input.address, input.prefix, result, input.expected)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	actionNamePreview = "preview"
+
+	previewCreateArguments = flag.NewFlagSet(actionNamePreview+" create", flag.ContinueOnError)
+	previewCreateDomain    = previewCreateArguments.String("domain", "", "Domain (e.g. example.com)")
+	previewCreateBase      = previewCreateArguments.String("base", "preview", "The subdomain below which the preview records are created")
+	previewCreateIP        = previewCreateArguments.String("ip", "", "IP address of the review app (e.g. 203.0.113.1)")
+	previewCreateIPSource  = previewCreateArguments.String("ip-source", "", "IP source used if no IP address is given (e.g. http, command:/path/to/script)")
+	previewCreateTTL       = previewCreateArguments.Int("ttl", 60, "The time to live in seconds")
+	previewCreateExpiresIn = previewCreateArguments.String("expires-in", "14d", "Delete the record with \"gc\" if the branch is not deployed again within the given period (empty: never)")
+
+	previewDeleteArguments = flag.NewFlagSet(actionNamePreview+" delete", flag.ContinueOnError)
+	previewDeleteDomain    = previewDeleteArguments.String("domain", "", "Domain (e.g. example.com)")
+	previewDeleteBase      = previewDeleteArguments.String("base", "preview", "The subdomain below which the preview records are created")
+
+	previewCleanupArguments = flag.NewFlagSet(actionNamePreview+" cleanup", flag.ContinueOnError)
+	previewCleanupDomain    = previewCleanupArguments.String("domain", "", "Domain (e.g. example.com)")
+	previewCleanupBase      = previewCleanupArguments.String("base", "preview", "The subdomain below which the preview records are created")
+	previewCleanupBranches  = previewCleanupArguments.String("branches", "", "Comma-separated list of the active branches whose records are kept (e.g. main,feature/login)")
+	previewCleanupApply     = previewCleanupArguments.Bool("apply", false, "Delete the records of stale branches instead of only previewing them")
+)
+
+// invalidLabelCharacters matches the characters that are not allowed in DNS labels.
+var invalidLabelCharacters = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// maxLabelLength is the maximum length of a DNS label.
+const maxLabelLength = 63
+
+type previewAction struct {
+	clientFactory dnsClientFactory
+	metadata      metadataStore
+	stdin         *os.File
+	ipProviders   ipProviderRegistry
+	ttlPolicy     ttlPolicyProvider
+}
+
+func (action previewAction) Name() string {
+	return actionNamePreview
+}
+
+func (action previewAction) Description() string {
+	return "Manage the address records of preview environments of branches"
+}
+
+func (action previewAction) Usage() string {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "  %s create <branch> [arguments ...]\n", actionNamePreview)
+	previewCreateArguments.SetOutput(buf)
+	previewCreateArguments.PrintDefaults()
+
+	fmt.Fprintf(buf, "\n  %s delete <branch> [arguments ...]\n", actionNamePreview)
+	previewDeleteArguments.SetOutput(buf)
+	previewDeleteArguments.PrintDefaults()
+
+	fmt.Fprintf(buf, "\n  %s cleanup [arguments ...]\n", actionNamePreview)
+	previewCleanupArguments.SetOutput(buf)
+	previewCleanupArguments.PrintDefaults()
+
+	return buf.String()
+}
+
+// Execute runs the given preview sub command ("create", "delete" or "cleanup").
+func (action previewAction) Execute(arguments []string) (message, error) {
+	if len(arguments) == 0 {
+		return nil, fmt.Errorf("No sub command supplied (create, delete, cleanup)")
+	}
+
+	switch arguments[0] {
+	case "create":
+		return action.create(arguments[1:])
+
+	case "delete":
+		return action.delete(arguments[1:])
+
+	case "cleanup":
+		return action.cleanup(arguments[1:])
+	}
+
+	return nil, fmt.Errorf("Unknown sub command: %q", arguments[0])
+}
+
+// create points the preview record of the given branch to the given IP and
+// extends its expiry time. The record is created if it does not exist yet.
+func (action previewAction) create(arguments []string) (message, error) {
+
+	// parse the arguments
+	*previewCreateDomain = ""
+	*previewCreateBase = "preview"
+	*previewCreateIP = ""
+	*previewCreateIPSource = ""
+	*previewCreateTTL = 60
+	*previewCreateExpiresIn = "14d"
+	branch, parseError := parseBranchArguments(previewCreateArguments, arguments)
+	if parseError != nil {
+		return nil, parseError
+	}
+
+	if isEmpty(*previewCreateDomain) {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	name, nameError := getPreviewRecordName(branch, *previewCreateBase)
+	if nameError != nil {
+		return nil, nameError
+	}
+
+	ttl, ttlError := applyTTLPolicy(action.ttlPolicy, actionNamePreview+" create", true, *previewCreateTTL, arguments)
+	if ttlError != nil {
+		return nil, ttlError
+	}
+
+	expiresIn, expiresInError := getExpiresIn(*previewCreateExpiresIn, action.metadata)
+	if expiresInError != nil {
+		return nil, expiresInError
+	}
+
+	ip, ipError := getIPAddress(*previewCreateIP, *previewCreateIPSource, action.ipProviders, action.stdin)
+	if ipError != nil {
+		return nil, ipError
+	}
+
+	recordType := getDNSRecordTypeByIP(ip)
+	if validationError := validateRecordArguments(name, recordType, ip.String(), ttl, recordArguments{"", "-ip", "-ttl"}); validationError != nil {
+		return nil, validationError
+	}
+
+	client, clientError := action.createClient()
+	if clientError != nil {
+		return nil, clientError
+	}
+
+	existing, exists, findError := findRecord(client, *previewCreateDomain, name, recordType)
+	if findError != nil {
+		return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", *previewCreateDomain, findError.Error())
+	}
+
+	fqdn := getFormattedDomainName(name, *previewCreateDomain)
+
+	var result message
+	var recordID string
+	if exists {
+		recordID = fmt.Sprintf("%d", existing.Id)
+		// repeated deployments of a branch must not fail the pipeline
+		result = successMessage{fmt.Sprintf("Unchanged: %s → %s", fqdn, ip.String())}
+
+		if existing.Content != ip.String() {
+			if _, updateError := client.UpdateRecord(*previewCreateDomain, recordID, &dnsimple.ChangeRecord{Value: ip.String()}); updateError != nil {
+				return nil, fmt.Errorf("%s", updateError.Error())
+			}
+
+			result = changeMessage{fmt.Sprintf("Updated: %s → %s", fqdn, ip.String()), 1}
+		}
+
+	} else {
+		if _, conflictError := resolveConflicts(client, *previewCreateDomain, name, recordType, false); conflictError != nil {
+			return nil, conflictError
+		}
+
+		id, createError := client.CreateRecord(*previewCreateDomain, &dnsimple.ChangeRecord{Name: name, Type: recordType, Value: ip.String(), Ttl: fmt.Sprintf("%d", ttl)})
+		if createError != nil {
+			return nil, fmt.Errorf("%s", createError.Error())
+		}
+
+		recordID = id
+		result = changeMessage{fmt.Sprintf("Created: %s → %s", fqdn, ip.String()), 1}
+	}
+
+	if expiresIn == 0 {
+		return result, nil
+	}
+
+	// every deployment extends the lifetime of the record
+	expiry, expiryError := markRecordAsTemporary(action.metadata, *previewCreateDomain, recordID, expiresIn)
+	if expiryError != nil {
+		return nil, fmt.Errorf("%s\n%s", result.Text(), expiryError.Error())
+	}
+
+	switch result := result.(type) {
+	case changeMessage:
+		return changeMessage{result.text + expiry, result.changedRecords}, nil
+
+	case successMessage:
+		return successMessage{result.text + expiry}, nil
+	}
+
+	return result, nil
+}
+
+// delete deletes the preview records of the given branch.
+func (action previewAction) delete(arguments []string) (message, error) {
+
+	// parse the arguments
+	*previewDeleteDomain = ""
+	*previewDeleteBase = "preview"
+	branch, parseError := parseBranchArguments(previewDeleteArguments, arguments)
+	if parseError != nil {
+		return nil, parseError
+	}
+
+	if isEmpty(*previewDeleteDomain) {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	name, nameError := getPreviewRecordName(branch, *previewDeleteBase)
+	if nameError != nil {
+		return nil, nameError
+	}
+
+	client, clientError := action.createClient()
+	if clientError != nil {
+		return nil, clientError
+	}
+
+	records, recordsError := client.GetRecords(*previewDeleteDomain)
+	if recordsError != nil {
+		return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", *previewDeleteDomain, recordsError.Error())
+	}
+
+	var deletions []dnsimple.Record
+	for _, record := range records {
+		if record.Name == name && isAddressRecordType(record.RecordType) {
+			deletions = append(deletions, record)
+		}
+	}
+
+	if len(deletions) == 0 {
+		return successMessage{fmt.Sprintf("Unchanged: %s has no preview records", getFormattedDomainName(name, *previewDeleteDomain))}, nil
+	}
+
+	return action.deleteRecords(client, *previewDeleteDomain, deletions)
+}
+
+// cleanup deletes the preview records of all branches that are not in the given list of active branches.
+func (action previewAction) cleanup(arguments []string) (message, error) {
+
+	// parse the arguments
+	*previewCleanupDomain = ""
+	*previewCleanupBase = "preview"
+	*previewCleanupBranches = ""
+	*previewCleanupApply = false
+	if parseError := previewCleanupArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if isEmpty(*previewCleanupDomain) {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	if !isFlagGiven(arguments, "branches") {
+		return nil, fmt.Errorf("No active branches supplied (e.g. -branches main,develop)")
+	}
+
+	active := make(map[string]bool)
+	for _, branch := range strings.Split(*previewCleanupBranches, ",") {
+		if strings.TrimSpace(branch) == "" {
+			continue
+		}
+
+		name, nameError := getPreviewRecordName(branch, *previewCleanupBase)
+		if nameError != nil {
+			return nil, nameError
+		}
+
+		active[name] = true
+	}
+
+	client, clientError := action.createClient()
+	if clientError != nil {
+		return nil, clientError
+	}
+
+	records, recordsError := client.GetRecords(*previewCleanupDomain)
+	if recordsError != nil {
+		return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", *previewCleanupDomain, recordsError.Error())
+	}
+
+	base := strings.Trim(strings.ToLower(*previewCleanupBase), ".")
+	var stale []dnsimple.Record
+	for _, record := range records {
+		if !isAddressRecordType(record.RecordType) || active[record.Name] {
+			continue
+		}
+
+		// only the records directly below the base (e.g. "feature-x.preview")
+		label := strings.TrimSuffix(record.Name, "."+base)
+		if label == record.Name || label == "" || strings.Contains(label, ".") {
+			continue
+		}
+
+		stale = append(stale, record)
+	}
+
+	sort.SliceStable(stale, func(i, j int) bool { return stale[i].Name < stale[j].Name })
+
+	if len(stale) == 0 {
+		return successMessage{fmt.Sprintf("No stale preview records below %s", getFormattedDomainName(base, *previewCleanupDomain))}, nil
+	}
+
+	if !*previewCleanupApply {
+		preview := new(bytes.Buffer)
+		for _, record := range stale {
+			fmt.Fprintf(preview, "Delete: %s %s %s\n", getFormattedDomainName(record.Name, *previewCleanupDomain), record.RecordType, record.Content)
+		}
+
+		fmt.Fprintf(preview, "Run again with -apply to delete %d records", len(stale))
+		return successMessage{preview.String()}, nil
+	}
+
+	return action.deleteRecords(client, *previewCleanupDomain, stale)
+}
+
+// deleteRecords deletes the given records and forgets their metadata.
+func (action previewAction) deleteRecords(client deens.DNSClient, domain string, records []dnsimple.Record) (message, error) {
+	var lines []string
+	for index, record := range records {
+		if deleteError := client.DestroyRecord(domain, fmt.Sprintf("%d", record.Id)); deleteError != nil {
+			return nil, fmt.Errorf("Deleted %d of %d records. %s failed: %s", index, len(records), getFormattedDomainName(record.Name, domain), deleteError.Error())
+		}
+
+		if action.metadata != nil {
+			if forgetError := action.metadata.SetMetadata(recordMetadata{Domain: domain, RecordID: record.Id}); forgetError != nil {
+				return nil, forgetError
+			}
+		}
+
+		lines = append(lines, fmt.Sprintf("Deleted: %s %s %s", getFormattedDomainName(record.Name, domain), record.RecordType, record.Content))
+	}
+
+	return changeMessage{strings.Join(lines, "\n"), len(records)}, nil
+}
+
+// createClient returns a new DNS client.
+func (action previewAction) createClient() (deens.DNSClient, error) {
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	return client, nil
+}
+
+// parseBranchArguments parses the given arguments of a sub command whose first
+// positional argument is the branch name (e.g. "feature/login -domain example.com").
+func parseBranchArguments(arguments *flag.FlagSet, values []string) (string, error) {
+	if parseError := arguments.Parse(values); parseError != nil {
+		return "", parseError
+	}
+
+	branch := arguments.Arg(0)
+	if arguments.NArg() > 0 {
+		// the flags that follow the branch
+		if parseError := arguments.Parse(arguments.Args()[1:]); parseError != nil {
+			return "", parseError
+		}
+	}
+
+	if isEmpty(branch) {
+		return "", fmt.Errorf("No branch supplied")
+	}
+
+	return branch, nil
+}
+
+// getPreviewRecordName returns the record name of the preview environment of
+// the given branch below the given base (e.g. "feature-login.preview").
+func getPreviewRecordName(branch, base string) (string, error) {
+	label := sanitizeBranchName(branch)
+	if label == "" {
+		return "", fmt.Errorf("The branch name %q contains no characters that are allowed in a DNS name", branch)
+	}
+
+	base = strings.Trim(strings.ToLower(strings.TrimSpace(base)), ".")
+	if base == "" {
+		return label, nil
+	}
+
+	return label + "." + base, nil
+}
+
+// sanitizeBranchName returns the given branch name as a DNS label: lower-case
+// letters, digits and hyphens (e.g. "Feature/JIRA-123_login" becomes
+// "feature-jira-123-login"). Names longer than 63 characters are shortened
+// and get a hash suffix so that different branches keep different names.
+func sanitizeBranchName(branch string) string {
+	label := invalidLabelCharacters.ReplaceAllString(strings.ToLower(strings.TrimSpace(branch)), "-")
+	label = strings.Trim(label, "-")
+	for strings.Contains(label, "--") {
+		label = strings.Replace(label, "--", "-", -1)
+	}
+
+	if len(label) <= maxLabelLength {
+		return label
+	}
+
+	hash := sha1.Sum([]byte(branch))
+	suffix := hex.EncodeToString(hash[:])[:8]
+	return strings.TrimRight(label[:maxLabelLength-len(suffix)-1], "-") + "-" + suffix
+}
+
+// isAddressRecordType returns true for "A" and "AAAA".
+func isAddressRecordType(recordType string) bool {
+	return recordType == "A" || recordType == "AAAA"
+}
@@ -0,0 +1,202 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"strings"
+	"testing"
+)
+
+// getPreviewTestAction returns a preview action for the given records with an in-memory state file.
+func getPreviewTestAction(records map[string][]dnsimple.Record) (previewAction, filesystemMetadataStore) {
+	metadata := filesystemMetadataStore{afero.NewMemMapFs(), "/state.json"}
+	return previewAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, metadata, nil, nil, nil}, metadata
+}
+
+// sanitizeBranchName should return valid DNS labels.
+func Test_sanitizeBranchName(t *testing.T) {
+	inputs := []struct {
+		branch   string
+		expected string
+	}{
+		{"main", "main"},
+		{"Feature/JIRA-123_login", "feature-jira-123-login"},
+		{"--fix//double--dash--", "fix-double-dash"},
+		{"dependabot/npm_and_yarn/lodash-4.17.21", "dependabot-npm-and-yarn-lodash-4-17-21"},
+		{"ü/ö", ""},
+	}
+
+	for _, input := range inputs {
+		// act
+		result := sanitizeBranchName(input.branch)
+
+		// assert
+		if result != input.expected {
+			t.Fail()
+			t.Logf("sanitizeBranchName(%q) returned %q instead of %q", input.branch, result, input.expected)
+		}
+	}
+}
+
+// sanitizeBranchName should shorten long branch names and keep them distinct.
+func Test_sanitizeBranchName_LongNames_NamesAreShortenedAndDistinct(t *testing.T) {
+	// arrange
+	prefix := strings.Repeat("very-long-branch-name-", 5)
+
+	// act
+	first, second := sanitizeBranchName(prefix+"one"), sanitizeBranchName(prefix+"two")
+
+	// assert
+	if len(first) > maxLabelLength || len(second) > maxLabelLength || first == second {
+		t.Fail()
+		t.Logf("The names should be at most %d characters long and distinct: %q, %q", maxLabelLength, first, second)
+	}
+}
+
+// preview create should create the record of the branch, update it on the
+// next deployment and record an expiry time.
+func Test_previewAction_Create_RecordIsCreatedAndUpdated(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{}
+	action, metadata := getPreviewTestAction(records)
+
+	// act
+	created, createError := action.Execute([]string{"create", "feature/login", "-domain", "example.com", "-ip", "203.0.113.1"})
+	updated, updateError := action.Execute([]string{"create", "feature/login", "-domain", "example.com", "-ip", "203.0.113.2"})
+
+	// assert
+	if createError != nil || updateError != nil {
+		t.Fatalf("preview create returned an error: %v, %v", createError, updateError)
+	}
+
+	if len(records["example.com"]) != 1 || records["example.com"][0].Name != "feature-login.preview" || records["example.com"][0].Content != "203.0.113.2" {
+		t.Fail()
+		t.Logf("There should be one updated record for the branch: %#v", records["example.com"])
+	}
+
+	if !strings.HasPrefix(created.Text(), "Created: feature-login.preview.example.com → 203.0.113.1") || !strings.HasPrefix(updated.Text(), "Updated:") {
+		t.Fail()
+		t.Logf("Unexpected results: %q, %q", created.Text(), updated.Text())
+	}
+
+	stored, _ := metadata.GetMetadata("example.com")
+	if stored[records["example.com"][0].Id].ExpiresAt == nil {
+		t.Fail()
+		t.Logf("The preview record should expire")
+	}
+}
+
+// preview delete should delete the records of the branch.
+func Test_previewAction_Delete_RecordsAreDeleted(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "feature-login.preview", RecordType: "A", Content: "203.0.113.1"},
+			{Id: 2, Name: "feature-login.preview", RecordType: "AAAA", Content: "2001:db8::1"},
+			{Id: 3, Name: "main.preview", RecordType: "A", Content: "203.0.113.3"},
+		},
+	}
+
+	action, _ := getPreviewTestAction(records)
+
+	// act
+	result, err := action.Execute([]string{"delete", "Feature/Login", "-domain", "example.com"})
+
+	// assert
+	if err != nil || getChangeSummary(result).Records != 2 || len(records["example.com"]) != 1 {
+		t.Fail()
+		t.Logf("preview delete should delete the two records of the branch but returned %v (%v)", result, err)
+	}
+}
+
+// preview cleanup should delete the records of branches that are not active.
+func Test_previewAction_Cleanup_StaleRecordsAreDeleted(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "feature-login.preview", RecordType: "A", Content: "203.0.113.1"},
+			{Id: 2, Name: "old-branch.preview", RecordType: "A", Content: "203.0.113.2"},
+			{Id: 3, Name: "main.preview", RecordType: "A", Content: "203.0.113.3"},
+			{Id: 4, Name: "preview", RecordType: "A", Content: "203.0.113.4"},
+			{Id: 5, Name: "www", RecordType: "A", Content: "203.0.113.5"},
+			{Id: 6, Name: "old-branch.preview", RecordType: "TXT", Content: "owner=ci"},
+		},
+	}
+
+	action, _ := getPreviewTestAction(records)
+	arguments := []string{"cleanup", "-domain", "example.com", "-branches", "main,feature/login"}
+
+	// act
+	preview, previewError := action.Execute(arguments)
+	result, err := action.Execute(append(arguments, "-apply"))
+
+	// assert
+	if previewError != nil || !strings.Contains(preview.Text(), "Delete: old-branch.preview.example.com A 203.0.113.2") {
+		t.Fail()
+		t.Logf("The preview should list the stale record: %v (%v)", preview, previewError)
+	}
+
+	if err != nil || getChangeSummary(result).Records != 1 || len(records["example.com"]) != 5 {
+		t.Fail()
+		t.Logf("Only the address record of the stale branch should have been deleted: %v (%v)", result, err)
+	}
+}
+
+// Repeated pipeline runs that have nothing to change should exit with code 0.
+func Test_previewAction_NothingToChange_ExitCodeIsZero(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "main.preview", RecordType: "A", Content: "203.0.113.1", Ttl: 60},
+		},
+	}
+
+	action, _ := getPreviewTestAction(records)
+	argumentsSet := [][]string{
+		{"create", "main", "-domain", "example.com", "-ip", "203.0.113.1"},
+		{"create", "main", "-domain", "example.com", "-ip", "203.0.113.1", "-expires-in", ""},
+		{"delete", "feature/login", "-domain", "example.com"},
+		{"cleanup", "-domain", "example.com", "-branches", "main", "-apply"},
+	}
+
+	for _, arguments := range argumentsSet {
+		// act
+		result, err := action.Execute(arguments)
+
+		// assert
+		if err != nil || getExitCode(result) != 0 || len(records["example.com"]) != 1 {
+			t.Fail()
+			t.Logf("preview %q should succeed without changes but returned %#v (%v)", arguments, result, err)
+		}
+	}
+}
+
+// The preview sub commands should return an error for missing arguments.
+func Test_previewAction_MissingArguments_ErrorIsReturned(t *testing.T) {
+	inputs := [][]string{
+		{},
+		{"create", "-domain", "example.com", "-ip", "203.0.113.1"},
+		{"create", "feature/login", "-ip", "203.0.113.1"},
+		{"create", "ü", "-domain", "example.com", "-ip", "203.0.113.1"},
+		{"delete", "-domain", "example.com"},
+		{"cleanup", "-domain", "example.com"},
+	}
+
+	for _, arguments := range inputs {
+		// arrange
+		action, _ := getPreviewTestAction(map[string][]dnsimple.Record{})
+
+		// act
+		_, err := action.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("previewAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
@@ -0,0 +1,722 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"net"
+	"strings"
+)
+
+var (
+	actionNameRecord = "record"
+
+	recordCreateArguments   = flag.NewFlagSet(actionNameRecord+" create", flag.ContinueOnError)
+	recordCreateDomain      = recordCreateArguments.String("domain", "", "Domain (e.g. example.com)")
+	recordCreateSubdomain   = recordCreateArguments.String("subdomain", "", "Subdomain (e.g. www)")
+	recordCreateType        = recordCreateArguments.String("type", "", "The record type (e.g. \"TXT\", \"NAPTR\", \"HINFO\", \"POOL\")")
+	recordCreateContent     = recordCreateArguments.String("content", "", "The raw record content (not required for NAPTR, HINFO and POOL records)")
+	recordCreateTTL         = recordCreateArguments.Int("ttl", defaultTTL, "The time to live in seconds")
+	recordCreateOrder       = recordCreateArguments.Int("order", 0, "NAPTR: The order in which the records must be processed")
+	recordCreatePreference  = recordCreateArguments.Int("preference", 0, "NAPTR: The preference of records with the same order")
+	recordCreateFlags       = recordCreateArguments.String("flags", "", "NAPTR: The flags (e.g. \"U\", \"S\")")
+	recordCreateService     = recordCreateArguments.String("service", "", "NAPTR: The service parameters (e.g. \"E2U+sip\")")
+	recordCreateRegexp      = recordCreateArguments.String("regexp", "", "NAPTR: The substitution expression (e.g. \"!^.*$!sip:info@example.com!\")")
+	recordCreateReplacement = recordCreateArguments.String("replacement", ".", "NAPTR: The replacement domain name")
+	recordCreateCPU         = recordCreateArguments.String("cpu", "", "HINFO: The CPU type (e.g. \"ARMV7\")")
+	recordCreateOS          = recordCreateArguments.String("os", "", "HINFO: The operating system (e.g. \"LINUX\")")
+	recordCreateTarget      = recordCreateArguments.String("target", "", "POOL: The hostname of the pool member (e.g. \"a.example.com\")")
+	recordCreateConflicts   = recordCreateArguments.Bool("replace-conflicting", false, "Delete records that conflict with the new record (e.g. a CNAME record of the same name)")
+	recordCreateExpiresIn   = recordCreateArguments.String("expires-in", "", "Create a temporary record that \"gc\" deletes after the given period (e.g. 24h, 7d)")
+
+	recordUpdateArguments = flag.NewFlagSet(actionNameRecord+" update", flag.ContinueOnError)
+	recordUpdateDomain    = recordUpdateArguments.String("domain", "", "Domain (e.g. example.com)")
+	recordUpdateID        = recordUpdateArguments.Int64("id", 0, "The ID of the record (e.g. from \"dee list -format json\")")
+	recordUpdateContent   = recordUpdateArguments.String("content", "", "The new raw record content (default: unchanged)")
+	recordUpdateTTL       = recordUpdateArguments.Int("ttl", 0, "The new time to live in seconds (default: unchanged)")
+
+	recordDeleteArguments = flag.NewFlagSet(actionNameRecord+" delete", flag.ContinueOnError)
+	recordDeleteDomain    = recordDeleteArguments.String("domain", "", "Domain (e.g. example.com)")
+	recordDeleteID        = recordDeleteArguments.Int64("id", 0, "The ID of the record (e.g. from \"dee list -format json\")")
+
+	recordReplaceArguments  = flag.NewFlagSet(actionNameRecord+" replace-content", flag.ContinueOnError)
+	recordReplaceDomain     = recordReplaceArguments.String("domain", "", "Domain (e.g. example.com)")
+	recordReplaceDomains    = recordReplaceArguments.String("domains", "", "Comma-separated list of domains or domain patterns (e.g. example.com,example.*)")
+	recordReplaceAllDomains = recordReplaceArguments.Bool("all-domains", false, "Search the records of all domains of the account")
+	recordReplaceFrom       = recordReplaceArguments.String("from", "", "The old IP address (e.g. 203.0.113.1)")
+	recordReplaceTo         = recordReplaceArguments.String("to", "", "The new IP address (e.g. 198.51.100.1)")
+	recordReplaceLabel      = recordReplaceArguments.String("label", "", "Only replace the content of records with the given labels (e.g. env=prod)")
+	recordReplaceApply      = recordReplaceArguments.Bool("apply", false, "Update the records instead of only previewing the changes")
+
+	recordLabelArguments = flag.NewFlagSet(actionNameRecord+" label", flag.ContinueOnError)
+	recordLabelDomain    = recordLabelArguments.String("domain", "", "Domain (e.g. example.com)")
+	recordLabelID        = recordLabelArguments.Int64("id", 0, "The ID of the record (e.g. from \"dee list -format json\")")
+	recordLabelLabels    = recordLabelArguments.String("label", "", "Labels that are added to the record (e.g. env=prod,team=web)")
+	recordLabelRemove    = recordLabelArguments.String("remove", "", "Names of labels that are removed from the record (e.g. env,team)")
+	recordLabelNote      = recordLabelArguments.String("note", "", "A free-form note (an empty note removes the note)")
+	recordLabelClear     = recordLabelArguments.Bool("clear", false, "Remove all labels and the note of the record")
+
+	recordEditArguments = flag.NewFlagSet(actionNameRecord+" edit", flag.ContinueOnError)
+	recordEditDomain    = recordEditArguments.String("domain", "", "Domain (e.g. example.com)")
+	recordEditSubdomain = recordEditArguments.String("subdomain", "", "Subdomain (e.g. www)")
+	recordEditType      = recordEditArguments.String("type", "", "Only edit a record of the given type (e.g. TXT)")
+	recordEditID        = recordEditArguments.Int64("id", 0, "The ID of the record (e.g. from \"dee list -format json\")")
+)
+
+type recordAction struct {
+	clientFactory dnsClientFactory
+	metadata      metadataStore
+	ttlPolicy     ttlPolicyProvider
+
+	// editFile opens the given file in the editor of the user
+	// and returns when the editor was closed.
+	editFile func(filePath string) error
+}
+
+func (action recordAction) Name() string {
+	return actionNameRecord
+}
+
+func (action recordAction) Description() string {
+	return "Manage DNS records of any type"
+}
+
+func (action recordAction) Usage() string {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "  %s create [arguments ...]\n", actionNameRecord)
+	recordCreateArguments.SetOutput(buf)
+	recordCreateArguments.PrintDefaults()
+
+	fmt.Fprintf(buf, "\n  %s update [arguments ...]\n", actionNameRecord)
+	recordUpdateArguments.SetOutput(buf)
+	recordUpdateArguments.PrintDefaults()
+
+	fmt.Fprintf(buf, "\n  %s delete [arguments ...]\n", actionNameRecord)
+	recordDeleteArguments.SetOutput(buf)
+	recordDeleteArguments.PrintDefaults()
+
+	fmt.Fprintf(buf, "\n  %s replace-content [arguments ...]\n", actionNameRecord)
+	recordReplaceArguments.SetOutput(buf)
+	recordReplaceArguments.PrintDefaults()
+
+	fmt.Fprintf(buf, "\n  %s label [arguments ...]\n", actionNameRecord)
+	recordLabelArguments.SetOutput(buf)
+	recordLabelArguments.PrintDefaults()
+
+	fmt.Fprintf(buf, "\n  %s edit [domain] [subdomain] [arguments ...]\n", actionNameRecord)
+	recordEditArguments.SetOutput(buf)
+	recordEditArguments.PrintDefaults()
+
+	return buf.String()
+}
+
+// Execute runs the given record sub command ("create", "update", "delete", "replace-content", "label" or "edit").
+func (action recordAction) Execute(arguments []string) (message, error) {
+	if len(arguments) == 0 {
+		return nil, fmt.Errorf("No sub command supplied (create, update, delete, replace-content, label, edit)")
+	}
+
+	switch arguments[0] {
+	case "create":
+		return action.create(arguments[1:])
+
+	case "update":
+		return action.update(arguments[1:])
+
+	case "delete":
+		return action.delete(arguments[1:])
+
+	case "replace-content":
+		return action.replaceContent(arguments[1:])
+
+	case "label":
+		return action.label(arguments[1:])
+
+	case "edit":
+		return action.edit(arguments[1:])
+	}
+
+	return nil, fmt.Errorf("Unknown sub command: %q", arguments[0])
+}
+
+// create creates a new DNS record from either the raw content
+// or the structured fields of the given record type.
+func (action recordAction) create(arguments []string) (message, error) {
+
+	// parse the arguments
+	*recordCreateDomain = ""
+	*recordCreateSubdomain = ""
+	*recordCreateType = ""
+	*recordCreateContent = ""
+	*recordCreateTTL = defaultTTL
+	*recordCreateOrder = 0
+	*recordCreatePreference = 0
+	*recordCreateFlags = ""
+	*recordCreateService = ""
+	*recordCreateRegexp = ""
+	*recordCreateReplacement = "."
+	*recordCreateCPU = ""
+	*recordCreateOS = ""
+	*recordCreateTarget = ""
+	*recordCreateConflicts = false
+	*recordCreateExpiresIn = ""
+	if parseError := recordCreateArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if *recordCreateDomain == "" {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	recordType := strings.ToUpper(strings.TrimSpace(*recordCreateType))
+	if recordType == "" {
+		return nil, fmt.Errorf("No record type supplied")
+	}
+
+	if *recordCreateTTL < 0 {
+		return nil, fmt.Errorf("The given TTL cannot be negative")
+	}
+
+	ttl, ttlError := applyTTLPolicy(action.ttlPolicy, actionNameRecord+" create", false, *recordCreateTTL, arguments)
+	if ttlError != nil {
+		return nil, ttlError
+	}
+
+	content := *recordCreateContent
+	if content == "" {
+		structuredContent, contentError := getStructuredRecordContent(recordType)
+		if contentError != nil {
+			return nil, contentError
+		}
+
+		content = structuredContent
+	}
+
+	if content == "" {
+		return nil, fmt.Errorf("No record content supplied")
+	}
+
+	if validationError := validateRecordArguments(*recordCreateSubdomain, recordType, content, ttl, recordArguments{"-subdomain", "-content", "-ttl"}); validationError != nil {
+		return nil, validationError
+	}
+
+	expiresIn, expiresInError := getExpiresIn(*recordCreateExpiresIn, action.metadata)
+	if expiresInError != nil {
+		return nil, expiresInError
+	}
+
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	replaced, conflictError := resolveConflicts(client, *recordCreateDomain, *recordCreateSubdomain, recordType, *recordCreateConflicts)
+	if conflictError != nil {
+		return nil, conflictError
+	}
+
+	changeRecord := &dnsimple.ChangeRecord{
+		Name:  *recordCreateSubdomain,
+		Value: content,
+		Type:  recordType,
+		Ttl:   fmt.Sprintf("%d", ttl),
+	}
+
+	id, createError := client.CreateRecord(*recordCreateDomain, changeRecord)
+	if createError != nil {
+		return nil, getReplacedRecordsError(createError, *recordCreateDomain, replaced)
+	}
+
+	text := fmt.Sprintf("Created: %s (%s %s)", getFormattedDomainName(*recordCreateSubdomain, *recordCreateDomain), recordType, content)
+	if expiresIn > 0 {
+		expiry, expiryError := markRecordAsTemporary(action.metadata, *recordCreateDomain, id, expiresIn)
+		if expiryError != nil {
+			return nil, fmt.Errorf("%s\n%s", text, expiryError.Error())
+		}
+
+		text += expiry
+	}
+
+	return changeMessage{text, 1}, nil
+}
+
+// update changes the content and/or TTL of the record with the given ID.
+// The record is looked up first so that the changed record is validated
+// like a new record before it is sent to the API.
+func (action recordAction) update(arguments []string) (message, error) {
+
+	// parse the arguments
+	*recordUpdateDomain = ""
+	*recordUpdateID = 0
+	*recordUpdateContent = ""
+	*recordUpdateTTL = 0
+	if parseError := recordUpdateArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if *recordUpdateDomain == "" {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	if *recordUpdateID <= 0 {
+		return nil, fmt.Errorf("No record ID supplied")
+	}
+
+	if *recordUpdateContent == "" && *recordUpdateTTL == 0 {
+		return nil, fmt.Errorf("Nothing to update (use -content and/or -ttl)")
+	}
+
+	if *recordUpdateTTL != 0 && *recordUpdateTTL < minimumTTL {
+		return nil, fmt.Errorf("Invalid -ttl %d: the TTL must be at least %d seconds", *recordUpdateTTL, minimumTTL)
+	}
+
+	ttl := 0
+	if *recordUpdateTTL != 0 {
+		policyTTL, ttlError := applyRecordTTLPolicy(action.ttlPolicy, actionNameRecord+" update", false, *recordUpdateTTL)
+		if ttlError != nil {
+			return nil, ttlError
+		}
+
+		ttl = policyTTL
+	}
+
+	client, clientError := action.createClient()
+	if clientError != nil {
+		return nil, clientError
+	}
+
+	records, recordsError := client.GetRecords(*recordUpdateDomain)
+	if recordsError != nil {
+		return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", *recordUpdateDomain, recordsError.Error())
+	}
+
+	record, recordError := findEditableRecord(records, *recordUpdateDomain, "", "", *recordUpdateID)
+	if recordError != nil {
+		return nil, recordError
+	}
+
+	updated := record
+	if *recordUpdateContent != "" {
+		updated.Content = *recordUpdateContent
+	}
+
+	if ttl != 0 {
+		updated.Ttl = int64(ttl)
+	}
+
+	if validationError := validateRecordArguments(updated.Name, updated.RecordType, updated.Content, int(updated.Ttl), recordArguments{"", "-content", "-ttl"}); validationError != nil {
+		return nil, validationError
+	}
+
+	changeRecord := &dnsimple.ChangeRecord{Value: *recordUpdateContent}
+	if ttl != 0 {
+		changeRecord.Ttl = fmt.Sprintf("%d", ttl)
+	}
+
+	id := fmt.Sprintf("%d", *recordUpdateID)
+	if _, updateError := client.UpdateRecord(*recordUpdateDomain, id, changeRecord); updateError != nil {
+		return nil, fmt.Errorf("%s", updateError.Error())
+	}
+
+	return changeMessage{fmt.Sprintf("Updated: record %s of %s", id, *recordUpdateDomain), 1}, nil
+}
+
+// delete deletes the record with the given ID without
+// looking up the record by name and type first.
+func (action recordAction) delete(arguments []string) (message, error) {
+
+	// parse the arguments
+	*recordDeleteDomain = ""
+	*recordDeleteID = 0
+	if parseError := recordDeleteArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if *recordDeleteDomain == "" {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	if *recordDeleteID <= 0 {
+		return nil, fmt.Errorf("No record ID supplied")
+	}
+
+	client, clientError := action.createClient()
+	if clientError != nil {
+		return nil, clientError
+	}
+
+	id := fmt.Sprintf("%d", *recordDeleteID)
+	if deleteError := client.DestroyRecord(*recordDeleteDomain, id); deleteError != nil {
+		return nil, fmt.Errorf("%s", deleteError.Error())
+	}
+
+	return changeMessage{fmt.Sprintf("Deleted: record %s of %s", id, *recordDeleteDomain), 1}, nil
+}
+
+// replacementRecord is an address record whose
+// content is replaced by the replace-content command.
+type replacementRecord struct {
+	domain string
+	record dnsimple.Record
+}
+
+// replaceContent previews or applies the replacement of an IP address in all
+// address records of the selected domains (e.g. when migrating to a new server).
+func (action recordAction) replaceContent(arguments []string) (message, error) {
+
+	// parse the arguments
+	*recordReplaceDomain = ""
+	*recordReplaceDomains = ""
+	*recordReplaceAllDomains = false
+	*recordReplaceFrom = ""
+	*recordReplaceTo = ""
+	*recordReplaceLabel = ""
+	*recordReplaceApply = false
+	if parseError := recordReplaceArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	from := net.ParseIP(strings.TrimSpace(*recordReplaceFrom))
+	if from == nil {
+		return nil, fmt.Errorf("Invalid -from IP address: %q", *recordReplaceFrom)
+	}
+
+	to := net.ParseIP(strings.TrimSpace(*recordReplaceTo))
+	if to == nil {
+		return nil, fmt.Errorf("Invalid -to IP address: %q", *recordReplaceTo)
+	}
+
+	recordType := getDNSRecordTypeByIP(from)
+	if getDNSRecordTypeByIP(to) != recordType {
+		return nil, fmt.Errorf("The -from and -to addresses must both be IPv4 or both be IPv6 addresses")
+	}
+
+	selector, labelError := parseLabels(*recordReplaceLabel)
+	if labelError != nil {
+		return nil, labelError
+	}
+
+	if len(selector) > 0 && action.metadata == nil {
+		return nil, fmt.Errorf("No metadata store available")
+	}
+
+	domainList := *recordReplaceDomains
+	if *recordReplaceAllDomains {
+		if *recordReplaceDomain != "" || domainList != "" {
+			return nil, fmt.Errorf("The -all-domains argument cannot be combined with -domain or -domains")
+		}
+
+		domainList = "*"
+	}
+
+	client, clientError := action.createClient()
+	if clientError != nil {
+		return nil, clientError
+	}
+
+	domains, domainsError := getTargetDomains(*recordReplaceDomain, domainList, dnsimpleInfoProviderFactory{action.clientFactory})
+	if domainsError != nil {
+		return nil, domainsError
+	}
+
+	// find the records that point to the old IP
+	var replacements []replacementRecord
+	for _, domain := range domains {
+		records, recordsError := client.GetRecords(domain)
+		if recordsError != nil {
+			return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", domain, recordsError.Error())
+		}
+
+		var metadata map[int64]recordMetadata
+		if len(selector) > 0 {
+			domainMetadata, metadataError := action.metadata.GetMetadata(domain)
+			if metadataError != nil {
+				return nil, metadataError
+			}
+
+			metadata = domainMetadata
+		}
+
+		for _, record := range records {
+			if record.RecordType == recordType && from.Equal(net.ParseIP(record.Content)) && matchesLabels(metadata[record.Id], selector) {
+				replacements = append(replacements, replacementRecord{domain, record})
+			}
+		}
+	}
+
+	if len(replacements) == 0 {
+		return successMessage{fmt.Sprintf("No %s records of %d domains point to %s", recordType, len(domains), from.String())}, nil
+	}
+
+	preview := new(bytes.Buffer)
+	for _, replacement := range replacements {
+		fmt.Fprintf(preview, "%s (%s, ID %d): %s → %s\n", getFormattedDomainName(replacement.record.Name, replacement.domain), recordType, replacement.record.Id, from.String(), to.String())
+	}
+
+	if !*recordReplaceApply {
+		fmt.Fprintf(preview, "Run again with -apply to update %d records", len(replacements))
+		return successMessage{preview.String()}, nil
+	}
+
+	for index, replacement := range replacements {
+		id := fmt.Sprintf("%d", replacement.record.Id)
+		if _, updateError := client.UpdateRecord(replacement.domain, id, &dnsimple.ChangeRecord{Value: to.String()}); updateError != nil {
+			return nil, fmt.Errorf("Updated %d of %d records. %s failed: %s", index, len(replacements), getFormattedDomainName(replacement.record.Name, replacement.domain), updateError.Error())
+		}
+	}
+
+	return changeMessage{fmt.Sprintf("%sUpdated %d records", preview.String(), len(replacements)), len(replacements)}, nil
+}
+
+// label changes the locally stored labels and note of the record with the given ID.
+func (action recordAction) label(arguments []string) (message, error) {
+
+	// parse the arguments
+	*recordLabelDomain = ""
+	*recordLabelID = 0
+	*recordLabelLabels = ""
+	*recordLabelRemove = ""
+	*recordLabelNote = ""
+	*recordLabelClear = false
+	if parseError := recordLabelArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if *recordLabelDomain == "" {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	if *recordLabelID <= 0 {
+		return nil, fmt.Errorf("No record ID supplied")
+	}
+
+	labels, labelError := parseLabels(*recordLabelLabels)
+	if labelError != nil {
+		return nil, labelError
+	}
+
+	noteGiven := isFlagGiven(arguments, "note")
+
+	if len(labels) == 0 && isEmpty(*recordLabelRemove) && !noteGiven && !*recordLabelClear {
+		return nil, fmt.Errorf("Nothing to change (use -label, -remove, -note or -clear)")
+	}
+
+	if action.metadata == nil {
+		return nil, fmt.Errorf("No metadata store available")
+	}
+
+	existing, metadataError := action.metadata.GetMetadata(*recordLabelDomain)
+	if metadataError != nil {
+		return nil, metadataError
+	}
+
+	metadata := recordMetadata{Domain: *recordLabelDomain, RecordID: *recordLabelID, Labels: make(map[string]string), ExpiresAt: existing[*recordLabelID].ExpiresAt}
+	if !*recordLabelClear {
+		metadata.Note = existing[*recordLabelID].Note
+		for key, value := range existing[*recordLabelID].Labels {
+			metadata.Labels[key] = value
+		}
+	}
+
+	for key, value := range labels {
+		metadata.Labels[key] = value
+	}
+
+	for _, key := range strings.Split(*recordLabelRemove, ",") {
+		delete(metadata.Labels, strings.TrimSpace(key))
+	}
+
+	if noteGiven {
+		metadata.Note = strings.TrimSpace(*recordLabelNote)
+	}
+
+	if saveError := action.metadata.SetMetadata(metadata); saveError != nil {
+		return nil, fmt.Errorf("Cannot save the labels: %s", saveError.Error())
+	}
+
+	if metadata.IsEmpty() {
+		return successMessage{fmt.Sprintf("Record %d of %s has no labels", *recordLabelID, *recordLabelDomain)}, nil
+	}
+
+	return successMessage{fmt.Sprintf("Labels of record %d of %s: %s", *recordLabelID, *recordLabelDomain, formatLabels(metadata.Labels))}, nil
+}
+
+// edit opens the fields of a record in the editor of the user and updates
+// the record with the saved changes. The domain and subdomain can either be
+// passed with -domain and -subdomain or as positional arguments
+// (e.g. "record edit example.com www -type TXT").
+func (action recordAction) edit(arguments []string) (message, error) {
+
+	// parse the arguments
+	*recordEditDomain = ""
+	*recordEditSubdomain = ""
+	*recordEditType = ""
+	*recordEditID = 0
+	if parseError := recordEditArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	// the positional arguments and the flags that follow them
+	var positional []string
+	for recordEditArguments.NArg() > 0 && len(positional) < 2 {
+		positional = append(positional, recordEditArguments.Arg(0))
+		if parseError := recordEditArguments.Parse(recordEditArguments.Args()[1:]); parseError != nil {
+			return nil, parseError
+		}
+	}
+
+	domain, subdomain := *recordEditDomain, *recordEditSubdomain
+	if domain == "" && len(positional) > 0 {
+		domain, positional = positional[0], positional[1:]
+	}
+
+	if subdomain == "" && len(positional) > 0 {
+		subdomain = positional[0]
+	}
+
+	if isEmpty(domain) {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	if action.editFile == nil {
+		return nil, fmt.Errorf("No editor available")
+	}
+
+	client, clientError := action.createClient()
+	if clientError != nil {
+		return nil, clientError
+	}
+
+	records, recordsError := client.GetRecords(domain)
+	if recordsError != nil {
+		return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", domain, recordsError.Error())
+	}
+
+	record, findError := findEditableRecord(records, domain, subdomain, *recordEditType, *recordEditID)
+	if findError != nil {
+		return nil, findError
+	}
+
+	edited, editError := editRecordDocument(record, domain, action.editFile)
+	if editError != nil {
+		return nil, editError
+	}
+
+	if edited.Type != record.RecordType {
+		return nil, fmt.Errorf("The type of a record cannot be changed (delete the record and create a new one)")
+	}
+
+	if edited.Name == "" && record.Name != "" {
+		return nil, fmt.Errorf("A record cannot be moved to the root domain (delete the record and create a new one)")
+	}
+
+	if validationError := validateRecord(edited.Name, edited.Type, edited.Content, edited.TTL); validationError != nil {
+		return nil, fmt.Errorf("Invalid %s record: %s", edited.Type, validationError.Error())
+	}
+
+	ttl, ttlError := applyRecordTTLPolicy(action.ttlPolicy, actionNameRecord+" edit", false, edited.TTL)
+	if ttlError != nil {
+		return nil, ttlError
+	}
+
+	updated := record
+	updated.Name, updated.Content, updated.Ttl = edited.Name, edited.Content, int64(ttl)
+	if updated == record {
+		return unchangedMessage{fmt.Sprintf("No changes: record %d of %s", record.Id, domain)}, nil
+	}
+
+	changeRecord := &dnsimple.ChangeRecord{
+		Name:  updated.Name,
+		Value: updated.Content,
+		Ttl:   fmt.Sprintf("%d", updated.Ttl),
+	}
+
+	id := fmt.Sprintf("%d", record.Id)
+	if _, updateError := client.UpdateRecord(domain, id, changeRecord); updateError != nil {
+		return nil, fmt.Errorf("%s", updateError.Error())
+	}
+
+	change := recordChange{Kind: recordChangeChanged, Previous: record, Current: updated}
+	return changeMessage{fmt.Sprintf("Updated: record %s of %s\n%s", id, domain, change.String(domain)), 1}, nil
+}
+
+// createClient returns a new DNS client.
+func (action recordAction) createClient() (deens.DNSClient, error) {
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	return client, nil
+}
+
+// getStructuredRecordContent assembles the record content for the given
+// record type from the structured NAPTR, HINFO and POOL arguments.
+func getStructuredRecordContent(recordType string) (string, error) {
+	switch recordType {
+	case "NAPTR":
+		return getNAPTRContent(*recordCreateOrder, *recordCreatePreference, *recordCreateFlags, *recordCreateService, *recordCreateRegexp, *recordCreateReplacement)
+
+	case "HINFO":
+		return getHINFOContent(*recordCreateCPU, *recordCreateOS)
+
+	case "POOL":
+		if isEmpty(*recordCreateTarget) {
+			return "", fmt.Errorf("No pool member (-target) supplied")
+		}
+
+		return strings.TrimSpace(*recordCreateTarget), nil
+	}
+
+	return "", nil
+}
+
+// getNAPTRContent returns the content of a NAPTR record
+// (e.g. `100 10 "U" "E2U+sip" "!^.*$!sip:info@example.com!" .`).
+func getNAPTRContent(order, preference int, flags, service, regexp, replacement string) (string, error) {
+	if order < 0 || order > 65535 {
+		return "", fmt.Errorf("The NAPTR order must be between 0 and 65535")
+	}
+
+	if preference < 0 || preference > 65535 {
+		return "", fmt.Errorf("The NAPTR preference must be between 0 and 65535")
+	}
+
+	if isEmpty(service) {
+		return "", fmt.Errorf("No NAPTR service (-service) supplied")
+	}
+
+	if regexp != "" && replacement != "." {
+		return "", fmt.Errorf("A NAPTR record cannot have both a regular expression and a replacement")
+	}
+
+	if isEmpty(replacement) {
+		replacement = "."
+	}
+
+	return fmt.Sprintf("%d %d %q %q %q %s", order, preference, flags, service, regexp, replacement), nil
+}
+
+// getHINFOContent returns the content of a HINFO record (e.g. `"ARMV7" "LINUX"`).
+func getHINFOContent(cpu, os string) (string, error) {
+	if isEmpty(cpu) || isEmpty(os) {
+		return "", fmt.Errorf("A HINFO record requires a CPU (-cpu) and an operating system (-os)")
+	}
+
+	return fmt.Sprintf("%q %q", cpu, os), nil
+}
@@ -0,0 +1,630 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// getRecordTestClient returns a DNS client that passes all
+// created records to the given function.
+func getRecordTestClient(created func(domain string, record *dnsimple.ChangeRecord)) testDNSClient {
+	return testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return nil, nil
+		},
+		createRecordFunc: func(domain string, opts *dnsimple.ChangeRecord) (string, error) {
+			created(domain, opts)
+			return "1", nil
+		},
+	}
+}
+
+func Test_recordAction_Name_CorrectActionNameIsReturned(t *testing.T) {
+
+	// arrange
+	recordAction := recordAction{}
+
+	// act
+	result := recordAction.Name()
+
+	// assert
+	if result != "record" {
+		t.Fail()
+		t.Logf("recordAction.Name() should have returned %q but returned %q instead.", "record", result)
+	}
+
+}
+
+func Test_recordAction_Usage_ResultIsNotEmpty(t *testing.T) {
+
+	// arrange
+	recordAction := recordAction{}
+
+	// act
+	result := recordAction.Usage()
+
+	// assert
+	if isEmpty(result) {
+		t.Fail()
+		t.Logf("recordAction.Usage() not be empty.")
+	}
+
+}
+
+// recordAction.Execute should return an error if the argument values are invalid.
+func Test_recordAction_Create_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{},
+		{"remove", "-domain", "example.com"},
+		{"create", "-domain", "", "-type", "TXT", "-content", "hello"},
+		{"create", "-domain", "example.com", "-type", "", "-content", "hello"},
+		{"create", "-domain", "example.com", "-type", "TXT", "-content", ""},
+		{"create", "-domain", "example.com", "-type", "TXT", "-content", "hello", "-ttl", "-1"},
+		{"create", "-domain", "example.com", "-type", "NAPTR", "-order", "100", "-preference", "10"},
+		{"create", "-domain", "example.com", "-type", "NAPTR", "-order", "70000", "-service", "E2U+sip"},
+		{"create", "-domain", "example.com", "-type", "NAPTR", "-service", "E2U+sip", "-regexp", "!^.*$!sip:a@b!", "-replacement", "sip.example.com."},
+		{"create", "-domain", "example.com", "-type", "HINFO", "-cpu", "ARMV7"},
+		{"create", "-domain", "example.com", "-type", "POOL"},
+		{"create", "-domain", "example.com", "-type", "TXT", "-content", "hello", "-ttl", "30"},
+		{"create", "-domain", "example.com", "-subdomain", "www", "-type", "CNAME", "-content", "203.0.113.1"},
+		{"create", "-domain", "example.com", "-subdomain", "my_host", "-type", "A", "-content", "203.0.113.1"},
+	}
+
+	client := getRecordTestClient(func(domain string, record *dnsimple.ChangeRecord) {})
+	recordAction := recordAction{testDNSClientFactory{client, nil}, nil, nil, nil}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := recordAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("recordAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// recordAction.Execute should assemble the record content from the structured arguments.
+func Test_recordAction_Create_StructuredArguments_ContentIsAssembled(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		arguments       []string
+		expectedType    string
+		expectedContent string
+	}{
+		{
+			[]string{"create", "-domain", "example.com", "-type", "naptr", "-order", "100", "-preference", "10", "-flags", "U", "-service", "E2U+sip", "-regexp", "!^.*$!sip:info@example.com!"},
+			"NAPTR",
+			`100 10 "U" "E2U+sip" "!^.*$!sip:info@example.com!" .`,
+		},
+		{
+			[]string{"create", "-domain", "example.com", "-subdomain", "_sip._udp", "-type", "NAPTR", "-order", "10", "-preference", "20", "-flags", "S", "-service", "SIP+D2U", "-replacement", "_sip._udp.example.com."},
+			"NAPTR",
+			`10 20 "S" "SIP+D2U" "" _sip._udp.example.com.`,
+		},
+		{
+			[]string{"create", "-domain", "example.com", "-subdomain", "host", "-type", "HINFO", "-cpu", "ARMV7", "-os", "LINUX"},
+			"HINFO",
+			`"ARMV7" "LINUX"`,
+		},
+		{
+			[]string{"create", "-domain", "example.com", "-subdomain", "www", "-type", "POOL", "-target", "a.example.com"},
+			"POOL",
+			"a.example.com",
+		},
+		{
+			[]string{"create", "-domain", "example.com", "-type", "TXT", "-content", "hello"},
+			"TXT",
+			"hello",
+		},
+	}
+
+	for _, input := range inputs {
+		var createdRecord *dnsimple.ChangeRecord
+		client := getRecordTestClient(func(domain string, record *dnsimple.ChangeRecord) {
+			createdRecord = record
+		})
+
+		recordAction := recordAction{testDNSClientFactory{client, nil}, nil, nil, nil}
+
+		// act
+		_, err := recordAction.Execute(input.arguments)
+
+		// assert
+		if err != nil {
+			t.Fail()
+			t.Logf("recordAction.Execute(%q) should not return an error: %s", input.arguments, err.Error())
+			continue
+		}
+
+		if createdRecord.Type != input.expectedType || createdRecord.Value != input.expectedContent {
+			t.Fail()
+			t.Logf("recordAction.Execute(%q) should have created a %s record with content %q but created %#v", input.arguments, input.expectedType, input.expectedContent, createdRecord)
+		}
+	}
+}
+
+// recordAction.Execute should return an error if the DNS client responds with one.
+func Test_recordAction_Create_CreateFails_ErrorIsReturned(t *testing.T) {
+	// arrange
+	arguments := []string{"create", "-domain", "example.com", "-type", "TXT", "-content", "hello"}
+	client := testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return nil, nil
+		},
+		createRecordFunc: func(domain string, opts *dnsimple.ChangeRecord) (string, error) {
+			return "", fmt.Errorf("API Error")
+		},
+	}
+
+	recordAction := recordAction{testDNSClientFactory{client, nil}, nil, nil, nil}
+
+	// act
+	_, err := recordAction.Execute(arguments)
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("recordAction.Execute(%q) should return an error because the DNS client returned one", arguments)
+	}
+}
+
+// recordAction.Execute should return an error if the DNS client factory returns an error.
+func Test_recordAction_Create_ClientCreationFails_ErrorIsReturned(t *testing.T) {
+	// arrange
+	arguments := []string{"create", "-domain", "example.com", "-type", "TXT", "-content", "hello"}
+	recordAction := recordAction{testDNSClientFactory{nil, fmt.Errorf("No credentials")}, nil, nil, nil}
+
+	// act
+	_, err := recordAction.Execute(arguments)
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("recordAction.Execute(%q) should return an error because the DNS client factory returned one", arguments)
+	}
+}
+
+// recordAction.Execute should not create a CNAME record if other records with the same name exist.
+func Test_recordAction_Create_ConflictingRecords_ErrorIsReturned(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 600},
+		},
+	}
+
+	recordAction := recordAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, nil, nil, nil}
+
+	// act
+	_, err := recordAction.Execute([]string{"create", "-domain", "example.com", "-subdomain", "www", "-type", "CNAME", "-content", "example.net"})
+
+	// assert
+	if err == nil || len(records["example.com"]) != 1 {
+		t.Fail()
+		t.Logf("recordAction.Execute should return a conflict error and not change the records (error: %v, records: %+v)", err, records["example.com"])
+	}
+}
+
+// recordAction.Execute should update the record with the given ID and only send the changed fields.
+func Test_recordAction_UpdateByID_OnlyContentAndTTLAreSent(t *testing.T) {
+	// arrange
+	var updatedDomain, updatedID string
+	var updatedRecord *dnsimple.ChangeRecord
+	client := testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{{Id: 12345, Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 3600}}, nil
+		},
+		updateRecordFunc: func(domain string, id string, opts *dnsimple.ChangeRecord) (string, error) {
+			updatedDomain, updatedID, updatedRecord = domain, id, opts
+			return id, nil
+		},
+	}
+
+	recordAction := recordAction{testDNSClientFactory{client, nil}, nil, nil, nil}
+	arguments := []string{"update", "-domain", "example.com", "-id", "12345", "-content", "203.0.113.2", "-ttl", "300"}
+
+	// act
+	result, err := recordAction.Execute(arguments)
+
+	// assert
+	if err != nil || updatedDomain != "example.com" || updatedID != "12345" {
+		t.Fatalf("recordAction.Execute(%q) should update record 12345 of example.com but returned %v", arguments, err)
+	}
+
+	expected := dnsimple.ChangeRecord{Value: "203.0.113.2", Ttl: "300"}
+	if *updatedRecord != expected {
+		t.Fail()
+		t.Logf("Only the content and the TTL should have been sent: %#v", *updatedRecord)
+	}
+
+	if getChangeSummary(result).Records != 1 {
+		t.Fail()
+		t.Logf("The result should report one changed record: %#v", result)
+	}
+}
+
+// recordAction.Execute should validate the updated record and not send invalid content or unknown records to the API.
+func Test_recordAction_UpdateByID_InvalidRecord_ErrorIsReturned(t *testing.T) {
+	inputs := []struct {
+		arguments     []string
+		expectedError string
+	}{
+		{[]string{"update", "-domain", "example.com", "-id", "1", "-content", "foo"}, "Invalid -content"},
+		{[]string{"update", "-domain", "example.com", "-id", "2", "-content", "203.0.113.2"}, "Invalid -content"},
+		{[]string{"update", "-domain", "example.com", "-id", "3", "-content", "203.0.113.2"}, "does not exist"},
+	}
+
+	for _, input := range inputs {
+		// arrange
+		records := map[string][]dnsimple.Record{
+			"example.com": {
+				{Id: 1, Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 3600},
+				{Id: 2, Name: "www", RecordType: "AAAA", Content: "2001:db8::1", Ttl: 3600},
+			},
+		}
+
+		recordAction := recordAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, nil, nil, nil}
+
+		// act
+		_, err := recordAction.Execute(input.arguments)
+
+		// assert
+		if err == nil || !strings.Contains(err.Error(), input.expectedError) {
+			t.Fail()
+			t.Logf("recordAction.Execute(%q) should return an error containing %q but returned %v", input.arguments, input.expectedError, err)
+		}
+
+		if records["example.com"][0].Content != "203.0.113.1" || records["example.com"][1].Content != "2001:db8::1" {
+			t.Fail()
+			t.Logf("recordAction.Execute(%q) should not change any record: %+v", input.arguments, records["example.com"])
+		}
+	}
+}
+
+// recordAction.Execute should delete the record with the given ID.
+func Test_recordAction_DeleteByID_RecordIsDeleted(t *testing.T) {
+	// arrange
+	deletedID := ""
+	client := testDNSClient{
+		destroyRecordFunc: func(domain string, id string) error {
+			deletedID = id
+			return nil
+		},
+	}
+
+	recordAction := recordAction{testDNSClientFactory{client, nil}, nil, nil, nil}
+	arguments := []string{"delete", "-domain", "example.com", "-id", "12345"}
+
+	// act
+	_, err := recordAction.Execute(arguments)
+
+	// assert
+	if err != nil || deletedID != "12345" {
+		t.Fail()
+		t.Logf("recordAction.Execute(%q) should delete record 12345 but deleted %q (%v)", arguments, deletedID, err)
+	}
+}
+
+// recordAction.Execute should return an error if the ID arguments are invalid.
+func Test_recordAction_ByID_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{"update", "-id", "12345", "-content", "203.0.113.2"},
+		{"update", "-domain", "example.com", "-content", "203.0.113.2"},
+		{"update", "-domain", "example.com", "-id", "-1", "-content", "203.0.113.2"},
+		{"update", "-domain", "example.com", "-id", "12345"},
+		{"update", "-domain", "example.com", "-id", "12345", "-ttl", "30"},
+		{"update", "-domain", "example.com", "-id", "abc", "-content", "203.0.113.2"},
+		{"delete", "-domain", "example.com"},
+		{"delete", "-id", "12345"},
+	}
+
+	recordAction := recordAction{testDNSClientFactory{testDNSClient{}, nil}, nil, nil, nil}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := recordAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("recordAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// getReplaceContentTestRecords returns the records of two domains, three of which point to 203.0.113.1.
+func getReplaceContentTestRecords() map[string][]dnsimple.Record {
+	return map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "", RecordType: "A", Content: "203.0.113.1", Ttl: 600},
+			{Id: 2, Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 600},
+			{Id: 3, Name: "mail", RecordType: "A", Content: "203.0.113.9", Ttl: 600},
+			{Id: 4, Name: "", RecordType: "TXT", Content: "203.0.113.1", Ttl: 600},
+		},
+		"example.net": {
+			{Id: 5, Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 3600},
+		},
+	}
+}
+
+// recordAction.Execute should only preview the replacements if -apply is not given.
+func Test_recordAction_ReplaceContent_NoApply_RecordsAreNotChanged(t *testing.T) {
+	// arrange
+	records := getReplaceContentTestRecords()
+	recordAction := recordAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, nil, nil, nil}
+	arguments := []string{"replace-content", "-from", "203.0.113.1", "-to", "198.51.100.1", "-all-domains"}
+
+	// act
+	result, err := recordAction.Execute(arguments)
+
+	// assert
+	if err != nil {
+		t.Fatalf("recordAction.Execute(%q) returned an error: %s", arguments, err.Error())
+	}
+
+	if !strings.Contains(result.Text(), "www.example.net (A, ID 5): 203.0.113.1 → 198.51.100.1") || !strings.Contains(result.Text(), "-apply to update 3 records") {
+		t.Fail()
+		t.Logf("The preview should list the three A records: %s", result.Text())
+	}
+
+	if records["example.com"][1].Content != "203.0.113.1" {
+		t.Fail()
+		t.Logf("The records should not have been changed without -apply")
+	}
+}
+
+// recordAction.Execute should update all address records of the selected domains that point to the old IP.
+func Test_recordAction_ReplaceContent_Apply_MatchingRecordsAreUpdated(t *testing.T) {
+	// arrange
+	records := getReplaceContentTestRecords()
+	recordAction := recordAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, nil, nil, nil}
+	arguments := []string{"replace-content", "-domain", "example.com", "-from", "203.0.113.1", "-to", "198.51.100.1", "-apply"}
+
+	// act
+	result, err := recordAction.Execute(arguments)
+
+	// assert
+	if err != nil || getChangeSummary(result).Records != 2 {
+		t.Fatalf("recordAction.Execute(%q) should update two records but returned %v (%v)", arguments, result, err)
+	}
+
+	expected := []string{"198.51.100.1", "198.51.100.1", "203.0.113.9", "203.0.113.1"}
+	for index, record := range records["example.com"] {
+		if record.Content != expected[index] || record.Ttl != 600 {
+			t.Fail()
+			t.Logf("Record %d should point to %s with an unchanged TTL but is %#v", record.Id, expected[index], record)
+		}
+	}
+
+	if records["example.net"][0].Content != "203.0.113.1" {
+		t.Fail()
+		t.Logf("The records of example.net should not have been changed")
+	}
+}
+
+// recordAction.Execute should return an error if the replace-content arguments are invalid.
+func Test_recordAction_ReplaceContent_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{"replace-content", "-all-domains", "-to", "198.51.100.1"},
+		{"replace-content", "-all-domains", "-from", "203.0.113.1"},
+		{"replace-content", "-all-domains", "-from", "203.0.113.1", "-to", "www.example.com"},
+		{"replace-content", "-all-domains", "-from", "203.0.113.1", "-to", "2001:db8::1"},
+		{"replace-content", "-from", "203.0.113.1", "-to", "198.51.100.1"},
+		{"replace-content", "-all-domains", "-domain", "example.com", "-from", "203.0.113.1", "-to", "198.51.100.1"},
+	}
+
+	recordAction := recordAction{testDNSClientFactory{newInMemoryTestDNSClient(getReplaceContentTestRecords()), nil}, nil, nil, nil}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := recordAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("recordAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// recordAction.Execute should only replace the content of records with the given labels.
+func Test_recordAction_ReplaceContent_LabelFilter_OnlyLabeledRecordsAreUpdated(t *testing.T) {
+	// arrange
+	records := getReplaceContentTestRecords()
+	metadata := filesystemMetadataStore{afero.NewMemMapFs(), "/state.json"}
+	metadata.SetMetadata(recordMetadata{Domain: "example.net", RecordID: 5, Labels: map[string]string{"env": "prod"}})
+
+	recordAction := recordAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, metadata, nil, nil}
+	arguments := []string{"replace-content", "-all-domains", "-from", "203.0.113.1", "-to", "198.51.100.1", "-label", "env=prod", "-apply"}
+
+	// act
+	result, err := recordAction.Execute(arguments)
+
+	// assert
+	if err != nil || getChangeSummary(result).Records != 1 {
+		t.Fatalf("recordAction.Execute(%q) should update one record but returned %v (%v)", arguments, result, err)
+	}
+
+	if records["example.net"][0].Content != "198.51.100.1" || records["example.com"][0].Content != "203.0.113.1" {
+		t.Fail()
+		t.Logf("Only the record labeled env=prod should have been changed")
+	}
+}
+
+// recordAction.Execute should add, replace and remove the labels of a record.
+func Test_recordAction_Label_LabelsAreChanged(t *testing.T) {
+	// arrange
+	metadata := filesystemMetadataStore{afero.NewMemMapFs(), "/state.json"}
+	recordAction := recordAction{testDNSClientFactory{testDNSClient{}, nil}, metadata, nil, nil}
+
+	// act
+	recordAction.Execute([]string{"label", "-domain", "example.com", "-id", "12345", "-label", "env=dev,team=web", "-note", "Web server"})
+	result, err := recordAction.Execute([]string{"label", "-domain", "example.com", "-id", "12345", "-label", "env=prod", "-remove", "team"})
+
+	// assert
+	if err != nil || !strings.Contains(result.Text(), "env=prod") {
+		t.Fatalf("recordAction.Execute should return the new labels but returned %v (%v)", result, err)
+	}
+
+	stored, _ := metadata.GetMetadata("example.com")
+	if formatLabels(stored[12345].Labels) != "env=prod" || stored[12345].Note != "Web server" {
+		t.Fail()
+		t.Logf("The record should be labeled env=prod and keep its note but has %#v", stored[12345])
+	}
+}
+
+// recordAction.Execute should return an error if the label arguments are invalid.
+func Test_recordAction_Label_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{"label", "-id", "12345", "-label", "env=prod"},
+		{"label", "-domain", "example.com", "-label", "env=prod"},
+		{"label", "-domain", "example.com", "-id", "12345"},
+		{"label", "-domain", "example.com", "-id", "12345", "-label", "=prod"},
+	}
+
+	recordAction := recordAction{testDNSClientFactory{testDNSClient{}, nil}, filesystemMetadataStore{afero.NewMemMapFs(), "/state.json"}, nil, nil}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := recordAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("recordAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// getRecordEditTestRecords returns the records of the "record edit" tests.
+func getRecordEditTestRecords() map[string][]dnsimple.Record {
+	return map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 3600},
+			{Id: 2, Name: "www", RecordType: "TXT", Content: "v=spf1 -all", Ttl: 3600},
+		},
+	}
+}
+
+// getTestEditor returns an editor that replaces the given text of the edited file.
+func getTestEditor(old, new string) func(filePath string) error {
+	return func(filePath string) error {
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(filePath, []byte(strings.Replace(string(content), old, new, 1)), 0600)
+	}
+}
+
+// recordAction.Execute should update the record with the fields saved in the editor.
+func Test_recordAction_Edit_ChangedFieldsAreUpdated(t *testing.T) {
+	// arrange
+	records := getRecordEditTestRecords()
+	editor := getTestEditor(`content: "v=spf1 -all"`, `content: "v=spf1 include:_spf.example.com ~all"`)
+	recordAction := recordAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, nil, nil, editor}
+	arguments := []string{"edit", "example.com", "www", "-type", "TXT"}
+
+	// act
+	result, err := recordAction.Execute(arguments)
+
+	// assert
+	if err != nil || getChangeSummary(result).Records != 1 {
+		t.Fatalf("recordAction.Execute(%q) should update one record but returned %v (%v)", arguments, result, err)
+	}
+
+	if records["example.com"][1].Content != "v=spf1 include:_spf.example.com ~all" {
+		t.Fail()
+		t.Logf("The content of the TXT record should have been updated: %q", records["example.com"][1].Content)
+	}
+
+	if !strings.Contains(result.Text(), "v=spf1 -all → v=spf1 include:_spf.example.com ~all") {
+		t.Fail()
+		t.Logf("The result should show the difference: %q", result.Text())
+	}
+}
+
+// recordAction.Execute should not update the record if the file was saved without changes.
+func Test_recordAction_Edit_NoChanges_UnchangedMessageIsReturned(t *testing.T) {
+	// arrange
+	client := newInMemoryTestDNSClient(getRecordEditTestRecords())
+	client.updateRecordFunc = func(domain string, id string, opts *dnsimple.ChangeRecord) (string, error) {
+		return "", fmt.Errorf("The record should not be updated")
+	}
+
+	recordAction := recordAction{testDNSClientFactory{client, nil}, nil, nil, getTestEditor("", "")}
+	arguments := []string{"edit", "-domain", "example.com", "-id", "1"}
+
+	// act
+	result, err := recordAction.Execute(arguments)
+
+	// assert
+	if _, isUnchanged := result.(unchangedMessage); err != nil || !isUnchanged {
+		t.Fail()
+		t.Logf("recordAction.Execute(%q) should return an unchanged message but returned %v (%v)", arguments, result, err)
+	}
+}
+
+// recordAction.Execute should return an error if the edited record is invalid or ambiguous.
+func Test_recordAction_Edit_InvalidEdits_ErrorIsReturned(t *testing.T) {
+	inputs := []struct {
+		arguments []string
+		old       string
+		new       string
+	}{
+		{[]string{"edit", "example.com", "www"}, "", ""},
+		{[]string{"edit", "example.com", "mail"}, "", ""},
+		{[]string{"edit", "example.com", "www", "-type", "A"}, "type: A", "type: AAAA"},
+		{[]string{"edit", "example.com", "www", "-type", "A"}, "ttl: 3600", "ttl: 10"},
+		{[]string{"edit", "example.com", "www", "-type", "A"}, "ttl: 3600", "priority: 10"},
+		{[]string{"edit", "example.com", "www", "-type", "A"}, `content: "203.0.113.1"`, `content: "203.0.113.1`},
+	}
+
+	for _, input := range inputs {
+		// arrange
+		recordAction := recordAction{testDNSClientFactory{newInMemoryTestDNSClient(getRecordEditTestRecords()), nil}, nil, nil, getTestEditor(input.old, input.new)}
+
+		// act
+		_, err := recordAction.Execute(input.arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("recordAction.Execute(%q) with the edit %q → %q should return an error", input.arguments, input.old, input.new)
+		}
+	}
+}
+
+// parseRecordDocument should parse the documents written by formatRecordDocument.
+func Test_parseRecordDocument_FormattedRecord_FieldsAreEqual(t *testing.T) {
+	// arrange
+	record := dnsimple.Record{Id: 7, Name: "_sip._tcp", RecordType: "SRV", Content: "10 5060 \"sip.example.com\": x", Ttl: 600}
+
+	// act
+	edited, err := parseRecordDocument(formatRecordDocument(record, "example.com"))
+
+	// assert
+	if err != nil || edited != (editableRecord{record.Name, record.RecordType, record.Content, int(record.Ttl)}) {
+		t.Fail()
+		t.Logf("parseRecordDocument returned %#v (%v) for %#v", edited, err, record)
+	}
+}
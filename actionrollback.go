@@ -0,0 +1,198 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"strings"
+)
+
+var (
+	actionNameRollback = "rollback"
+
+	rollbackArguments = flag.NewFlagSet(actionNameRollback, flag.ContinueOnError)
+	rollbackSteps     = rollbackArguments.Int("steps", 1, "The number of changes to roll back")
+	rollbackApply     = rollbackArguments.Bool("apply", false, "Roll back the changes instead of only previewing them")
+)
+
+type rollbackAction struct {
+	clientFactory dnsClientFactory
+	journal       changeJournal
+}
+
+func (action rollbackAction) Name() string {
+	return actionNameRollback
+}
+
+func (action rollbackAction) Description() string {
+	return "Revert the most recent changes from the change journal"
+}
+
+func (action rollbackAction) Usage() string {
+	buf := new(bytes.Buffer)
+	rollbackArguments.SetOutput(buf)
+	rollbackArguments.PrintDefaults()
+	return buf.String()
+}
+
+// Execute previews or reverts the given number of most recent changes.
+// The changes are reverted in reverse order.
+func (action rollbackAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*rollbackSteps = 1
+	*rollbackApply = false
+	if parseError := rollbackArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if *rollbackSteps < 1 {
+		return nil, fmt.Errorf("The number of steps must be at least 1")
+	}
+
+	if action.journal == nil {
+		return nil, fmt.Errorf("No change journal available")
+	}
+
+	entries, journalError := action.journal.GetEntries()
+	if journalError != nil {
+		return nil, journalError
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("There are no changes to roll back")
+	}
+
+	if *rollbackSteps > len(entries) {
+		return nil, fmt.Errorf("Cannot roll back %d changes. The journal contains only %d", *rollbackSteps, len(entries))
+	}
+
+	// most recent first
+	var changes []journalEntry
+	for index := len(entries) - 1; index >= len(entries)-*rollbackSteps; index-- {
+		changes = append(changes, entries[index])
+	}
+
+	preview := new(bytes.Buffer)
+	for _, change := range changes {
+		fmt.Fprintf(preview, "%s\n", getRollbackDescription(change))
+	}
+
+	if !*rollbackApply {
+		fmt.Fprintf(preview, "Run again with -apply to roll back %d changes", len(changes))
+		return successMessage{preview.String()}, nil
+	}
+
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	// recreated deleted records get a new ID, so the older changes
+	// of these records are reverted with the new ID
+	recreated := make(map[string]string)
+	for index, change := range changes {
+		if newID, isRecreated := recreated[change.Domain+"/"+change.RecordID]; isRecreated {
+			change.RecordID = newID
+		}
+
+		newID, revertError := revertChange(client, change)
+		if revertError != nil {
+			failure := fmt.Sprintf("Rolled back %d of %d changes. %s failed: %s", index, len(changes), getRollbackDescription(change), revertError.Error())
+			if journalError := action.updateJournal(changes[:index], recreated); journalError != nil {
+				failure += fmt.Sprintf(". The rolled back changes could not be removed from the journal: %s", journalError.Error())
+			}
+
+			return nil, fmt.Errorf("%s", failure)
+		}
+
+		if newID != "" {
+			recreated[change.Domain+"/"+change.RecordID] = newID
+		}
+	}
+
+	if journalError := action.updateJournal(changes, recreated); journalError != nil {
+		return nil, fmt.Errorf("The changes were rolled back but could not be removed from the journal: %s", journalError.Error())
+	}
+
+	return changeMessage{fmt.Sprintf("%sRolled back %d changes", preview.String(), len(changes)), len(changes)}, nil
+}
+
+// updateJournal removes the given reverted changes from the journal and
+// assigns the remaining changes of recreated records to their new IDs.
+func (action rollbackAction) updateJournal(reverted []journalEntry, recreated map[string]string) error {
+	if removeError := action.journal.Remove(reverted); removeError != nil {
+		return removeError
+	}
+
+	for record, newID := range recreated {
+		separator := strings.LastIndex(record, "/")
+		if replaceError := action.journal.ReplaceRecordID(record[:separator], record[separator+1:], newID); replaceError != nil {
+			return replaceError
+		}
+	}
+
+	return nil
+}
+
+// getRollbackDescription returns a description of
+// how the given change is reverted.
+func getRollbackDescription(change journalEntry) string {
+	timestamp := change.Time.Format("2006-01-02 15:04:05")
+
+	switch change.Operation {
+	case journalOperationCreate:
+		return fmt.Sprintf("%s %s: delete %s", timestamp, change.Domain, change.After)
+
+	case journalOperationUpdate:
+		if change.Before == nil {
+			return fmt.Sprintf("%s %s: unknown previous state of record %s", timestamp, change.Domain, change.RecordID)
+		}
+
+		return fmt.Sprintf("%s %s: restore %s (TTL %d) instead of %s (TTL %d)", timestamp, change.Domain, change.Before, change.Before.TTL, change.After.Content, change.After.TTL)
+
+	case journalOperationDelete:
+		if change.Before == nil {
+			return fmt.Sprintf("%s %s: unknown previous state of record %s", timestamp, change.Domain, change.RecordID)
+		}
+
+		return fmt.Sprintf("%s %s: recreate %s (TTL %d)", timestamp, change.Domain, change.Before, change.Before.TTL)
+	}
+
+	return fmt.Sprintf("%s %s: unknown operation %q", timestamp, change.Domain, change.Operation)
+}
+
+// revertChange restores the state of the record before the given change.
+// If a deleted record is recreated the ID of the new record is returned.
+func revertChange(client deens.DNSClient, change journalEntry) (string, error) {
+	switch change.Operation {
+	case journalOperationCreate:
+		return "", client.DestroyRecord(change.Domain, change.RecordID)
+
+	case journalOperationUpdate:
+		if change.Before == nil {
+			return "", fmt.Errorf("The previous state of the record is unknown")
+		}
+
+		_, err := client.UpdateRecord(change.Domain, change.RecordID, change.Before.ChangeRecord())
+		return "", err
+
+	case journalOperationDelete:
+		if change.Before == nil {
+			return "", fmt.Errorf("The previous state of the record is unknown")
+		}
+
+		return client.CreateRecord(change.Domain, change.Before.ChangeRecord())
+	}
+
+	return "", fmt.Errorf("Unknown operation %q", change.Operation)
+}
@@ -0,0 +1,198 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getRollbackTestSetup returns a record store with two changes recorded in the journal.
+func getRollbackTestSetup() (map[string][]dnsimple.Record, filesystemJournal, testDNSClient) {
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "www", RecordType: "A", Content: "127.0.0.1", Ttl: 600},
+		},
+	}
+
+	client := newInMemoryTestDNSClient(records)
+	journal := filesystemJournal{afero.NewMemMapFs(), "/home/user/.dee/journal.json"}
+
+	journalingClient := journalingDNSClient{client, journal, time.Now, journalOrigin{}, nil}
+	journalingClient.UpdateRecord("example.com", "1", &dnsimple.ChangeRecord{Name: "www", Value: "127.0.0.2", Type: "A", Ttl: "60"})
+	journalingClient.CreateRecord("example.com", &dnsimple.ChangeRecord{Name: "api", Value: "127.0.0.3", Type: "A", Ttl: "600"})
+
+	return records, journal, client
+}
+
+func Test_rollbackAction_Name_CorrectActionNameIsReturned(t *testing.T) {
+
+	// arrange
+	rollbackAction := rollbackAction{}
+
+	// act
+	result := rollbackAction.Name()
+
+	// assert
+	if result != "rollback" {
+		t.Fail()
+		t.Logf("rollbackAction.Name() should have returned %q but returned %q instead.", "rollback", result)
+	}
+
+}
+
+func Test_rollbackAction_Usage_ResultIsNotEmpty(t *testing.T) {
+
+	// arrange
+	rollbackAction := rollbackAction{}
+
+	// act
+	result := rollbackAction.Usage()
+
+	// assert
+	if isEmpty(result) {
+		t.Fail()
+		t.Logf("rollbackAction.Usage() not be empty.")
+	}
+
+}
+
+// rollbackAction.Execute should return an error if the arguments are invalid.
+func Test_rollbackAction_InvalidArguments_ErrorIsReturned(t *testing.T) {
+	// arrange
+	_, journal, client := getRollbackTestSetup()
+	rollbackAction := rollbackAction{testDNSClientFactory{client, nil}, journal}
+
+	argumentsSet := [][]string{
+		{"-steps", "0"},
+		{"-steps", "3"},
+	}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := rollbackAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("rollbackAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// Without -apply the changes should only be previewed.
+func Test_rollbackAction_NoApply_ChangesArePreviewed(t *testing.T) {
+	// arrange
+	records, journal, client := getRollbackTestSetup()
+	rollbackAction := rollbackAction{testDNSClientFactory{client, nil}, journal}
+
+	// act
+	result, err := rollbackAction.Execute([]string{"-steps", "2"})
+
+	// assert
+	if err != nil {
+		t.Fatalf("rollbackAction.Execute should not return an error: %s", err.Error())
+	}
+
+	if !strings.Contains(result.Text(), "delete api A 127.0.0.3") || !strings.Contains(result.Text(), "restore www A 127.0.0.1 (TTL 600)") {
+		t.Fail()
+		t.Logf("The preview should describe both changes but was %q", result.Text())
+	}
+
+	if len(records["example.com"]) != 2 || records["example.com"][0].Content != "127.0.0.2" {
+		t.Fail()
+		t.Logf("The records should not have been changed: %+v", records["example.com"])
+	}
+}
+
+// With -apply the changes should be reverted and removed from the journal.
+func Test_rollbackAction_Apply_ChangesAreReverted(t *testing.T) {
+	// arrange
+	records, journal, client := getRollbackTestSetup()
+	rollbackAction := rollbackAction{testDNSClientFactory{client, nil}, journal}
+
+	// act
+	_, err := rollbackAction.Execute([]string{"-steps", "2", "-apply"})
+
+	// assert
+	if err != nil {
+		t.Fatalf("rollbackAction.Execute should not return an error: %s", err.Error())
+	}
+
+	expected := dnsimple.Record{Id: 1, Name: "www", RecordType: "A", Content: "127.0.0.1", Ttl: 600}
+	if len(records["example.com"]) != 1 || records["example.com"][0] != expected {
+		t.Fail()
+		t.Logf("The records should have been restored but are %+v", records["example.com"])
+	}
+
+	if entries, _ := journal.GetEntries(); len(entries) != 0 {
+		t.Fail()
+		t.Logf("The reverted changes should have been removed from the journal: %+v", entries)
+	}
+}
+
+// A deleted record is recreated with a new ID, so the older changes of the record should be reverted with the new ID.
+func Test_rollbackAction_Apply_RecreatedRecord_OlderChangesAreRevertedWithNewID(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "www", RecordType: "A", Content: "127.0.0.1", Ttl: 600},
+		},
+	}
+
+	client := newInMemoryTestDNSClient(records)
+	journal := filesystemJournal{afero.NewMemMapFs(), "/home/user/.dee/journal.json"}
+
+	journalingClient := journalingDNSClient{client, journal, time.Now, journalOrigin{}, nil}
+	journalingClient.UpdateRecord("example.com", "1", &dnsimple.ChangeRecord{Value: "127.0.0.2"})
+	journalingClient.UpdateRecord("example.com", "1", &dnsimple.ChangeRecord{Value: "127.0.0.3"})
+	journalingClient.DestroyRecord("example.com", "1")
+
+	rollbackAction := rollbackAction{testDNSClientFactory{client, nil}, journal}
+
+	// act
+	_, firstError := rollbackAction.Execute([]string{"-steps", "2", "-apply"})
+	_, secondError := rollbackAction.Execute([]string{"-apply"})
+
+	// assert
+	if firstError != nil || secondError != nil {
+		t.Fatalf("rollbackAction.Execute should not return an error: %v, %v", firstError, secondError)
+	}
+
+	if len(records["example.com"]) != 1 || records["example.com"][0].Content != "127.0.0.1" || records["example.com"][0].Name != "www" {
+		t.Fail()
+		t.Logf("The recreated record should have been restored but the records are %+v", records["example.com"])
+	}
+}
+
+// A failed revert should report the error and remove only the reverted changes from the journal.
+func Test_rollbackAction_Apply_RevertFails_RevertedChangesAreRemoved(t *testing.T) {
+	// arrange
+	_, journal, client := getRollbackTestSetup()
+	client.updateRecordFunc = func(domain string, id string, opts *dnsimple.ChangeRecord) (string, error) {
+		return "", fmt.Errorf("The API is unavailable")
+	}
+
+	rollbackAction := rollbackAction{testDNSClientFactory{client, nil}, journal}
+
+	// act
+	_, err := rollbackAction.Execute([]string{"-steps", "2", "-apply"})
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), "Rolled back 1 of 2 changes") {
+		t.Fail()
+		t.Logf("rollbackAction.Execute should report the failed revert but returned %v", err)
+	}
+
+	if entries, _ := journal.GetEntries(); len(entries) != 1 || entries[0].Operation != journalOperationUpdate {
+		t.Fail()
+		t.Logf("Only the reverted change should have been removed from the journal: %+v", entries)
+	}
+}
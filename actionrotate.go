@@ -0,0 +1,178 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	actionNameRotate = "rotate"
+
+	rotateArguments = flag.NewFlagSet(actionNameRotate, flag.ContinueOnError)
+	rotateDomain    = rotateArguments.String("domain", "", "Domain (e.g. example.com)")
+	rotateSubdomain = rotateArguments.String("subdomain", "", "Subdomain (e.g. www)")
+	rotateIPs       = rotateArguments.String("ips", "", "A comma-separated list of IP addresses with optional weights (e.g. 203.0.113.1=3,198.51.100.2=1)")
+	rotateInterval  = rotateArguments.Duration("interval", 5*time.Minute, "The time between two rotations")
+	rotateTTL       = rotateArguments.Int("ttl", 60, "The time to live in seconds")
+)
+
+type rotateAction struct {
+	clientFactory dnsClientFactory
+	sleep         func(duration time.Duration)
+	log           logger
+	ttlPolicy     ttlPolicyProvider
+}
+
+func (action rotateAction) Name() string {
+	return actionNameRotate
+}
+
+func (action rotateAction) Description() string {
+	return "Periodically rotate an address record between a set of weighted IPs"
+}
+
+func (action rotateAction) Usage() string {
+	buf := new(bytes.Buffer)
+	rotateArguments.SetOutput(buf)
+	rotateArguments.PrintDefaults()
+	return buf.String()
+}
+
+// Execute points the address record to the next IP of the weighted
+// rotation after each interval until the process is stopped.
+func (action rotateAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*rotateDomain = ""
+	*rotateSubdomain = ""
+	*rotateIPs = ""
+	*rotateInterval = 5 * time.Minute
+	*rotateTTL = 60
+	if parseError := rotateArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if *rotateDomain == "" {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	rotation, rotationError := newRecordRotation(*rotateIPs)
+	if rotationError != nil {
+		return nil, rotationError
+	}
+
+	if *rotateInterval <= 0 {
+		return nil, fmt.Errorf("The interval must be positive")
+	}
+
+	if *rotateTTL < 0 {
+		return nil, fmt.Errorf("The given TTL cannot be negative")
+	}
+
+	// the short TTL of the rotated record is kept unless it is below the minimum of the policy
+	ttl, ttlError := applyRecordTTLPolicy(action.ttlPolicy, actionNameRotate, true, *rotateTTL)
+	if ttlError != nil {
+		return nil, ttlError
+	}
+
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	fullDomainName := getFormattedDomainName(*rotateSubdomain, *rotateDomain)
+	log := action.log.With(logFields{Domain: *rotateDomain, Subdomain: *rotateSubdomain, Action: actionNameRotate})
+	for {
+		ip := rotation.Next()
+		if _, err := setRecord(client, *rotateDomain, *rotateSubdomain, getDNSRecordTypeByIP(ip), ip.String(), ttl); err != nil {
+			log.With(logFields{Error: err}).Errorf("Unable to point %s to %s", fullDomainName, ip)
+		} else {
+			log.Infof("Pointed %s to %s", fullDomainName, ip)
+		}
+
+		action.sleep(*rotateInterval)
+	}
+}
+
+// weightedIP is an IP address of a record rotation.
+type weightedIP struct {
+	ip     net.IP
+	weight int
+}
+
+// newRecordRotation creates a record rotation from the given list of
+// IP addresses with optional weights (e.g. "203.0.113.1=3,198.51.100.2").
+func newRecordRotation(list string) (*recordRotation, error) {
+	var ips []weightedIP
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		ipAndWeight := strings.SplitN(entry, "=", 2)
+		ip := net.ParseIP(strings.TrimSpace(ipAndWeight[0]))
+		if ip == nil {
+			return nil, fmt.Errorf("Cannot parse IP %q", ipAndWeight[0])
+		}
+
+		weight := 1
+		if len(ipAndWeight) == 2 {
+			parsedWeight, parseError := strconv.Atoi(strings.TrimSpace(ipAndWeight[1]))
+			if parseError != nil || parsedWeight < 1 {
+				return nil, fmt.Errorf("The weight of %s must be a positive number", ip)
+			}
+
+			weight = parsedWeight
+		}
+
+		if len(ips) > 0 && getDNSRecordTypeByIP(ips[0].ip) != getDNSRecordTypeByIP(ip) {
+			return nil, fmt.Errorf("All IPs must be of the same address family")
+		}
+
+		ips = append(ips, weightedIP{ip, weight})
+	}
+
+	if len(ips) < 2 {
+		return nil, fmt.Errorf("At least two IPs are required for a rotation")
+	}
+
+	return &recordRotation{ips, make([]int, len(ips))}, nil
+}
+
+// recordRotation selects the IPs in a smooth weighted
+// round-robin order (e.g. a a b a for weights 3 and 1).
+type recordRotation struct {
+	ips     []weightedIP
+	current []int
+}
+
+// Next returns the next IP of the rotation.
+func (rotation *recordRotation) Next() net.IP {
+	total := 0
+	selected := 0
+	for index, entry := range rotation.ips {
+		rotation.current[index] += entry.weight
+		total += entry.weight
+
+		if rotation.current[index] > rotation.current[selected] {
+			selected = index
+		}
+	}
+
+	rotation.current[selected] -= total
+	return rotation.ips[selected].ip
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func Test_rotateAction_Name_CorrectActionNameIsReturned(t *testing.T) {
+
+	// arrange
+	rotateAction := rotateAction{}
+
+	// act
+	result := rotateAction.Name()
+
+	// assert
+	if result != "rotate" {
+		t.Fail()
+		t.Logf("rotateAction.Name() should have returned %q but returned %q instead.", "rotate", result)
+	}
+
+}
+
+func Test_rotateAction_Usage_ResultIsNotEmpty(t *testing.T) {
+
+	// arrange
+	rotateAction := rotateAction{}
+
+	// act
+	result := rotateAction.Usage()
+
+	// assert
+	if isEmpty(result) {
+		t.Fail()
+		t.Logf("rotateAction.Usage() not be empty.")
+	}
+
+}
+
+// rotateAction.Execute should return an error if the argument values are invalid.
+func Test_rotateAction_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{},
+		{"-domain", "example.com", "-ips", "203.0.113.1"},
+		{"-domain", "example.com", "-ips", "203.0.113.1,2001:db8::1"},
+		{"-domain", "example.com", "-ips", "203.0.113.1=0,198.51.100.2"},
+		{"-domain", "example.com", "-ips", "203.0.113.1,198.51.100.2", "-interval", "0s"},
+		{"-domain", "example.com", "-ips", "203.0.113.1,198.51.100.2", "-ttl", "-1"},
+	}
+
+	rotateAction := rotateAction{testDNSClientFactory{}, nil, logger{}, nil}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := rotateAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("rotateAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// The IPs should be selected in proportion to their weights.
+func Test_recordRotation_Next_IPsAreSelectedByWeight(t *testing.T) {
+	// arrange
+	rotation, _ := newRecordRotation("203.0.113.1=3, 198.51.100.2")
+
+	expected := []string{"203.0.113.1", "203.0.113.1", "198.51.100.2", "203.0.113.1", "203.0.113.1", "203.0.113.1", "198.51.100.2", "203.0.113.1"}
+
+	for index, expectedIP := range expected {
+
+		// act
+		ip := rotation.Next()
+
+		// assert
+		if ip.String() != expectedIP {
+			t.Fail()
+			t.Logf("Rotation %d should select %s but selected %s", index+1, expectedIP, ip)
+		}
+	}
+}
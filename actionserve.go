@@ -0,0 +1,403 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/andreaskoch/dnsimple-cli/pkg/ddns"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	actionNameServe = "serve"
+
+	serveArguments = flag.NewFlagSet(actionNameServe, flag.ContinueOnError)
+	serveListen    = serveArguments.String("listen", "127.0.0.1:8053", "The address the REST API listens on")
+	serveTokenFile = serveArguments.String("token-file", "", "A file containing the token clients must send as bearer token (default: DEE_API_TOKEN)")
+)
+
+// apexSubdomain is the subdomain name that addresses the records of the domain itself.
+const apexSubdomain = "@"
+
+// maxAPIRequestBodySize is the maximum size in bytes of the request body of the REST API.
+const maxAPIRequestBodySize = 64 * 1024
+
+// The timeouts of the REST API server. Every request needs at most one API
+// round-trip to DNSimple, so the write timeout leaves room for a slow API.
+const (
+	serveReadTimeout  = 10 * time.Second
+	serveWriteTimeout = 60 * time.Second
+	serveIdleTimeout  = 120 * time.Second
+)
+
+type serveAction struct {
+	editorFactory       dnsEditorCreator
+	infoProviderFactory dnsInfoProviderCreator
+	fs                  afero.Fs
+	getenv              func(key string) string
+	listenAndServe      func(address string, handler http.Handler) error
+	log                 logger
+	ttlPolicy           ttlPolicyProvider
+}
+
+func (action serveAction) Name() string {
+	return actionNameServe
+}
+
+func (action serveAction) Description() string {
+	return "Serve a local REST API for creating, updating, deleting and listing address records"
+}
+
+func (action serveAction) Usage() string {
+	buf := new(bytes.Buffer)
+	serveArguments.SetOutput(buf)
+	serveArguments.PrintDefaults()
+	return buf.String()
+}
+
+// Execute starts the REST API server and runs until the server fails.
+func (action serveAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*serveListen = "127.0.0.1:8053"
+	*serveTokenFile = ""
+	if parseError := serveArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if _, _, addressError := net.SplitHostPort(*serveListen); addressError != nil {
+		return nil, fmt.Errorf("Invalid listen address %q: %s", *serveListen, addressError.Error())
+	}
+
+	token, tokenError := action.getToken()
+	if tokenError != nil {
+		return nil, tokenError
+	}
+
+	if action.listenAndServe == nil {
+		return nil, fmt.Errorf("No HTTP server available")
+	}
+
+	handler := apiHandler{token, action.editorFactory, action.infoProviderFactory, action.log.With(logFields{Action: actionNameServe}), action.ttlPolicy}
+
+	action.log.Infof("Serving the REST API on %s", *serveListen)
+	if serveError := action.listenAndServe(*serveListen, handler); serveError != nil {
+		return nil, serveError
+	}
+
+	return successMessage{"The REST API server stopped"}, nil
+}
+
+// getToken returns the API token from the token file or the environment.
+func (action serveAction) getToken() (string, error) {
+	token := ""
+	if *serveTokenFile != "" {
+		content, readError := afero.ReadFile(action.fs, *serveTokenFile)
+		if readError != nil {
+			return "", fmt.Errorf("Cannot read the token file: %s", readError.Error())
+		}
+
+		token = string(content)
+	} else if action.getenv != nil {
+		token = action.getenv("DEE_API_TOKEN")
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("No API token supplied (use -token-file or DEE_API_TOKEN)")
+	}
+
+	return token, nil
+}
+
+// apiHandler serves the REST API:
+//
+//	GET    /domains
+//	GET    /domains/{domain}/records
+//	POST   /domains/{domain}/records               {"subdomain": "www", "ip": "203.0.113.1", "ttl": 600}
+//	GET    /domains/{domain}/records/{subdomain}
+//	PUT    /domains/{domain}/records/{subdomain}   {"ip": "203.0.113.2"}
+//	DELETE /domains/{domain}/records/{subdomain}?type=A
+//
+// The subdomain "@" addresses the domain itself.
+type apiHandler struct {
+	token               string
+	editorFactory       dnsEditorCreator
+	infoProviderFactory dnsInfoProviderCreator
+	log                 logger
+	ttlPolicy           ttlPolicyProvider
+}
+
+// apiRecordRequest is the request body for creating or updating an address record.
+type apiRecordRequest struct {
+	Subdomain string `json:"subdomain"`
+	IP        string `json:"ip"`
+	TTL       int    `json:"ttl"`
+}
+
+// apiRecord is the representation of a DNS record in API responses.
+type apiRecord struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	TTL     int64  `json:"ttl"`
+}
+
+// apiError is the response body of failed requests.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// apiMessage is the response body of successful changes.
+type apiMessage struct {
+	Message string `json:"message"`
+}
+
+// ServeHTTP authenticates the request and dispatches it to the matching operation.
+func (handler apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	status, body := handler.handle(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+
+	log := handler.log.With(logFields{Duration: time.Since(start)})
+	if status >= 400 {
+		log.Errorf("%s %s: %d", r.Method, r.URL.Path, status)
+		return
+	}
+
+	log.Infof("%s %s: %d", r.Method, r.URL.Path, status)
+}
+
+// handle executes the request and returns the status code and response body.
+func (handler apiHandler) handle(r *http.Request) (int, interface{}) {
+	if !handler.isAuthorized(r) {
+		return http.StatusUnauthorized, apiError{"Invalid or missing bearer token"}
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if segments[0] != "domains" {
+		return http.StatusNotFound, apiError{"Not found"}
+	}
+
+	switch {
+	case len(segments) == 1 && r.Method == "GET":
+		return handler.listDomains()
+
+	case len(segments) == 3 && segments[2] == "records":
+		switch r.Method {
+		case "GET":
+			return handler.listRecords(segments[1], nil)
+
+		case "POST":
+			return handler.createRecord(segments[1], r)
+		}
+
+	case len(segments) == 4 && segments[2] == "records":
+		subdomain := segments[3]
+		if subdomain == apexSubdomain {
+			subdomain = ""
+		}
+
+		switch r.Method {
+		case "GET":
+			return handler.listRecords(segments[1], &subdomain)
+
+		case "PUT":
+			return handler.updateRecord(segments[1], subdomain, r)
+
+		case "DELETE":
+			return handler.deleteRecord(segments[1], subdomain, r.URL.Query().Get("type"))
+		}
+
+	default:
+		return http.StatusNotFound, apiError{"Not found"}
+	}
+
+	return http.StatusMethodNotAllowed, apiError{fmt.Sprintf("Method %s not allowed", r.Method)}
+}
+
+// isAuthorized returns true if the request contains the expected bearer token.
+func (handler apiHandler) isAuthorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimPrefix(header, "Bearer ")
+	return handler.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(handler.token)) == 1
+}
+
+// listDomains returns the names of all domains.
+func (handler apiHandler) listDomains() (int, interface{}) {
+	infoProvider, infoProviderError := handler.infoProviderFactory.CreateInfoProvider()
+	if infoProviderError != nil {
+		return http.StatusInternalServerError, apiError{infoProviderError.Error()}
+	}
+
+	domains, domainsError := infoProvider.GetDomainNames()
+	if domainsError != nil {
+		return http.StatusBadGateway, apiError{domainsError.Error()}
+	}
+
+	if domains == nil {
+		domains = []string{}
+	}
+
+	return http.StatusOK, domains
+}
+
+// listRecords returns the records of the given domain or, if
+// a subdomain is given, of the given subdomain.
+func (handler apiHandler) listRecords(domain string, subdomain *string) (int, interface{}) {
+	infoProvider, infoProviderError := handler.infoProviderFactory.CreateInfoProvider()
+	if infoProviderError != nil {
+		return http.StatusInternalServerError, apiError{infoProviderError.Error()}
+	}
+
+	var records []dnsimple.Record
+	var recordsError error
+	if subdomain == nil {
+		records, recordsError = infoProvider.GetDomainRecords(domain)
+	} else {
+		records, recordsError = infoProvider.GetSubdomainRecords(domain, *subdomain)
+	}
+
+	if recordsError != nil {
+		return http.StatusBadGateway, apiError{recordsError.Error()}
+	}
+
+	result := []apiRecord{}
+	for _, record := range records {
+		result = append(result, apiRecord{record.Id, record.Name, record.RecordType, record.Content, record.Ttl})
+	}
+
+	return http.StatusOK, result
+}
+
+// createRecord creates an address record from the request body.
+func (handler apiHandler) createRecord(domain string, r *http.Request) (int, interface{}) {
+	request, ip, requestError := parseAPIRecordRequest(r)
+	if requestError != nil {
+		return http.StatusBadRequest, apiError{requestError.Error()}
+	}
+
+	// address records of the API are dynamic DNS records
+	ttl, ttlError := applyRecordTTLPolicy(handler.ttlPolicy, actionNameServe, true, request.TTL)
+	if ttlError != nil {
+		return http.StatusInternalServerError, apiError{ttlError.Error()}
+	}
+
+	if validationError := validateRecord(request.Subdomain, getDNSRecordTypeByIP(ip), ip.String(), ttl); validationError != nil {
+		return http.StatusBadRequest, apiError{validationError.Error()}
+	}
+
+	editor, editorError := handler.editorFactory.CreateDNSEditor()
+	if editorError != nil {
+		return http.StatusInternalServerError, apiError{editorError.Error()}
+	}
+
+	if createError := editor.CreateSubdomain(domain, request.Subdomain, ttl, ip); createError != nil {
+		return http.StatusUnprocessableEntity, apiError{createError.Error()}
+	}
+
+	return http.StatusCreated, apiMessage{fmt.Sprintf("Created: %s → %s", getFormattedDomainName(request.Subdomain, domain), ip.String())}
+}
+
+// updateRecord updates the IP address of the given subdomain.
+func (handler apiHandler) updateRecord(domain, subdomain string, r *http.Request) (int, interface{}) {
+	_, ip, requestError := parseAPIRecordRequest(r)
+	if requestError != nil {
+		return http.StatusBadRequest, apiError{requestError.Error()}
+	}
+
+	editor, editorError := handler.editorFactory.CreateDNSEditor()
+	if editorError != nil {
+		return http.StatusInternalServerError, apiError{editorError.Error()}
+	}
+
+	updateError := editor.UpdateSubdomain(domain, subdomain, ip)
+	if ddns.IsUnchangedError(updateError) {
+		return http.StatusOK, apiMessage{getUnchangedAddressMessage(subdomain, domain, ip).Text()}
+	}
+
+	if updateError != nil {
+		return http.StatusUnprocessableEntity, apiError{updateError.Error()}
+	}
+
+	return http.StatusOK, apiMessage{fmt.Sprintf("Updated: %s → %s", getFormattedDomainName(subdomain, domain), ip.String())}
+}
+
+// deleteRecord deletes the address record of the given type.
+func (handler apiHandler) deleteRecord(domain, subdomain, recordType string) (int, interface{}) {
+	recordType = strings.ToUpper(recordType)
+	if recordType != "A" && recordType != "AAAA" {
+		return http.StatusBadRequest, apiError{"The type parameter must be A or AAAA"}
+	}
+
+	editor, editorError := handler.editorFactory.CreateDNSEditor()
+	if editorError != nil {
+		return http.StatusInternalServerError, apiError{editorError.Error()}
+	}
+
+	if deleteError := editor.DeleteSubdomain(domain, subdomain, recordType); deleteError != nil {
+		return http.StatusUnprocessableEntity, apiError{deleteError.Error()}
+	}
+
+	return http.StatusOK, apiMessage{fmt.Sprintf("Deleted: %s (%s)", getFormattedDomainName(subdomain, domain), recordType)}
+}
+
+// parseAPIRecordRequest decodes the request body and parses its IP address.
+// Request bodies larger than maxAPIRequestBodySize are rejected.
+func parseAPIRecordRequest(r *http.Request) (apiRecordRequest, net.IP, error) {
+	var request apiRecordRequest
+	body := http.MaxBytesReader(nil, r.Body, maxAPIRequestBodySize)
+	if decodeError := json.NewDecoder(body).Decode(&request); decodeError != nil {
+		if _, tooLarge := decodeError.(*http.MaxBytesError); tooLarge {
+			return apiRecordRequest{}, nil, fmt.Errorf("The request body is larger than %d bytes", maxAPIRequestBodySize)
+		}
+
+		return apiRecordRequest{}, nil, fmt.Errorf("Invalid request body: %s", decodeError.Error())
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(request.IP))
+	if ip == nil {
+		return apiRecordRequest{}, nil, fmt.Errorf("Invalid IP address: %q", request.IP)
+	}
+
+	if request.Subdomain == apexSubdomain {
+		request.Subdomain = ""
+	}
+
+	return request, ip, nil
+}
+
+// listenAndServe serves the given handler on the given address with the
+// timeouts of the REST API, so slow clients cannot hold connections open.
+func listenAndServe(address string, handler http.Handler) error {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: serveReadTimeout,
+		ReadTimeout:       serveReadTimeout,
+		WriteTimeout:      serveWriteTimeout,
+		IdleTimeout:       serveIdleTimeout,
+	}
+
+	return server.ListenAndServe()
+}
@@ -0,0 +1,270 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// getTestAPIHandler returns an API handler with the token "secret" that
+// records the executed changes.
+func getTestAPIHandler(changes *[]string) apiHandler {
+	editor := &testDNSEditor{
+		createSubdomainFunc: func(domain, subdomain string, timeToLive int, ip net.IP) error {
+			*changes = append(*changes, fmt.Sprintf("create %s %s %s %d", domain, subdomain, ip, timeToLive))
+			return nil
+		},
+		updateSubdomainFunc: func(domain, subdomain string, ip net.IP) error {
+			if subdomain == "missing" {
+				return fmt.Errorf("No address record found")
+			}
+
+			*changes = append(*changes, fmt.Sprintf("update %s %s %s", domain, subdomain, ip))
+			return nil
+		},
+		deleteSubdomainFunc: func(domain, subdomain string, recordType string) error {
+			*changes = append(*changes, fmt.Sprintf("delete %s %s %s", domain, subdomain, recordType))
+			return nil
+		},
+	}
+
+	infoProvider := testDNSInfoProvider{
+		getDomainNamesFunc: func() ([]string, error) {
+			return []string{"example.com"}, nil
+		},
+		getDomainRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{{Id: 1, Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 600}}, nil
+		},
+		getSubdomainRecordsFunc: func(domain, subdomain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{{Id: 1, Name: subdomain, RecordType: "A", Content: "203.0.113.1", Ttl: 600}}, nil
+		},
+	}
+
+	return apiHandler{"secret", testDNSEditorFactory{editor, nil}, testInfoProviderFactory{infoProvider, nil}, logger{}, nil}
+}
+
+// sendTestAPIRequest sends the given request to the handler and returns the response.
+func sendTestAPIRequest(handler http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func Test_serveAction_Name_CorrectActionNameIsReturned(t *testing.T) {
+
+	// arrange
+	serveAction := serveAction{}
+
+	// act
+	result := serveAction.Name()
+
+	// assert
+	if result != "serve" {
+		t.Fail()
+		t.Logf("serveAction.Name() should have returned %q but returned %q instead.", "serve", result)
+	}
+
+}
+
+func Test_serveAction_Usage_ResultIsNotEmpty(t *testing.T) {
+
+	// arrange
+	serveAction := serveAction{}
+
+	// act
+	result := serveAction.Usage()
+
+	// assert
+	if isEmpty(result) {
+		t.Fail()
+		t.Logf("serveAction.Usage() not be empty.")
+	}
+
+}
+
+// serveAction.Execute should refuse to start without an API token.
+func Test_serveAction_InvalidArguments_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{},
+		{"-listen", "8053"},
+		{"-token-file", "/home/user/missing"},
+	}
+
+	started := false
+	listenAndServe := func(address string, handler http.Handler) error {
+		started = true
+		return nil
+	}
+
+	serveAction := serveAction{nil, nil, afero.NewMemMapFs(), getTestEnvironment(nil), listenAndServe, logger{}, nil}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := serveAction.Execute(arguments)
+
+		// assert
+		if err == nil || started {
+			t.Fail()
+			t.Logf("serveAction.Execute(%q) should return an error and not start the server", arguments)
+		}
+	}
+}
+
+// serveAction.Execute should start the server with the token from the token file.
+func Test_serveAction_TokenFile_ServerIsStarted(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/etc/dee/token", []byte("secret\n"), 0600)
+
+	var listenAddress string
+	var token string
+	listenAndServe := func(address string, handler http.Handler) error {
+		listenAddress = address
+		token = handler.(apiHandler).token
+		return nil
+	}
+
+	serveAction := serveAction{nil, nil, fs, getTestEnvironment(nil), listenAndServe, logger{}, nil}
+
+	// act
+	_, err := serveAction.Execute([]string{"-listen", "127.0.0.1:9000", "-token-file", "/etc/dee/token"})
+
+	// assert
+	if err != nil || listenAddress != "127.0.0.1:9000" || token != "secret" {
+		t.Fail()
+		t.Logf("serveAction.Execute should start the server on 127.0.0.1:9000 with the token %q but used %q and %q (error: %v)", "secret", listenAddress, token, err)
+	}
+}
+
+// Requests without a valid bearer token should be rejected.
+func Test_apiHandler_InvalidToken_RequestIsRejected(t *testing.T) {
+	// arrange
+	var changes []string
+	handler := getTestAPIHandler(&changes)
+
+	for _, token := range []string{"", "wrong"} {
+
+		// act
+		response := sendTestAPIRequest(handler, "POST", "/domains/example.com/records", token, `{"subdomain":"www","ip":"203.0.113.1"}`)
+
+		// assert
+		if response.Code != http.StatusUnauthorized || len(changes) != 0 {
+			t.Fail()
+			t.Logf("A request with the token %q should be rejected but returned %d", token, response.Code)
+		}
+	}
+}
+
+// The API should only accept the token in the bearer scheme.
+func Test_apiHandler_TokenWithoutBearerScheme_RequestIsRejected(t *testing.T) {
+	// arrange
+	var changes []string
+	handler := getTestAPIHandler(&changes)
+
+	for _, authorization := range []string{"secret", "Basic secret", "bearer secret"} {
+		request := httptest.NewRequest("POST", "/domains/example.com/records", strings.NewReader(`{"subdomain":"www","ip":"203.0.113.1"}`))
+		request.Header.Set("Authorization", authorization)
+		response := httptest.NewRecorder()
+
+		// act
+		handler.ServeHTTP(response, request)
+
+		// assert
+		if response.Code != http.StatusUnauthorized || len(changes) != 0 {
+			t.Fail()
+			t.Logf("A request with the Authorization header %q should be rejected but returned %d", authorization, response.Code)
+		}
+	}
+}
+
+// The API should reject request bodies that exceed the size limit.
+func Test_apiHandler_RequestBodyTooLarge_RequestIsRejected(t *testing.T) {
+	// arrange
+	var changes []string
+	handler := getTestAPIHandler(&changes)
+	body := `{"subdomain":"www","ip":"203.0.113.1","padding":"` + strings.Repeat("x", maxAPIRequestBodySize) + `"}`
+
+	// act
+	response := sendTestAPIRequest(handler, "POST", "/domains/example.com/records", "secret", body)
+
+	// assert
+	if response.Code != http.StatusBadRequest || len(changes) != 0 || !strings.Contains(response.Body.String(), "larger than") {
+		t.Fail()
+		t.Logf("A request body larger than %d bytes should be rejected but returned %d: %s", maxAPIRequestBodySize, response.Code, response.Body.String())
+	}
+}
+
+// The API should execute the create, update, delete and list operations.
+func Test_apiHandler_Operations_ChangesAreExecuted(t *testing.T) {
+	// arrange
+	var changes []string
+	handler := getTestAPIHandler(&changes)
+
+	inputs := []struct {
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"GET", "/domains", "", http.StatusOK, `["example.com"]`},
+		{"GET", "/domains/example.com/records", "", http.StatusOK, `[{"id":1,"name":"www","type":"A","content":"203.0.113.1","ttl":600}]`},
+		{"GET", "/domains/example.com/records/www", "", http.StatusOK, `[{"id":1,"name":"www","type":"A","content":"203.0.113.1","ttl":600}]`},
+		{"POST", "/domains/example.com/records", `{"subdomain":"www","ip":"203.0.113.1"}`, http.StatusCreated, `{"message":"Created: www.example.com → 203.0.113.1"}`},
+		{"PUT", "/domains/example.com/records/@", `{"ip":"2001:db8::1"}`, http.StatusOK, `{"message":"Updated: example.com → 2001:db8::1"}`},
+		{"DELETE", "/domains/example.com/records/www?type=aaaa", "", http.StatusOK, `{"message":"Deleted: www.example.com (AAAA)"}`},
+		{"POST", "/domains/example.com/records", `{"subdomain":"www","ip":"not-an-ip"}`, http.StatusBadRequest, ""},
+		{"PUT", "/domains/example.com/records/missing", `{"ip":"203.0.113.1"}`, http.StatusUnprocessableEntity, ""},
+		{"DELETE", "/domains/example.com/records/www", "", http.StatusBadRequest, ""},
+		{"PATCH", "/domains/example.com/records/www", "", http.StatusMethodNotAllowed, ""},
+		{"GET", "/zones", "", http.StatusNotFound, ""},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		response := sendTestAPIRequest(handler, input.method, input.path, "secret", input.body)
+
+		// assert
+		if response.Code != input.expectedStatus {
+			t.Fail()
+			t.Logf("%s %s should return %d but returned %d: %s", input.method, input.path, input.expectedStatus, response.Code, response.Body.String())
+			continue
+		}
+
+		if input.expectedBody != "" && strings.TrimSpace(response.Body.String()) != input.expectedBody {
+			t.Fail()
+			t.Logf("%s %s should return %s but returned %s", input.method, input.path, input.expectedBody, response.Body.String())
+		}
+	}
+
+	expectedChanges := []string{
+		"create example.com www 203.0.113.1 600",
+		"update example.com  2001:db8::1",
+		"delete example.com www AAAA",
+	}
+
+	changesJSON, _ := json.Marshal(changes)
+	expectedJSON, _ := json.Marshal(expectedChanges)
+	if string(changesJSON) != string(expectedJSON) {
+		t.Fail()
+		t.Logf("The API should have executed %s but executed %s", expectedJSON, changesJSON)
+	}
+}
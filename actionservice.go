@@ -0,0 +1,281 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var (
+	actionNameService = "service"
+
+	serviceInstallArguments = flag.NewFlagSet(actionNameService+" install", flag.ContinueOnError)
+	serviceInstallName      = serviceInstallArguments.String("name", "dee", "The name of the Windows service")
+	serviceInstallConfig    = serviceInstallArguments.String("config", "", "The path of the configuration file of the daemon (default: ~/.dee/config.json of the service account)")
+
+	serviceControlArguments = flag.NewFlagSet(actionNameService+" uninstall|start|stop", flag.ContinueOnError)
+	serviceControlName      = serviceControlArguments.String("name", "dee", "The name of the Windows service")
+
+	serviceRunArguments = flag.NewFlagSet(actionNameService+" run", flag.ContinueOnError)
+	serviceRunName      = serviceRunArguments.String("name", "dee", "The name of the Windows service")
+	serviceRunConfig    = serviceRunArguments.String("config", "", "The path of the configuration file of the daemon")
+)
+
+// eventLog writes messages to the Windows event log.
+type eventLog interface {
+	Info(message string) error
+	Error(message string) error
+}
+
+type serviceAction struct {
+	goos       string
+	executable func() (string, error)
+	runCommand func(input []byte, name string, arguments ...string) ([]byte, error)
+	getActions func() []action
+
+	// runService runs the given function as the Windows service with the given
+	// name. The function writes its log to the event log and must return after
+	// the stop channel was closed (the service is stopped when it returned).
+	runService func(name string, run func(events eventLog, stop <-chan bool)) error
+}
+
+func (action serviceAction) Name() string {
+	return actionNameService
+}
+
+func (action serviceAction) Description() string {
+	return "Install and control the daemon as a Windows service"
+}
+
+func (action serviceAction) Usage() string {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "  %s install [arguments ...]\n", actionNameService)
+	serviceInstallArguments.SetOutput(buf)
+	serviceInstallArguments.PrintDefaults()
+
+	fmt.Fprintf(buf, "  %s uninstall|start|stop [arguments ...]\n", actionNameService)
+	serviceControlArguments.SetOutput(buf)
+	serviceControlArguments.PrintDefaults()
+
+	fmt.Fprintf(buf, "  %s run [arguments ...] (used by the service control manager)\n", actionNameService)
+	serviceRunArguments.SetOutput(buf)
+	serviceRunArguments.PrintDefaults()
+
+	return buf.String()
+}
+
+// Execute runs the given service sub command
+// ("install", "uninstall", "start", "stop" or "run").
+func (action serviceAction) Execute(arguments []string) (message, error) {
+	if len(arguments) == 0 {
+		return nil, fmt.Errorf("No sub command supplied (install, uninstall, start, stop)")
+	}
+
+	if action.goos != "windows" {
+		return nil, fmt.Errorf("Services are only supported on Windows (use systemd, launchd or cron to run \"dee daemon\" on %s)", action.goos)
+	}
+
+	if action.runCommand == nil {
+		return nil, fmt.Errorf("No command runner available")
+	}
+
+	switch arguments[0] {
+	case "install":
+		return action.install(arguments[1:])
+
+	case "uninstall":
+		return action.uninstall(arguments[1:])
+
+	case "start":
+		return action.control("start", "Started", arguments[1:])
+
+	case "stop":
+		return action.control("stop", "Stopped", arguments[1:])
+
+	case "run":
+		return action.run(arguments[1:])
+	}
+
+	return nil, fmt.Errorf("Unknown sub command %q", arguments[0])
+}
+
+// install registers the daemon with the service control manager (started
+// automatically at boot) and registers the event log source of the service.
+func (action serviceAction) install(arguments []string) (message, error) {
+
+	// parse the arguments
+	*serviceInstallName = "dee"
+	*serviceInstallConfig = ""
+	if parseError := serviceInstallArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	name := strings.TrimSpace(*serviceInstallName)
+	if name == "" || strings.ContainsAny(name, `\/" `) {
+		return nil, fmt.Errorf("Invalid service name %q", name)
+	}
+
+	executablePath, executableError := action.executable()
+	if executableError != nil {
+		return nil, fmt.Errorf("Cannot determine the path of dee: %s", executableError.Error())
+	}
+
+	commandLine := fmt.Sprintf(`"%s" %s run -name %s`, executablePath, actionNameService, name)
+	if *serviceInstallConfig != "" {
+		commandLine += fmt.Sprintf(` -config "%s"`, *serviceInstallConfig)
+	}
+
+	commands := [][]string{
+		{"sc.exe", "create", name, "binPath=", commandLine, "start=", "auto", "DisplayName=", "dee dynamic DNS (" + name + ")"},
+		{"sc.exe", "description", name, "Runs the scheduled tasks of the dee configuration file"},
+		{"reg.exe", "add", getEventSourceKey(name), "/v", "EventMessageFile", "/t", "REG_EXPAND_SZ", "/d", `%SystemRoot%\System32\EventCreate.exe`, "/f"},
+		{"reg.exe", "add", getEventSourceKey(name), "/v", "TypesSupported", "/t", "REG_DWORD", "/d", "7", "/f"},
+	}
+
+	for _, command := range commands {
+		if commandError := action.runServiceCommand(command); commandError != nil {
+			return nil, commandError
+		}
+	}
+
+	return successMessage{fmt.Sprintf("Installed the service %q (%s)\nStart it with \"dee service start -name %s\"", name, commandLine, name)}, nil
+}
+
+// uninstall stops and removes the service and its event log source.
+func (action serviceAction) uninstall(arguments []string) (message, error) {
+
+	// parse the arguments
+	*serviceControlName = "dee"
+	if parseError := serviceControlArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	name := *serviceControlName
+
+	// the service might not be running
+	action.runServiceCommand([]string{"sc.exe", "stop", name})
+
+	if deleteError := action.runServiceCommand([]string{"sc.exe", "delete", name}); deleteError != nil {
+		return nil, deleteError
+	}
+
+	if sourceError := action.runServiceCommand([]string{"reg.exe", "delete", getEventSourceKey(name), "/f"}); sourceError != nil {
+		return nil, sourceError
+	}
+
+	return successMessage{fmt.Sprintf("Uninstalled the service %q", name)}, nil
+}
+
+// control starts or stops the service.
+func (action serviceAction) control(command, done string, arguments []string) (message, error) {
+
+	// parse the arguments
+	*serviceControlName = "dee"
+	if parseError := serviceControlArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if commandError := action.runServiceCommand([]string{"sc.exe", command, *serviceControlName}); commandError != nil {
+		return nil, commandError
+	}
+
+	return successMessage{fmt.Sprintf("%s the service %q", done, *serviceControlName)}, nil
+}
+
+// run executes the daemon under the service control manager
+// and writes the log of the daemon to the event log.
+func (action serviceAction) run(arguments []string) (message, error) {
+
+	// parse the arguments
+	*serviceRunName = "dee"
+	*serviceRunConfig = ""
+	if parseError := serviceRunArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if action.getActions == nil || action.runService == nil {
+		return nil, fmt.Errorf("No service host available")
+	}
+
+	daemon, isDaemon := getActionByName(actionNameDaemon, action.getActions()).(daemonAction)
+	if !isDaemon {
+		return nil, fmt.Errorf("The daemon action is not available")
+	}
+
+	var configArguments []string
+	if *serviceRunConfig != "" {
+		configArguments = []string{"-config", *serviceRunConfig}
+	}
+
+	serviceError := action.runService(*serviceRunName, func(events eventLog, stop <-chan bool) {
+		daemon.log = daemon.log.WithOutput(eventLogWriter{events})
+		daemon.stop = stop
+		if _, daemonError := daemon.Execute(configArguments); daemonError != nil {
+			events.Error(fmt.Sprintf("The daemon failed: %s", daemonError.Error()))
+		}
+	})
+
+	if serviceError != nil {
+		return nil, serviceError
+	}
+
+	return successMessage{fmt.Sprintf("The service %q stopped", *serviceRunName)}, nil
+}
+
+// runServiceCommand runs the given command and adds its output to the error.
+func (action serviceAction) runServiceCommand(command []string) error {
+	output, commandError := action.runCommand(nil, command[0], command[1:]...)
+	if commandError != nil {
+		return fmt.Errorf("%s %s failed: %s %s", command[0], command[1], commandError.Error(), strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// getEventSourceKey returns the registry key of the event log source of the given service.
+func getEventSourceKey(name string) string {
+	return `HKLM\SYSTEM\CurrentControlSet\Services\EventLog\Application\` + name
+}
+
+// eventLogWriter writes the log lines of the daemon to an event log.
+// ERROR lines are written as errors, all other lines as information.
+type eventLogWriter struct {
+	events eventLog
+}
+
+// Write writes the given log line to the event log.
+func (writer eventLogWriter) Write(data []byte) (int, error) {
+	line := strings.TrimSpace(string(data))
+	if line == "" {
+		return len(data), nil
+	}
+
+	var writeError error
+	if isErrorLogLine(line) {
+		writeError = writer.events.Error(line)
+	} else {
+		writeError = writer.events.Info(line)
+	}
+
+	if writeError != nil {
+		return 0, writeError
+	}
+
+	return len(data), nil
+}
+
+// isErrorLogLine returns true if the given text or JSON log line has the level ERROR.
+func isErrorLogLine(line string) bool {
+	if strings.HasPrefix(line, "{") {
+		return strings.Contains(line, `"level":"ERROR"`)
+	}
+
+	fields := strings.Fields(line)
+	return len(fields) > 1 && fields[1] == "ERROR"
+}
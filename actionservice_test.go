@@ -0,0 +1,156 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testEventLog records the messages written to the event log.
+type testEventLog struct {
+	infos  *[]string
+	errors *[]string
+}
+
+func (events testEventLog) Info(message string) error {
+	*events.infos = append(*events.infos, message)
+	return nil
+}
+
+func (events testEventLog) Error(message string) error {
+	*events.errors = append(*events.errors, message)
+	return nil
+}
+
+// getTestServiceAction returns a Windows service action that records the commands it runs.
+func getTestServiceAction(commands *[]string) serviceAction {
+	runCommand := func(input []byte, name string, arguments ...string) ([]byte, error) {
+		*commands = append(*commands, name+" "+strings.Join(arguments, " "))
+		return nil, nil
+	}
+
+	executable := func() (string, error) {
+		return `C:\Program Files\dee\dee.exe`, nil
+	}
+
+	return serviceAction{"windows", executable, runCommand, nil, nil}
+}
+
+// service install should register the service and its event log source.
+func Test_serviceAction_Install_ServiceAndEventSourceAreRegistered(t *testing.T) {
+	// arrange
+	var commands []string
+	action := getTestServiceAction(&commands)
+
+	// act
+	_, err := action.Execute([]string{"install", "-name", "dee-home", "-config", `C:\dee\config.json`})
+
+	// assert
+	if err != nil {
+		t.Fatalf("service install should succeed: %s", err.Error())
+	}
+
+	expected := []string{
+		`sc.exe create dee-home binPath= "C:\Program Files\dee\dee.exe" service run -name dee-home -config "C:\dee\config.json" start= auto DisplayName= dee dynamic DNS (dee-home)`,
+		`sc.exe description dee-home`,
+		`reg.exe add HKLM\SYSTEM\CurrentControlSet\Services\EventLog\Application\dee-home /v EventMessageFile`,
+		`reg.exe add HKLM\SYSTEM\CurrentControlSet\Services\EventLog\Application\dee-home /v TypesSupported`,
+	}
+
+	if len(commands) != len(expected) {
+		t.Fatalf("service install should run %d commands but ran %q", len(expected), commands)
+	}
+
+	for index, command := range commands {
+		if !strings.HasPrefix(command, expected[index]) {
+			t.Fail()
+			t.Logf("Command %d should start with %q but is %q", index+1, expected[index], command)
+		}
+	}
+}
+
+// service start and stop should control the service with sc.exe.
+func Test_serviceAction_StartStop_ServiceIsControlled(t *testing.T) {
+	// arrange
+	var commands []string
+	action := getTestServiceAction(&commands)
+
+	// act
+	_, startError := action.Execute([]string{"start"})
+	_, stopError := action.Execute([]string{"stop", "-name", "dee-home"})
+
+	// assert
+	if startError != nil || stopError != nil {
+		t.Fatalf("service start and stop should succeed (%v, %v)", startError, stopError)
+	}
+
+	if strings.Join(commands, "\n") != "sc.exe start dee\nsc.exe stop dee-home" {
+		t.Fail()
+		t.Logf("The service should be started and stopped but the commands are %q", commands)
+	}
+}
+
+// Failing commands should be reported with their output.
+func Test_serviceAction_CommandFails_ErrorIsReturned(t *testing.T) {
+	// arrange
+	action := getTestServiceAction(&[]string{})
+	action.runCommand = func(input []byte, name string, arguments ...string) ([]byte, error) {
+		return []byte("[SC] OpenService FAILED 5: Access is denied."), fmt.Errorf("exit status 5")
+	}
+
+	// act
+	_, err := action.Execute([]string{"start"})
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), "Access is denied") {
+		t.Fail()
+		t.Logf("service start should report the output of sc.exe but returned %v", err)
+	}
+}
+
+// The service commands should be refused on other platforms.
+func Test_serviceAction_NotWindows_ErrorIsReturned(t *testing.T) {
+	// arrange
+	var commands []string
+	action := getTestServiceAction(&commands)
+	action.goos = "linux"
+
+	// act
+	_, err := action.Execute([]string{"install"})
+
+	// assert
+	if err == nil || len(commands) > 0 {
+		t.Fail()
+		t.Logf("service install should fail on linux without running commands")
+	}
+}
+
+// The daemon log lines should be written to the event log with their level.
+func Test_eventLogWriter_LinesAreWrittenWithTheirLevel(t *testing.T) {
+	// arrange
+	var infos, errors []string
+	log := newLogger(eventLogWriter{testEventLog{&infos, &errors}}, nil)
+
+	jsonFormat := logFormatJSON
+	jsonLog := newLogger(eventLogWriter{testEventLog{&infos, &errors}}, &jsonFormat)
+
+	// act
+	log.Infof("update home IP: Updated home.example.com")
+	log.Errorf("update home IP failed")
+	jsonLog.Errorf("CAA audit failed")
+
+	// assert
+	if len(infos) != 1 || !strings.Contains(infos[0], "Updated home.example.com") {
+		t.Fail()
+		t.Logf("The INFO line should be written as information but the information events are %q", infos)
+	}
+
+	if len(errors) != 2 {
+		t.Fail()
+		t.Logf("The ERROR lines should be written as errors but the error events are %q", errors)
+	}
+}
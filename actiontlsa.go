@@ -0,0 +1,398 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"github.com/spf13/afero"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	actionNameTLSA = "tlsa"
+
+	tlsaSetArguments    = flag.NewFlagSet(actionNameTLSA+" set", flag.ContinueOnError)
+	tlsaSetDomain       = tlsaSetArguments.String("domain", "", "Domain (e.g. example.com)")
+	tlsaSetSubdomain    = tlsaSetArguments.String("subdomain", "", "Subdomain (e.g. www)")
+	tlsaSetPort         = tlsaSetArguments.Int("port", 443, "The port of the TLS service")
+	tlsaSetProtocol     = tlsaSetArguments.String("protocol", "tcp", "The transport protocol of the TLS service")
+	tlsaSetCertificate  = tlsaSetArguments.String("cert", "", "Path to the PEM-encoded certificate chain (e.g. ./fullchain.pem)")
+	tlsaSetUsage        = tlsaSetArguments.Int("usage", 3, "Certificate usage (0: PKIX-TA, 1: PKIX-EE, 2: DANE-TA, 3: DANE-EE)")
+	tlsaSetSelector     = tlsaSetArguments.Int("selector", 1, "Selector (0: full certificate, 1: subject public key)")
+	tlsaSetMatchingType = tlsaSetArguments.Int("match", 1, "Matching type (0: exact, 1: SHA-256, 2: SHA-512)")
+	tlsaSetTTL          = tlsaSetArguments.Int("ttl", defaultTTL, "The time to live in seconds")
+
+	tlsaVerifyArguments = flag.NewFlagSet(actionNameTLSA+" verify", flag.ContinueOnError)
+	tlsaVerifyDomain    = tlsaVerifyArguments.String("domain", "", "Domain (e.g. example.com)")
+	tlsaVerifySubdomain = tlsaVerifyArguments.String("subdomain", "", "Subdomain (e.g. www)")
+	tlsaVerifyPort      = tlsaVerifyArguments.Int("port", 443, "The port of the TLS service")
+	tlsaVerifyProtocol  = tlsaVerifyArguments.String("protocol", "tcp", "The transport protocol of the TLS service")
+)
+
+type tlsaAction struct {
+	clientFactory dnsClientFactory
+	fs            afero.Fs
+	dialTLS       func(address, serverName string) ([]*x509.Certificate, error)
+	ttlPolicy     ttlPolicyProvider
+}
+
+func (action tlsaAction) Name() string {
+	return actionNameTLSA
+}
+
+func (action tlsaAction) Description() string {
+	return "Publish or verify the TLSA (DANE) record of a TLS service"
+}
+
+func (action tlsaAction) Usage() string {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "  %s set [arguments ...]\n", actionNameTLSA)
+	tlsaSetArguments.SetOutput(buf)
+	tlsaSetArguments.PrintDefaults()
+
+	fmt.Fprintf(buf, "\n  %s verify [arguments ...]\n", actionNameTLSA)
+	tlsaVerifyArguments.SetOutput(buf)
+	tlsaVerifyArguments.PrintDefaults()
+
+	return buf.String()
+}
+
+// Execute publishes a TLSA record for the given certificate ("set") or
+// compares the published TLSA records with the live TLS endpoint ("verify").
+func (action tlsaAction) Execute(arguments []string) (message, error) {
+	if len(arguments) == 0 {
+		return nil, fmt.Errorf("No sub command supplied (set, verify)")
+	}
+
+	switch arguments[0] {
+	case "set":
+		return action.set(arguments[1:])
+	case "verify":
+		return action.verify(arguments[1:])
+	}
+
+	return nil, fmt.Errorf("Unknown sub command: %q", arguments[0])
+}
+
+// set hashes the given certificate and creates or updates the TLSA record.
+func (action tlsaAction) set(arguments []string) (message, error) {
+
+	// parse the arguments
+	*tlsaSetDomain = ""
+	*tlsaSetSubdomain = ""
+	*tlsaSetPort = 443
+	*tlsaSetProtocol = "tcp"
+	*tlsaSetCertificate = ""
+	*tlsaSetUsage = 3
+	*tlsaSetSelector = 1
+	*tlsaSetMatchingType = 1
+	*tlsaSetTTL = defaultTTL
+	if parseError := tlsaSetArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if *tlsaSetDomain == "" {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	if *tlsaSetTTL < 0 {
+		return nil, fmt.Errorf("The given TTL cannot be negative")
+	}
+
+	parameters := tlsaParameters{*tlsaSetUsage, *tlsaSetSelector, *tlsaSetMatchingType}
+	if validationError := parameters.Validate(); validationError != nil {
+		return nil, validationError
+	}
+
+	recordName, nameError := getTLSARecordName(*tlsaSetPort, *tlsaSetProtocol, *tlsaSetSubdomain)
+	if nameError != nil {
+		return nil, nameError
+	}
+
+	chain, certificateError := action.readCertificateChain(*tlsaSetCertificate)
+	if certificateError != nil {
+		return nil, certificateError
+	}
+
+	content, contentError := parameters.Content(chain)
+	if contentError != nil {
+		return nil, contentError
+	}
+
+	ttl, ttlError := applyTTLPolicy(action.ttlPolicy, actionNameTLSA+" set", false, *tlsaSetTTL, arguments)
+	if ttlError != nil {
+		return nil, ttlError
+	}
+
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	created, setError := setRecord(client, *tlsaSetDomain, recordName, "TLSA", content, ttl)
+	if setError != nil {
+		return nil, fmt.Errorf("%s", setError.Error())
+	}
+
+	if created {
+		return changeMessage{fmt.Sprintf("Created: %s (TLSA %s)", getFormattedDomainName(recordName, *tlsaSetDomain), content), 1}, nil
+	}
+
+	return changeMessage{fmt.Sprintf("Updated: %s (TLSA %s)", getFormattedDomainName(recordName, *tlsaSetDomain), content), 1}, nil
+}
+
+// verify compares the TLSA records of the given service with the
+// certificates presented by the live TLS endpoint.
+func (action tlsaAction) verify(arguments []string) (message, error) {
+
+	// parse the arguments
+	*tlsaVerifyDomain = ""
+	*tlsaVerifySubdomain = ""
+	*tlsaVerifyPort = 443
+	*tlsaVerifyProtocol = "tcp"
+	if parseError := tlsaVerifyArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	if *tlsaVerifyDomain == "" {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	recordName, nameError := getTLSARecordName(*tlsaVerifyPort, *tlsaVerifyProtocol, *tlsaVerifySubdomain)
+	if nameError != nil {
+		return nil, nameError
+	}
+
+	if action.clientFactory == nil {
+		return nil, fmt.Errorf("No DNS client factory available")
+	}
+
+	client, clientError := action.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, fmt.Errorf("Cannot create DNS client: %s", clientError.Error())
+	}
+
+	records, recordsError := client.GetRecords(*tlsaVerifyDomain)
+	if recordsError != nil {
+		return nil, fmt.Errorf("Unable to fetch DNS records for domain %s", *tlsaVerifyDomain)
+	}
+
+	var tlsaContents []string
+	for _, record := range records {
+		if record.Name == recordName && record.RecordType == "TLSA" {
+			tlsaContents = append(tlsaContents, record.Content)
+		}
+	}
+
+	fullRecordName := getFormattedDomainName(recordName, *tlsaVerifyDomain)
+	if len(tlsaContents) == 0 {
+		return nil, fmt.Errorf("No TLSA record found for %s", fullRecordName)
+	}
+
+	if action.dialTLS == nil {
+		return nil, fmt.Errorf("No TLS dialer available")
+	}
+
+	hostname := getFormattedDomainName(*tlsaVerifySubdomain, *tlsaVerifyDomain)
+	address := net.JoinHostPort(hostname, fmt.Sprintf("%d", *tlsaVerifyPort))
+	chain, dialError := action.dialTLS(address, hostname)
+	if dialError != nil {
+		return nil, fmt.Errorf("Unable to connect to %s: %s", address, dialError.Error())
+	}
+
+	for _, tlsaContent := range tlsaContents {
+		parameters, associationData, parseError := parseTLSAContent(tlsaContent)
+		if parseError != nil {
+			continue
+		}
+
+		expectedContent, contentError := parameters.Content(chain)
+		if contentError != nil {
+			continue
+		}
+
+		if _, expectedData, _ := parseTLSAContent(expectedContent); expectedData == associationData {
+			return successMessage{fmt.Sprintf("OK: %s matches the certificate of %s (TLSA %s)", fullRecordName, address, tlsaContent)}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("None of the TLSA records of %s match the certificate presented by %s", fullRecordName, address)
+}
+
+// readCertificateChain reads the PEM-encoded certificates from the given file.
+func (action tlsaAction) readCertificateChain(filename string) ([]*x509.Certificate, error) {
+	if filename == "" {
+		return nil, fmt.Errorf("No certificate file supplied")
+	}
+
+	if action.fs == nil {
+		return nil, fmt.Errorf("No filesystem provided")
+	}
+
+	content, readError := afero.ReadFile(action.fs, filename)
+	if readError != nil {
+		return nil, fmt.Errorf("Unable to read certificate file: %s", readError.Error())
+	}
+
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, parseError := x509.ParseCertificate(block.Bytes)
+		if parseError != nil {
+			return nil, fmt.Errorf("Unable to parse certificate: %s", parseError.Error())
+		}
+
+		chain = append(chain, certificate)
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("No certificate found in %q", filename)
+	}
+
+	return chain, nil
+}
+
+// tlsaParameters contains the certificate usage, selector and
+// matching type fields of a TLSA record (see RFC 6698).
+type tlsaParameters struct {
+	usage        int
+	selector     int
+	matchingType int
+}
+
+// Validate returns an error if one of the TLSA parameters is out of range.
+func (parameters tlsaParameters) Validate() error {
+	if parameters.usage < 0 || parameters.usage > 3 {
+		return fmt.Errorf("The certificate usage must be between 0 and 3")
+	}
+
+	if parameters.selector < 0 || parameters.selector > 1 {
+		return fmt.Errorf("The selector must be 0 or 1")
+	}
+
+	if parameters.matchingType < 0 || parameters.matchingType > 2 {
+		return fmt.Errorf("The matching type must be between 0 and 2")
+	}
+
+	return nil
+}
+
+// Content returns the TLSA record content (e.g. "3 1 1 ab12...") for the
+// given certificate chain. The end-entity certificate is used for the
+// usages 1 and 3, the last certificate of the chain for the usages 0 and 2.
+func (parameters tlsaParameters) Content(chain []*x509.Certificate) (string, error) {
+	if len(chain) == 0 {
+		return "", fmt.Errorf("No certificate supplied")
+	}
+
+	certificate := chain[0]
+	if parameters.usage == 0 || parameters.usage == 2 {
+		if len(chain) < 2 {
+			return "", fmt.Errorf("The certificate usage %d requires the issuing certificate in the chain", parameters.usage)
+		}
+
+		certificate = chain[len(chain)-1]
+	}
+
+	data := certificate.Raw
+	if parameters.selector == 1 {
+		data = certificate.RawSubjectPublicKeyInfo
+	}
+
+	switch parameters.matchingType {
+	case 1:
+		hash := sha256.Sum256(data)
+		data = hash[:]
+	case 2:
+		hash := sha512.Sum512(data)
+		data = hash[:]
+	}
+
+	return fmt.Sprintf("%d %d %d %s", parameters.usage, parameters.selector, parameters.matchingType, hex.EncodeToString(data)), nil
+}
+
+// parseTLSAContent parses the given TLSA record content into
+// its parameters and the lower-case hex association data.
+func parseTLSAContent(content string) (tlsaParameters, string, error) {
+	var parameters tlsaParameters
+	fields := strings.Fields(content)
+	if len(fields) < 4 {
+		return parameters, "", fmt.Errorf("Invalid TLSA record: %q", content)
+	}
+
+	if _, scanError := fmt.Sscanf(strings.Join(fields[:3], " "), "%d %d %d", &parameters.usage, &parameters.selector, &parameters.matchingType); scanError != nil {
+		return parameters, "", fmt.Errorf("Invalid TLSA record: %q", content)
+	}
+
+	return parameters, strings.ToLower(strings.Join(fields[3:], "")), nil
+}
+
+// getTLSARecordName returns the TLSA record name for the given
+// port, protocol and subdomain (e.g. "_443._tcp.www").
+func getTLSARecordName(port int, protocol, subdomain string) (string, error) {
+	if port < 1 || port > 65535 {
+		return "", fmt.Errorf("The given port is invalid: %d", port)
+	}
+
+	if protocol != "tcp" && protocol != "udp" && protocol != "sctp" {
+		return "", fmt.Errorf("The given protocol is invalid: %q", protocol)
+	}
+
+	if subdomain == "" {
+		return fmt.Sprintf("_%d._%s", port, protocol), nil
+	}
+
+	return fmt.Sprintf("_%d._%s.%s", port, protocol, subdomain), nil
+}
+
+// tlsDialTimeout is the maximum time to connect to a server
+// and to complete the TLS handshake.
+const tlsDialTimeout = 10 * time.Second
+
+// getPeerCertificates connects to the given address and returns the
+// certificate chain presented by the server. The chain is not validated
+// because it is compared with the TLSA records instead.
+func getPeerCertificates(address, serverName string) ([]*x509.Certificate, error) {
+	dialer := &net.Dialer{Timeout: tlsDialTimeout, Deadline: time.Now().Add(tlsDialTimeout)}
+	connection, dialError := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	if dialError != nil {
+		return nil, dialError
+	}
+
+	defer connection.Close()
+
+	if deadlineError := connection.SetDeadline(time.Now().Add(tlsDialTimeout)); deadlineError != nil {
+		return nil, deadlineError
+	}
+
+	return connection.ConnectionState().PeerCertificates, nil
+}
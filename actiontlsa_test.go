@@ -0,0 +1,279 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getTLSATestCertificate returns a self-signed test certificate and a
+// filesystem that contains the PEM-encoded certificate at "fullchain.pem".
+func getTLSATestCertificate(t *testing.T) (afero.Fs, *x509.Certificate) {
+	privateKey, keyError := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if keyError != nil {
+		t.Fatal(keyError)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, createError := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if createError != nil {
+		t.Fatal(createError)
+	}
+
+	certificate, parseError := x509.ParseCertificate(der)
+	if parseError != nil {
+		t.Fatal(parseError)
+	}
+
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "fullchain.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+
+	return fs, certificate
+}
+
+func Test_tlsaAction_Name_CorrectActionNameIsReturned(t *testing.T) {
+
+	// arrange
+	tlsaAction := tlsaAction{}
+
+	// act
+	result := tlsaAction.Name()
+
+	// assert
+	if result != "tlsa" {
+		t.Fail()
+		t.Logf("tlsaAction.Name() should have returned %q but returned %q instead.", "tlsa", result)
+	}
+
+}
+
+func Test_tlsaAction_Usage_ResultContainsAllSubCommands(t *testing.T) {
+
+	// arrange
+	tlsaAction := tlsaAction{}
+
+	// act
+	result := tlsaAction.Usage()
+
+	// assert
+	if !strings.Contains(result, "tlsa set") || !strings.Contains(result, "tlsa verify") {
+		t.Fail()
+		t.Logf("tlsaAction.Usage() should describe the set and verify sub commands but returned %q.", result)
+	}
+
+}
+
+// tlsaAction.Execute("set", ...) should return an error if the argument values are invalid.
+func Test_tlsaAction_Set_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
+	// arrange
+	fs, _ := getTLSATestCertificate(t)
+	argumentsSet := [][]string{
+		{"set", "-domain", "", "-cert", "fullchain.pem"},
+		{"set", "-domain", "example.com", "-cert", ""},
+		{"set", "-domain", "example.com", "-cert", "fullchain.pem", "-usage", "4"},
+		{"set", "-domain", "example.com", "-cert", "fullchain.pem", "-selector", "2"},
+		{"set", "-domain", "example.com", "-cert", "fullchain.pem", "-match", "3"},
+		{"set", "-domain", "example.com", "-cert", "fullchain.pem", "-port", "0"},
+		{"set", "-domain", "example.com", "-cert", "fullchain.pem", "-protocol", "http"},
+		{"set", "-domain", "example.com", "-cert", "fullchain.pem", "-usage", "2"},
+	}
+
+	client := testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return nil, nil
+		},
+		createRecordFunc: func(domain string, opts *dnsimple.ChangeRecord) (string, error) {
+			return "1", nil
+		},
+	}
+
+	tlsaAction := tlsaAction{testDNSClientFactory{client, nil}, fs, nil, nil}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := tlsaAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("tlsaAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// tlsaAction.Execute("set", ...) should create a TLSA record with the hashed public key.
+func Test_tlsaAction_Set_ValidArguments_TLSARecordIsCreated(t *testing.T) {
+	// arrange
+	fs, certificate := getTLSATestCertificate(t)
+	arguments := []string{"set", "-domain", "example.com", "-subdomain", "www", "-cert", "fullchain.pem", "-usage", "3", "-selector", "1", "-match", "1"}
+
+	var createdRecord *dnsimple.ChangeRecord
+	client := testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return nil, nil
+		},
+		createRecordFunc: func(domain string, opts *dnsimple.ChangeRecord) (string, error) {
+			createdRecord = opts
+			return "1", nil
+		},
+	}
+
+	tlsaAction := tlsaAction{testDNSClientFactory{client, nil}, fs, nil, nil}
+
+	// act
+	_, err := tlsaAction.Execute(arguments)
+
+	// assert
+	if err != nil {
+		t.Fatalf("tlsaAction.Execute(%q) should not return an error: %s", arguments, err.Error())
+	}
+
+	hash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	expectedContent := "3 1 1 " + hex.EncodeToString(hash[:])
+	if createdRecord == nil || createdRecord.Name != "_443._tcp.www" || createdRecord.Type != "TLSA" || createdRecord.Value != expectedContent {
+		t.Fail()
+		t.Logf("tlsaAction.Execute(%q) should have created the TLSA record %q for _443._tcp.www but created %#v", arguments, expectedContent, createdRecord)
+	}
+}
+
+// tlsaAction.Execute("verify", ...) should succeed if the live certificate matches a TLSA record.
+func Test_tlsaAction_Verify_CertificateMatches_SuccessMessageIsReturned(t *testing.T) {
+	// arrange
+	_, certificate := getTLSATestCertificate(t)
+	arguments := []string{"verify", "-domain", "example.com", "-subdomain", "www"}
+
+	content, _ := tlsaParameters{3, 0, 2}.Content([]*x509.Certificate{certificate})
+	client := testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{
+				{Name: "_443._tcp.www", RecordType: "TLSA", Content: "3 1 1 0000"},
+				{Name: "_443._tcp.www", RecordType: "TLSA", Content: strings.ToUpper(content)},
+			}, nil
+		},
+	}
+
+	var dialedAddress string
+	dialTLS := func(address, serverName string) ([]*x509.Certificate, error) {
+		dialedAddress = address
+		return []*x509.Certificate{certificate}, nil
+	}
+
+	tlsaAction := tlsaAction{testDNSClientFactory{client, nil}, nil, dialTLS, nil}
+
+	// act
+	_, err := tlsaAction.Execute(arguments)
+
+	// assert
+	if err != nil || dialedAddress != "www.example.com:443" {
+		t.Fail()
+		t.Logf("tlsaAction.Execute(%q) should succeed after connecting to www.example.com:443 (connected to: %q, error: %v)", arguments, dialedAddress, err)
+	}
+}
+
+// tlsaAction.Execute("verify", ...) should return an error if no TLSA record matches the live certificate.
+func Test_tlsaAction_Verify_CertificateDiffers_ErrorIsReturned(t *testing.T) {
+	// arrange
+	_, certificate := getTLSATestCertificate(t)
+	arguments := []string{"verify", "-domain", "example.com", "-subdomain", "www"}
+
+	client := testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{
+				{Name: "_443._tcp.www", RecordType: "TLSA", Content: "3 1 1 0000"},
+			}, nil
+		},
+	}
+
+	dialTLS := func(address, serverName string) ([]*x509.Certificate, error) {
+		return []*x509.Certificate{certificate}, nil
+	}
+
+	tlsaAction := tlsaAction{testDNSClientFactory{client, nil}, nil, dialTLS, nil}
+
+	// act
+	_, err := tlsaAction.Execute(arguments)
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("tlsaAction.Execute(%q) should return an error because the certificate does not match", arguments)
+	}
+}
+
+// tlsaAction.Execute("verify", ...) should return an error if the TLS connection fails.
+func Test_tlsaAction_Verify_ConnectionFails_ErrorIsReturned(t *testing.T) {
+	// arrange
+	arguments := []string{"verify", "-domain", "example.com"}
+
+	client := testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return []dnsimple.Record{
+				{Name: "_443._tcp", RecordType: "TLSA", Content: "3 1 1 0000"},
+			}, nil
+		},
+	}
+
+	dialTLS := func(address, serverName string) ([]*x509.Certificate, error) {
+		return nil, fmt.Errorf("connection refused")
+	}
+
+	tlsaAction := tlsaAction{testDNSClientFactory{client, nil}, nil, dialTLS, nil}
+
+	// act
+	_, err := tlsaAction.Execute(arguments)
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("tlsaAction.Execute(%q) should return an error because the connection failed", arguments)
+	}
+}
+
+func Test_getTLSARecordName(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		port      int
+		protocol  string
+		subdomain string
+		expected  string
+	}{
+		{443, "tcp", "www", "_443._tcp.www"},
+		{25, "tcp", "", "_25._tcp"},
+		{853, "udp", "a.b", "_853._udp.a.b"},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		result, _ := getTLSARecordName(input.port, input.protocol, input.subdomain)
+
+		// assert
+		if result != input.expected {
+			t.Fail()
+			t.Logf("getTLSARecordName(%d, %q, %q) should return %q but returned %q", input.port, input.protocol, input.subdomain, input.expected, result)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"flag"
 	"fmt"
 	"github.com/andreaskoch/dee-ns"
+	"github.com/andreaskoch/dnsimple-cli/pkg/ddns"
 	"net"
 	"os"
 )
@@ -18,13 +19,21 @@ var (
 
 	updateAddressRecordArguments = flag.NewFlagSet(actionNameUpdate, flag.ContinueOnError)
 	updateDomain                 = updateAddressRecordArguments.String("domain", "", "Domain (e.g. example.com)")
+	updateDomains                = updateAddressRecordArguments.String("domains", "", "Comma-separated list of domains or domain patterns (e.g. example.com,example.*)")
 	updateSubdomain              = updateAddressRecordArguments.String("subdomain", "", "Subdomain (e.g. www)")
 	updateIP                     = updateAddressRecordArguments.String("ip", "", "IP address (e.g. ::1, 127.0.0.1)")
+	updateIPSource               = updateAddressRecordArguments.String("ip-source", "", "IP source used if no IP address is given (e.g. http, interface:eth0, file:/path, command:/path/to/script)")
+	updateIPFromInterface        = updateAddressRecordArguments.String("ip-from-interface", "", "Network interface the IP address is taken from (e.g. eth0)")
+	updatePreferIPv6             = updateAddressRecordArguments.Bool("prefer-ipv6", false, "Prefer the IPv6 address of the network interface")
+	updateGlobalOnly             = updateAddressRecordArguments.Bool("global-only", false, "Ignore private addresses of the network interface")
+	updateType                   = updateAddressRecordArguments.String("type", "", "The record type (A or AAAA; default: the type of the IP address)")
 )
 
 type updateAction struct {
-	dnsEditorFactory dnsEditorCreator
-	stdin            *os.File
+	dnsEditorFactory    dnsEditorCreator
+	infoProviderFactory dnsInfoProviderCreator
+	stdin               *os.File
+	ipProviders         ipProviderRegistry
 }
 
 func (action updateAction) Name() string {
@@ -48,31 +57,44 @@ func (action updateAction) Execute(arguments []string) (message, error) {
 
 	// parse the arguments
 	*updateDomain = ""
+	*updateDomains = ""
 	*updateSubdomain = ""
 	*updateIP = ""
+	*updateIPSource = ""
+	*updateIPFromInterface = ""
+	*updatePreferIPv6 = false
+	*updateGlobalOnly = false
+	*updateType = ""
 	if parseError := updateAddressRecordArguments.Parse(arguments); parseError != nil {
 		return nil, parseError
 	}
 
-	// domain
-	if *updateDomain == "" {
-		return nil, fmt.Errorf("No domain supplied")
+	// domains
+	domains, domainsError := getTargetDomains(*updateDomain, *updateDomains, action.infoProviderFactory)
+	if domainsError != nil {
+		return nil, domainsError
 	}
 
-	// take ip from stdin
-	if *updateIP == "" && stdinHasData(action.stdin) {
-		ipAddressFromStdin := ""
-		fmt.Fscanf(os.Stdin, "%s", &ipAddressFromStdin)
-		updateIP = &ipAddressFromStdin
+	// IP address
+	ipSource, ipSourceError := getInterfaceIPSource(*updateIPSource, *updateIPFromInterface, *updateType, *updatePreferIPv6, *updateGlobalOnly)
+	if ipSourceError != nil {
+		return nil, ipSourceError
 	}
 
-	if *updateIP == "" {
-		return nil, fmt.Errorf("No IP address supplied")
+	ip, ipError := getIPAddress(*updateIP, ipSource, action.ipProviders, action.stdin)
+	if ipError != nil {
+		return nil, ipError
 	}
 
-	ip := net.ParseIP(*updateIP)
-	if ip == nil {
-		return nil, fmt.Errorf("Cannot parse IP %q", ip)
+	// record type
+	recordType, recordTypeError := getDNSRecordType(*updateType, ip)
+	if recordTypeError != nil {
+		return nil, recordTypeError
+	}
+
+	// the TTL of the records is not changed
+	if validationError := validateRecordArguments(*updateSubdomain, recordType, ip.String(), minimumTTL, recordArguments{"-subdomain", "-ip", ""}); validationError != nil {
+		return nil, validationError
 	}
 
 	// create a DNS editor
@@ -82,10 +104,22 @@ func (action updateAction) Execute(arguments []string) (message, error) {
 		return nil, fmt.Errorf("Cannot create DNS editor: %s", dnsEditorError.Error())
 	}
 
-	updateError := addressRecordUpdater.UpdateSubdomain(*updateDomain, *updateSubdomain, ip)
-	if updateError != nil {
-		return nil, fmt.Errorf("%s", updateError.Error())
-	}
+	return applyToDomains(domains, func(domain string) (message, error) {
+		updateError := addressRecordUpdater.UpdateSubdomain(domain, *updateSubdomain, ip)
+		if ddns.IsUnchangedError(updateError) {
+			return getUnchangedAddressMessage(*updateSubdomain, domain, ip), nil
+		}
+
+		if updateError != nil {
+			return nil, fmt.Errorf("%s", updateError.Error())
+		}
+
+		return addressChangeMessage{changeMessage{fmt.Sprintf("Updated: %s → %s", getFormattedDomainName(*updateSubdomain, domain), ip.String()), 1}, ip}, nil
+	})
+}
 
-	return successMessage{fmt.Sprintf("Updated: %s → %s", getFormattedDomainName(*updateSubdomain, *updateDomain), ip.String())}, nil
+// getUnchangedAddressMessage returns the message for an address
+// record that already points to the given IP address.
+func getUnchangedAddressMessage(subdomain, domain string, ip net.IP) message {
+	return unchangedMessage{fmt.Sprintf("Unchanged: %s → %s", getFormattedDomainName(subdomain, domain), ip.String())}
 }
@@ -7,7 +7,9 @@ package main
 import (
 	"fmt"
 	"net"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -142,7 +144,7 @@ func Test_updateAction_InvalidArguments_ErrorIsReturned(t *testing.T) {
 
 	editorFactory := testDNSEditorFactory{dnsUpdater, nil}
 
-	updateAction := updateAction{editorFactory, nil}
+	updateAction := updateAction{editorFactory, nil, nil, nil}
 
 	for _, arguments := range validArgumentsSet {
 
@@ -187,7 +189,7 @@ func Test_updateAction_ValidArgumentsButEmpty_ErrorIsReturned(t *testing.T) {
 
 	editorFactory := testDNSEditorFactory{dnsUpdater, nil}
 
-	updateAction := updateAction{editorFactory, nil}
+	updateAction := updateAction{editorFactory, nil, nil, nil}
 
 	for _, arguments := range validArgumentsSet {
 
@@ -220,7 +222,7 @@ func Test_updateAction_IPAddressIsInvalid_ErrorIsReturned(t *testing.T) {
 
 	editorFactory := testDNSEditorFactory{dnsUpdater, nil}
 
-	updateAction := updateAction{editorFactory, nil}
+	updateAction := updateAction{editorFactory, nil, nil, nil}
 
 	for _, invalidIP := range invalidIPs {
 
@@ -302,7 +304,7 @@ func Test_updateAction_ValidArguments_NoErrorIsReturned(t *testing.T) {
 
 	editorFactory := testDNSEditorFactory{dnsUpdater, nil}
 
-	updateAction := updateAction{editorFactory, nil}
+	updateAction := updateAction{editorFactory, nil, nil, nil}
 
 	for _, arguments := range validArgumentsSet {
 
@@ -337,7 +339,7 @@ func Test_updateAction_ValidArguments_DNSUpdaterRespondsWithError_ErrorIsReturne
 
 	editorFactory := testDNSEditorFactory{dnsUpdater, nil}
 
-	updateAction := updateAction{editorFactory, nil}
+	updateAction := updateAction{editorFactory, nil, nil, nil}
 
 	// act
 	_, err := updateAction.Execute(arguments)
@@ -369,7 +371,7 @@ func Test_updateAction_ValidArguments_DNSUpdaterSucceeds_SuccessMessageIsReturne
 
 	editorFactory := testDNSEditorFactory{dnsUpdater, nil}
 
-	updateAction := updateAction{editorFactory, nil}
+	updateAction := updateAction{editorFactory, nil, nil, nil}
 
 	// act
 	response, _ := updateAction.Execute(arguments)
@@ -394,7 +396,7 @@ func Test_updateAction_ValidArguments_DNSEditorCreationFails_ErrorIsReturned(t *
 	}
 
 	editorFactory := testDNSEditorFactory{nil, fmt.Errorf("Unable to create DNS Editor")}
-	updateAction := updateAction{editorFactory, nil}
+	updateAction := updateAction{editorFactory, nil, nil, nil}
 
 	// act
 	_, err := updateAction.Execute(arguments)
@@ -426,7 +428,7 @@ func Test_updateAction_ValidArguments_DNSUpdaterSucceeds_SuccessMessageContainsT
 
 	editorFactory := testDNSEditorFactory{dnsUpdater, nil}
 
-	updateAction := updateAction{editorFactory, nil}
+	updateAction := updateAction{editorFactory, nil, nil, nil}
 
 	// act
 	response, _ := updateAction.Execute(arguments)
@@ -441,3 +443,134 @@ func Test_updateAction_ValidArguments_DNSUpdaterSucceeds_SuccessMessageContainsT
 		t.Logf("updateAction.Execute(%q) should respond with a success message that contains the domain, subdomain and ip but responded with %q instead.", arguments, response.Text())
 	}
 }
+
+// updateAction.Execute should return an unchanged message if the record already has the IP address.
+func Test_updateAction_ValidArguments_IPDidNotChange_UnchangedMessageIsReturned(t *testing.T) {
+	// arrange
+	arguments := []string{
+		"-domain",
+		"example.com",
+		"-subdomain",
+		"www",
+		"-ip",
+		"127.0.0.1",
+	}
+
+	dnsUpdater := &testDNSEditor{
+		updateSubdomainFunc: func(domain, subdomain string, ip net.IP) error {
+			return fmt.Errorf("No update required. IP address did not change (127.0.0.1).")
+		},
+	}
+
+	updateAction := updateAction{testDNSEditorFactory{dnsUpdater, nil}, nil, nil, nil}
+
+	// act
+	response, err := updateAction.Execute(arguments)
+
+	// assert
+	if _, isUnchanged := response.(unchangedMessage); err != nil || !isUnchanged {
+		t.Fail()
+		t.Logf("updateAction.Execute(%q) should return an unchanged message but returned %#v (%v)", arguments, response, err)
+	}
+}
+
+// updateAction.Execute should refuse to update a record if the IP does not match the given record type.
+func Test_updateAction_RecordTypeDoesNotMatchIP_ErrorIsReturned(t *testing.T) {
+	// arrange
+	arguments := []string{
+		"-domain",
+		"example.com",
+		"-subdomain",
+		"www",
+		"-type",
+		"A",
+		"-ip",
+		"2001:db8::1",
+	}
+
+	dnsUpdater := &testDNSEditor{
+		updateSubdomainFunc: func(domain, subdomain string, ip net.IP) error {
+			t.Fail()
+			t.Logf("The record should not have been updated")
+			return nil
+		},
+	}
+
+	updateAction := updateAction{testDNSEditorFactory{dnsUpdater, nil}, nil, nil, nil}
+
+	// act
+	_, err := updateAction.Execute(arguments)
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("updateAction.Execute(%q) should return an error because the IPv6 address does not match the record type A.", arguments)
+	}
+}
+
+// updateAction.Execute should update the subdomain of all domains that match the -domains argument.
+func Test_updateAction_MultipleDomains_AllDomainsAreUpdated(t *testing.T) {
+	// arrange
+	arguments := []string{
+		"-domains",
+		"example.*,other.com",
+		"-subdomain",
+		"www",
+		"-ip",
+		"203.0.113.1",
+	}
+
+	// the domains are updated in parallel
+	var lock sync.Mutex
+	var updatedDomains []string
+	dnsUpdater := &testDNSEditor{
+		updateSubdomainFunc: func(domain, subdomain string, ip net.IP) error {
+			lock.Lock()
+			defer lock.Unlock()
+			updatedDomains = append(updatedDomains, domain)
+			return nil
+		},
+	}
+
+	infoProviderFactory := getTestDomainInfoProviderFactory("example.com", "example.net", "other.com", "unrelated.org")
+	updateAction := updateAction{testDNSEditorFactory{dnsUpdater, nil}, infoProviderFactory, nil, nil}
+
+	// act
+	result, err := updateAction.Execute(arguments)
+
+	// assert
+	sort.Strings(updatedDomains)
+	if err != nil || strings.Join(updatedDomains, ",") != "example.com,example.net,other.com" {
+		t.Fatalf("updateAction.Execute(%q) should update example.com, example.net and other.com but updated %q (%v)", arguments, updatedDomains, err)
+	}
+
+	if getChangeSummary(result).Records != 3 {
+		t.Fail()
+		t.Logf("The result should report three changed records: %q", result.Text())
+	}
+}
+
+// updateAction.Execute should accept -type AAAA together with an explicit IPv6 address.
+func Test_updateAction_TypeAAAAWithIPv6_RecordIsUpdated(t *testing.T) {
+	// arrange
+	arguments := []string{"-domain", "example.com", "-subdomain", "www", "-type", "AAAA", "-ip", "2001:db8::1"}
+
+	var updatedIP net.IP
+	dnsUpdater := &testDNSEditor{
+		updateSubdomainFunc: func(domain, subdomain string, ip net.IP) error {
+			updatedIP = ip
+			return nil
+		},
+	}
+
+	updateAction := updateAction{testDNSEditorFactory{dnsUpdater, nil}, nil, nil, nil}
+
+	// act
+	_, err := updateAction.Execute(arguments)
+
+	// assert
+	if err != nil || !updatedIP.Equal(net.ParseIP("2001:db8::1")) {
+		t.Fail()
+		t.Logf("updateAction.Execute(%q) should update the AAAA record but returned %v", arguments, err)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"sort"
+	"time"
+)
+
+var (
+	actionNameWatch = "watch"
+
+	watchArguments = flag.NewFlagSet(actionNameWatch, flag.ContinueOnError)
+	watchDomain    = watchArguments.String("domain", "", "Domain (e.g. example.com)")
+	watchInterval  = watchArguments.Duration("interval", 30*time.Second, "The time between two polls of the zone")
+	watchCount     = watchArguments.Int("count", 0, "Stop after the given number of polls (0 = until the process is stopped)")
+)
+
+const (
+	recordChangeAdded   = "added"
+	recordChangeChanged = "changed"
+	recordChangeRemoved = "removed"
+)
+
+type watchAction struct {
+	infoProviderFactory dnsInfoProviderCreator
+	sleep               func(duration time.Duration)
+	log                 logger
+}
+
+func (action watchAction) Name() string {
+	return actionNameWatch
+}
+
+func (action watchAction) Description() string {
+	return "Print the records of a domain that are added, changed or removed"
+}
+
+func (action watchAction) Usage() string {
+	buf := new(bytes.Buffer)
+	watchArguments.SetOutput(buf)
+	watchArguments.PrintDefaults()
+	return buf.String()
+}
+
+// Execute polls the records of the given domain and logs every change
+// until the process is stopped or the given number of polls is reached.
+// The domain can either be passed with -domain or as the first positional argument.
+func (action watchAction) Execute(arguments []string) (message, error) {
+
+	// parse the arguments
+	*watchDomain = ""
+	*watchInterval = 30 * time.Second
+	*watchCount = 0
+	if parseError := watchArguments.Parse(arguments); parseError != nil {
+		return nil, parseError
+	}
+
+	domain := *watchDomain
+	if domain == "" {
+		domain = watchArguments.Arg(0)
+	}
+
+	if isEmpty(domain) {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	if *watchInterval <= 0 {
+		return nil, fmt.Errorf("The interval must be positive")
+	}
+
+	if *watchCount < 0 {
+		return nil, fmt.Errorf("The number of polls cannot be negative")
+	}
+
+	if action.infoProviderFactory == nil {
+		return nil, fmt.Errorf("No DNS info provider factory available")
+	}
+
+	infoProvider, infoProviderError := action.infoProviderFactory.CreateInfoProvider()
+	if infoProviderError != nil {
+		return nil, fmt.Errorf("No DNS info provider available")
+	}
+
+	// the initial state
+	previous, recordsError := infoProvider.GetDomainRecords(domain)
+	if recordsError != nil {
+		return nil, fmt.Errorf("Unable to retrieve the records of %q: %s", domain, recordsError.Error())
+	}
+
+	log := action.log.With(logFields{Domain: domain, Action: actionNameWatch})
+	log.Infof("Watching %d records of %s", len(previous), domain)
+
+	changes := 0
+	for poll := 1; *watchCount == 0 || poll <= *watchCount; poll++ {
+		action.sleep(*watchInterval)
+
+		current, err := infoProvider.GetDomainRecords(domain)
+		if err != nil {
+			log.With(logFields{Error: err}).Errorf("Unable to retrieve the records of %s", domain)
+			continue
+		}
+
+		for _, change := range diffRecords(previous, current) {
+			log.With(logFields{Subdomain: change.Record().Name}).Infof("%s", change.String(domain))
+			changes++
+		}
+
+		previous = current
+	}
+
+	return successMessage{fmt.Sprintf("Watched %s: %d changes", domain, changes)}, nil
+}
+
+// recordChange is a difference between two states of a zone.
+type recordChange struct {
+	// Kind is "added", "changed" or "removed".
+	Kind string
+
+	// Previous is the record before the change (not set for added records).
+	Previous dnsimple.Record
+
+	// Current is the record after the change (not set for removed records).
+	Current dnsimple.Record
+}
+
+// Record returns the current record or, for removed records, the previous record.
+func (change recordChange) Record() dnsimple.Record {
+	if change.Kind == recordChangeRemoved {
+		return change.Previous
+	}
+
+	return change.Current
+}
+
+// String describes the change (e.g. "changed: www.example.com A 203.0.113.1 → 203.0.113.2").
+func (change recordChange) String(domain string) string {
+	record := change.Record()
+	name := getFormattedDomainName(record.Name, domain)
+
+	if change.Kind != recordChangeChanged {
+		return fmt.Sprintf("%s: %s %s %s (TTL %d)", change.Kind, name, record.RecordType, record.Content, record.Ttl)
+	}
+
+	previous, current := change.Previous, change.Current
+	description := fmt.Sprintf("%s: %s %s", change.Kind, name, current.RecordType)
+
+	if previous.Name != current.Name || previous.RecordType != current.RecordType {
+		description = fmt.Sprintf("%s: %s %s → %s %s", change.Kind, getFormattedDomainName(previous.Name, domain), previous.RecordType, name, current.RecordType)
+	}
+
+	if previous.Content != current.Content {
+		description += fmt.Sprintf(" %s → %s", previous.Content, current.Content)
+	} else {
+		description += " " + current.Content
+	}
+
+	if previous.Ttl != current.Ttl {
+		description += fmt.Sprintf(" (TTL %d → %d)", previous.Ttl, current.Ttl)
+	}
+
+	if previous.Prio != current.Prio {
+		description += fmt.Sprintf(" (priority %d → %d)", previous.Prio, current.Prio)
+	}
+
+	return description
+}
+
+// diffRecords returns the records that were added, changed or removed between
+// the two given states of a zone. Records are identified by their ID.
+func diffRecords(previous, current []dnsimple.Record) []recordChange {
+	previousByID := make(map[int64]dnsimple.Record)
+	for _, record := range previous {
+		previousByID[record.Id] = record
+	}
+
+	var changes []recordChange
+	currentIDs := make(map[int64]bool)
+	for _, record := range current {
+		currentIDs[record.Id] = true
+
+		previousRecord, exists := previousByID[record.Id]
+		if !exists {
+			changes = append(changes, recordChange{Kind: recordChangeAdded, Current: record})
+			continue
+		}
+
+		if previousRecord != record {
+			changes = append(changes, recordChange{Kind: recordChangeChanged, Previous: previousRecord, Current: record})
+		}
+	}
+
+	for _, record := range previous {
+		if !currentIDs[record.Id] {
+			changes = append(changes, recordChange{Kind: recordChangeRemoved, Previous: record})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Record().Name < changes[j].Record().Name
+	})
+
+	return changes
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/pearkes/dnsimple"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_watchAction_Name_CorrectActionNameIsReturned(t *testing.T) {
+
+	// arrange
+	watchAction := watchAction{}
+
+	// act
+	result := watchAction.Name()
+
+	// assert
+	if result != "watch" {
+		t.Fail()
+		t.Logf("watchAction.Name() should have returned %q but returned %q instead.", "watch", result)
+	}
+
+}
+
+// watchAction.Execute should return an error if the argument values are invalid.
+func Test_watchAction_InvalidArgumentValues_ErrorIsReturned(t *testing.T) {
+	// arrange
+	argumentsSet := [][]string{
+		{},
+		{"-domain", "example.com", "-interval", "0s"},
+		{"-domain", "example.com", "-count", "-1"},
+	}
+
+	watchAction := watchAction{testInfoProviderFactory{}, func(duration time.Duration) {}, logger{}}
+
+	for _, arguments := range argumentsSet {
+
+		// act
+		_, err := watchAction.Execute(arguments)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("watchAction.Execute(%q) should return an error", arguments)
+		}
+	}
+}
+
+// watchAction.Execute should log the changes between two polls.
+func Test_watchAction_RecordsChange_ChangesAreLogged(t *testing.T) {
+	// arrange
+	states := [][]dnsimple.Record{
+		{
+			{Id: 1, Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 600},
+			{Id: 2, Name: "old", RecordType: "A", Content: "203.0.113.3", Ttl: 600},
+		},
+		{
+			{Id: 1, Name: "www", RecordType: "A", Content: "203.0.113.2", Ttl: 600},
+			{Id: 3, Name: "", RecordType: "MX", Content: "mx.example.net", Prio: 10, Ttl: 3600},
+		},
+	}
+
+	polls := 0
+	infoProvider := testDNSInfoProvider{
+		getDomainRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			state := states[polls]
+			if polls < len(states)-1 {
+				polls++
+			}
+
+			return state, nil
+		},
+	}
+
+	output := new(bytes.Buffer)
+	log := logger{output: output, now: time.Now}
+	watchAction := watchAction{testInfoProviderFactory{infoProvider, nil}, func(duration time.Duration) {}, log}
+
+	// act
+	result, err := watchAction.Execute([]string{"-count", "2", "example.com"})
+
+	// assert
+	if err != nil || result.Text() != "Watched example.com: 3 changes" {
+		t.Fatalf("watchAction.Execute should report three changes but returned %v (%v)", result, err)
+	}
+
+	expected := []string{
+		"added: example.com MX mx.example.net (TTL 3600)",
+		"removed: old.example.com A 203.0.113.3 (TTL 600)",
+		"changed: www.example.com A 203.0.113.1 → 203.0.113.2",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(output.String(), line) {
+			t.Fail()
+			t.Logf("The log should contain %q:\n%s", line, output.String())
+		}
+	}
+}
+
+// diffRecords should not report records that did not change.
+func Test_diffRecords_NoChanges_ResultIsEmpty(t *testing.T) {
+	// arrange
+	records := []dnsimple.Record{
+		{Id: 1, Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 600},
+	}
+
+	// act
+	changes := diffRecords(records, []dnsimple.Record{records[0]})
+
+	// assert
+	if len(changes) != 0 {
+		t.Fail()
+		t.Logf("diffRecords should not return any changes but returned %#v", changes)
+	}
+}
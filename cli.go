@@ -5,15 +5,20 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/andreaskoch/dee-ns"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/afero"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // GitInfo is either the empty string (the default)
@@ -33,6 +38,30 @@ func version() string {
 
 var actions []action
 
+// runs remembers the runs that completed with an idempotency key.
+var runs runStore
+
+var (
+	quietMode = flag.Bool("quiet", false, "Suppress the normal output and print a JSON change summary instead")
+	logFormat = flag.String("log-format", logFormatText, "The log format of long-running actions (text, json)")
+
+	credentialsFrom    = flag.String("credentials-from", "", "Read the API credentials from an external source instead of the credential file (e.g. vault://secret/data/dee)")
+	providerName       = flag.String("provider", "", "The DNS provider (default: $DEE_PROVIDER, the provider of the configuration file or dnsimple)")
+	ignoreNamingPolicy = flag.Bool("ignore-naming-policy", false, "Allow changes of records whose names the naming policy of the configuration file reserves or denies")
+	profileName        = flag.String("profile", "", "The profile of the configuration file whose credentials and allowed domains are used (default: $DEE_PROFILE)")
+
+	caFile         = flag.String("ca-file", "", "A PEM file with additional CA certificates trusted for the DNSimple API (e.g. of a corporate proxy)")
+	tlsMinVersion  = flag.String("tls-min-version", "1.2", "The minimum TLS version of the DNSimple API connections (1.2, 1.3)")
+	maxConnections = flag.Int("max-connections", 4, "The maximum number of concurrent connections to the DNSimple API")
+	noKeepAlive    = flag.Bool("no-keep-alive", false, "Open a new connection to the DNSimple API for every request")
+	noCache        = flag.Bool("no-cache", false, "Do not cache the responses of the DNSimple API")
+
+	requestsPerHour = flag.Int("requests-per-hour", 0, "The maximum number of API requests per hour of all invocations on this machine (default: DEE_REQUESTS_PER_HOUR; 0: no limit)")
+
+	parallelDomains = flag.Int("parallel", 4, "The number of domains that multi-domain actions (e.g. update -domains) process at the same time")
+	idempotencyKey  = flag.String("idempotency-key", "", "Skip the action if a run with the same key already completed (e.g. the ID of a CI job)")
+)
+
 type action interface {
 	Name() string
 	Description() string
@@ -59,8 +88,47 @@ func init() {
 	credentialFilePath := filepath.Join(baseFolder, "credentials.json")
 	credentialStore := filesystemCredentialStore{filesystem, credentialFilePath}
 
-	// DNS client factory
-	dnsClientFactory := dnsimpleClientFactory{credentialStore}
+	// configuration file (optionally encrypted with age or GPG)
+	configFilePath := filepath.Join(baseFolder, "config.json")
+
+	ageIdentityFile := os.Getenv("DEE_AGE_IDENTITY")
+	if ageIdentityFile == "" {
+		ageIdentityFile = filepath.Join(baseFolder, "identity.txt")
+	}
+
+	decrypter := configDecrypter{ageIdentityFile, runCommandWithInput}
+
+	// the configuration file is loaded once and shared by the profiles,
+	// the DNS provider and the naming and TTL policies
+	configuration := newConfigFile(filesystem, decrypter, configFilePath)
+
+	// credential sources
+	credentialSources := newCredentialSourceRegistry(filesystem, userHomeDir, os.Getenv, configFilePath, decrypter)
+	// profiles (e.g. "personal" and "work")
+	profiles := configProfileProvider{configuration, profileName, os.Getenv}
+	credentialProvider := profileCredentialProvider{profiles, credentialsFrom, credentialSources, credentialStore}
+
+	// all DNSimple clients share one HTTP client
+	// (the responses of the API are cached in the "cache" folder)
+	httpClient := &sharedHTTPClient{fs: filesystem, options: httpClientOptions{caFile, tlsMinVersion, maxConnections, noKeepAlive, noCache, requestsPerHour}, cacheFolder: filepath.Join(baseFolder, "cache"), budgetFile: filepath.Join(baseFolder, "budget.json")}
+
+	// DNS client factory of the selected DNS provider
+	// (DEE_API_URL points dee to another API server, e.g. in integration tests)
+	dnsProviders := newDNSProviderRegistry(credentialProvider, httpClient, os.Getenv("DEE_API_URL"))
+	apiClientFactory := configDNSProviderFactory{dnsProviders, configuration, providerName, os.Getenv}
+
+	// all changes are recorded in the change journal
+	// (changes of domains that the active profile does not allow and
+	// of names that the naming policy reserves or denies are refused;
+	// rollbacks are restricted the same way but are not recorded)
+	journal := filesystemJournal{filesystem, filepath.Join(baseFolder, "journal.json")}
+	namingPolicies := configNamingPolicyProvider{configuration}
+	restrictedClientFactory := namingPolicyClientFactory{guardedClientFactory{apiClientFactory, profiles}, namingPolicies, ignoreNamingPolicy}
+	dnsClientFactory := journalingClientFactory{restrictedClientFactory, journal, profiles, os.Hostname, os.Stderr}
+
+	// local notes and labels of records
+	metadata := filesystemMetadataStore{filesystem, filepath.Join(baseFolder, "state.json")}
+	runs = metadata
 
 	// create DNSimple info provider
 	dnsInfoProviderFactory := dnsimpleInfoProviderFactory{dnsClientFactory}
@@ -68,20 +136,61 @@ func init() {
 	// create a DNS editor instance
 	dnsEditorFactory := dnsEditorFactory{dnsClientFactory, dnsInfoProviderFactory}
 
+	// IP sources
+	ipProviders := newIPProviderRegistry(filesystem)
+
+	// default and minimum TTLs of new records
+	ttlPolicy := configTTLPolicyProvider{configuration, os.Stderr}
+
+	// mirror targets
+	secondaryProviders := newSecondaryProviderRegistry(filesystem)
+
 	actions = []action{
 		loginAction{credentialStore},
 		logoutAction{credentialStore},
-		listAction{dnsInfoProviderFactory},
-		createAction{dnsEditorFactory, os.Stdin},
-		updateAction{dnsEditorFactory, os.Stdin},
+		listAction{dnsInfoProviderFactory, metadata, journal},
+		createAction{dnsEditorFactory, dnsClientFactory, os.Stdin, ipProviders, ttlPolicy, metadata},
+		updateAction{dnsEditorFactory, dnsInfoProviderFactory, os.Stdin, ipProviders},
 		deleteAction{dnsEditorFactory},
-		createOrUpdateAction{dnsEditorFactory, dnsInfoProviderFactory, os.Stdin},
+		createOrUpdateAction{dnsEditorFactory, dnsInfoProviderFactory, os.Stdin, ipProviders, ttlPolicy},
+		dkimAction{dnsClientFactory, filesystem, net.LookupTXT, ttlPolicy},
+		tlsaAction{dnsClientFactory, filesystem, getPeerCertificates, ttlPolicy},
+		caaAction{dnsInfoProviderFactory},
+		lintAction{dnsInfoProviderFactory, net.LookupHost},
+		recordAction{dnsClientFactory, metadata, ttlPolicy, runEditor},
+		failoverAction{dnsClientFactory, probeEndpoint, time.Sleep, newLogger(os.Stdout, logFormat), ttlPolicy},
+		rotateAction{dnsClientFactory, time.Sleep, newLogger(os.Stdout, logFormat), ttlPolicy},
+		rollbackAction{restrictedClientFactory, journal},
+		mirrorAction{dnsInfoProviderFactory, secondaryProviders},
+		watchAction{dnsInfoProviderFactory, time.Sleep, newLogger(os.Stdout, logFormat)},
+		findIPAction{dnsInfoProviderFactory},
+		bootstrapAction{dnsClientFactory, filesystem, decrypter, configFilePath, ttlPolicy},
+		domainsAction{dnsClientFactory, getPeerCertificates, time.Now},
+		prefixAction{dnsClientFactory, dnsInfoProviderFactory, os.Stdin, ipProviders},
+		gcAction{dnsClientFactory, metadata, time.Now},
+		previewAction{dnsClientFactory, metadata, os.Stdin, ipProviders, ttlPolicy},
+		serveAction{dnsEditorFactory, dnsInfoProviderFactory, filesystem, os.Getenv, listenAndServe, newLogger(os.Stdout, logFormat), ttlPolicy},
 	}
 
+	// daemon mode
+	actions = append(actions, daemonAction{filesystem, decrypter, configFilePath, func() []action { return actions }, time.Now, time.Sleep, newLogger(os.Stdout, logFormat), nil})
+
+	// configuration file validation
+	actions = append(actions, configAction{filesystem, decrypter, configFilePath, func() []action { return actions }})
+
+	// Windows service mode of the daemon
+	actions = append(actions, serviceAction{runtime.GOOS, os.Executable, runCommandWithInput, func() []action { return actions }, runWindowsService})
+
+	// one-shot mode for containers (e.g. Kubernetes init containers and Jobs)
+	actions = append(actions, oneshotAction{func() []action { return actions }, ipProviders, os.Getenv, filesystem, lookupHostAtNameserver, time.Now, time.Sleep})
+
 	// override the help information printer
 	// of the flag package
 	executablePath := os.Args[0]
 	executableName := path.Base(executablePath)
+
+	actions = append(actions, genManAction{filesystem, executableName, version(), func() []action { return actions }})
+
 	usagePrinter := newUsagePrinter(executableName, version(), actions)
 
 	flag.Usage = func() {
@@ -92,14 +201,43 @@ func init() {
 
 func main() {
 
+	// parse the global options
+	flag.Parse()
+
+	// the credential source can also be given in the environment (e.g. in containers)
+	if *credentialsFrom == "" {
+		*credentialsFrom = os.Getenv("DEE_CREDENTIALS_FROM")
+	}
+
+	// the API budget is usually shared by all invocations (e.g. of cron jobs)
+	if *requestsPerHour == 0 && os.Getenv("DEE_REQUESTS_PER_HOUR") != "" {
+		budget, budgetError := strconv.Atoi(os.Getenv("DEE_REQUESTS_PER_HOUR"))
+		if budgetError != nil {
+			fmt.Fprintf(os.Stderr, "Invalid DEE_REQUESTS_PER_HOUR %q\n", os.Getenv("DEE_REQUESTS_PER_HOUR"))
+			os.Exit(1)
+		}
+
+		*requestsPerHour = budget
+	}
+
+	if *requestsPerHour < 0 {
+		fmt.Fprintf(os.Stderr, "The number of requests per hour cannot be negative\n")
+		os.Exit(1)
+	}
+
+	if logFormatError := validateLogFormat(*logFormat); logFormatError != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", logFormatError.Error())
+		os.Exit(1)
+	}
+
 	// get action
-	if len(os.Args) < 2 {
+	if flag.NArg() < 1 {
 		flag.Usage()
 		os.Exit(1)
 	}
 
 	// get the action name
-	selectedActionName := strings.TrimSpace(strings.ToLower(os.Args[1]))
+	selectedActionName := strings.TrimSpace(strings.ToLower(flag.Arg(0)))
 
 	// find a matching action
 	selectedAction := getActionByName(selectedActionName, actions)
@@ -109,14 +247,21 @@ func main() {
 	}
 
 	// execute the action
-	message, err := selectedAction.Execute(os.Args[2:])
+	// (runs with an idempotency key that already completed are skipped)
+	message, err := executeIdempotent(selectedAction, flag.Args()[1:], *idempotencyKey, runs, time.Now)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
-		os.Exit(1)
+		os.Exit(getErrorExitCode(err))
+	}
+
+	if *quietMode {
+		summary, _ := json.Marshal(getChangeSummary(message))
+		fmt.Fprintf(os.Stdout, "%s\n", summary)
+		os.Exit(getExitCode(message))
 	}
 
 	fmt.Fprintf(os.Stdout, "%s\n", message.Text())
-	os.Exit(0)
+	os.Exit(getExitCode(message))
 
 }
 
@@ -159,33 +304,112 @@ func (m successMessage) Text() string {
 	return m.text
 }
 
-// dnsClientFactory provides the ability to create DNS clients.
-type dnsClientFactory interface {
-	// CreateClient create a new dnsClient client instance.
-	CreateClient() (deens.DNSClient, error)
+// unchangedMessage contains a text-message indicating that the
+// records already matched and no change was needed.
+type unchangedMessage struct {
+	text string
+}
+
+// Text returns the text of the current message.
+func (m unchangedMessage) Text() string {
+	return m.text
+}
+
+// exitCodeUnchanged is the exit code of actions that
+// succeeded without having to change anything.
+const exitCodeUnchanged = 3
+
+// exitCodeFindings is the exit code of checks that succeeded but found
+// something that needs attention (e.g. domains that are about to expire).
+const exitCodeFindings = 4
+
+// The exit codes of the oneshot action (e.g. for Kubernetes Jobs that
+// must tell retryable failures from configuration errors).
+const (
+	exitCodeInvalidSettings    = 5
+	exitCodeIPUnavailable      = 6
+	exitCodeChangeFailed       = 7
+	exitCodePropagationTimeout = 8
+)
+
+// findingsMessage contains the result of a check
+// that found something that needs attention.
+type findingsMessage struct {
+	text string
+}
+
+// Text returns the text of the current message.
+func (m findingsMessage) Text() string {
+	return m.text
 }
 
-// dnsimpleClientFactory creates DNSimple clients.
-type dnsimpleClientFactory struct {
-	credentialStore deens.CredentialStore
+// getExitCode returns the exit code for the given message.
+func getExitCode(m message) int {
+	switch m.(type) {
+	case unchangedMessage:
+		return exitCodeUnchanged
+
+	case findingsMessage:
+		return exitCodeFindings
+	}
+
+	return 0
 }
 
-// CreateClient create a new DNSimple client instance.
-func (clientFactory dnsimpleClientFactory) CreateClient() (deens.DNSClient, error) {
+// exitCodeError is an error that ends dee with a specific exit code
+// (e.g. exitCodePropagationTimeout) instead of the exit code 1.
+type exitCodeError struct {
+	error
+	code int
+}
 
-	// get the credentials
-	credentials, credentialError := clientFactory.credentialStore.GetCredentials()
-	if credentialError != nil {
-		return nil, fmt.Errorf("%s", credentialError.Error())
+// getErrorExitCode returns the exit code for the given error.
+func getErrorExitCode(err error) int {
+	if codeError, hasCode := err.(exitCodeError); hasCode {
+		return codeError.code
 	}
 
-	// create a DNSimple client
-	dnsimpleClient, dnsimpleClientError := deens.NewDNSClient(credentials)
-	if dnsimpleClientError != nil {
-		return nil, fmt.Errorf("Unable to create DNSimple client. Error: %s", dnsimpleClientError.Error())
+	return 1
+}
+
+// changeMessage contains a text-message and the number
+// of DNS records that have been changed.
+type changeMessage struct {
+	text           string
+	changedRecords int
+}
+
+// Text returns the text of the current message.
+func (m changeMessage) Text() string {
+	return m.text
+}
+
+// addressChangeMessage is a change message of an action
+// that pointed an address record to a new IP address.
+type addressChangeMessage struct {
+	changeMessage
+	ip net.IP
+}
+
+// changeSummary is the machine-readable summary
+// that is printed in quiet mode.
+type changeSummary struct {
+	Changed bool `json:"changed"`
+	Records int  `json:"records"`
+}
+
+// getChangeSummary returns the change summary for the given message.
+// Messages that are not change messages did not change any records.
+func getChangeSummary(m message) changeSummary {
+	switch change := m.(type) {
+	case changeMessage:
+		return changeSummary{change.changedRecords > 0, change.changedRecords}
+
+	case addressChangeMessage:
+		return changeSummary{change.changedRecords > 0, change.changedRecords}
 	}
 
-	return dnsimpleClient, nil
+	return changeSummary{}
 }
 
 type dnsInfoProviderCreator interface {
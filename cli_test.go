@@ -1,8 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
 	"net"
+	"sort"
+	"strconv"
+	"testing"
 )
 
 type testDNSEditorFactory struct {
@@ -40,3 +45,159 @@ type testInfoProviderFactory struct {
 func (factory testInfoProviderFactory) CreateInfoProvider() (deens.DNSInfoProvider, error) {
 	return factory.infoProvider, factory.err
 }
+
+type testDNSClientFactory struct {
+	client deens.DNSClient
+	err    error
+}
+
+func (clientFactory testDNSClientFactory) CreateClient() (deens.DNSClient, error) {
+	return clientFactory.client, clientFactory.err
+}
+
+// testDNSClient is a DNS client used for testing.
+type testDNSClient struct {
+	updateRecordFunc  func(domain string, id string, opts *dnsimple.ChangeRecord) (string, error)
+	getRecordsFunc    func(domain string) ([]dnsimple.Record, error)
+	getDomainsFunc    func() ([]dnsimple.Domain, error)
+	createRecordFunc  func(domain string, opts *dnsimple.ChangeRecord) (string, error)
+	destroyRecordFunc func(domain string, id string) error
+}
+
+func (client testDNSClient) UpdateRecord(domain string, id string, opts *dnsimple.ChangeRecord) (string, error) {
+	return client.updateRecordFunc(domain, id, opts)
+}
+
+func (client testDNSClient) GetRecords(domain string) ([]dnsimple.Record, error) {
+	return client.getRecordsFunc(domain)
+}
+
+func (client testDNSClient) GetDomains() ([]dnsimple.Domain, error) {
+	return client.getDomainsFunc()
+}
+
+func (client testDNSClient) CreateRecord(domain string, opts *dnsimple.ChangeRecord) (string, error) {
+	return client.createRecordFunc(domain, opts)
+}
+
+func (client testDNSClient) DestroyRecord(domain string, id string) error {
+	return client.destroyRecordFunc(domain, id)
+}
+
+// newInMemoryTestDNSClient returns a DNS client that
+// stores the records of all domains in the given map.
+func newInMemoryTestDNSClient(records map[string][]dnsimple.Record) testDNSClient {
+	nextID := int64(1000)
+	return testDNSClient{
+		getRecordsFunc: func(domain string) ([]dnsimple.Record, error) {
+			return records[domain], nil
+		},
+		getDomainsFunc: func() ([]dnsimple.Domain, error) {
+			var domains []dnsimple.Domain
+			for name := range records {
+				domains = append(domains, dnsimple.Domain{Name: name})
+			}
+
+			sort.Slice(domains, func(i, j int) bool { return domains[i].Name < domains[j].Name })
+			return domains, nil
+		},
+		createRecordFunc: func(domain string, opts *dnsimple.ChangeRecord) (string, error) {
+			nextID++
+			ttl, _ := strconv.ParseInt(opts.Ttl, 10, 64)
+			records[domain] = append(records[domain], dnsimple.Record{Id: nextID, Name: opts.Name, RecordType: opts.Type, Content: opts.Value, Ttl: ttl})
+			return strconv.FormatInt(nextID, 10), nil
+		},
+		updateRecordFunc: func(domain string, id string, opts *dnsimple.ChangeRecord) (string, error) {
+			for index, record := range records[domain] {
+				if record.StringId() != id {
+					continue
+				}
+
+				// like the DNSimple API only the given fields are changed
+				if opts.Name != "" {
+					record.Name = opts.Name
+				}
+
+				if opts.Type != "" {
+					record.RecordType = opts.Type
+				}
+
+				if opts.Value != "" {
+					record.Content = opts.Value
+				}
+
+				if opts.Ttl != "" {
+					record.Ttl, _ = strconv.ParseInt(opts.Ttl, 10, 64)
+				}
+
+				records[domain][index] = record
+				return id, nil
+			}
+
+			return "", fmt.Errorf("Record %s not found", id)
+		},
+		destroyRecordFunc: func(domain string, id string) error {
+			for index, record := range records[domain] {
+				if record.StringId() != id {
+					continue
+				}
+
+				records[domain] = append(records[domain][:index], records[domain][index+1:]...)
+				return nil
+			}
+
+			return fmt.Errorf("Record %s not found", id)
+		},
+	}
+}
+
+func Test_getChangeSummary(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		message  message
+		expected changeSummary
+	}{
+		{successMessage{"example.com"}, changeSummary{false, 0}},
+		{changeMessage{"Updated: www.example.com → 127.0.0.1", 1}, changeSummary{true, 1}},
+		{changeMessage{"Updated: 3 records", 3}, changeSummary{true, 3}},
+		{changeMessage{"No update required", 0}, changeSummary{false, 0}},
+		{unchangedMessage{"Unchanged: www.example.com → 127.0.0.1"}, changeSummary{false, 0}},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		result := getChangeSummary(input.message)
+
+		// assert
+		if result != input.expected {
+			t.Fail()
+			t.Logf("getChangeSummary(%#v) should return %#v but returned %#v", input.message, input.expected, result)
+		}
+	}
+}
+
+func Test_getExitCode(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		message  message
+		expected int
+	}{
+		{successMessage{"example.com"}, 0},
+		{changeMessage{"Updated: www.example.com → 127.0.0.1", 1}, 0},
+		{unchangedMessage{"Unchanged: www.example.com → 127.0.0.1"}, exitCodeUnchanged},
+		{findingsMessage{"example.com   domain   2016-03-10   in 6 days"}, exitCodeFindings},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		result := getExitCode(input.message)
+
+		// assert
+		if result != input.expected {
+			t.Fail()
+			t.Logf("getExitCode(%#v) should return %d but returned %d", input.message, input.expected, result)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// encryptedConfigExtensions contains the file extensions of encrypted
+// configuration files in the order they are looked up.
+var encryptedConfigExtensions = []string{".age", ".gpg", ".asc"}
+
+// config contains the settings of the daemon mode and,
+// optionally, the API credentials.
+type config struct {
+	// Tasks are the actions the daemon runs on a schedule.
+	Tasks []taskConfig `json:"tasks"`
+
+	// Log defines where the daemon writes its log to.
+	Log logConfig `json:"log"`
+
+	// MQTT defines the broker the daemon publishes change events to.
+	MQTT mqttConfig `json:"mqtt"`
+
+	// TTLPolicy defines the TTLs of new records.
+	TTLPolicy ttlPolicy `json:"ttl_policy"`
+
+	// Templates are the named record sets of the bootstrap action (e.g. "webhost").
+	Templates map[string][]recordTemplate `json:"templates"`
+
+	// Credentials are the DNSimple API credentials
+	// (should only be used in encrypted files).
+	Credentials *credentialsConfig `json:"credentials"`
+
+	// Provider selects the DNS provider (default: DNSimple).
+	Provider dnsProviderConfig `json:"provider"`
+
+	// NamingPolicy defines the record names that may be changed.
+	NamingPolicy namingPolicy `json:"naming_policy"`
+
+	// Profiles are the named accounts that are selected with -profile (e.g. "personal").
+	Profiles map[string]profileConfig `json:"profiles"`
+}
+
+// credentialsConfig contains the DNSimple API credentials.
+type credentialsConfig struct {
+	Email string `json:"email"`
+	Token string `json:"token"`
+}
+
+// mqttConfig defines the MQTT broker change events are published to.
+// If no broker is given no events are published.
+type mqttConfig struct {
+	// Broker is the URL of the broker (e.g. "tcp://homeassistant.local:1883").
+	Broker string `json:"broker"`
+
+	// Topic is the prefix of the event topics (default: "dee").
+	Topic string `json:"topic"`
+
+	// ClientID identifies the daemon at the broker (default: "dee").
+	ClientID string `json:"client_id"`
+
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// Retain asks the broker to keep the last event of each topic.
+	Retain bool `json:"retain"`
+}
+
+// taskConfig defines an action that is executed on a schedule.
+type taskConfig struct {
+	// Name identifies the task in the log (e.g. "update home IP").
+	Name string `json:"name"`
+
+	// Schedule is a cron expression (e.g. "0 3 * * *")
+	// or an interval (e.g. "@every 5m").
+	Schedule string `json:"schedule"`
+
+	// Action is the name of the action that is executed (e.g. "createorupdate").
+	Action string `json:"action"`
+
+	// Arguments are passed to the action (e.g. ["-domain", "example.com"]).
+	Arguments []string `json:"arguments"`
+}
+
+// logConfig defines the log file of the daemon and its rotation.
+// If no file is given the log is written to stdout.
+type logConfig struct {
+	// File is the path of the log file (e.g. "/var/log/dee.log").
+	File string `json:"file"`
+
+	// MaxSizeMB is the size in megabytes after which the log file is rotated.
+	MaxSizeMB int `json:"max_size_mb"`
+
+	// MaxAge is the age after which the log file is rotated (e.g. "24h").
+	MaxAge string `json:"max_age"`
+
+	// MaxBackups is the number of rotated log files that are kept.
+	MaxBackups int `json:"max_backups"`
+
+	// Retention is the age after which rotated log files are deleted (e.g. "168h").
+	Retention string `json:"retention"`
+}
+
+// loadConfig reads the configuration from the given JSON file.
+// Files ending with ".age", ".gpg" or ".asc" are decrypted first.
+func loadConfig(fs afero.Fs, decrypter configDecrypter, filePath string) (config, error) {
+	if fs == nil {
+		return config{}, fmt.Errorf("No filesystem provided")
+	}
+
+	content, readError := afero.ReadFile(fs, filePath)
+	if readError != nil {
+		if os.IsNotExist(readError) {
+			return config{}, fmt.Errorf("There is no configuration file at %q", filePath)
+		}
+
+		return config{}, readError
+	}
+
+	content, decryptError := decrypter.Decrypt(filePath, content)
+	if decryptError != nil {
+		return config{}, decryptError
+	}
+
+	var result config
+	if unmarshalError := json.Unmarshal(content, &result); unmarshalError != nil {
+		return config{}, fmt.Errorf("Cannot parse %q: %s", filePath, unmarshalError.Error())
+	}
+
+	return result, nil
+}
+
+// configFile loads the configuration file once and shares it between the
+// profile, the DNS provider and the naming and TTL policies, so that an
+// encrypted file is decrypted only once per invocation.
+type configFile struct {
+	fs        afero.Fs
+	decrypter configDecrypter
+	filePath  string
+
+	lock     sync.Mutex
+	loaded   bool
+	exists   bool
+	settings config
+	err      error
+}
+
+// newConfigFile creates a loader of the given configuration file
+// (or of its encrypted variant, see findConfigFile).
+func newConfigFile(fs afero.Fs, decrypter configDecrypter, filePath string) *configFile {
+	return &configFile{fs: fs, decrypter: decrypter, filePath: filePath}
+}
+
+// Load returns the settings of the configuration file. The returned bool is
+// false if there is no configuration file.
+func (file *configFile) Load() (config, bool, error) {
+	file.lock.Lock()
+	defer file.lock.Unlock()
+
+	if !file.loaded {
+		filePath := findConfigFile(file.fs, file.filePath)
+		if file.exists, _ = afero.Exists(file.fs, filePath); file.exists {
+			file.settings, file.err = loadConfig(file.fs, file.decrypter, filePath)
+		}
+
+		file.loaded = true
+	}
+
+	return file.settings, file.exists, file.err
+}
+
+// findConfigFile returns the given configuration file path or, if the
+// file does not exist, the path of an encrypted version of the file
+// (e.g. "config.json.age"). If none exists the given path is returned.
+func findConfigFile(fs afero.Fs, filePath string) string {
+	if exists, _ := afero.Exists(fs, filePath); exists {
+		return filePath
+	}
+
+	for _, extension := range encryptedConfigExtensions {
+		if exists, _ := afero.Exists(fs, filePath+extension); exists {
+			return filePath + extension
+		}
+	}
+
+	return filePath
+}
+
+// configDecrypter decrypts age- and GPG-encrypted configuration files
+// with the age and gpg command line tools.
+type configDecrypter struct {
+	// ageIdentityFile is the identity file age-encrypted
+	// files are decrypted with (e.g. "~/.dee/identity.txt").
+	ageIdentityFile string
+
+	// runCommand runs the given command with the given input and returns its output.
+	runCommand func(input []byte, name string, arguments ...string) ([]byte, error)
+}
+
+// Decrypt returns the decrypted content of the given file. The
+// content of files that are not encrypted is returned as-is.
+func (decrypter configDecrypter) Decrypt(filePath string, content []byte) ([]byte, error) {
+	var name string
+	var arguments []string
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".age":
+		name, arguments = "age", []string{"--decrypt", "--identity", decrypter.ageIdentityFile}
+
+	case ".gpg", ".asc":
+		// the passphrase or key is provided by the gpg-agent
+		name, arguments = "gpg", []string{"--batch", "--quiet", "--decrypt"}
+
+	default:
+		return content, nil
+	}
+
+	if decrypter.runCommand == nil {
+		return nil, fmt.Errorf("Cannot decrypt %q: no command runner available", filePath)
+	}
+
+	decrypted, decryptError := decrypter.runCommand(content, name, arguments...)
+	if decryptError != nil {
+		return nil, fmt.Errorf("Cannot decrypt %q with %s: %s", filePath, name, decryptError.Error())
+	}
+
+	return decrypted, nil
+}
+
+// runCommandWithInput runs the given command with the given input on stdin and
+// returns its output. The error contains the output of stderr.
+func runCommandWithInput(input []byte, name string, arguments ...string) ([]byte, error) {
+	command := exec.Command(name, arguments...)
+	command.Stdin = bytes.NewReader(input)
+
+	stderr := new(bytes.Buffer)
+	command.Stderr = stderr
+
+	output, err := command.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s (%s)", err.Error(), message)
+		}
+
+		return nil, err
+	}
+
+	return output, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/afero"
+	"strings"
+	"testing"
+)
+
+// getTestDecrypter returns a decrypter that "decrypts" content by removing
+// the prefix "encrypted:" and records the executed commands.
+func getTestDecrypter(commands *[]string) configDecrypter {
+	return configDecrypter{
+		ageIdentityFile: "/home/user/.dee/identity.txt",
+		runCommand: func(input []byte, name string, arguments ...string) ([]byte, error) {
+			*commands = append(*commands, name+" "+strings.Join(arguments, " "))
+
+			if !strings.HasPrefix(string(input), "encrypted:") {
+				return nil, fmt.Errorf("no identity matched")
+			}
+
+			return []byte(strings.TrimPrefix(string(input), "encrypted:")), nil
+		},
+	}
+}
+
+// Encrypted configuration files should be decrypted with age or gpg.
+func Test_loadConfig_EncryptedFile_FileIsDecrypted(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		filePath        string
+		expectedCommand string
+	}{
+		{"/home/user/.dee/config.json.age", "age --decrypt --identity /home/user/.dee/identity.txt"},
+		{"/home/user/.dee/config.json.gpg", "gpg --batch --quiet --decrypt"},
+	}
+
+	for _, input := range inputs {
+		fs := afero.NewMemMapFs()
+		afero.WriteFile(fs, input.filePath, []byte(`encrypted:{"tasks":[{"name":"list"}],"credentials":{"email":"john@example.com","token":"secret"}}`), 0600)
+
+		var commands []string
+
+		// act
+		settings, err := loadConfig(fs, getTestDecrypter(&commands), input.filePath)
+
+		// assert
+		if err != nil {
+			t.Fail()
+			t.Logf("loadConfig(%q) should not return an error: %s", input.filePath, err.Error())
+			continue
+		}
+
+		if len(commands) != 1 || commands[0] != input.expectedCommand {
+			t.Fail()
+			t.Logf("loadConfig(%q) should have executed %q but executed %q", input.filePath, input.expectedCommand, commands)
+		}
+
+		if len(settings.Tasks) != 1 || settings.Credentials == nil || settings.Credentials.Token != "secret" {
+			t.Fail()
+			t.Logf("loadConfig(%q) returned the wrong settings: %+v", input.filePath, settings)
+		}
+	}
+}
+
+// Unencrypted configuration files should be read without a decryption command.
+func Test_loadConfig_PlainFile_NoCommandIsExecuted(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/user/.dee/config.json", []byte(`{"tasks":[]}`), 0600)
+
+	var commands []string
+
+	// act
+	_, err := loadConfig(fs, getTestDecrypter(&commands), "/home/user/.dee/config.json")
+
+	// assert
+	if err != nil || len(commands) != 0 {
+		t.Fail()
+		t.Logf("loadConfig should read the file without decrypting it (error: %v, commands: %q)", err, commands)
+	}
+}
+
+// A failed decryption should result in an error.
+func Test_loadConfig_DecryptionFails_ErrorIsReturned(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/user/.dee/config.json.age", []byte(`garbage`), 0600)
+
+	var commands []string
+
+	// act
+	_, err := loadConfig(fs, getTestDecrypter(&commands), "/home/user/.dee/config.json.age")
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("loadConfig should return an error if the file cannot be decrypted")
+	}
+}
+
+// findConfigFile should fall back to the encrypted configuration file.
+func Test_findConfigFile_OnlyEncryptedFileExists_EncryptedFileIsReturned(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/user/.dee/config.json.age", []byte(`encrypted:{}`), 0600)
+
+	// act
+	result := findConfigFile(fs, "/home/user/.dee/config.json")
+
+	// assert
+	if result != "/home/user/.dee/config.json.age" {
+		t.Fail()
+		t.Logf("findConfigFile should have returned the encrypted file but returned %q", result)
+	}
+}
+
+// The profile, the DNS provider and the policies should share one decryption of the configuration file.
+func Test_configFile_Load_EncryptedFileIsDecryptedOnce(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/user/.dee/config.json.age", []byte(`encrypted:{"profiles":{"work":{}},"naming_policy":{"deny":["^_"]}}`), 0600)
+
+	var commands []string
+	configuration := newConfigFile(fs, getTestDecrypter(&commands), "/home/user/.dee/config.json")
+	name := "work"
+
+	// act
+	_, _, profileError := configProfileProvider{configuration, &name, nil}.GetProfile()
+	policy, policyError := configNamingPolicyProvider{configuration}.GetNamingPolicy()
+	_, ttlError := configTTLPolicyProvider{configuration, nil}.GetTTL("update", true, 0, false)
+
+	// assert
+	if profileError != nil || policyError != nil || ttlError != nil || len(policy.Deny) != 1 {
+		t.Fatalf("The settings should have been read from the configuration file (errors: %v, %v, %v)", profileError, policyError, ttlError)
+	}
+
+	if len(commands) != 1 {
+		t.Fail()
+		t.Logf("The configuration file should have been decrypted once but was decrypted with %q", commands)
+	}
+}
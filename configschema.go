@@ -0,0 +1,592 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// configSchema is a JSON schema (draft 2019-09) of (a part of) the configuration file.
+type configSchema struct {
+	Schema               string                   `json:"$schema,omitempty"`
+	Title                string                   `json:"title,omitempty"`
+	Description          string                   `json:"description,omitempty"`
+	Type                 string                   `json:"type"`
+	Properties           map[string]*configSchema `json:"properties,omitempty"`
+	Required             []string                 `json:"required,omitempty"`
+	DependentRequired    map[string][]string      `json:"dependentRequired,omitempty"`
+	AdditionalProperties interface{}              `json:"additionalProperties,omitempty"`
+	Items                *configSchema            `json:"items,omitempty"`
+	Minimum              *int                     `json:"minimum,omitempty"`
+
+	// check validates the value beyond its type (e.g. the syntax of a schedule)
+	// and returns a description of the problem or an empty string.
+	check func(node *configNode) string
+}
+
+// getConfigSchema returns the schema of the configuration file. The actions
+// of the tasks must be one of the given actions (if any are given).
+func getConfigSchema(actions []action) *configSchema {
+	zero := 0
+
+	task := objectSchema("An action that the daemon executes on a schedule", map[string]*configSchema{
+		"name":      valueSchema("string", "Identifies the task in the log (e.g. \"update home IP\")", nil),
+		"schedule":  valueSchema("string", "A cron expression (e.g. \"0 3 * * *\") or an interval (e.g. \"@every 5m\")", checkSchedule),
+		"action":    valueSchema("string", "The name of the action that is executed (e.g. \"createorupdate\")", getActionCheck(actions)),
+		"arguments": arraySchema("The arguments of the action (e.g. [\"-domain\", \"example.com\"])", valueSchema("string", "", nil)),
+	}, "schedule", "action")
+
+	log := objectSchema("The log file of the daemon and its rotation (default: stdout)", map[string]*configSchema{
+		"file":        valueSchema("string", "The path of the log file (e.g. \"/var/log/dee.log\")", nil),
+		"max_size_mb": minimumSchema("integer", "The size in megabytes after which the log file is rotated", &zero),
+		"max_age":     valueSchema("string", "The age after which the log file is rotated (e.g. \"24h\")", checkDuration),
+		"max_backups": minimumSchema("integer", "The number of rotated log files that are kept", &zero),
+		"retention":   valueSchema("string", "The age after which rotated log files are deleted (e.g. \"168h\")", checkDuration),
+	})
+	log.DependentRequired = map[string][]string{
+		"max_size_mb": {"file"},
+		"max_age":     {"file"},
+		"max_backups": {"file"},
+		"retention":   {"file"},
+	}
+
+	mqtt := objectSchema("The MQTT broker the daemon publishes change events to", map[string]*configSchema{
+		"broker":    valueSchema("string", "The URL of the broker (e.g. \"tcp://homeassistant.local:1883\")", checkMQTTBroker),
+		"topic":     valueSchema("string", "The prefix of the event topics (default: \"dee\")", nil),
+		"client_id": valueSchema("string", "Identifies the daemon at the broker (default: \"dee\")", nil),
+		"username":  valueSchema("string", "", nil),
+		"password":  valueSchema("string", "", nil),
+		"retain":    valueSchema("boolean", "Asks the broker to keep the last event of each topic", nil),
+	})
+	mqtt.DependentRequired = map[string][]string{
+		"topic":     {"broker"},
+		"client_id": {"broker"},
+		"username":  {"broker"},
+		"password":  {"broker"},
+		"retain":    {"broker"},
+	}
+
+	ttlPolicy := objectSchema("The TTLs of new records in seconds", map[string]*configSchema{
+		"dynamic":  minimumSchema("integer", "The default TTL of the records of create and createorupdate (e.g. 60)", &zero),
+		"default":  minimumSchema("integer", "The default TTL of all other records (e.g. 3600)", &zero),
+		"minimum":  minimumSchema("integer", "The smallest TTL that is accepted", &zero),
+		"commands": mapSchema("The default TTLs of single commands (e.g. {\"record create\": 300})", minimumSchema("integer", "", &zero)),
+	})
+
+	template := arraySchema("The records of a template", objectSchema("A record of a template; the name and content can contain placeholders (e.g. \"{domain}\")", map[string]*configSchema{
+		"name":    valueSchema("string", "The subdomain (empty for the root domain)", nil),
+		"type":    valueSchema("string", "The record type (e.g. \"A\")", nil),
+		"content": valueSchema("string", "The content of the record (e.g. \"{ip}\")", nil),
+		"ttl":     minimumSchema("integer", "The time to live in seconds (default: the default TTL of the TTL policy)", &zero),
+	}, "type", "content"))
+
+	credentials := objectSchema("The DNSimple API credentials (should only be used in encrypted files)", map[string]*configSchema{
+		"email": valueSchema("string", "", nil),
+		"token": valueSchema("string", "", nil),
+	}, "email", "token")
+
+	profile := objectSchema("A named account that is selected with -profile", map[string]*configSchema{
+		"credentials_from": valueSchema("string", "The credential source of the profile (e.g. \"vault://secret/data/dee-personal\")", nil),
+		"allowed_domains":  arraySchema("The domains or domain patterns the profile may change (e.g. \"*.example.com\"; default: all)", valueSchema("string", "", checkDomainPattern)),
+	})
+
+	naming := objectSchema("The record names that dee may change (\"@\" stands for the root domain)", map[string]*configSchema{
+		"reserved": arraySchema("The names or name patterns that must not be changed (e.g. \"mail\", \"*._domainkey\")", valueSchema("string", "", checkDomainPattern)),
+		"allow":    arraySchema("Regular expressions of which a name must match at least one (default: all names)", valueSchema("string", "", checkRegularExpression)),
+		"deny":     arraySchema("Regular expressions of which a name must not match any (e.g. \"^_\")", valueSchema("string", "", checkRegularExpression)),
+	})
+
+	provider := objectSchema("The DNS provider whose API dee changes", map[string]*configSchema{
+		"name":    valueSchema("string", "The name of the provider (default: \"dnsimple\")", nil),
+		"api_url": valueSchema("string", "Replaces the URL of the API of the provider (optional)", nil),
+	})
+
+	root := objectSchema("The configuration file of dee (~/.dee/config.json)", map[string]*configSchema{
+		"tasks":         arraySchema("The actions the daemon runs on a schedule", task),
+		"log":           log,
+		"mqtt":          mqtt,
+		"ttl_policy":    ttlPolicy,
+		"templates":     mapSchema("The named record sets of the bootstrap action (e.g. \"webhost\")", template),
+		"credentials":   credentials,
+		"provider":      provider,
+		"naming_policy": naming,
+		"profiles":      mapSchema("The named accounts that are selected with -profile (e.g. \"personal\")", profile),
+	})
+
+	root.Schema = "https://json-schema.org/draft/2019-09/schema"
+	root.Title = "dee configuration"
+	return root
+}
+
+// objectSchema returns the schema of an object with the given properties.
+func objectSchema(description string, properties map[string]*configSchema, required ...string) *configSchema {
+	return &configSchema{Type: "object", Description: description, Properties: properties, Required: required, AdditionalProperties: false}
+}
+
+// mapSchema returns the schema of an object with arbitrary keys and the given values.
+func mapSchema(description string, values *configSchema) *configSchema {
+	return &configSchema{Type: "object", Description: description, AdditionalProperties: values}
+}
+
+// arraySchema returns the schema of an array with the given items.
+func arraySchema(description string, items *configSchema) *configSchema {
+	return &configSchema{Type: "array", Description: description, Items: items}
+}
+
+// valueSchema returns the schema of a value of the given type.
+func valueSchema(valueType, description string, check func(node *configNode) string) *configSchema {
+	return &configSchema{Type: valueType, Description: description, check: check}
+}
+
+// minimumSchema returns the schema of a number with the given minimum.
+func minimumSchema(valueType, description string, minimum *int) *configSchema {
+	return &configSchema{Type: valueType, Description: description, Minimum: minimum}
+}
+
+// checkSchedule reports schedules that cannot be parsed.
+func checkSchedule(node *configNode) string {
+	if _, scheduleError := parseSchedule(node.String()); scheduleError != nil {
+		return scheduleError.Error()
+	}
+
+	return ""
+}
+
+// checkDuration reports durations that cannot be parsed.
+func checkDuration(node *configNode) string {
+	if _, durationError := parseOptionalDuration(node.String()); durationError != nil {
+		return fmt.Sprintf("Invalid duration %q (e.g. \"24h\"): %s", node.String(), durationError.Error())
+	}
+
+	return ""
+}
+
+// checkDomainPattern reports domain patterns that cannot be parsed.
+func checkDomainPattern(node *configNode) string {
+	if _, patternError := path.Match(node.String(), ""); patternError != nil {
+		return fmt.Sprintf("Invalid domain pattern %q: %s", node.String(), patternError.Error())
+	}
+
+	return ""
+}
+
+// checkRegularExpression reports invalid regular expressions.
+func checkRegularExpression(node *configNode) string {
+	if _, expressionError := regexp.Compile(node.String()); expressionError != nil {
+		return fmt.Sprintf("Invalid regular expression %q: %s", node.String(), expressionError.Error())
+	}
+
+	return ""
+}
+
+// checkMQTTBroker reports broker URLs the daemon cannot connect to.
+func checkMQTTBroker(node *configNode) string {
+	if _, brokerError := newMQTTPublisher(mqttConfig{Broker: node.String()}); brokerError != nil {
+		return brokerError.Error()
+	}
+
+	return ""
+}
+
+// getActionCheck returns a check that reports unknown
+// actions and actions that cannot be scheduled.
+func getActionCheck(actions []action) func(node *configNode) string {
+	return func(node *configNode) string {
+		name := node.String()
+		if containsString(unschedulableActions, name) {
+			return fmt.Sprintf("The action %q cannot be scheduled", name)
+		}
+
+		if len(actions) > 0 && getActionByName(name, actions) == nil {
+			return fmt.Sprintf("Unknown action: %q", name)
+		}
+
+		return ""
+	}
+}
+
+// configNode is a value of a JSON document and its position in the document.
+type configNode struct {
+	// Kind is the JSON type of the value (object, array, string, number, boolean or null).
+	Kind string
+
+	// Value is the string, json.Number or bool value of scalar nodes.
+	Value interface{}
+
+	Members []configMember
+	Items   []*configNode
+
+	// Offset is the byte offset of the value in the document.
+	Offset int64
+}
+
+// configMember is a key of an object and its value.
+type configMember struct {
+	Key       string
+	KeyOffset int64
+	Value     *configNode
+}
+
+// String returns the value of a string node.
+func (node *configNode) String() string {
+	text, _ := node.Value.(string)
+	return text
+}
+
+// get returns the member value with the given key or nil.
+func (node *configNode) get(key string) *configNode {
+	for _, member := range node.Members {
+		if member.Key == key {
+			return member.Value
+		}
+	}
+
+	return nil
+}
+
+// configDiagnostic is a problem at a position of the configuration file.
+type configDiagnostic struct {
+	Line   int
+	Column int
+
+	// Path is the location of the value (e.g. "tasks[0].schedule").
+	Path string
+	Text string
+}
+
+// String returns the diagnostic in the format "line:column: path: text".
+func (diagnostic configDiagnostic) String() string {
+	if diagnostic.Path == "" {
+		return fmt.Sprintf("%d:%d: %s", diagnostic.Line, diagnostic.Column, diagnostic.Text)
+	}
+
+	return fmt.Sprintf("%d:%d: %s: %s", diagnostic.Line, diagnostic.Column, diagnostic.Path, diagnostic.Text)
+}
+
+// validateConfigDocument checks the given JSON document against the given
+// schema and returns the problems ordered by their position.
+func validateConfigDocument(content []byte, schema *configSchema) []configDiagnostic {
+	root, parseError := parseConfigDocument(content)
+	if parseError != nil {
+		offset := int64(len(content))
+		switch positionError := parseError.(type) {
+		case *json.SyntaxError:
+			offset = positionError.Offset
+
+		case configParseError:
+			offset = positionError.Offset
+		}
+
+		line, column := getLineAndColumn(content, offset)
+		return []configDiagnostic{{line, column, "", fmt.Sprintf("Invalid JSON: %s", parseError.Error())}}
+	}
+
+	validator := configValidator{content: content}
+	validator.validate(root, schema, "")
+
+	sort.SliceStable(validator.diagnostics, func(i, j int) bool {
+		first, second := validator.diagnostics[i], validator.diagnostics[j]
+		if first.Line != second.Line {
+			return first.Line < second.Line
+		}
+
+		return first.Column < second.Column
+	})
+
+	return validator.diagnostics
+}
+
+// configValidator collects the problems of a configuration document.
+type configValidator struct {
+	content     []byte
+	diagnostics []configDiagnostic
+}
+
+// report adds a problem at the given offset.
+func (validator *configValidator) report(offset int64, path, format string, arguments ...interface{}) {
+	line, column := getLineAndColumn(validator.content, offset)
+	validator.diagnostics = append(validator.diagnostics, configDiagnostic{line, column, path, fmt.Sprintf(format, arguments...)})
+}
+
+// validate checks the given node and its children against the given schema.
+func (validator *configValidator) validate(node *configNode, schema *configSchema, path string) {
+
+	// null values are ignored like missing values
+	if node.Kind == "null" {
+		return
+	}
+
+	if !hasConfigType(node, schema.Type) {
+		validator.report(node.Offset, path, "Expected %s but found %s", getConfigTypeName(schema.Type), describeConfigNode(node))
+		return
+	}
+
+	switch schema.Type {
+	case "object":
+		validator.validateObject(node, schema, path)
+
+	case "array":
+		for index, item := range node.Items {
+			validator.validate(item, schema.Items, fmt.Sprintf("%s[%d]", path, index))
+		}
+
+	case "integer":
+		if number, _ := node.Value.(json.Number).Int64(); schema.Minimum != nil && number < int64(*schema.Minimum) {
+			validator.report(node.Offset, path, "The value must be at least %d", *schema.Minimum)
+		}
+	}
+
+	if schema.check != nil {
+		if problem := schema.check(node); problem != "" {
+			validator.report(node.Offset, path, "%s", problem)
+		}
+	}
+}
+
+// validateObject checks the keys and values of the given object.
+func (validator *configValidator) validateObject(node *configNode, schema *configSchema, path string) {
+	seen := make(map[string]bool)
+	for _, member := range node.Members {
+		memberPath := joinConfigPath(path, member.Key, schema.Properties == nil)
+
+		if seen[member.Key] {
+			validator.report(member.KeyOffset, memberPath, "Duplicate key %q", member.Key)
+		}
+
+		seen[member.Key] = true
+
+		memberSchema, isKnown := schema.Properties[member.Key]
+		if !isKnown {
+			if values, isMap := schema.AdditionalProperties.(*configSchema); isMap {
+				memberSchema, isKnown = values, true
+			}
+		}
+
+		if !isKnown {
+			validator.report(member.KeyOffset, memberPath, "Unknown key %q%s", member.Key, suggestConfigKey(member.Key, schema.Properties))
+			continue
+		}
+
+		validator.validate(member.Value, memberSchema, memberPath)
+	}
+
+	for _, key := range schema.Required {
+		if !isConfigValueGiven(node.get(key)) {
+			validator.report(node.Offset, path, "The key %q is required", key)
+		}
+	}
+
+	var keys []string
+	for key := range schema.DependentRequired {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !isConfigValueGiven(node.get(key)) {
+			continue
+		}
+
+		for _, dependency := range schema.DependentRequired[key] {
+			if !isConfigValueGiven(node.get(dependency)) {
+				validator.report(node.Offset, path, "The key %q is required when %q is set", dependency, key)
+			}
+		}
+	}
+}
+
+// parseConfigDocument parses the given JSON document and
+// remembers the position of every key and value.
+func parseConfigDocument(content []byte) (*configNode, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	root, parseError := parseConfigNode(decoder, content)
+	if parseError != nil {
+		return nil, parseError
+	}
+
+	trailingOffset := skipJSONSeparators(content, decoder.InputOffset())
+	if _, trailingError := decoder.Token(); trailingError != io.EOF {
+		return nil, configParseError{trailingOffset, "unexpected data after the top-level value"}
+	}
+
+	return root, nil
+}
+
+// configParseError is a syntax error at an offset of a JSON document.
+type configParseError struct {
+	Offset int64
+	Text   string
+}
+
+func (parseError configParseError) Error() string {
+	return parseError.Text
+}
+
+// parseConfigNode reads the next value of the given decoder.
+func parseConfigNode(decoder *json.Decoder, content []byte) (*configNode, error) {
+	offset := skipJSONSeparators(content, decoder.InputOffset())
+	token, tokenError := decoder.Token()
+	if tokenError == io.EOF {
+		return nil, configParseError{offset, "unexpected end of JSON input"}
+	}
+
+	if tokenError != nil {
+		return nil, tokenError
+	}
+
+	node := &configNode{Offset: offset, Value: token}
+	switch value := token.(type) {
+	case json.Delim:
+		node.Value = nil
+		if value == '{' {
+			node.Kind = "object"
+			for decoder.More() {
+				keyOffset := skipJSONSeparators(content, decoder.InputOffset())
+				key, keyError := decoder.Token()
+				if keyError != nil {
+					return nil, keyError
+				}
+
+				member, memberError := parseConfigNode(decoder, content)
+				if memberError != nil {
+					return nil, memberError
+				}
+
+				node.Members = append(node.Members, configMember{key.(string), keyOffset, member})
+			}
+		} else {
+			node.Kind = "array"
+			for decoder.More() {
+				item, itemError := parseConfigNode(decoder, content)
+				if itemError != nil {
+					return nil, itemError
+				}
+
+				node.Items = append(node.Items, item)
+			}
+		}
+
+		// the closing bracket
+		if _, closeError := decoder.Token(); closeError != nil {
+			return nil, closeError
+		}
+
+	case string:
+		node.Kind = "string"
+
+	case json.Number:
+		node.Kind = "number"
+
+	case bool:
+		node.Kind = "boolean"
+
+	default:
+		node.Kind = "null"
+	}
+
+	return node, nil
+}
+
+// skipJSONSeparators returns the offset of the next token after the given offset.
+func skipJSONSeparators(content []byte, offset int64) int64 {
+	for offset < int64(len(content)) && strings.IndexByte(" \t\r\n,:", content[offset]) >= 0 {
+		offset++
+	}
+
+	return offset
+}
+
+// getLineAndColumn returns the line and column (both starting at 1) of the given offset.
+func getLineAndColumn(content []byte, offset int64) (int, int) {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+
+	before := content[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// hasConfigType returns true if the given node has the given schema type.
+func hasConfigType(node *configNode, schemaType string) bool {
+	if schemaType == "integer" {
+		if node.Kind != "number" {
+			return false
+		}
+
+		_, integerError := node.Value.(json.Number).Int64()
+		return integerError == nil
+	}
+
+	return node.Kind == schemaType
+}
+
+// getConfigTypeName returns the description of the given schema type (e.g. "an integer").
+func getConfigTypeName(schemaType string) string {
+	switch schemaType {
+	case "object", "array", "integer":
+		return "an " + schemaType
+	}
+
+	return "a " + schemaType
+}
+
+// describeConfigNode returns the type and, for scalars, the value of the given node (e.g. `a string ("60")`).
+func describeConfigNode(node *configNode) string {
+	switch node.Kind {
+	case "object", "array":
+		return getConfigTypeName(node.Kind)
+
+	case "string":
+		return fmt.Sprintf("a string (%q)", node.String())
+
+	case "null":
+		return "null"
+	}
+
+	return fmt.Sprintf("%s (%v)", getConfigTypeName(node.Kind), node.Value)
+}
+
+// isConfigValueGiven returns true if the given value is neither missing nor null.
+func isConfigValueGiven(node *configNode) bool {
+	return node != nil && node.Kind != "null"
+}
+
+// joinConfigPath returns the path of the given key of the object at
+// the given path (e.g. "tasks[0].schedule" or `templates["webhost"]`).
+func joinConfigPath(path, key string, isMap bool) string {
+	if isMap {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// suggestConfigKey returns a hint for keys that only differ in case
+// from a known key (e.g. "Tasks"), because encoding/json would accept
+// them but the schema does not.
+func suggestConfigKey(key string, properties map[string]*configSchema) string {
+	for property := range properties {
+		if strings.EqualFold(property, key) {
+			return fmt.Sprintf(" (did you mean %q?)", property)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,173 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/spf13/afero"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// credentialSourceFactory creates a credential provider from the
+// location of a credential source (e.g. "vault://secret/data/dee").
+type credentialSourceFactory func(location *url.URL) (deens.CredentialProvider, error)
+
+// credentialSourceRegistry maps the URL schemes of credential
+// sources (e.g. "vault") to their provider factories.
+type credentialSourceRegistry map[string]credentialSourceFactory
+
+// newCredentialSourceRegistry creates a registry that contains all built-in
+// credential sources. The environment is read with the given function.
+func newCredentialSourceRegistry(fs afero.Fs, homeDir string, getenv func(key string) string, defaultConfigFilePath string, decrypter configDecrypter) credentialSourceRegistry {
+	registry := credentialSourceRegistry{
+		"vault": func(location *url.URL) (deens.CredentialProvider, error) {
+			return newVaultCredentialProvider(fs, homeDir, getenv, location)
+		},
+		"config": func(location *url.URL) (deens.CredentialProvider, error) {
+			filePath := location.Host + location.Path
+			if filePath == "" {
+				filePath = findConfigFile(fs, defaultConfigFilePath)
+			}
+
+			return configCredentialProvider{fs, decrypter, filePath}, nil
+		},
+		"env": func(location *url.URL) (deens.CredentialProvider, error) {
+			return newEnvironmentCredentialProvider(getenv, location), nil
+		},
+	}
+
+	for name, service := range awsSecretServices {
+		service := service
+		registry[name] = func(location *url.URL) (deens.CredentialProvider, error) {
+			return newAWSCredentialProvider(service, getenv, location)
+		}
+	}
+
+	return registry
+}
+
+// Names returns the sorted names of all registered credential sources.
+func (registry credentialSourceRegistry) Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// GetProvider returns the credential provider for the given source URL.
+func (registry credentialSourceRegistry) GetProvider(source string) (deens.CredentialProvider, error) {
+	location, parseError := url.Parse(strings.TrimSpace(source))
+	if parseError != nil {
+		return nil, fmt.Errorf("Invalid credential source %q: %s", source, parseError.Error())
+	}
+
+	factory, exists := registry[strings.ToLower(location.Scheme)]
+	if !exists {
+		return nil, fmt.Errorf("Unknown credential source %q (available: %s)", location.Scheme, strings.Join(registry.Names(), ", "))
+	}
+
+	return factory(location)
+}
+
+// sourcedCredentialProvider reads the API credentials from the
+// credential source given with the -credentials-from option or,
+// if no source was given, from the fallback provider.
+type sourcedCredentialProvider struct {
+	source   *string
+	registry credentialSourceRegistry
+	fallback deens.CredentialProvider
+}
+
+// GetCredentials returns the credentials of the selected credential source.
+func (provider sourcedCredentialProvider) GetCredentials() (deens.APICredentials, error) {
+	if provider.source == nil || isEmpty(*provider.source) {
+		return provider.fallback.GetCredentials()
+	}
+
+	sourceProvider, sourceError := provider.registry.GetProvider(*provider.source)
+	if sourceError != nil {
+		return deens.APICredentials{}, sourceError
+	}
+
+	return sourceProvider.GetCredentials()
+}
+
+// getCredentialsFromSecret returns the API credentials from the
+// "email" and "token" fields of the given secret.
+func getCredentialsFromSecret(secret map[string]interface{}) (deens.APICredentials, error) {
+	email, _ := secret["email"].(string)
+	token, _ := secret["token"].(string)
+
+	credentials, credentialsError := deens.NewAPICredentials(email, token)
+	if credentialsError != nil {
+		return deens.APICredentials{}, fmt.Errorf("The secret does not contain valid credentials (fields \"email\" and \"token\"): %s", credentialsError.Error())
+	}
+
+	return credentials, nil
+}
+
+// configCredentialProvider reads the API credentials from the
+// "credentials" section of a (usually encrypted) configuration file.
+type configCredentialProvider struct {
+	fs        afero.Fs
+	decrypter configDecrypter
+	filePath  string
+}
+
+// GetCredentials returns the credentials of the configuration file.
+func (provider configCredentialProvider) GetCredentials() (deens.APICredentials, error) {
+	settings, configError := loadConfig(provider.fs, provider.decrypter, provider.filePath)
+	if configError != nil {
+		return deens.APICredentials{}, configError
+	}
+
+	if settings.Credentials == nil {
+		return deens.APICredentials{}, fmt.Errorf("The configuration file %q contains no credentials", provider.filePath)
+	}
+
+	return deens.NewAPICredentials(settings.Credentials.Email, settings.Credentials.Token)
+}
+
+// environmentCredentialProvider reads the API credentials from environment
+// variables (e.g. in containers whose secrets are mounted as variables).
+type environmentCredentialProvider struct {
+	getenv        func(key string) string
+	emailVariable string
+	tokenVariable string
+}
+
+// newEnvironmentCredentialProvider creates a credential provider for the variables
+// DEE_EMAIL and DEE_TOKEN. The "email" and "token" parameters select other
+// variables (e.g. "env://?email=DNSIMPLE_EMAIL&token=DNSIMPLE_TOKEN").
+func newEnvironmentCredentialProvider(getenv func(key string) string, location *url.URL) environmentCredentialProvider {
+	provider := environmentCredentialProvider{getenv, "DEE_EMAIL", "DEE_TOKEN"}
+
+	parameters := location.Query()
+	if variable := parameters.Get("email"); variable != "" {
+		provider.emailVariable = variable
+	}
+
+	if variable := parameters.Get("token"); variable != "" {
+		provider.tokenVariable = variable
+	}
+
+	return provider
+}
+
+// GetCredentials returns the credentials of the environment variables.
+func (provider environmentCredentialProvider) GetCredentials() (deens.APICredentials, error) {
+	credentials, credentialsError := deens.NewAPICredentials(provider.getenv(provider.emailVariable), provider.getenv(provider.tokenVariable))
+	if credentialsError != nil {
+		return deens.APICredentials{}, fmt.Errorf("The environment variables %s and %s contain no valid credentials: %s", provider.emailVariable, provider.tokenVariable, credentialsError.Error())
+	}
+
+	return credentials, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/spf13/afero"
+	"net/url"
+	"testing"
+)
+
+type testCredentialProvider struct {
+	credentials deens.APICredentials
+	err         error
+}
+
+func (provider testCredentialProvider) GetCredentials() (deens.APICredentials, error) {
+	return provider.credentials, provider.err
+}
+
+// getTestEnvironment returns a getenv function for the given variables.
+func getTestEnvironment(variables map[string]string) func(key string) string {
+	return func(key string) string {
+		return variables[key]
+	}
+}
+
+// Without a credential source the credentials should be read from the fallback provider.
+func Test_sourcedCredentialProvider_NoSource_FallbackIsUsed(t *testing.T) {
+	// arrange
+	source := ""
+	fallback := testCredentialProvider{deens.APICredentials{Email: "john@example.com", Token: "file-token"}, nil}
+	provider := sourcedCredentialProvider{&source, credentialSourceRegistry{}, fallback}
+
+	// act
+	credentials, err := provider.GetCredentials()
+
+	// assert
+	if err != nil || credentials.Token != "file-token" {
+		t.Fail()
+		t.Logf("GetCredentials() should return the credentials of the fallback provider but returned %+v (error: %v)", credentials, err)
+	}
+}
+
+// With a credential source the credentials should be read from the matching provider.
+func Test_sourcedCredentialProvider_Source_SourceProviderIsUsed(t *testing.T) {
+	// arrange
+	source := "test://secret"
+	registry := credentialSourceRegistry{
+		"test": func(location *url.URL) (deens.CredentialProvider, error) {
+			if location.Host != "secret" {
+				return nil, fmt.Errorf("Unexpected location %q", location)
+			}
+
+			return testCredentialProvider{deens.APICredentials{Email: "john@example.com", Token: "source-token"}, nil}, nil
+		},
+	}
+
+	fallback := testCredentialProvider{deens.APICredentials{}, fmt.Errorf("The fallback should not be used")}
+	provider := sourcedCredentialProvider{&source, registry, fallback}
+
+	// act
+	credentials, err := provider.GetCredentials()
+
+	// assert
+	if err != nil || credentials.Token != "source-token" {
+		t.Fail()
+		t.Logf("GetCredentials() should return the credentials of the source but returned %+v (error: %v)", credentials, err)
+	}
+}
+
+// Unknown credential sources should result in an error.
+func Test_credentialSourceRegistry_GetProvider_UnknownSource_ErrorIsReturned(t *testing.T) {
+	// arrange
+	registry := newCredentialSourceRegistry(nil, "/home/user", getTestEnvironment(nil), "/home/user/.dee/config.json", configDecrypter{})
+
+	// act
+	_, err := registry.GetProvider("keychain://dee")
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("GetProvider should return an error for an unknown credential source")
+	}
+}
+
+// The config credential source should read the credentials from the encrypted configuration file.
+func Test_configCredentialProvider_GetCredentials_CredentialsAreReturned(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/user/.dee/config.json.age", []byte(`encrypted:{"credentials":{"email":"john@example.com","token":"config-token"}}`), 0600)
+
+	var commands []string
+	registry := newCredentialSourceRegistry(fs, "/home/user", getTestEnvironment(nil), "/home/user/.dee/config.json", getTestDecrypter(&commands))
+
+	// act
+	provider, providerError := registry.GetProvider("config://")
+	if providerError != nil {
+		t.Fatalf("GetProvider should not return an error: %s", providerError.Error())
+	}
+
+	credentials, err := provider.GetCredentials()
+
+	// assert
+	if err != nil || credentials.Email != "john@example.com" || credentials.Token != "config-token" {
+		t.Fail()
+		t.Logf("GetCredentials() should return the credentials of the configuration file but returned %+v (error: %v)", credentials, err)
+	}
+}
+
+// The env credential source should read DEE_EMAIL and DEE_TOKEN or the variables of its parameters.
+func Test_environmentCredentialProvider_GetCredentials_VariablesAreRead(t *testing.T) {
+	// arrange
+	environment := getTestEnvironment(map[string]string{
+		"DEE_EMAIL":      "john@example.com",
+		"DEE_TOKEN":      "env-token",
+		"DNSIMPLE_TOKEN": "dnsimple-token",
+	})
+
+	registry := newCredentialSourceRegistry(afero.NewMemMapFs(), "/home/user", environment, "/home/user/.dee/config.json", configDecrypter{})
+
+	for source, expected := range map[string]string{"env://": "env-token", "env://?token=DNSIMPLE_TOKEN": "dnsimple-token"} {
+		// act
+		provider, providerError := registry.GetProvider(source)
+		if providerError != nil {
+			t.Fatalf("GetProvider(%q) should not return an error: %s", source, providerError.Error())
+		}
+
+		credentials, err := provider.GetCredentials()
+
+		// assert
+		if err != nil || credentials.Email != "john@example.com" || credentials.Token != expected {
+			t.Fail()
+			t.Logf("GetCredentials() of %q should return the token %q but returned %+v (error: %v)", source, expected, credentials, err)
+		}
+	}
+}
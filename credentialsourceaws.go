@@ -0,0 +1,373 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// awsContainerCredentialsBaseURL is the address of the
+// ECS task role credential endpoint.
+const awsContainerCredentialsBaseURL = "http://169.254.170.2"
+
+// awsSecretService describes an AWS API that returns a secret value.
+type awsSecretService struct {
+	// name is the service name used in the endpoint and the request signature.
+	name string
+
+	// target is the value of the X-Amz-Target header.
+	target string
+
+	// getRequest returns the request body for the given secret name.
+	getRequest func(name string) interface{}
+
+	// getValue returns the secret value from the response body.
+	getValue func(response []byte) (string, error)
+}
+
+// awsSecretServices contains the supported AWS secret services by credential source name.
+var awsSecretServices = map[string]awsSecretService{
+	"aws-sm": {
+		name:   "secretsmanager",
+		target: "secretsmanager.GetSecretValue",
+		getRequest: func(name string) interface{} {
+			return map[string]string{"SecretId": name}
+		},
+		getValue: func(response []byte) (string, error) {
+			var secret struct {
+				SecretString string
+			}
+
+			if err := json.Unmarshal(response, &secret); err != nil {
+				return "", err
+			}
+
+			return secret.SecretString, nil
+		},
+	},
+	"aws-ssm": {
+		name:   "ssm",
+		target: "AmazonSSM.GetParameter",
+		getRequest: func(name string) interface{} {
+			return map[string]interface{}{"Name": name, "WithDecryption": true}
+		},
+		getValue: func(response []byte) (string, error) {
+			var parameter struct {
+				Parameter struct {
+					Value string
+				}
+			}
+
+			if err := json.Unmarshal(response, &parameter); err != nil {
+				return "", err
+			}
+
+			return parameter.Parameter.Value, nil
+		},
+	},
+}
+
+// newAWSCredentialProvider creates a credential provider that reads the
+// credentials from the given AWS secret service (e.g. "aws-sm://dee" or
+// "aws-ssm:///dee/credentials"). The region is taken from the "region"
+// parameter, AWS_REGION, AWS_DEFAULT_REGION or the EC2 instance metadata.
+// The "endpoint" parameter overrides the service endpoint (e.g. for VPC endpoints).
+func newAWSCredentialProvider(service awsSecretService, getenv func(key string) string, location *url.URL) (awsCredentialProvider, error) {
+	secretName := location.Host + location.Path
+	if location.Host == "" {
+		secretName = location.Path
+	}
+
+	if secretName == "" || secretName == "/" {
+		return awsCredentialProvider{}, fmt.Errorf("No secret name supplied (e.g. aws-sm://dee or aws-ssm:///dee/credentials)")
+	}
+
+	parameters := location.Query()
+
+	return awsCredentialProvider{
+		service:          service,
+		secretName:       secretName,
+		region:           parameters.Get("region"),
+		endpoint:         strings.TrimSuffix(parameters.Get("endpoint"), "/"),
+		getenv:           getenv,
+		containerBaseURL: awsContainerCredentialsBaseURL,
+		instanceMetadata: newCloudMetadataIPProvider(cloudMetadataServices["aws"], ""),
+		client:           &http.Client{Timeout: 10 * time.Second},
+		now:              time.Now,
+	}, nil
+}
+
+// awsCredentialProvider reads the API credentials from a secret
+// stored in AWS Secrets Manager or the SSM Parameter Store.
+type awsCredentialProvider struct {
+	service          awsSecretService
+	secretName       string
+	region           string
+	endpoint         string
+	getenv           func(key string) string
+	containerBaseURL string
+	instanceMetadata cloudMetadataIPProvider
+	client           *http.Client
+	now              func() time.Time
+}
+
+// awsAccessKeys contains the AWS credentials used to sign requests.
+type awsAccessKeys struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+}
+
+// GetCredentials reads the secret and returns its credentials.
+// The secret value must be a JSON object with the fields
+// "email" and "token".
+func (provider awsCredentialProvider) GetCredentials() (deens.APICredentials, error) {
+	region, regionError := provider.getRegion()
+	if regionError != nil {
+		return deens.APICredentials{}, regionError
+	}
+
+	keys, keysError := provider.getAccessKeys()
+	if keysError != nil {
+		return deens.APICredentials{}, keysError
+	}
+
+	endpoint := provider.endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com", provider.service.name, region)
+	}
+
+	body, _ := json.Marshal(provider.service.getRequest(provider.secretName))
+
+	request, requestError := http.NewRequest("POST", endpoint+"/", bytes.NewReader(body))
+	if requestError != nil {
+		return deens.APICredentials{}, requestError
+	}
+
+	request.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	request.Header.Set("X-Amz-Target", provider.service.target)
+	signAWSRequest(request, body, keys, region, provider.service.name, provider.now())
+
+	response, responseError := provider.client.Do(request)
+	if responseError != nil {
+		return deens.APICredentials{}, responseError
+	}
+
+	defer response.Body.Close()
+
+	responseBody, readError := ioutil.ReadAll(response.Body)
+	if readError != nil {
+		return deens.APICredentials{}, readError
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return deens.APICredentials{}, fmt.Errorf("Unable to read the secret %q: %s %s", provider.secretName, response.Status, strings.TrimSpace(string(responseBody)))
+	}
+
+	value, valueError := provider.service.getValue(responseBody)
+	if valueError != nil {
+		return deens.APICredentials{}, fmt.Errorf("Invalid response: %s", valueError.Error())
+	}
+
+	var secret map[string]interface{}
+	if unmarshalError := json.Unmarshal([]byte(value), &secret); unmarshalError != nil {
+		return deens.APICredentials{}, fmt.Errorf("The secret %q is not a JSON object: %s", provider.secretName, unmarshalError.Error())
+	}
+
+	return getCredentialsFromSecret(secret)
+}
+
+// getRegion returns the AWS region of the secret.
+func (provider awsCredentialProvider) getRegion() (string, error) {
+	for _, region := range []string{provider.region, provider.getenv("AWS_REGION"), provider.getenv("AWS_DEFAULT_REGION")} {
+		if region != "" {
+			return region, nil
+		}
+	}
+
+	region, metadataError := provider.getInstanceMetadata("/latest/meta-data/placement/region")
+	if metadataError != nil {
+		return "", fmt.Errorf("No AWS region supplied (use the region parameter or AWS_REGION)")
+	}
+
+	return strings.TrimSpace(region), nil
+}
+
+// getAccessKeys returns the first AWS credentials found in the environment
+// variables, the ECS task role or the EC2 instance profile.
+func (provider awsCredentialProvider) getAccessKeys() (awsAccessKeys, error) {
+	sources := []func() (awsAccessKeys, error){
+		provider.getEnvironmentAccessKeys,
+		provider.getContainerAccessKeys,
+		provider.getInstanceAccessKeys,
+	}
+
+	for _, source := range sources {
+		if keys, err := source(); err == nil {
+			return keys, nil
+		}
+	}
+
+	return awsAccessKeys{}, fmt.Errorf("No AWS credentials found (environment, ECS task role or EC2 instance profile)")
+}
+
+// getEnvironmentAccessKeys reads the AWS credentials from the environment variables.
+func (provider awsCredentialProvider) getEnvironmentAccessKeys() (awsAccessKeys, error) {
+	keys := awsAccessKeys{provider.getenv("AWS_ACCESS_KEY_ID"), provider.getenv("AWS_SECRET_ACCESS_KEY"), provider.getenv("AWS_SESSION_TOKEN")}
+	if keys.AccessKeyID == "" || keys.SecretAccessKey == "" {
+		return awsAccessKeys{}, fmt.Errorf("No AWS credentials in the environment")
+	}
+
+	return keys, nil
+}
+
+// getContainerAccessKeys reads the credentials of the ECS task role.
+func (provider awsCredentialProvider) getContainerAccessKeys() (awsAccessKeys, error) {
+	credentialsURL := provider.getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relativeURI := provider.getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relativeURI != "" {
+		credentialsURL = provider.containerBaseURL + relativeURI
+	}
+
+	if credentialsURL == "" {
+		return awsAccessKeys{}, fmt.Errorf("No container credentials available")
+	}
+
+	request, requestError := http.NewRequest("GET", credentialsURL, nil)
+	if requestError != nil {
+		return awsAccessKeys{}, requestError
+	}
+
+	if authorization := provider.getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+
+	body, responseError := provider.instanceMetadata.do(request)
+	if responseError != nil {
+		return awsAccessKeys{}, responseError
+	}
+
+	return parseAWSAccessKeys(body)
+}
+
+// getInstanceAccessKeys reads the credentials of the EC2 instance profile.
+func (provider awsCredentialProvider) getInstanceAccessKeys() (awsAccessKeys, error) {
+	roles, rolesError := provider.getInstanceMetadata("/latest/meta-data/iam/security-credentials/")
+	if rolesError != nil {
+		return awsAccessKeys{}, rolesError
+	}
+
+	role := strings.TrimSpace(strings.SplitN(roles, "\n", 2)[0])
+	if role == "" {
+		return awsAccessKeys{}, fmt.Errorf("The instance has no IAM role")
+	}
+
+	body, credentialsError := provider.getInstanceMetadata("/latest/meta-data/iam/security-credentials/" + role)
+	if credentialsError != nil {
+		return awsAccessKeys{}, credentialsError
+	}
+
+	return parseAWSAccessKeys(body)
+}
+
+// getInstanceMetadata reads the given path from the EC2 instance metadata (IMDSv2).
+func (provider awsCredentialProvider) getInstanceMetadata(path string) (string, error) {
+	token, tokenError := provider.instanceMetadata.getToken()
+	if tokenError != nil {
+		return "", tokenError
+	}
+
+	request, requestError := http.NewRequest("GET", provider.instanceMetadata.baseURL+path, nil)
+	if requestError != nil {
+		return "", requestError
+	}
+
+	request.Header.Set("X-aws-ec2-metadata-token", token)
+
+	return provider.instanceMetadata.do(request)
+}
+
+// parseAWSAccessKeys parses the credentials returned by the ECS and EC2 credential endpoints.
+func parseAWSAccessKeys(body string) (awsAccessKeys, error) {
+	var keys awsAccessKeys
+	if err := json.Unmarshal([]byte(body), &keys); err != nil {
+		return awsAccessKeys{}, err
+	}
+
+	if keys.AccessKeyID == "" || keys.SecretAccessKey == "" {
+		return awsAccessKeys{}, fmt.Errorf("The credential endpoint returned no access key")
+	}
+
+	return keys, nil
+}
+
+// signAWSRequest adds the AWS Signature Version 4 authorization
+// header to the given request.
+func signAWSRequest(request *http.Request, body []byte, keys awsAccessKeys, region, service string, now time.Time) {
+	timestamp := now.UTC().Format("20060102T150405Z")
+	date := timestamp[:8]
+
+	request.Header.Set("Host", request.URL.Host)
+	request.Header.Set("X-Amz-Date", timestamp)
+	if keys.Token != "" {
+		request.Header.Set("X-Amz-Security-Token", keys.Token)
+	}
+
+	signedHeaders := []string{"content-type", "host", "x-amz-date"}
+	if keys.Token != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+
+	signedHeaders = append(signedHeaders, "x-amz-target")
+
+	canonicalHeaders := new(bytes.Buffer)
+	for _, header := range signedHeaders {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", header, strings.TrimSpace(request.Header.Get(header)))
+	}
+
+	path := request.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		path,
+		request.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", timestamp, scope, hex.EncodeToString(canonicalRequestHash[:])}, "\n")
+
+	key := []byte("AWS4" + keys.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", keys.AccessKeyID, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the given data.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
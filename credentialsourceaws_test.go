@@ -0,0 +1,159 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAWSServer returns a server that acts as the Secrets Manager and SSM
+// endpoint as well as the ECS and EC2 credential endpoints.
+func newTestAWSServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/latest/api/token":
+			fmt.Fprintf(w, "imds-token")
+
+		case r.URL.Path == "/latest/meta-data/placement/region":
+			fmt.Fprintf(w, "eu-west-1")
+
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprintf(w, "dee-role")
+
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/dee-role":
+			fmt.Fprintf(w, `{"AccessKeyId":"AKIDINSTANCE","SecretAccessKey":"secret","Token":"instance-session"}`)
+
+		case r.URL.Path == "/v2/credentials/task":
+			fmt.Fprintf(w, `{"AccessKeyId":"AKIDTASK","SecretAccessKey":"secret","Token":"task-session"}`)
+
+		case r.Method == "POST" && r.URL.Path == "/":
+			body, _ := ioutil.ReadAll(r.Body)
+			authorization := r.Header.Get("Authorization")
+			if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKID") || !strings.Contains(authorization, "Signature=") {
+				http.Error(w, `{"message":"Missing signature"}`, http.StatusForbidden)
+				return
+			}
+
+			switch r.Header.Get("X-Amz-Target") {
+			case "secretsmanager.GetSecretValue":
+				if string(body) != `{"SecretId":"dee"}` {
+					http.Error(w, `{"__type":"ResourceNotFoundException"}`, http.StatusBadRequest)
+					return
+				}
+
+				fmt.Fprintf(w, `{"Name":"dee","SecretString":"{\"email\":\"john@example.com\",\"token\":\"sm-token\"}"}`)
+
+			case "AmazonSSM.GetParameter":
+				fmt.Fprintf(w, `{"Parameter":{"Name":"/dee/credentials","Value":"{\"email\":\"john@example.com\",\"token\":\"ssm-token\"}"}}`)
+			}
+
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	}))
+}
+
+// getTestAWSCredentialProvider returns a provider for the given source that uses the test server.
+func getTestAWSCredentialProvider(server *httptest.Server, source string, environment map[string]string) (awsCredentialProvider, error) {
+	location, _ := url.Parse(source + "?endpoint=" + server.URL)
+	scheme := location.Scheme
+
+	provider, err := newAWSCredentialProvider(awsSecretServices[scheme], getTestEnvironment(environment), location)
+	if err != nil {
+		return provider, err
+	}
+
+	provider.containerBaseURL = server.URL
+	provider.instanceMetadata = newCloudMetadataIPProvider(cloudMetadataServices["aws"], server.URL)
+	provider.now = func() time.Time { return time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC) }
+
+	return provider, nil
+}
+
+// The AWS credential sources should read the credentials with the available AWS credentials.
+func Test_awsCredentialProvider_GetCredentials_CredentialsAreReturned(t *testing.T) {
+	// arrange
+	server := newTestAWSServer()
+	defer server.Close()
+
+	inputs := []struct {
+		source        string
+		environment   map[string]string
+		expectedToken string
+	}{
+		{"aws-sm://dee", map[string]string{"AWS_REGION": "eu-central-1", "AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "secret"}, "sm-token"},
+		{"aws-ssm:///dee/credentials", map[string]string{"AWS_DEFAULT_REGION": "us-east-1", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "/v2/credentials/task"}, "ssm-token"},
+		{"aws-sm://dee", nil, "sm-token"},
+	}
+
+	for _, input := range inputs {
+		provider, providerError := getTestAWSCredentialProvider(server, input.source, input.environment)
+		if providerError != nil {
+			t.Fatalf("newAWSCredentialProvider(%q) should not return an error: %s", input.source, providerError.Error())
+		}
+
+		// act
+		credentials, err := provider.GetCredentials()
+
+		// assert
+		if err != nil || credentials.Email != "john@example.com" || credentials.Token != input.expectedToken {
+			t.Fail()
+			t.Logf("GetCredentials() for %q should return the token %q but returned %+v (error: %v)", input.source, input.expectedToken, credentials, err)
+		}
+	}
+}
+
+// The AWS requests should be signed with the credentials, region and service.
+func Test_signAWSRequest_AuthorizationHeaderIsSet(t *testing.T) {
+	// arrange
+	body := []byte(`{"SecretId":"dee"}`)
+	request, _ := http.NewRequest("POST", "https://secretsmanager.eu-central-1.amazonaws.com/", nil)
+	request.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	request.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	keys := awsAccessKeys{"AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "session"}
+	now := time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+
+	// act
+	signAWSRequest(request, body, keys, "eu-central-1", "secretsmanager", now)
+
+	// assert
+	expectedPrefix := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20160304/eu-central-1/secretsmanager/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target, Signature="
+	authorization := request.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, expectedPrefix) || len(authorization) != len(expectedPrefix)+64 {
+		t.Fail()
+		t.Logf("The authorization header should start with %q but was %q", expectedPrefix, authorization)
+	}
+
+	if request.Header.Get("X-Amz-Date") != "20160304T100000Z" || request.Header.Get("X-Amz-Security-Token") != "session" {
+		t.Fail()
+		t.Logf("The date and session token headers should be set: %v", request.Header)
+	}
+}
+
+// The AWS credential sources should return an error if no secret name is given.
+func Test_newAWSCredentialProvider_NoSecretName_ErrorIsReturned(t *testing.T) {
+	// arrange
+	registry := newCredentialSourceRegistry(nil, "/home/user", getTestEnvironment(nil), "/home/user/.dee/config.json", configDecrypter{})
+
+	for _, source := range []string{"aws-sm://", "aws-ssm:///"} {
+
+		// act
+		_, err := registry.GetProvider(source)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("GetProvider(%q) should return an error", source)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/spf13/afero"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	vaultAuthToken   = "token"
+	vaultAuthAppRole = "approle"
+)
+
+// newVaultCredentialProvider creates a credential provider that reads the
+// credentials from a HashiCorp Vault secret (e.g. "vault://secret/data/dee").
+// The Vault address is taken from the "address" parameter or the VAULT_ADDR
+// environment variable. The "auth" parameter selects the auth method:
+// "token" (VAULT_TOKEN or ~/.vault-token) or "approle" (VAULT_ROLE_ID
+// and VAULT_SECRET_ID).
+func newVaultCredentialProvider(fs afero.Fs, homeDir string, getenv func(key string) string, location *url.URL) (vaultCredentialProvider, error) {
+	secretPath := strings.Trim(location.Host+location.Path, "/")
+	if secretPath == "" {
+		return vaultCredentialProvider{}, fmt.Errorf("No Vault secret path supplied (e.g. vault://secret/data/dee)")
+	}
+
+	parameters := location.Query()
+
+	address := parameters.Get("address")
+	if address == "" {
+		address = getenv("VAULT_ADDR")
+	}
+
+	if address == "" {
+		return vaultCredentialProvider{}, fmt.Errorf("No Vault address supplied (use the address parameter or VAULT_ADDR)")
+	}
+
+	auth := strings.ToLower(parameters.Get("auth"))
+	if auth == "" {
+		auth = vaultAuthToken
+	}
+
+	if auth != vaultAuthToken && auth != vaultAuthAppRole {
+		return vaultCredentialProvider{}, fmt.Errorf("Unknown Vault auth method %q (available: %s, %s)", auth, vaultAuthToken, vaultAuthAppRole)
+	}
+
+	appRoleMount := parameters.Get("mount")
+	if appRoleMount == "" {
+		appRoleMount = vaultAuthAppRole
+	}
+
+	return vaultCredentialProvider{
+		fs:            fs,
+		tokenFilePath: filepath.Join(homeDir, ".vault-token"),
+		getenv:        getenv,
+		address:       strings.TrimSuffix(address, "/"),
+		secretPath:    secretPath,
+		auth:          auth,
+		appRoleMount:  appRoleMount,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// vaultCredentialProvider reads the API credentials from a
+// key/value secret (version 1 or 2) stored in HashiCorp Vault.
+type vaultCredentialProvider struct {
+	fs            afero.Fs
+	tokenFilePath string
+	getenv        func(key string) string
+	address       string
+	secretPath    string
+	auth          string
+	appRoleMount  string
+	client        *http.Client
+}
+
+// vaultResponse contains the fields of a Vault API response that are used.
+type vaultResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Auth   *vaultAuth             `json:"auth"`
+	Errors []string               `json:"errors"`
+}
+
+// vaultAuth contains the client token of a Vault login response.
+type vaultAuth struct {
+	ClientToken string `json:"client_token"`
+}
+
+// GetCredentials reads the secret from Vault and returns its credentials.
+func (provider vaultCredentialProvider) GetCredentials() (deens.APICredentials, error) {
+	token, tokenError := provider.getToken()
+	if tokenError != nil {
+		return deens.APICredentials{}, tokenError
+	}
+
+	response, responseError := provider.do("GET", "/v1/"+provider.secretPath, token, nil)
+	if responseError != nil {
+		return deens.APICredentials{}, fmt.Errorf("Unable to read the Vault secret %q: %s", provider.secretPath, responseError.Error())
+	}
+
+	secret := response.Data
+
+	// key/value version 2 secrets are nested in a second data field
+	if nested, isNested := secret["data"].(map[string]interface{}); isNested {
+		secret = nested
+	}
+
+	return getCredentialsFromSecret(secret)
+}
+
+// getToken returns the Vault token of the selected auth method.
+func (provider vaultCredentialProvider) getToken() (string, error) {
+	if provider.auth == vaultAuthAppRole {
+		return provider.loginWithAppRole()
+	}
+
+	if token := provider.getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	content, readError := afero.ReadFile(provider.fs, provider.tokenFilePath)
+	if readError != nil || isEmpty(string(content)) {
+		return "", fmt.Errorf("No Vault token found (set VAULT_TOKEN or log in with the Vault CLI)")
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+// loginWithAppRole requests a Vault token with the role and secret
+// ID from the VAULT_ROLE_ID and VAULT_SECRET_ID environment variables.
+func (provider vaultCredentialProvider) loginWithAppRole() (string, error) {
+	roleID := provider.getenv("VAULT_ROLE_ID")
+	secretID := provider.getenv("VAULT_SECRET_ID")
+	if roleID == "" || secretID == "" {
+		return "", fmt.Errorf("The Vault AppRole login requires VAULT_ROLE_ID and VAULT_SECRET_ID")
+	}
+
+	body, _ := json.Marshal(map[string]string{"role_id": roleID, "secret_id": secretID})
+
+	response, responseError := provider.do("POST", "/v1/auth/"+provider.appRoleMount+"/login", "", body)
+	if responseError != nil {
+		return "", fmt.Errorf("The Vault AppRole login failed: %s", responseError.Error())
+	}
+
+	if response.Auth == nil || response.Auth.ClientToken == "" {
+		return "", fmt.Errorf("The Vault AppRole login did not return a token")
+	}
+
+	return response.Auth.ClientToken, nil
+}
+
+// do sends a request to the Vault API and decodes the response.
+func (provider vaultCredentialProvider) do(method, path, token string, body []byte) (vaultResponse, error) {
+	request, requestError := http.NewRequest(method, provider.address+path, bytes.NewReader(body))
+	if requestError != nil {
+		return vaultResponse{}, requestError
+	}
+
+	if token != "" {
+		request.Header.Set("X-Vault-Token", token)
+	}
+
+	if namespace := provider.getenv("VAULT_NAMESPACE"); namespace != "" {
+		request.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	response, responseError := provider.client.Do(request)
+	if responseError != nil {
+		return vaultResponse{}, responseError
+	}
+
+	defer response.Body.Close()
+
+	var result vaultResponse
+	decodeError := json.NewDecoder(response.Body).Decode(&result)
+
+	if response.StatusCode != http.StatusOK {
+		if len(result.Errors) > 0 {
+			return vaultResponse{}, fmt.Errorf("%s (%s)", response.Status, strings.Join(result.Errors, "; "))
+		}
+
+		return vaultResponse{}, fmt.Errorf("%s", response.Status)
+	}
+
+	if decodeError != nil {
+		return vaultResponse{}, fmt.Errorf("Invalid response: %s", decodeError.Error())
+	}
+
+	return result, nil
+}
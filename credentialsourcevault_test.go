@@ -0,0 +1,120 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/afero"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestVaultServer returns a Vault server with a key/value version 2 secret
+// at "secret/data/dee", a version 1 secret at "kv/dee" and an AppRole login.
+func newTestVaultServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/v1/auth/approle/login":
+			var login map[string]string
+			json.NewDecoder(r.Body).Decode(&login)
+			if login["role_id"] != "role" || login["secret_id"] != "secret" {
+				http.Error(w, `{"errors":["invalid role or secret ID"]}`, http.StatusBadRequest)
+				return
+			}
+
+			fmt.Fprintf(w, `{"auth":{"client_token":"approle-token"}}`)
+
+		case r.Header.Get("X-Vault-Token") != "s.token" && r.Header.Get("X-Vault-Token") != "approle-token":
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+
+		case r.URL.Path == "/v1/secret/data/dee":
+			fmt.Fprintf(w, `{"data":{"data":{"email":"john@example.com","token":"kv2-token"},"metadata":{"version":1}}}`)
+
+		case r.URL.Path == "/v1/kv/dee":
+			fmt.Fprintf(w, `{"data":{"email":"john@example.com","token":"kv1-token"}}`)
+
+		default:
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		}
+	}))
+}
+
+// The Vault credential source should read the credentials with the configured auth method.
+func Test_vaultCredentialProvider_GetCredentials_CredentialsAreReturned(t *testing.T) {
+	// arrange
+	server := newTestVaultServer()
+	defer server.Close()
+
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/user/.vault-token", []byte("s.token\n"), 0600)
+
+	inputs := []struct {
+		source        string
+		environment   map[string]string
+		expectedToken string
+	}{
+		{"vault://secret/data/dee", map[string]string{"VAULT_ADDR": server.URL, "VAULT_TOKEN": "s.token"}, "kv2-token"},
+		{"vault://kv/dee?address=" + server.URL, nil, "kv1-token"},
+		{"vault://kv/dee?auth=approle", map[string]string{"VAULT_ADDR": server.URL, "VAULT_ROLE_ID": "role", "VAULT_SECRET_ID": "secret"}, "kv1-token"},
+	}
+
+	for _, input := range inputs {
+		registry := newCredentialSourceRegistry(fs, "/home/user", getTestEnvironment(input.environment), "/home/user/.dee/config.json", configDecrypter{})
+
+		// act
+		provider, providerError := registry.GetProvider(input.source)
+		if providerError != nil {
+			t.Fail()
+			t.Logf("GetProvider(%q) should not return an error: %s", input.source, providerError.Error())
+			continue
+		}
+
+		credentials, err := provider.GetCredentials()
+
+		// assert
+		if err != nil || credentials.Email != "john@example.com" || credentials.Token != input.expectedToken {
+			t.Fail()
+			t.Logf("GetCredentials() for %q should return the token %q but returned %+v (error: %v)", input.source, input.expectedToken, credentials, err)
+		}
+	}
+}
+
+// The Vault credential source should return an error if the secret cannot be read.
+func Test_vaultCredentialProvider_GetCredentials_InvalidSettings_ErrorIsReturned(t *testing.T) {
+	// arrange
+	server := newTestVaultServer()
+	defer server.Close()
+
+	inputs := []struct {
+		source      string
+		environment map[string]string
+	}{
+		{"vault://secret/data/dee", map[string]string{"VAULT_TOKEN": "s.token"}},
+		{"vault://", map[string]string{"VAULT_ADDR": server.URL, "VAULT_TOKEN": "s.token"}},
+		{"vault://secret/data/dee?auth=ldap", map[string]string{"VAULT_ADDR": server.URL}},
+		{"vault://secret/data/dee", map[string]string{"VAULT_ADDR": server.URL}},
+		{"vault://secret/data/dee", map[string]string{"VAULT_ADDR": server.URL, "VAULT_TOKEN": "s.wrong"}},
+		{"vault://secret/data/missing", map[string]string{"VAULT_ADDR": server.URL, "VAULT_TOKEN": "s.token"}},
+		{"vault://kv/dee?auth=approle", map[string]string{"VAULT_ADDR": server.URL, "VAULT_ROLE_ID": "role", "VAULT_SECRET_ID": "wrong"}},
+	}
+
+	for _, input := range inputs {
+		registry := newCredentialSourceRegistry(afero.NewMemMapFs(), "/home/user", getTestEnvironment(input.environment), "/home/user/.dee/config.json", configDecrypter{})
+
+		// act
+		provider, err := registry.GetProvider(input.source)
+		if err == nil {
+			_, err = provider.GetCredentials()
+		}
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("Reading the credentials from %q with %v should fail", input.source, input.environment)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"strconv"
+)
+
+// dnsimpleClientFactory creates DNSimple clients.
+type dnsimpleClientFactory struct {
+	credentialProvider deens.CredentialProvider
+
+	// httpClient is the HTTP client shared by all DNSimple clients (optional).
+	httpClient *sharedHTTPClient
+
+	// apiURL replaces the URL of the DNSimple API (optional; e.g. the URL of a dnsimpletest server).
+	apiURL string
+}
+
+// CreateClient create a new DNSimple client instance.
+func (clientFactory dnsimpleClientFactory) CreateClient() (deens.DNSClient, error) {
+
+	// get the credentials
+	credentials, credentialError := clientFactory.credentialProvider.GetCredentials()
+	if credentialError != nil {
+		return nil, fmt.Errorf("%s", credentialError.Error())
+	}
+
+	// create a DNSimple client
+	dnsimpleClient, dnsimpleClientError := dnsimple.NewClient(credentials.Email, credentials.Token)
+	if dnsimpleClientError != nil {
+		return nil, fmt.Errorf("Unable to create DNSimple client. Error: %s", dnsimpleClientError.Error())
+	}
+
+	if clientFactory.apiURL != "" {
+		dnsimpleClient.URL = clientFactory.apiURL
+	}
+
+	// reuse the connections of the shared HTTP client
+	if clientFactory.httpClient != nil {
+		httpClient, httpClientError := clientFactory.httpClient.Get()
+		if httpClientError != nil {
+			return nil, httpClientError
+		}
+
+		dnsimpleClient.Http = httpClient
+	}
+
+	return dnsimpleClient, nil
+}
+
+// dnsimpleProvider adapts the DNSimple API to the DNS provider interface.
+type dnsimpleProvider struct {
+	client deens.DNSClient
+}
+
+// GetDomains returns the domains of the DNSimple account.
+func (provider dnsimpleProvider) GetDomains() ([]dnsDomain, error) {
+	domains, domainsError := provider.client.GetDomains()
+	if domainsError != nil {
+		return nil, domainsError
+	}
+
+	var result []dnsDomain
+	for _, domain := range domains {
+		result = append(result, dnsDomain{domain.Name, domain.ExpiresOn})
+	}
+
+	return result, nil
+}
+
+// GetRecords returns the records of the given domain.
+func (provider dnsimpleProvider) GetRecords(domain string) ([]dnsRecord, error) {
+	records, recordsError := provider.client.GetRecords(domain)
+	if recordsError != nil {
+		return nil, recordsError
+	}
+
+	var result []dnsRecord
+	for _, record := range records {
+		result = append(result, dnsRecord{record.StringId(), record.Name, record.RecordType, record.Content, int(record.Ttl), int(record.Prio)})
+	}
+
+	return result, nil
+}
+
+// CreateRecord creates the given record and returns its ID.
+func (provider dnsimpleProvider) CreateRecord(domain string, record dnsRecord) (string, error) {
+	return provider.client.CreateRecord(domain, getDNSimpleChangeRecord(record))
+}
+
+// UpdateRecord changes the non-empty fields of the record with the given ID.
+func (provider dnsimpleProvider) UpdateRecord(domain, id string, record dnsRecord) error {
+	_, err := provider.client.UpdateRecord(domain, id, getDNSimpleChangeRecord(record))
+	return err
+}
+
+// DeleteRecord deletes the record with the given ID.
+func (provider dnsimpleProvider) DeleteRecord(domain, id string) error {
+	return provider.client.DestroyRecord(domain, id)
+}
+
+// getDNSimpleChangeRecord returns the given record as a change of the DNSimple
+// API. The DNSimple client cannot change the priority of records.
+func getDNSimpleChangeRecord(record dnsRecord) *dnsimple.ChangeRecord {
+	change := &dnsimple.ChangeRecord{Name: record.Name, Type: record.Type, Value: record.Content}
+	if record.TTL > 0 {
+		change.Ttl = strconv.Itoa(record.TTL)
+	}
+
+	return change
+}
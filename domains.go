@@ -0,0 +1,204 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"sync"
+)
+
+// getTargetDomains returns the domains an action is applied to: either the
+// given domain or the domains of the given comma-separated list. List entries
+// with wildcards (e.g. "example.*") are matched against the domains of the account.
+func getTargetDomains(domain, domainList string, infoProviderFactory dnsInfoProviderCreator) ([]string, error) {
+	if domain != "" && domainList != "" {
+		return nil, fmt.Errorf("The -domain and -domains arguments cannot be combined")
+	}
+
+	if domainList == "" {
+		if domain == "" {
+			return nil, fmt.Errorf("No domain supplied")
+		}
+
+		return []string{domain}, nil
+	}
+
+	var accountDomains []string
+	var domains []string
+	for _, entry := range strings.Split(domainList, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+
+		if !strings.ContainsAny(entry, "*?[") {
+			if !containsString(domains, entry) {
+				domains = append(domains, entry)
+			}
+
+			continue
+		}
+
+		if _, patternError := path.Match(entry, ""); patternError != nil {
+			return nil, fmt.Errorf("Invalid domain pattern %q: %s", entry, patternError.Error())
+		}
+
+		if accountDomains == nil {
+			names, namesError := getAccountDomains(infoProviderFactory)
+			if namesError != nil {
+				return nil, namesError
+			}
+
+			accountDomains = names
+		}
+
+		matched := false
+		for _, name := range accountDomains {
+			if isMatch, _ := path.Match(entry, strings.ToLower(name)); !isMatch {
+				continue
+			}
+
+			matched = true
+			if !containsString(domains, name) {
+				domains = append(domains, name)
+			}
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("No domain matches %q", entry)
+		}
+	}
+
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("No domain supplied")
+	}
+
+	return domains, nil
+}
+
+// getAccountDomains returns the names of all domains of the account.
+func getAccountDomains(infoProviderFactory dnsInfoProviderCreator) ([]string, error) {
+	if infoProviderFactory == nil {
+		return nil, fmt.Errorf("No DNS info provider factory available")
+	}
+
+	infoProvider, infoProviderError := infoProviderFactory.CreateInfoProvider()
+	if infoProviderError != nil {
+		return nil, fmt.Errorf("No DNS info provider available")
+	}
+
+	names, namesError := infoProvider.GetDomainNames()
+	if namesError != nil {
+		return nil, fmt.Errorf("Unable to retrieve domain names: %s", namesError.Error())
+	}
+
+	return names, nil
+}
+
+// applyToDomains executes the given function for each domain and combines
+// the results into one message with a section per domain. The domains are
+// processed in parallel (see -parallel). A failing domain does not stop the
+// others; the failures are returned as one error that also lists the successful changes.
+func applyToDomains(domains []string, apply func(domain string) (message, error)) (message, error) {
+	return applyToDomainsInParallel(domains, *parallelDomains, apply)
+}
+
+// domainResult is the result of a multi-domain action for a single domain.
+type domainResult struct {
+	result message
+	err    error
+}
+
+// applyToDomainsInParallel executes the given function for each domain
+// with the given number of workers and combines the results.
+func applyToDomainsInParallel(domains []string, workers int, apply func(domain string) (message, error)) (message, error) {
+	if len(domains) == 1 {
+		return apply(domains[0])
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	// the results are kept in the order of the domains
+	results := make([]domainResult, len(domains))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers && worker < len(domains); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = applyToDomain(domains[index], apply)
+			}
+		}()
+	}
+
+	for index := range domains {
+		indexes <- index
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	var sections []string
+	var ip net.IP
+	failures := 0
+	changedRecords := 0
+
+	for index, result := range results {
+		if result.err != nil {
+			sections = append(sections, formatDomainSection(domains[index], "Failed: "+result.err.Error()))
+			failures++
+			continue
+		}
+
+		sections = append(sections, formatDomainSection(domains[index], result.result.Text()))
+		changedRecords += getChangeSummary(result.result).Records
+
+		if addressChange, isAddressChange := result.result.(addressChangeMessage); isAddressChange {
+			ip = addressChange.ip
+		}
+	}
+
+	text := strings.Join(sections, "\n")
+	if failures > 0 {
+		return nil, fmt.Errorf("%d of %d domains failed:\n%s", failures, len(domains), text)
+	}
+
+	if changedRecords == 0 {
+		return unchangedMessage{text}, nil
+	}
+
+	if ip != nil {
+		return addressChangeMessage{changeMessage{text, changedRecords}, ip}, nil
+	}
+
+	return changeMessage{text, changedRecords}, nil
+}
+
+// applyToDomain executes the given function for a single domain.
+// A panic is returned as the error of the domain so that it
+// does not abort the other domains.
+func applyToDomain(domain string, apply func(domain string) (message, error)) (result domainResult) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result = domainResult{nil, fmt.Errorf("%v", recovered)}
+		}
+	}()
+
+	applied, err := apply(domain)
+	return domainResult{applied, err}
+}
+
+// formatDomainSection returns the result of a domain as
+// a section with the domain name and the indented text.
+func formatDomainSection(domain, text string) string {
+	return domain + ":\n  " + strings.Replace(text, "\n", "\n  ", -1)
+}
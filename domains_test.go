@@ -0,0 +1,201 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// getTestDomainInfoProviderFactory returns an info provider factory for an account with the given domains.
+func getTestDomainInfoProviderFactory(domains ...string) testInfoProviderFactory {
+	return testInfoProviderFactory{testDNSInfoProvider{
+		getDomainNamesFunc: func() ([]string, error) {
+			return domains, nil
+		},
+	}, nil}
+}
+
+func Test_getTargetDomains(t *testing.T) {
+	// arrange
+	infoProviderFactory := getTestDomainInfoProviderFactory("example.com", "example.net", "example.org", "other.com")
+	inputs := []struct {
+		domain         string
+		domainList     string
+		expectedResult string
+	}{
+		{"example.com", "", "example.com"},
+		{"", "example.com,example.net", "example.com,example.net"},
+		{"", " example.com , , example.com ", "example.com"},
+		{"", "example.*", "example.com,example.net,example.org"},
+		{"", "*.com,example.org", "example.com,other.com,example.org"},
+		{"", "unknown.com", "unknown.com"},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		result, err := getTargetDomains(input.domain, input.domainList, infoProviderFactory)
+
+		// assert
+		if err != nil || strings.Join(result, ",") != input.expectedResult {
+			t.Fail()
+			t.Logf("getTargetDomains(%q, %q) returned %q (%v) but should have returned %q.", input.domain, input.domainList, result, err, input.expectedResult)
+		}
+	}
+}
+
+// getTargetDomains should return an error for missing, combined or unmatched domain arguments.
+func Test_getTargetDomains_InvalidArguments_ErrorIsReturned(t *testing.T) {
+	// arrange
+	infoProviderFactory := getTestDomainInfoProviderFactory("example.com")
+	inputs := []struct {
+		domain     string
+		domainList string
+	}{
+		{"", ""},
+		{"", " , "},
+		{"example.com", "example.net"},
+		{"", "*.org"},
+		{"", "example.[com"},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		_, err := getTargetDomains(input.domain, input.domainList, infoProviderFactory)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("getTargetDomains(%q, %q) should return an error.", input.domain, input.domainList)
+		}
+	}
+}
+
+// applyToDomains should combine the results of all domains and report the failed ones.
+func Test_applyToDomains_OneDomainFails_AllDomainsAreProcessed(t *testing.T) {
+	// arrange
+	ip := net.ParseIP("203.0.113.1")
+	var lock sync.Mutex
+	var processed []string
+
+	// act
+	_, err := applyToDomains([]string{"example.com", "example.net", "example.org"}, func(domain string) (message, error) {
+		lock.Lock()
+		processed = append(processed, domain)
+		lock.Unlock()
+
+		if domain == "example.net" {
+			return nil, fmt.Errorf("No address record found")
+		}
+
+		return addressChangeMessage{changeMessage{"Updated: www." + domain, 1}, ip}, nil
+	})
+
+	// assert
+	if len(processed) != 3 {
+		t.Fail()
+		t.Logf("All domains should have been processed: %q", processed)
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "example.net:\n  Failed: No address record found") || !strings.Contains(err.Error(), "Updated: www.example.org") {
+		t.Fail()
+		t.Logf("The error should contain the failure and the successful changes: %v", err)
+	}
+}
+
+// applyToDomains should return the total number of changes or an unchanged message.
+func Test_applyToDomains_CombinedResultIsReturned(t *testing.T) {
+	// arrange
+	ip := net.ParseIP("203.0.113.1")
+	domains := []string{"example.com", "example.net"}
+
+	// act
+	changed, _ := applyToDomains(domains, func(domain string) (message, error) {
+		if domain == "example.com" {
+			return unchangedMessage{"Unchanged: www." + domain}, nil
+		}
+
+		return addressChangeMessage{changeMessage{"Updated: www." + domain, 1}, ip}, nil
+	})
+
+	unchanged, _ := applyToDomains(domains, func(domain string) (message, error) {
+		return unchangedMessage{"Unchanged: www." + domain}, nil
+	})
+
+	// assert
+	if addressChange, isAddressChange := changed.(addressChangeMessage); !isAddressChange || addressChange.changedRecords != 1 || !addressChange.ip.Equal(ip) {
+		t.Fail()
+		t.Logf("applyToDomains should return an address change of one record but returned %#v", changed)
+	}
+
+	if _, isUnchanged := unchanged.(unchangedMessage); !isUnchanged || strings.Count(unchanged.Text(), "Unchanged") != 2 {
+		t.Fail()
+		t.Logf("applyToDomains should return an unchanged message for both domains but returned %#v", unchanged)
+	}
+}
+
+// applyToDomainsInParallel should process the domains at the same time and keep their order in the result.
+func Test_applyToDomainsInParallel_DomainsAreProcessedConcurrently(t *testing.T) {
+	// arrange
+	domains := []string{"example.com", "example.net", "example.org"}
+	started := make(chan bool, len(domains))
+	release := make(chan bool)
+
+	go func() {
+		for range domains {
+			<-started
+		}
+
+		close(release)
+	}()
+
+	// act
+	result, err := applyToDomainsInParallel(domains, len(domains), func(domain string) (message, error) {
+		// every domain waits until all domains were started
+		started <- true
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+			return nil, fmt.Errorf("The domains were not processed concurrently")
+		}
+
+		return changeMessage{"Updated: www." + domain, 1}, nil
+	})
+
+	// assert
+	if err != nil {
+		t.Fatalf("applyToDomainsInParallel returned an error: %s", err.Error())
+	}
+
+	expected := "example.com:\n  Updated: www.example.com\nexample.net:\n  Updated: www.example.net\nexample.org:\n  Updated: www.example.org"
+	if result.Text() != expected || getChangeSummary(result).Records != 3 {
+		t.Fail()
+		t.Logf("applyToDomainsInParallel returned %q instead of %q", result.Text(), expected)
+	}
+}
+
+// applyToDomainsInParallel should report a panic of one domain as its failure.
+func Test_applyToDomainsInParallel_DomainPanics_OtherDomainsAreProcessed(t *testing.T) {
+	// act
+	_, err := applyToDomainsInParallel([]string{"example.com", "example.net"}, 2, func(domain string) (message, error) {
+		if domain == "example.com" {
+			panic("unexpected response")
+		}
+
+		return changeMessage{"Updated: www." + domain, 1}, nil
+	})
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), "Failed: unexpected response") || !strings.Contains(err.Error(), "Updated: www.example.net") {
+		t.Fail()
+		t.Logf("The error should contain the panic and the successful change: %v", err)
+	}
+}
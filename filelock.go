@@ -0,0 +1,63 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"time"
+)
+
+// lockFile creates the given lock file, so that concurrent invocations of dee
+// (e.g. cron jobs and the daemon) do not change the same file at the same time.
+// It waits up to the given timeout for other invocations to remove the lock
+// file; lock files that are older than the timeout are left over by crashed
+// invocations and are removed. The returned function removes the lock file.
+func lockFile(fs afero.Fs, lockPath string, timeout time.Duration) (func(), error) {
+	start := time.Now()
+
+	for {
+		file, lockError := fs.OpenFile(lockPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if lockError == nil {
+			file.Close()
+			return func() { fs.Remove(lockPath) }, nil
+		}
+
+		// only an existing lock file is waited for
+		if !os.IsExist(lockError) {
+			return nil, fmt.Errorf("Cannot acquire the lock %q: %s", lockPath, lockError.Error())
+		}
+
+		// remove stale locks
+		if info, statError := fs.Stat(lockPath); statError == nil && time.Since(info.ModTime()) > timeout {
+			fs.Remove(lockPath)
+			continue
+		}
+
+		if time.Since(start) > timeout {
+			return nil, fmt.Errorf("Cannot acquire the lock %q: %s", lockPath, lockError.Error())
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeFileAtomic writes the given content to a temporary file next to the
+// given file and renames it into place, so that concurrent readers see
+// either the previous or the new content but never a partially written file.
+func writeFileAtomic(fs afero.Fs, filePath string, content []byte, perm os.FileMode) error {
+	temporaryPath := filePath + ".tmp"
+	if writeError := afero.WriteFile(fs, temporaryPath, content, perm); writeError != nil {
+		return writeError
+	}
+
+	if renameError := fs.Rename(temporaryPath, filePath); renameError != nil {
+		fs.Remove(temporaryPath)
+		return renameError
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/spf13/afero"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// getLockTestFs returns a filesystem in a temporary folder of the operating
+// system (the in-memory filesystem does not support exclusive creation) and
+// a function that removes the folder.
+func getLockTestFs(t *testing.T) (afero.Fs, func()) {
+	folder, folderError := ioutil.TempDir("", "dee-lock-test")
+	if folderError != nil {
+		t.Fatalf("Cannot create a temporary folder: %s", folderError.Error())
+	}
+
+	fs := afero.NewBasePathFs(afero.NewOsFs(), folder)
+	fs.MkdirAll("/home/user/.dee", 0700)
+
+	return fs, func() { os.RemoveAll(folder) }
+}
+
+// A lock that is held by another invocation should be acquired once it is released.
+func Test_lockFile_LockIsHeld_LockIsAcquiredAfterRelease(t *testing.T) {
+	// arrange
+	fs, cleanup := getLockTestFs(t)
+	defer cleanup()
+
+	unlock, _ := lockFile(fs, "/home/user/.dee/journal.json.lock", time.Minute)
+	start := time.Now()
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		unlock()
+	}()
+
+	// act
+	secondUnlock, err := lockFile(fs, "/home/user/.dee/journal.json.lock", time.Minute)
+
+	// assert
+	if err != nil || time.Since(start) < 100*time.Millisecond {
+		t.Fail()
+		t.Logf("lockFile should wait until the lock is released but returned %v after %s", err, time.Since(start))
+	}
+
+	if secondUnlock != nil {
+		secondUnlock()
+	}
+}
+
+// A lock file that cannot be created should be reported without waiting for the timeout.
+func Test_lockFile_LockCannotBeCreated_ErrorIsReturnedImmediately(t *testing.T) {
+	// arrange
+	fs := afero.NewReadOnlyFs(afero.NewMemMapFs())
+	start := time.Now()
+
+	// act
+	_, err := lockFile(fs, "/home/user/.dee/journal.json.lock", time.Minute)
+
+	// assert
+	if err == nil || time.Since(start) > time.Second {
+		t.Fail()
+		t.Logf("lockFile should return an error immediately but returned %v after %s", err, time.Since(start))
+	}
+}
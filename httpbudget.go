@@ -0,0 +1,157 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/afero"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// budgetLockTimeout is the maximum time to wait for the lock of the budget file.
+// Locks that are older are left over by crashed invocations and are removed.
+var budgetLockTimeout = 10 * time.Second
+
+// budgetState is the state of the request budget that is shared by all
+// invocations of dee on the same machine.
+type budgetState struct {
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+}
+
+// requestBudget is a token bucket that allows the given number of API requests
+// per hour. The bucket is stored in a file of the settings folder so that
+// concurrent invocations (e.g. cron jobs and the daemon) share one budget.
+type requestBudget struct {
+	fs              afero.Fs
+	filePath        string
+	requestsPerHour int
+	now             func() time.Time
+	sleep           func(duration time.Duration)
+}
+
+// Take removes a token from the bucket. If the bucket is empty it
+// waits until the next token is available or the given deadline has passed.
+func (budget requestBudget) Take(deadline time.Time) error {
+	for {
+		wait, takeError := budget.tryTake()
+		if takeError != nil {
+			return takeError
+		}
+
+		if wait == 0 {
+			return nil
+		}
+
+		if !deadline.IsZero() && budget.now().Add(wait).After(deadline) {
+			return fmt.Errorf("The API budget of %d requests per hour is exhausted (next request in %s)", budget.requestsPerHour, wait.Round(time.Second))
+		}
+
+		budget.sleep(wait)
+	}
+}
+
+// Limit lowers the tokens to the number of requests
+// that the API reports as remaining.
+func (budget requestBudget) Limit(remaining int) error {
+	return budget.update(func(state *budgetState) {
+		if float64(remaining) < state.Tokens {
+			state.Tokens = float64(remaining)
+		}
+	})
+}
+
+// tryTake removes a token from the bucket and returns 0 or, if the bucket
+// is empty, the time until the next token is available.
+func (budget requestBudget) tryTake() (time.Duration, error) {
+	var wait time.Duration
+	updateError := budget.update(func(state *budgetState) {
+		if state.Tokens >= 1 {
+			state.Tokens--
+			return
+		}
+
+		secondsPerToken := 3600 / float64(budget.requestsPerHour)
+		wait = time.Duration((1 - state.Tokens) * secondsPerToken * float64(time.Second))
+	})
+
+	return wait, updateError
+}
+
+// update refills the bucket, passes it to the given function and saves it.
+// The budget file is locked while it is updated.
+func (budget requestBudget) update(change func(state *budgetState)) error {
+	if budget.requestsPerHour < 1 {
+		return fmt.Errorf("The API budget must allow at least 1 request per hour")
+	}
+
+	unlock, lockError := lockFile(budget.fs, budget.filePath+".lock", budgetLockTimeout)
+	if lockError != nil {
+		return lockError
+	}
+
+	defer unlock()
+
+	now := budget.now()
+	state := budgetState{Tokens: float64(budget.requestsPerHour), Updated: now}
+	if content, readError := afero.ReadFile(budget.fs, budget.filePath); readError == nil {
+		if json.Unmarshal(content, &state) != nil {
+			state = budgetState{Tokens: float64(budget.requestsPerHour), Updated: now}
+		}
+	}
+
+	// refill
+	if elapsed := now.Sub(state.Updated); elapsed > 0 {
+		state.Tokens += elapsed.Hours() * float64(budget.requestsPerHour)
+	}
+
+	if state.Tokens > float64(budget.requestsPerHour) {
+		state.Tokens = float64(budget.requestsPerHour)
+	}
+
+	state.Updated = now
+	change(&state)
+
+	content, encodeError := json.Marshal(state)
+	if encodeError != nil {
+		return encodeError
+	}
+
+	if writeError := afero.WriteFile(budget.fs, budget.filePath, content, 0600); writeError != nil {
+		return fmt.Errorf("Cannot save the API budget: %s", writeError.Error())
+	}
+
+	return nil
+}
+
+// budgetTransport takes a token from the request budget before every request.
+// The X-RateLimit-Remaining header of the API lowers the budget, so that
+// requests of other machines with the same account are accounted for, too.
+type budgetTransport struct {
+	next   http.RoundTripper
+	budget requestBudget
+}
+
+// RoundTrip waits for the request budget and sends the given request.
+func (transport *budgetTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	deadline, _ := request.Context().Deadline()
+	if budgetError := transport.budget.Take(deadline); budgetError != nil {
+		return nil, budgetError
+	}
+
+	response, responseError := transport.next.RoundTrip(request)
+	if responseError != nil {
+		return nil, responseError
+	}
+
+	if remaining, parseError := strconv.Atoi(response.Header.Get("X-RateLimit-Remaining")); parseError == nil {
+		transport.budget.Limit(remaining)
+	}
+
+	return response, nil
+}
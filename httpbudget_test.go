@@ -0,0 +1,98 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/andreaskoch/dnsimple-cli/pkg/dnsimpletest"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// getTestBudgets returns two budgets (e.g. of two concurrent invocations) that share
+// the same budget file and a clock that advances when one of them sleeps.
+func getTestBudgets(fs afero.Fs, requestsPerHour int, waits *[]time.Duration) (requestBudget, requestBudget) {
+	clock := time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+	now := func() time.Time { return clock }
+	sleep := func(duration time.Duration) {
+		*waits = append(*waits, duration)
+		clock = clock.Add(duration)
+	}
+
+	first := requestBudget{fs, "/home/user/.dee/budget.json", requestsPerHour, now, sleep}
+	second := requestBudget{fs, "/home/user/.dee/budget.json", requestsPerHour, now, sleep}
+	return first, second
+}
+
+// Invocations that share the budget file should collectively respect the requests per hour.
+func Test_requestBudget_Take_BudgetIsShared(t *testing.T) {
+	// arrange
+	var waits []time.Duration
+	first, second := getTestBudgets(afero.NewMemMapFs(), 6, &waits)
+
+	// act
+	for _, budget := range []requestBudget{first, second, first, second, first, second, first} {
+		if err := budget.Take(time.Time{}); err != nil {
+			t.Fatalf("Take should succeed: %s", err.Error())
+		}
+	}
+
+	// assert
+	if len(waits) != 1 || waits[0] != 10*time.Minute {
+		t.Fail()
+		t.Logf("The seventh request should wait 10 minutes for the next token but the waits are %v", waits)
+	}
+}
+
+// Take should fail instead of waiting beyond the deadline of the request.
+func Test_requestBudget_Take_Exhausted_DeadlineIsRespected(t *testing.T) {
+	// arrange
+	var waits []time.Duration
+	budget, _ := getTestBudgets(afero.NewMemMapFs(), 1, &waits)
+	budget.Take(time.Time{})
+
+	// act
+	err := budget.Take(budget.now().Add(time.Minute))
+
+	// assert
+	if err == nil || len(waits) > 0 {
+		t.Fail()
+		t.Logf("Take should fail without waiting for an hour (waits: %v)", waits)
+	}
+}
+
+// The remaining requests that the API reports should lower the budget.
+func Test_budgetTransport_RateLimitHeader_BudgetIsLowered(t *testing.T) {
+	// arrange
+	server := dnsimpletest.NewServer("john@example.com", "secret")
+	defer server.Close()
+
+	server.AddDomain("example.com")
+	server.SetRateLimit(3, time.Hour)
+
+	fs := afero.NewMemMapFs()
+	var waits []time.Duration
+	budget, _ := getTestBudgets(fs, 100, &waits)
+
+	client, _ := dnsimple.NewClient("john@example.com", "secret")
+	client.URL = server.URL()
+	client.Http = &http.Client{Transport: &budgetTransport{http.DefaultTransport, budget}}
+
+	// act
+	_, err := client.GetRecords("example.com")
+
+	// assert
+	if err != nil {
+		t.Fatalf("The request should succeed: %s", err.Error())
+	}
+
+	content, _ := afero.ReadFile(fs, "/home/user/.dee/budget.json")
+	if string(content) != `{"tokens":2,"updated":"2016-03-04T10:00:00Z"}` {
+		t.Fail()
+		t.Logf("The budget should be lowered to the 2 remaining requests but is %s", content)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/afero"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+)
+
+// httpCacheEntry is a cached API response and its validators.
+type httpCacheEntry struct {
+	URL          string      `json:"url"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+}
+
+// cachingTransport caches the responses of GET requests (e.g. the zone
+// listings) that carry an ETag or Last-Modified validator. Repeated requests
+// are sent as conditional requests and a "304 Not Modified" response is
+// answered from the cache, so unchanged zones are not downloaded again.
+// The cache is stored in the given folder and shared by consecutive runs.
+type cachingTransport struct {
+	next   http.RoundTripper
+	fs     afero.Fs
+	folder string
+}
+
+// RoundTrip sends the given request and caches or revalidates its response.
+func (transport *cachingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Method != "GET" {
+		return transport.next.RoundTrip(request)
+	}
+
+	filePath := transport.getEntryPath(request)
+	entry, isCached := transport.read(filePath)
+
+	if isCached {
+		// the original request must not be modified
+		request = request.Clone(request.Context())
+		if entry.ETag != "" {
+			request.Header.Set("If-None-Match", entry.ETag)
+		}
+
+		if entry.LastModified != "" {
+			request.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	response, responseError := transport.next.RoundTrip(request)
+	if responseError != nil {
+		return nil, responseError
+	}
+
+	if isCached && response.StatusCode == http.StatusNotModified {
+		response.Body.Close()
+		return entry.toResponse(request), nil
+	}
+
+	etag, lastModified := response.Header.Get("ETag"), response.Header.Get("Last-Modified")
+	if response.StatusCode != http.StatusOK || (etag == "" && lastModified == "") {
+		return response, nil
+	}
+
+	body, readError := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if readError != nil {
+		return nil, readError
+	}
+
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// the cache is only an optimization, a failed write is ignored
+	transport.write(filePath, httpCacheEntry{request.URL.String(), response.StatusCode, response.Header, body, etag, lastModified})
+
+	return response, nil
+}
+
+// getEntryPath returns the path of the cache file of the given request.
+// The credentials are part of the key so that accounts do not share entries.
+func (transport *cachingTransport) getEntryPath(request *http.Request) string {
+	key := sha256.Sum256([]byte(request.URL.String() + "\n" + request.Header.Get("X-DNSimple-Token") + "\n" + request.Header.Get("Authorization")))
+	return filepath.Join(transport.folder, fmt.Sprintf("%x.json", key))
+}
+
+// read returns the cache entry of the given file.
+func (transport *cachingTransport) read(filePath string) (httpCacheEntry, bool) {
+	content, readError := afero.ReadFile(transport.fs, filePath)
+	if readError != nil {
+		return httpCacheEntry{}, false
+	}
+
+	var entry httpCacheEntry
+	if unmarshalError := json.Unmarshal(content, &entry); unmarshalError != nil {
+		return httpCacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+// write stores the given cache entry in the given file.
+func (transport *cachingTransport) write(filePath string, entry httpCacheEntry) error {
+	content, marshalError := json.Marshal(entry)
+	if marshalError != nil {
+		return marshalError
+	}
+
+	if folderError := transport.fs.MkdirAll(transport.folder, 0700); folderError != nil {
+		return folderError
+	}
+
+	return afero.WriteFile(transport.fs, filePath, content, 0600)
+}
+
+// toResponse returns the cached response for the given request.
+func (entry httpCacheEntry) toResponse(request *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.StatusCode, http.StatusText(entry.StatusCode)),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        entry.Header,
+		Body:          ioutil.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       request,
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/andreaskoch/dnsimple-cli/pkg/dnsimpletest"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Repeated listings of an unchanged zone should be answered from the cache.
+func Test_cachingTransport_UnchangedZone_RecordsAreServedFromTheCache(t *testing.T) {
+	// arrange
+	server := dnsimpletest.NewServer("john@example.com", "secret")
+	defer server.Close()
+
+	server.AddDomain("example.com")
+	server.AddRecord("example.com", dnsimple.Record{Name: "www", RecordType: "A", Content: "203.0.113.1"})
+
+	client, _ := dnsimple.NewClient("john@example.com", "secret")
+	client.URL = server.URL()
+	client.Http = &http.Client{Transport: &cachingTransport{http.DefaultTransport, afero.NewMemMapFs(), "/home/user/.dee/cache"}}
+
+	// act
+	first, firstError := client.GetRecords("example.com")
+	cached, cachedError := client.GetRecords("example.com")
+	server.AddRecord("example.com", dnsimple.Record{Name: "mail", RecordType: "A", Content: "203.0.113.2"})
+	changed, changedError := client.GetRecords("example.com")
+
+	// assert
+	if firstError != nil || cachedError != nil || changedError != nil {
+		t.Fatalf("The requests should succeed (%v, %v, %v)", firstError, cachedError, changedError)
+	}
+
+	if server.NotModified() != 1 {
+		t.Fail()
+		t.Logf("The second listing should have been revalidated with a conditional request (%d not modified responses)", server.NotModified())
+	}
+
+	if len(first) != 1 || len(cached) != 1 || cached[0].Content != "203.0.113.1" {
+		t.Fail()
+		t.Logf("The cached listing should contain the unchanged record but contains %#v", cached)
+	}
+
+	if len(changed) != 2 {
+		t.Fail()
+		t.Logf("The changed zone should be downloaded again but the listing contains %#v", changed)
+	}
+}
+
+// Every account should have its own cache entries.
+func Test_cachingTransport_OtherCredentials_CacheIsNotShared(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	transport := &cachingTransport{http.DefaultTransport, fs, "/cache"}
+
+	first, _ := http.NewRequest("GET", "https://api.dnsimple.com/v1/domains", nil)
+	first.Header.Set("X-DNSimple-Token", "john@example.com:secret")
+
+	second, _ := http.NewRequest("GET", "https://api.dnsimple.com/v1/domains", nil)
+	second.Header.Set("X-DNSimple-Token", "jane@example.com:secret")
+
+	// act
+	firstPath, secondPath := transport.getEntryPath(first), transport.getEntryPath(second)
+
+	// assert
+	if firstPath == secondPath {
+		t.Fail()
+		t.Logf("The requests of different accounts should not share the cache entry %q", firstPath)
+	}
+}
+
+// Responses without validators and the responses of other methods should not be cached.
+func Test_cachingTransport_NoValidators_ResponseIsNotCached(t *testing.T) {
+	// arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.Path == "/etag" {
+			w.Header().Set("ETag", `"1"`)
+		}
+
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	fs := afero.NewMemMapFs()
+	client := &http.Client{Transport: &cachingTransport{http.DefaultTransport, fs, "/cache"}}
+
+	// act
+	plain, _ := client.Get(server.URL + "/plain")
+	posted, _ := client.Post(server.URL+"/etag", "application/json", nil)
+	plain.Body.Close()
+	posted.Body.Close()
+
+	entries, _ := afero.ReadDir(fs, "/cache")
+
+	// assert
+	if len(entries) != 0 {
+		t.Fail()
+		t.Logf("No responses should have been cached but the cache contains %d entries", len(entries))
+	}
+}
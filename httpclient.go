@@ -0,0 +1,137 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/spf13/afero"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tlsVersions maps the supported values of the
+// -tls-min-version option to their TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// httpClientOptions contains the (command line) settings
+// of the HTTP client that is used for the DNSimple API.
+type httpClientOptions struct {
+	// caFile is a PEM file with additional trusted CA certificates.
+	caFile *string
+
+	// tlsMinVersion is the minimum TLS version (e.g. "1.2").
+	tlsMinVersion *string
+
+	// maxConnections is the maximum number of connections per host.
+	maxConnections *int
+
+	// disableKeepAlives closes the connections after every request.
+	disableKeepAlives *bool
+
+	// disableCache turns off the response cache.
+	disableCache *bool
+
+	// requestsPerHour is the API budget of all invocations (0: no limit).
+	requestsPerHour *int
+}
+
+// sharedHTTPClient creates the HTTP client on first use (after the command
+// line options have been parsed) and then returns the same client to all
+// callers, so that connections and TLS sessions are reused.
+// If a cache folder is given, the responses of the API are cached there.
+// If a budget file is given, the requests are limited to the requests
+// per hour of the options.
+type sharedHTTPClient struct {
+	fs          afero.Fs
+	options     httpClientOptions
+	cacheFolder string
+	budgetFile  string
+
+	once   sync.Once
+	client *http.Client
+	err    error
+}
+
+// Get returns the shared HTTP client.
+func (shared *sharedHTTPClient) Get() (*http.Client, error) {
+	shared.once.Do(func() {
+		shared.client, shared.err = newHTTPClient(shared.fs, *shared.options.caFile, *shared.options.tlsMinVersion, *shared.options.maxConnections, *shared.options.disableKeepAlives)
+		if shared.err != nil {
+			return
+		}
+
+		// cached responses are revalidated with the API, so they count against the budget, too
+		if shared.budgetFile != "" && shared.options.requestsPerHour != nil && *shared.options.requestsPerHour > 0 {
+			budget := requestBudget{shared.fs, shared.budgetFile, *shared.options.requestsPerHour, time.Now, time.Sleep}
+			shared.client.Transport = &budgetTransport{shared.client.Transport, budget}
+		}
+
+		if shared.cacheFolder == "" || *shared.options.disableCache {
+			return
+		}
+
+		shared.client.Transport = &cachingTransport{shared.client.Transport, shared.fs, shared.cacheFolder}
+	})
+
+	return shared.client, shared.err
+}
+
+// newHTTPClient creates an HTTP client with a connection pool of the given size
+// that trusts the system CAs and, if given, the CAs of the given PEM file.
+func newHTTPClient(fs afero.Fs, caFile, tlsMinVersion string, maxConnections int, disableKeepAlives bool) (*http.Client, error) {
+	minVersion, isSupported := tlsVersions[tlsMinVersion]
+	if !isSupported {
+		return nil, fmt.Errorf("Unsupported minimum TLS version %q (available: 1.2, 1.3)", tlsMinVersion)
+	}
+
+	if maxConnections < 1 {
+		return nil, fmt.Errorf("The maximum number of connections must be at least 1")
+	}
+
+	tlsConfig := &tls.Config{MinVersion: minVersion}
+
+	if caFile != "" {
+		pem, readError := afero.ReadFile(fs, caFile)
+		if readError != nil {
+			return nil, fmt.Errorf("Cannot read the CA file: %s", readError.Error())
+		}
+
+		pool, poolError := x509.SystemCertPool()
+		if poolError != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("The CA file %q contains no PEM certificates", caFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        maxConnections,
+		MaxIdleConnsPerHost: maxConnections,
+		MaxConnsPerHost:     maxConnections,
+		IdleConnTimeout:     90 * time.Second,
+		DisableKeepAlives:   disableKeepAlives,
+	}
+
+	return &http.Client{Transport: transport, Timeout: 60 * time.Second}, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/pem"
+	"github.com/spf13/afero"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newHTTPClient should return an error for invalid options.
+func Test_newHTTPClient_InvalidOptions_ErrorIsReturned(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/etc/dee/empty.pem", []byte("no certificate"), 0600)
+
+	inputs := []struct {
+		caFile         string
+		tlsMinVersion  string
+		maxConnections int
+	}{
+		{"", "1.0", 4},
+		{"", "", 4},
+		{"", "1.2", 0},
+		{"/etc/dee/missing.pem", "1.2", 4},
+		{"/etc/dee/empty.pem", "1.2", 4},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		_, err := newHTTPClient(fs, input.caFile, input.tlsMinVersion, input.maxConnections, false)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("newHTTPClient(%q, %q, %d) should return an error", input.caFile, input.tlsMinVersion, input.maxConnections)
+		}
+	}
+}
+
+// The HTTP client should trust the certificates of the given CA file.
+func Test_newHTTPClient_CAFile_CertificateIsTrusted(t *testing.T) {
+	// arrange
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/etc/dee/ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	defaultClient, _ := newHTTPClient(fs, "", "1.2", 4, false)
+	caClient, _ := newHTTPClient(fs, "/etc/dee/ca.pem", "1.2", 4, false)
+
+	// act
+	_, defaultError := defaultClient.Get(server.URL)
+	response, caError := caClient.Get(server.URL)
+
+	// assert
+	if defaultError == nil {
+		t.Fail()
+		t.Logf("The client without the CA file should not trust the test server")
+	}
+
+	if caError != nil {
+		t.Fail()
+		t.Logf("The client with the CA file should trust the test server: %s", caError.Error())
+	} else {
+		response.Body.Close()
+	}
+}
+
+// sharedHTTPClient.Get should always return the same client.
+func Test_sharedHTTPClient_Get_SameClientIsReturned(t *testing.T) {
+	// arrange
+	caFile, tlsMinVersion, maxConnections, disableKeepAlives, disableCache, requestsPerHour := "", "1.3", 2, false, false, 0
+	shared := &sharedHTTPClient{fs: afero.NewMemMapFs(), options: httpClientOptions{&caFile, &tlsMinVersion, &maxConnections, &disableKeepAlives, &disableCache, &requestsPerHour}}
+
+	// act
+	first, firstError := shared.Get()
+	second, _ := shared.Get()
+
+	// assert
+	if firstError != nil || first != second {
+		t.Fail()
+		t.Logf("sharedHTTPClient.Get() should return the same client (%v)", firstError)
+	}
+
+	if transport := first.Transport.(*http.Transport); transport.MaxConnsPerHost != 2 || transport.TLSClientConfig.MinVersion != tlsVersions["1.3"] {
+		t.Fail()
+		t.Logf("The client should use the given options")
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxCompletedRuns is the number of idempotency keys the state file keeps.
+const maxCompletedRuns = 500
+
+// runLockTimeout is the maximum time a run waits for a concurrent run with the
+// same idempotency key (e.g. a retried CI job) before it takes over its lock.
+var runLockTimeout = 15 * time.Minute
+
+// completedRun is a run of an action with an idempotency key
+// (e.g. the ID of a CI job) that completed successfully.
+type completedRun struct {
+	Key     string    `json:"key"`
+	Action  string    `json:"action"`
+	Hash    string    `json:"arguments_hash"`
+	Time    time.Time `json:"time"`
+	Records int       `json:"records"`
+}
+
+// runStore remembers the runs that completed with an idempotency key.
+type runStore interface {
+	// GetRun returns the completed run with the given key or nil if there is none.
+	GetRun(key string) (*completedRun, error)
+
+	// SaveRun records the given completed run.
+	SaveRun(run completedRun) error
+
+	// LockRun waits until no other invocation runs with the given key and
+	// returns a function that releases the key again.
+	LockRun(key string) (func(), error)
+}
+
+// GetRun returns the completed run with the given idempotency key from the state file.
+func (store filesystemMetadataStore) GetRun(key string) (*completedRun, error) {
+	state, readError := store.read()
+	if readError != nil {
+		return nil, readError
+	}
+
+	for _, run := range state.Runs {
+		if run.Key == key {
+			return &run, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// SaveRun records the given completed run in the state file.
+// Only the most recent runs are kept.
+func (store filesystemMetadataStore) SaveRun(run completedRun) error {
+	unlock, lockError := store.lock()
+	if lockError != nil {
+		return lockError
+	}
+
+	defer unlock()
+
+	state, readError := store.read()
+	if readError != nil {
+		return readError
+	}
+
+	runs := []completedRun{}
+	for _, existing := range state.Runs {
+		if existing.Key != run.Key {
+			runs = append(runs, existing)
+		}
+	}
+
+	runs = append(runs, run)
+	if len(runs) > maxCompletedRuns {
+		runs = runs[len(runs)-maxCompletedRuns:]
+	}
+
+	state.Runs = runs
+	return store.save(state)
+}
+
+// LockRun creates a lock file for the given idempotency key next to the state file.
+func (store filesystemMetadataStore) LockRun(key string) (func(), error) {
+	if store.fs == nil {
+		return nil, fmt.Errorf("No filesystem provided")
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	return lockFile(store.fs, fmt.Sprintf("%s.run-%s.lock", store.filePath, hex.EncodeToString(hash[:8])), runLockTimeout)
+}
+
+// executeIdempotent executes the given action unless a run with the given
+// idempotency key already completed. Re-using a key with other arguments is
+// an error. Without a key the action is always executed.
+func executeIdempotent(selectedAction action, arguments []string, key string, store runStore, now func() time.Time) (message, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return selectedAction.Execute(arguments)
+	}
+
+	if store == nil {
+		return nil, fmt.Errorf("No state store available for the idempotency key %q", key)
+	}
+
+	hash := getArgumentsHash(selectedAction.Name(), arguments)
+
+	// concurrent runs with the same key (e.g. two retries of a CI job) wait for each other
+	unlock, lockError := store.LockRun(key)
+	if lockError != nil {
+		return nil, lockError
+	}
+
+	defer unlock()
+
+	previous, readError := store.GetRun(key)
+	if readError != nil {
+		return nil, readError
+	}
+
+	if previous != nil {
+		if previous.Action != selectedAction.Name() || previous.Hash != hash {
+			return nil, fmt.Errorf("The idempotency key %q was already used for another %q command at %s", key, previous.Action, previous.Time.Format(time.RFC3339))
+		}
+
+		// the run succeeded before, so a retry must succeed, too
+		return successMessage{fmt.Sprintf("Skipped: the run with the idempotency key %q already completed at %s (%d records changed)", key, previous.Time.Format(time.RFC3339), previous.Records)}, nil
+	}
+
+	result, err := selectedAction.Execute(arguments)
+	if err != nil {
+		// failed runs are not recorded so that they can be retried
+		return nil, err
+	}
+
+	run := completedRun{key, selectedAction.Name(), hash, now(), getChangeSummary(result).Records}
+	if saveError := store.SaveRun(run); saveError != nil {
+		return nil, fmt.Errorf("%s\nCannot record the idempotency key %q: %s", result.Text(), key, saveError.Error())
+	}
+
+	return result, nil
+}
+
+// getArgumentsHash returns a hash of the given action name and arguments.
+func getArgumentsHash(actionName string, arguments []string) string {
+	hash := sha256.Sum256([]byte(actionName + "\x00" + strings.Join(arguments, "\x00")))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/afero"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingTestAction is an action that counts its executions
+// and fails as long as err is set.
+type countingTestAction struct {
+	executions *int
+	err        *error
+}
+
+func (action countingTestAction) Name() string        { return "record" }
+func (action countingTestAction) Description() string { return "" }
+func (action countingTestAction) Usage() string       { return "" }
+
+func (action countingTestAction) Execute(arguments []string) (message, error) {
+	*action.executions++
+	if *action.err != nil {
+		return nil, *action.err
+	}
+
+	return changeMessage{"Updated: 2 records", 2}, nil
+}
+
+func getIdempotencyTestTime() time.Time {
+	return time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+}
+
+// executeIdempotent should skip a second run with the same idempotency key.
+func Test_executeIdempotent_SameKey_SecondRunIsSkipped(t *testing.T) {
+	// arrange
+	executions := 0
+	var err error
+	action := countingTestAction{&executions, &err}
+	store := filesystemMetadataStore{afero.NewMemMapFs(), "/state.json"}
+	arguments := []string{"replace-content", "-from", "203.0.113.1", "-to", "198.51.100.1", "-apply"}
+
+	// act
+	first, firstError := executeIdempotent(action, arguments, "ci-job-42", store, getIdempotencyTestTime)
+	second, secondError := executeIdempotent(action, arguments, "ci-job-42", store, getIdempotencyTestTime)
+
+	// assert
+	if firstError != nil || secondError != nil {
+		t.Fatalf("executeIdempotent returned an error: %v, %v", firstError, secondError)
+	}
+
+	if executions != 1 {
+		t.Fail()
+		t.Logf("The action should have been executed once but was executed %d times", executions)
+	}
+
+	if getExitCode(first) != 0 || getExitCode(second) != 0 || !strings.HasPrefix(second.Text(), "Skipped") {
+		t.Fail()
+		t.Logf("The second run should be reported as skipped with the exit code 0: %q, %q", first.Text(), second.Text())
+	}
+}
+
+// Concurrent runs with the same idempotency key should execute the action only once.
+func Test_executeIdempotent_ConcurrentRuns_ActionIsExecutedOnce(t *testing.T) {
+	// arrange
+	executions := 0
+	var err error
+	action := countingTestAction{&executions, &err}
+	fs, cleanup := getLockTestFs(t)
+	defer cleanup()
+
+	store := filesystemMetadataStore{fs, "/state.json"}
+	arguments := []string{"replace-content", "-from", "203.0.113.1", "-to", "198.51.100.1", "-apply"}
+
+	// act
+	var wait sync.WaitGroup
+	errors := make([]error, 4)
+	for index := range errors {
+		wait.Add(1)
+		go func(index int) {
+			defer wait.Done()
+			_, errors[index] = executeIdempotent(action, arguments, "ci-job-42", store, getIdempotencyTestTime)
+		}(index)
+	}
+
+	wait.Wait()
+
+	// assert
+	for _, runError := range errors {
+		if runError != nil {
+			t.Fatalf("executeIdempotent returned an error: %s", runError.Error())
+		}
+	}
+
+	if executions != 1 {
+		t.Fail()
+		t.Logf("The action should have been executed once but was executed %d times", executions)
+	}
+}
+
+// executeIdempotent should execute the action again if the previous run with the key failed.
+func Test_executeIdempotent_PreviousRunFailed_ActionIsExecutedAgain(t *testing.T) {
+	// arrange
+	executions := 0
+	err := fmt.Errorf("API error")
+	action := countingTestAction{&executions, &err}
+	store := filesystemMetadataStore{afero.NewMemMapFs(), "/state.json"}
+
+	// act
+	executeIdempotent(action, []string{"-apply"}, "ci-job-42", store, getIdempotencyTestTime)
+	err = nil
+	_, retryError := executeIdempotent(action, []string{"-apply"}, "ci-job-42", store, getIdempotencyTestTime)
+
+	// assert
+	if retryError != nil || executions != 2 {
+		t.Fail()
+		t.Logf("The failed run should have been retried (executions: %d, error: %v)", executions, retryError)
+	}
+}
+
+// executeIdempotent should refuse to re-use a key with other arguments.
+func Test_executeIdempotent_SameKeyOtherArguments_ErrorIsReturned(t *testing.T) {
+	// arrange
+	executions := 0
+	var err error
+	action := countingTestAction{&executions, &err}
+	store := filesystemMetadataStore{afero.NewMemMapFs(), "/state.json"}
+
+	// act
+	executeIdempotent(action, []string{"-id", "1"}, "ci-job-42", store, getIdempotencyTestTime)
+	_, secondError := executeIdempotent(action, []string{"-id", "2"}, "ci-job-42", store, getIdempotencyTestTime)
+
+	// assert
+	if secondError == nil || executions != 1 {
+		t.Fail()
+		t.Logf("Re-using the key with other arguments should return an error (executions: %d)", executions)
+	}
+}
+
+// executeIdempotent should always execute the action without a key.
+func Test_executeIdempotent_NoKey_ActionIsAlwaysExecuted(t *testing.T) {
+	// arrange
+	executions := 0
+	var err error
+	action := countingTestAction{&executions, &err}
+
+	// act
+	executeIdempotent(action, nil, "", nil, getIdempotencyTestTime)
+	executeIdempotent(action, nil, "", nil, getIdempotencyTestTime)
+
+	// assert
+	if executions != 2 {
+		t.Fail()
+		t.Logf("The action should have been executed twice but was executed %d times", executions)
+	}
+}
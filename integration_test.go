@@ -0,0 +1,79 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/andreaskoch/dee-ns"
+	"github.com/andreaskoch/dnsimple-cli/pkg/dnsimpletest"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"testing"
+)
+
+// getIntegrationTestClientFactory returns a client factory for the given fake DNSimple server.
+func getIntegrationTestClientFactory(t *testing.T, server *dnsimpletest.Server) dnsimpleClientFactory {
+	credentialStore := filesystemCredentialStore{afero.NewMemMapFs(), "/home/user/.dee/credentials.json"}
+	if saveError := credentialStore.SaveCredentials(deens.APICredentials{Email: "john@example.com", Token: "secret"}); saveError != nil {
+		t.Fatalf("Cannot save the test credentials: %s", saveError.Error())
+	}
+
+	return dnsimpleClientFactory{credentialStore, nil, server.URL()}
+}
+
+// createorupdate should create and then update the address record through the DNSimple API.
+func Test_Integration_CreateOrUpdate_RecordIsCreatedAndUpdated(t *testing.T) {
+	// arrange
+	server := dnsimpletest.NewServer("john@example.com", "secret")
+	defer server.Close()
+
+	server.AddDomain("example.com")
+	server.AddRecord("example.com", dnsimple.Record{Name: "", RecordType: "A", Content: "203.0.113.9"})
+
+	clientFactory := getIntegrationTestClientFactory(t, server)
+	infoProviderFactory := dnsimpleInfoProviderFactory{clientFactory}
+	action := createOrUpdateAction{dnsEditorFactory{clientFactory, infoProviderFactory}, infoProviderFactory, nil, nil, nil}
+
+	// act
+	_, createError := action.Execute([]string{"-domain", "example.com", "-subdomain", "home", "-ip", "203.0.113.1"})
+	_, updateError := action.Execute([]string{"-domain", "example.com", "-subdomain", "home", "-ip", "203.0.113.2"})
+	unchanged, unchangedError := action.Execute([]string{"-domain", "example.com", "-subdomain", "home", "-ip", "203.0.113.2"})
+
+	// assert
+	if createError != nil || updateError != nil || unchangedError != nil {
+		t.Fatalf("createorupdate should succeed (%v, %v, %v)", createError, updateError, unchangedError)
+	}
+
+	if _, isUnchanged := unchanged.(unchangedMessage); !isUnchanged {
+		t.Fail()
+		t.Logf("The last createorupdate should not change anything but returned %q", unchanged.Text())
+	}
+
+	records := server.Records("example.com")
+	if len(records) != 2 || records[1].Name != "home" || records[1].Content != "203.0.113.2" || records[0].Content != "203.0.113.9" {
+		t.Fail()
+		t.Logf("Only the home record should point to 203.0.113.2 but the records are %#v", records)
+	}
+}
+
+// The actions should report authentication failures of the DNSimple API.
+func Test_Integration_InvalidCredentials_ErrorIsReturned(t *testing.T) {
+	// arrange
+	server := dnsimpletest.NewServer("john@example.com", "another-secret")
+	defer server.Close()
+
+	server.AddDomain("example.com")
+
+	clientFactory := getIntegrationTestClientFactory(t, server)
+	action := recordAction{clientFactory, nil, nil, nil}
+
+	// act
+	_, err := action.Execute([]string{"create", "-domain", "example.com", "-type", "TXT", "-content", "hello"})
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("recordAction.Execute should return an error for invalid credentials")
+	}
+}
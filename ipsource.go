@@ -0,0 +1,415 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/afero"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultIPServiceURL is the URL of the HTTP service that is
+// used by the "http" IP source if no URL is given.
+const defaultIPServiceURL = "https://api.ipify.org"
+
+// ipProvider determines the IP address that shall be
+// assigned to an address record.
+type ipProvider interface {
+	// GetIP returns the current IP address.
+	GetIP() (net.IP, error)
+}
+
+// ipProviderFactory creates an IP provider from the
+// parameter of an IP source (e.g. "eth0" in "interface:eth0").
+type ipProviderFactory func(parameter string) (ipProvider, error)
+
+// ipProviderRegistry maps the names of IP sources
+// (e.g. "http") to their provider factories.
+type ipProviderRegistry map[string]ipProviderFactory
+
+// newIPProviderRegistry creates a registry that contains all built-in IP sources.
+func newIPProviderRegistry(fs afero.Fs) ipProviderRegistry {
+	registry := ipProviderRegistry{
+		"http": func(parameter string) (ipProvider, error) {
+			return newHTTPIPProvider(parameter), nil
+		},
+		"interface": func(parameter string) (ipProvider, error) {
+			return newInterfaceIPProviderFromParameter(parameter)
+		},
+		"file": func(parameter string) (ipProvider, error) {
+			return newFileIPProvider(fs, parameter)
+		},
+		"command": func(parameter string) (ipProvider, error) {
+			return newCommandIPProvider(parameter)
+		},
+		"consensus": func(parameter string) (ipProvider, error) {
+			return newConsensusIPProvider(parameter)
+		},
+		"natpmp": func(parameter string) (ipProvider, error) {
+			return newNATPMPIPProvider(fs, parameter)
+		},
+		"upnp": func(parameter string) (ipProvider, error) {
+			return newUPnPIPProvider(parameter), nil
+		},
+	}
+
+	for name, service := range cloudMetadataServices {
+		service := service
+		registry.Register(name, func(parameter string) (ipProvider, error) {
+			return newCloudMetadataIPProvider(service, parameter), nil
+		})
+	}
+
+	return registry
+}
+
+// Register adds the given IP source to the registry.
+func (registry ipProviderRegistry) Register(name string, factory ipProviderFactory) {
+	registry[name] = factory
+}
+
+// Names returns the sorted names of all registered IP sources.
+func (registry ipProviderRegistry) Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// GetProvider returns the IP provider for the given IP source. The source
+// consists of the name and an optional parameter (e.g. "interface:eth0").
+func (registry ipProviderRegistry) GetProvider(source string) (ipProvider, error) {
+	nameAndParameter := strings.SplitN(source, ":", 2)
+	name := strings.ToLower(strings.TrimSpace(nameAndParameter[0]))
+
+	parameter := ""
+	if len(nameAndParameter) == 2 {
+		parameter = strings.TrimSpace(nameAndParameter[1])
+	}
+
+	factory, exists := registry[name]
+	if !exists {
+		return nil, fmt.Errorf("Unknown IP source %q (available: %s)", name, strings.Join(registry.Names(), ", "))
+	}
+
+	return factory(parameter)
+}
+
+// getIPAddress returns the IP address from the given argument. If no IP address
+// was given, the IP is taken from the given IP source or, if no IP source was
+// given either, from stdin.
+func getIPAddress(ipArgument, ipSource string, registry ipProviderRegistry, stdin *os.File) (net.IP, error) {
+
+	// take ip from the ip source
+	if ipArgument == "" && ipSource != "" {
+		if registry == nil {
+			return nil, fmt.Errorf("No IP sources available")
+		}
+
+		provider, providerError := registry.GetProvider(ipSource)
+		if providerError != nil {
+			return nil, providerError
+		}
+
+		ip, ipError := provider.GetIP()
+		if ipError != nil {
+			return nil, fmt.Errorf("Unable to determine the IP address from %q: %s", ipSource, ipError.Error())
+		}
+
+		return ip, nil
+	}
+
+	// take ip from stdin
+	if ipArgument == "" && stdinHasData(stdin) {
+		fmt.Fscanf(stdin, "%s", &ipArgument)
+	}
+
+	if ipArgument == "" {
+		return nil, fmt.Errorf("No IP address supplied")
+	}
+
+	ip := net.ParseIP(ipArgument)
+	if ip == nil {
+		return nil, fmt.Errorf("Cannot parse IP %q", ipArgument)
+	}
+
+	return ip, nil
+}
+
+// getInterfaceIPSource returns the IP source for the given network interface
+// and options (e.g. "interface:eth0,prefer-ipv6,global-only"). If a record
+// type is given only addresses of the matching family are used (e.g.
+// "interface:eth0,ipv4-only" for "A"). If no interface name is given the
+// given IP source is returned unchanged.
+func getInterfaceIPSource(ipSource, interfaceName, recordType string, preferIPv6, globalOnly bool) (string, error) {
+	if interfaceName == "" {
+		if preferIPv6 || globalOnly {
+			return "", fmt.Errorf("-prefer-ipv6 and -global-only can only be used with -ip-from-interface")
+		}
+
+		return ipSource, nil
+	}
+
+	if ipSource != "" {
+		return "", fmt.Errorf("-ip-from-interface cannot be combined with -ip-source")
+	}
+
+	options := []string{interfaceName}
+	switch strings.ToUpper(recordType) {
+	case "A":
+		if preferIPv6 {
+			return "", fmt.Errorf("-prefer-ipv6 cannot be combined with -type A")
+		}
+
+		options = append(options, interfaceOptionIPv4Only)
+
+	case "AAAA":
+		options = append(options, interfaceOptionIPv6Only)
+
+	default:
+		if preferIPv6 {
+			options = append(options, interfaceOptionPreferIPv6)
+		}
+	}
+
+	if globalOnly {
+		options = append(options, interfaceOptionGlobalOnly)
+	}
+
+	return "interface:" + strings.Join(options, ","), nil
+}
+
+// parseIPFromText returns the first IP address in the given text.
+func parseIPFromText(text string) (net.IP, error) {
+	for _, field := range strings.Fields(text) {
+		if ip := net.ParseIP(field); ip != nil {
+			return ip, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No IP address found in %q", strings.TrimSpace(text))
+}
+
+// newHTTPIPProvider creates an IP provider that requests
+// the IP address from the given "what is my IP" service.
+func newHTTPIPProvider(url string) httpIPProvider {
+	if url == "" {
+		url = defaultIPServiceURL
+	}
+
+	return httpIPProvider{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// httpIPProvider returns the IP address reported by a HTTP service
+// that responds with the IP address of the requesting client.
+type httpIPProvider struct {
+	url    string
+	client *http.Client
+}
+
+// GetIP returns the IP address from the response of the HTTP service.
+func (provider httpIPProvider) GetIP() (net.IP, error) {
+	response, requestError := provider.client.Get(provider.url)
+	if requestError != nil {
+		return nil, requestError
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %s", provider.url, response.Status)
+	}
+
+	body, readError := ioutil.ReadAll(response.Body)
+	if readError != nil {
+		return nil, readError
+	}
+
+	return parseIPFromText(string(body))
+}
+
+const (
+	// interfaceOptionPreferIPv6 selects an IPv6 address of the
+	// network interface if it has one.
+	interfaceOptionPreferIPv6 = "prefer-ipv6"
+
+	// interfaceOptionGlobalOnly excludes private addresses
+	// (e.g. 192.168.0.0/16, fd00::/8).
+	interfaceOptionGlobalOnly = "global-only"
+
+	// interfaceOptionIPv4Only and interfaceOptionIPv6Only only select
+	// addresses of the given family (e.g. for A or AAAA records).
+	interfaceOptionIPv4Only = "ipv4-only"
+	interfaceOptionIPv6Only = "ipv6-only"
+)
+
+// newInterfaceIPProviderFromParameter creates an interface IP provider from
+// the given IP source parameter (e.g. "eth0,prefer-ipv6,global-only").
+func newInterfaceIPProviderFromParameter(parameter string) (interfaceIPProvider, error) {
+	options := strings.Split(parameter, ",")
+
+	preferIPv6 := false
+	globalOnly := false
+	ipVersion := 0
+	for _, option := range options[1:] {
+		switch strings.TrimSpace(option) {
+		case interfaceOptionPreferIPv6:
+			preferIPv6 = true
+		case interfaceOptionGlobalOnly:
+			globalOnly = true
+		case interfaceOptionIPv4Only:
+			ipVersion = 4
+		case interfaceOptionIPv6Only:
+			ipVersion = 6
+		default:
+			return interfaceIPProvider{}, fmt.Errorf("Unknown network interface option: %q", option)
+		}
+	}
+
+	return newInterfaceIPProvider(strings.TrimSpace(options[0]), preferIPv6, globalOnly, ipVersion)
+}
+
+// newInterfaceIPProvider creates an IP provider that returns the address of
+// the network interface with the given name. An IP version of 4 or 6 only
+// selects addresses of that family.
+func newInterfaceIPProvider(interfaceName string, preferIPv6, globalOnly bool, ipVersion int) (interfaceIPProvider, error) {
+	if interfaceName == "" {
+		return interfaceIPProvider{}, fmt.Errorf("No network interface name supplied (e.g. interface:eth0)")
+	}
+
+	return interfaceIPProvider{interfaceName, preferIPv6, globalOnly, ipVersion, getInterfaceAddresses}, nil
+}
+
+// interfaceIPProvider returns the IP address of a local network interface.
+type interfaceIPProvider struct {
+	interfaceName string
+	preferIPv6    bool
+	globalOnly    bool
+	ipVersion     int
+	getAddresses  func(interfaceName string) ([]net.Addr, error)
+}
+
+// GetIP returns the first unicast address of the network interface that
+// is neither a loopback nor a link-local address. If IPv6 is preferred an
+// IPv6 address is returned if available. If only global addresses are
+// allowed, private addresses are skipped. If an IP version is set,
+// addresses of the other family are skipped.
+func (provider interfaceIPProvider) GetIP() (net.IP, error) {
+	addresses, addressError := provider.getAddresses(provider.interfaceName)
+	if addressError != nil {
+		return nil, addressError
+	}
+
+	var candidates []net.IP
+	for _, address := range addresses {
+		ipNet, isIPNet := address.(*net.IPNet)
+		if !isIPNet || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+
+		if provider.globalOnly && ipNet.IP.IsPrivate() {
+			continue
+		}
+
+		isIPv4 := ipNet.IP.To4() != nil
+		if (provider.ipVersion == 4 && !isIPv4) || (provider.ipVersion == 6 && isIPv4) {
+			continue
+		}
+
+		candidates = append(candidates, ipNet.IP)
+	}
+
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("The network interface %q has no suitable address", provider.interfaceName)
+	}
+
+	if provider.preferIPv6 {
+		for _, candidate := range candidates {
+			if candidate.To4() == nil {
+				return candidate, nil
+			}
+		}
+	}
+
+	return candidates[0], nil
+}
+
+// getInterfaceAddresses returns the addresses of the network interface with the given name.
+func getInterfaceAddresses(interfaceName string) ([]net.Addr, error) {
+	networkInterface, interfaceError := net.InterfaceByName(interfaceName)
+	if interfaceError != nil {
+		return nil, interfaceError
+	}
+
+	return networkInterface.Addrs()
+}
+
+// newFileIPProvider creates an IP provider that reads the IP address from the given file.
+func newFileIPProvider(fs afero.Fs, filePath string) (fileIPProvider, error) {
+	if filePath == "" {
+		return fileIPProvider{}, fmt.Errorf("No file path supplied (e.g. file:/var/run/wan-ip)")
+	}
+
+	if fs == nil {
+		return fileIPProvider{}, fmt.Errorf("No filesystem provided")
+	}
+
+	return fileIPProvider{fs, filePath}, nil
+}
+
+// fileIPProvider returns the IP address stored in a file.
+type fileIPProvider struct {
+	fs       afero.Fs
+	filePath string
+}
+
+// GetIP returns the first IP address in the file.
+func (provider fileIPProvider) GetIP() (net.IP, error) {
+	content, readError := afero.ReadFile(provider.fs, provider.filePath)
+	if readError != nil {
+		return nil, readError
+	}
+
+	return parseIPFromText(string(content))
+}
+
+// newCommandIPProvider creates an IP provider that runs the given
+// command line (e.g. "ip-helper --wan") and parses its output.
+func newCommandIPProvider(commandLine string) (commandIPProvider, error) {
+	arguments := strings.Fields(commandLine)
+	if len(arguments) == 0 {
+		return commandIPProvider{}, fmt.Errorf("No command supplied (e.g. command:ip-helper --wan)")
+	}
+
+	return commandIPProvider{arguments}, nil
+}
+
+// commandIPProvider returns the IP address printed by a command.
+type commandIPProvider struct {
+	arguments []string
+}
+
+// GetIP runs the command and returns the first IP address of its output.
+func (provider commandIPProvider) GetIP() (net.IP, error) {
+	output, commandError := exec.Command(provider.arguments[0], provider.arguments[1:]...).Output()
+	if commandError != nil {
+		return nil, fmt.Errorf("%q failed: %s", strings.Join(provider.arguments, " "), commandError.Error())
+	}
+
+	return parseIPFromText(string(output))
+}
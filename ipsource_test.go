@@ -0,0 +1,333 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/afero"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testIPProvider is an IP provider used for testing.
+type testIPProvider struct {
+	ip  net.IP
+	err error
+}
+
+func (provider testIPProvider) GetIP() (net.IP, error) {
+	return provider.ip, provider.err
+}
+
+// getTestIPProviderRegistry returns a registry with a single IP source
+// named "test" that returns the given IP address.
+func getTestIPProviderRegistry(ip string) ipProviderRegistry {
+	registry := ipProviderRegistry{}
+	registry.Register("test", func(parameter string) (ipProvider, error) {
+		return testIPProvider{net.ParseIP(ip), nil}, nil
+	})
+
+	return registry
+}
+
+// An unknown IP source should result in an error.
+func Test_ipProviderRegistry_GetProvider_UnknownSource_ErrorIsReturned(t *testing.T) {
+	// arrange
+	registry := newIPProviderRegistry(afero.NewMemMapFs())
+
+	// act
+	_, err := registry.GetProvider("carrier-pigeon:home")
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("GetProvider should return an error for an unknown IP source")
+	}
+}
+
+// Registered IP sources should receive the parameter of the IP source.
+func Test_ipProviderRegistry_Register_ParameterIsPassedToFactory(t *testing.T) {
+	// arrange
+	registry := ipProviderRegistry{}
+
+	parameter := ""
+	registry.Register("custom", func(p string) (ipProvider, error) {
+		parameter = p
+		return testIPProvider{}, nil
+	})
+
+	// act
+	_, err := registry.GetProvider("Custom: a:b ")
+
+	// assert
+	if err != nil || parameter != "a:b" {
+		t.Fail()
+		t.Logf("GetProvider(%q) should pass %q to the factory but passed %q (error: %v)", "Custom: a:b ", "a:b", parameter, err)
+	}
+}
+
+// The IP argument takes precedence over the IP source.
+func Test_getIPAddress_IPArgumentAndSourceGiven_IPArgumentIsUsed(t *testing.T) {
+	// arrange
+	registry := getTestIPProviderRegistry("10.0.0.1")
+
+	// act
+	ip, err := getIPAddress("127.0.0.1", "test", registry, nil)
+
+	// assert
+	if err != nil || ip.String() != "127.0.0.1" {
+		t.Fail()
+		t.Logf("getIPAddress should return the IP argument but returned %s (error: %v)", ip, err)
+	}
+}
+
+// The IP is taken from the IP source if no IP argument is given.
+func Test_getIPAddress_OnlySourceGiven_IPFromSourceIsUsed(t *testing.T) {
+	// arrange
+	registry := getTestIPProviderRegistry("2001:db8::1")
+
+	// act
+	ip, err := getIPAddress("", "test", registry, nil)
+
+	// assert
+	if err != nil || ip.String() != "2001:db8::1" {
+		t.Fail()
+		t.Logf("getIPAddress should return the IP from the IP source but returned %s (error: %v)", ip, err)
+	}
+}
+
+// Errors of the IP source are returned.
+func Test_getIPAddress_SourceFails_ErrorIsReturned(t *testing.T) {
+	// arrange
+	registry := ipProviderRegistry{}
+	registry.Register("broken", func(parameter string) (ipProvider, error) {
+		return testIPProvider{nil, fmt.Errorf("timeout")}, nil
+	})
+
+	// act
+	_, err := getIPAddress("", "broken", registry, nil)
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("getIPAddress should return an error if the IP source fails")
+	}
+}
+
+// The http IP source should parse the IP address from the response body.
+func Test_httpIPProvider_GetIP_IPFromResponseIsReturned(t *testing.T) {
+	// arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "203.0.113.7\n")
+	}))
+	defer server.Close()
+
+	provider := newHTTPIPProvider(server.URL)
+
+	// act
+	ip, err := provider.GetIP()
+
+	// assert
+	if err != nil || ip.String() != "203.0.113.7" {
+		t.Fail()
+		t.Logf("httpIPProvider.GetIP() should return 203.0.113.7 but returned %s (error: %v)", ip, err)
+	}
+}
+
+// The http IP source should return an error if the service does not respond with 200.
+func Test_httpIPProvider_GetIP_ServiceFails_ErrorIsReturned(t *testing.T) {
+	// arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "203.0.113.7", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	provider := newHTTPIPProvider(server.URL)
+
+	// act
+	_, err := provider.GetIP()
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("httpIPProvider.GetIP() should return an error if the service responds with an error")
+	}
+}
+
+// The interface IP source should skip link-local and loopback addresses.
+func Test_interfaceIPProvider_GetIP_FirstGlobalUnicastAddressIsReturned(t *testing.T) {
+	// arrange
+	provider := interfaceIPProvider{"eth0", false, false, 0, func(interfaceName string) ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+			&net.IPNet{IP: net.ParseIP("192.168.1.20"), Mask: net.CIDRMask(24, 32)},
+		}, nil
+	}}
+
+	// act
+	ip, err := provider.GetIP()
+
+	// assert
+	if err != nil || ip.String() != "192.168.1.20" {
+		t.Fail()
+		t.Logf("interfaceIPProvider.GetIP() should return 192.168.1.20 but returned %s (error: %v)", ip, err)
+	}
+}
+
+// getTestInterfaceAddresses returns a private and a public IPv4 and IPv6 address
+// (the private IPv6 address is listed first).
+func getTestInterfaceAddresses(interfaceName string) ([]net.Addr, error) {
+	return []net.Addr{
+		&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.ParseIP("fd00::10"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.ParseIP("192.168.1.20"), Mask: net.CIDRMask(24, 32)},
+		&net.IPNet{IP: net.ParseIP("fd00::20"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.ParseIP("203.0.113.20"), Mask: net.CIDRMask(24, 32)},
+		&net.IPNet{IP: net.ParseIP("2001:db8::20"), Mask: net.CIDRMask(64, 128)},
+	}, nil
+}
+
+// The interface options should select the matching address.
+func Test_interfaceIPProvider_GetIP_OptionsGiven_MatchingAddressIsReturned(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		preferIPv6 bool
+		globalOnly bool
+		ipVersion  int
+		expected   string
+	}{
+		{false, false, 0, "fd00::10"},
+		{true, false, 0, "fd00::10"},
+		{false, true, 0, "203.0.113.20"},
+		{true, true, 0, "2001:db8::20"},
+		{false, false, 4, "192.168.1.20"},
+		{false, true, 4, "203.0.113.20"},
+		{false, false, 6, "fd00::10"},
+		{false, true, 6, "2001:db8::20"},
+	}
+
+	for _, input := range inputs {
+		provider := interfaceIPProvider{"eth0", input.preferIPv6, input.globalOnly, input.ipVersion, getTestInterfaceAddresses}
+
+		// act
+		ip, err := provider.GetIP()
+
+		// assert
+		if err != nil || ip.String() != input.expected {
+			t.Fail()
+			t.Logf("interfaceIPProvider.GetIP() with prefer-ipv6=%t, global-only=%t and IP version %d should return %s but returned %s (error: %v)", input.preferIPv6, input.globalOnly, input.ipVersion, input.expected, ip, err)
+		}
+	}
+}
+
+// The interface IP source should return an error if only private addresses are available.
+func Test_interfaceIPProvider_GetIP_GlobalOnlyWithoutGlobalAddress_ErrorIsReturned(t *testing.T) {
+	// arrange
+	provider := interfaceIPProvider{"eth0", false, true, 0, func(interfaceName string) ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(8, 32)},
+		}, nil
+	}}
+
+	// act
+	_, err := provider.GetIP()
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("interfaceIPProvider.GetIP() should return an error if the interface has no global address")
+	}
+}
+
+// The options of the interface IP source should be parsed from the parameter.
+func Test_newInterfaceIPProviderFromParameter_OptionsAreParsed(t *testing.T) {
+	// act
+	provider, err := newInterfaceIPProviderFromParameter("eth0,prefer-ipv6, global-only,ipv6-only")
+
+	// assert
+	if err != nil || provider.interfaceName != "eth0" || !provider.preferIPv6 || !provider.globalOnly || provider.ipVersion != 6 {
+		t.Fail()
+		t.Logf("newInterfaceIPProviderFromParameter should parse the interface name and options but returned %+v (error: %v)", provider, err)
+	}
+
+	if _, unknownOptionError := newInterfaceIPProviderFromParameter("eth0,fastest"); unknownOptionError == nil {
+		t.Fail()
+		t.Logf("newInterfaceIPProviderFromParameter should return an error for unknown options")
+	}
+}
+
+func Test_getInterfaceIPSource(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		ipSource      string
+		interfaceName string
+		recordType    string
+		preferIPv6    bool
+		globalOnly    bool
+		expected      string
+		expectError   bool
+	}{
+		{"http", "", "", false, false, "http", false},
+		{"http", "", "A", false, false, "http", false},
+		{"", "eth0", "", false, false, "interface:eth0", false},
+		{"", "eth0", "", true, true, "interface:eth0,prefer-ipv6,global-only", false},
+		{"", "eth0", "a", false, true, "interface:eth0,ipv4-only,global-only", false},
+		{"", "eth0", "AAAA", true, false, "interface:eth0,ipv6-only", false},
+		{"", "eth0", "A", true, false, "", true},
+		{"http", "eth0", "", false, false, "", true},
+		{"", "", "", true, false, "", true},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		result, err := getInterfaceIPSource(input.ipSource, input.interfaceName, input.recordType, input.preferIPv6, input.globalOnly)
+
+		// assert
+		if result != input.expected || (err != nil) != input.expectError {
+			t.Fail()
+			t.Logf("getInterfaceIPSource(%q, %q, %q, %t, %t) should return %q (error expected: %t) but returned %q (error: %v)", input.ipSource, input.interfaceName, input.recordType, input.preferIPv6, input.globalOnly, input.expected, input.expectError, result, err)
+		}
+	}
+}
+
+// The file IP source should return the IP address stored in the file.
+func Test_fileIPProvider_GetIP_IPFromFileIsReturned(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/var/run/wan-ip", []byte("  198.51.100.2\n"), 0644)
+
+	provider, _ := newFileIPProvider(fs, "/var/run/wan-ip")
+
+	// act
+	ip, err := provider.GetIP()
+
+	// assert
+	if err != nil || ip.String() != "198.51.100.2" {
+		t.Fail()
+		t.Logf("fileIPProvider.GetIP() should return 198.51.100.2 but returned %s (error: %v)", ip, err)
+	}
+}
+
+// IP sources that require a parameter should return an error without one.
+func Test_newIPProviderRegistry_MissingParameter_ErrorIsReturned(t *testing.T) {
+	// arrange
+	registry := newIPProviderRegistry(afero.NewMemMapFs())
+
+	for _, source := range []string{"interface", "file:", "command"} {
+
+		// act
+		_, err := registry.GetProvider(source)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("GetProvider(%q) should return an error", source)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cloudMetadataService describes how the public IP address
+// of a virtual machine is read from the instance metadata
+// endpoint of a cloud provider.
+type cloudMetadataService struct {
+	// baseURL is the default address of the metadata endpoint.
+	baseURL string
+
+	// path is the path of the public IP address.
+	path string
+
+	// header contains the headers required by the metadata endpoint.
+	header map[string]string
+
+	// tokenPath is the path a session token must be requested
+	// from before querying the metadata (AWS IMDSv2).
+	tokenPath string
+}
+
+// cloudMetadataServices contains the metadata services
+// of the supported cloud providers by IP source name.
+var cloudMetadataServices = map[string]cloudMetadataService{
+	"aws": {
+		baseURL:   "http://169.254.169.254",
+		path:      "/latest/meta-data/public-ipv4",
+		tokenPath: "/latest/api/token",
+	},
+	"gcp": {
+		baseURL: "http://metadata.google.internal",
+		path:    "/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip",
+		header:  map[string]string{"Metadata-Flavor": "Google"},
+	},
+	"azure": {
+		baseURL: "http://169.254.169.254",
+		path:    "/metadata/instance/network/interface/0/ipv4/ipAddress/0/publicIpAddress?api-version=2021-02-01&format=text",
+		header:  map[string]string{"Metadata": "true"},
+	},
+}
+
+// newCloudMetadataIPProvider creates an IP provider that reads the public IP
+// address from the given metadata service. The base URL of the metadata
+// endpoint can be overridden (e.g. "aws:http://127.0.0.1:1338").
+func newCloudMetadataIPProvider(service cloudMetadataService, baseURL string) cloudMetadataIPProvider {
+	if baseURL == "" {
+		baseURL = service.baseURL
+	}
+
+	return cloudMetadataIPProvider{
+		service: service,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// cloudMetadataIPProvider returns the public IP address
+// of a virtual machine from its instance metadata.
+type cloudMetadataIPProvider struct {
+	service cloudMetadataService
+	baseURL string
+	client  *http.Client
+}
+
+// GetIP requests the public IP address from the metadata endpoint.
+func (provider cloudMetadataIPProvider) GetIP() (net.IP, error) {
+	request, requestError := http.NewRequest("GET", provider.baseURL+provider.service.path, nil)
+	if requestError != nil {
+		return nil, requestError
+	}
+
+	for name, value := range provider.service.header {
+		request.Header.Set(name, value)
+	}
+
+	if provider.service.tokenPath != "" {
+		token, tokenError := provider.getToken()
+		if tokenError != nil {
+			return nil, tokenError
+		}
+
+		request.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+
+	body, responseError := provider.do(request)
+	if responseError != nil {
+		return nil, responseError
+	}
+
+	return parseIPFromText(body)
+}
+
+// getToken requests a session token for the metadata endpoint.
+func (provider cloudMetadataIPProvider) getToken() (string, error) {
+	request, requestError := http.NewRequest("PUT", provider.baseURL+provider.service.tokenPath, nil)
+	if requestError != nil {
+		return "", requestError
+	}
+
+	request.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+
+	token, responseError := provider.do(request)
+	if responseError != nil {
+		return "", fmt.Errorf("Unable to get a metadata token: %s", responseError.Error())
+	}
+
+	return strings.TrimSpace(token), nil
+}
+
+// do executes the given request and returns the response body.
+func (provider cloudMetadataIPProvider) do(request *http.Request) (string, error) {
+	response, responseError := provider.client.Do(request)
+	if responseError != nil {
+		return "", responseError
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s responded with %s", request.URL.Path, response.Status)
+	}
+
+	body, readError := ioutil.ReadAll(response.Body)
+	if readError != nil {
+		return "", readError
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/afero"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// The cloud IP sources should be available in the registry.
+func Test_newIPProviderRegistry_CloudSourcesAreRegistered(t *testing.T) {
+	// arrange
+	registry := newIPProviderRegistry(afero.NewMemMapFs())
+
+	for _, source := range []string{"aws", "gcp", "azure"} {
+
+		// act
+		_, err := registry.GetProvider(source)
+
+		// assert
+		if err != nil {
+			t.Fail()
+			t.Logf("GetProvider(%q) should not return an error: %s", source, err.Error())
+		}
+	}
+}
+
+// The aws IP source should request a session token before reading the public IP.
+func Test_cloudMetadataIPProvider_GetIP_AWS_TokenIsUsed(t *testing.T) {
+	// arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/latest/api/token":
+			fmt.Fprintf(w, "session-token")
+
+		case r.URL.Path == "/latest/meta-data/public-ipv4" && r.Header.Get("X-aws-ec2-metadata-token") == "session-token":
+			fmt.Fprintf(w, "54.93.1.2")
+
+		default:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	provider := newCloudMetadataIPProvider(cloudMetadataServices["aws"], server.URL)
+
+	// act
+	ip, err := provider.GetIP()
+
+	// assert
+	if err != nil || ip.String() != "54.93.1.2" {
+		t.Fail()
+		t.Logf("cloudMetadataIPProvider.GetIP() should return 54.93.1.2 but returned %s (error: %v)", ip, err)
+	}
+}
+
+// The gcp and azure IP sources should send the required metadata headers.
+func Test_cloudMetadataIPProvider_GetIP_RequiredHeadersAreSent(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		source string
+		header string
+		value  string
+	}{
+		{"gcp", "Metadata-Flavor", "Google"},
+		{"azure", "Metadata", "true"},
+	}
+
+	for _, input := range inputs {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(input.header) != input.value {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+
+			fmt.Fprintf(w, "35.190.0.1\n")
+		}))
+
+		provider := newCloudMetadataIPProvider(cloudMetadataServices[input.source], server.URL+"/")
+
+		// act
+		ip, err := provider.GetIP()
+		server.Close()
+
+		// assert
+		if err != nil || ip.String() != "35.190.0.1" {
+			t.Fail()
+			t.Logf("cloudMetadataIPProvider.GetIP() for %q should return 35.190.0.1 but returned %s (error: %v)", input.source, ip, err)
+		}
+	}
+}
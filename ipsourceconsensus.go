@@ -0,0 +1,117 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	// consensusModeMajority requires more than half of the
+	// IP services to report the same address.
+	consensusModeMajority = "majority"
+
+	// consensusModeAll requires all IP services to
+	// report the same address.
+	consensusModeAll = "all"
+)
+
+// defaultConsensusIPServiceURLs are the HTTP services that are
+// queried by the "consensus" IP source if no URLs are given. Like
+// the default "http" source they only return IPv4 addresses, so
+// the services of a dual-stack host agree on the same address.
+var defaultConsensusIPServiceURLs = []string{
+	defaultIPServiceURL,
+	"https://ipv4.icanhazip.com",
+	"https://ipv4.wtfismyip.com/text",
+}
+
+// newConsensusIPProvider creates an IP provider that queries several HTTP IP
+// services from the given parameter (e.g. "all,https://a.example,https://b.example").
+// The optional mode ("majority" or "all") defines how many services must agree.
+func newConsensusIPProvider(parameter string) (consensusIPProvider, error) {
+	mode := consensusModeMajority
+	var urls []string
+	for _, option := range strings.Split(parameter, ",") {
+		option = strings.TrimSpace(option)
+		switch option {
+		case "":
+			continue
+		case consensusModeMajority, consensusModeAll:
+			mode = option
+		default:
+			urls = append(urls, option)
+		}
+	}
+
+	if len(urls) == 0 {
+		urls = defaultConsensusIPServiceURLs
+	}
+
+	if len(urls) < 2 {
+		return consensusIPProvider{}, fmt.Errorf("The consensus IP source requires at least two URLs")
+	}
+
+	providers := make(map[string]ipProvider)
+	for _, url := range urls {
+		providers[url] = newHTTPIPProvider(url)
+	}
+
+	return consensusIPProvider{providers, mode == consensusModeAll}, nil
+}
+
+// consensusIPProvider returns the IP address that several IP providers agree on.
+type consensusIPProvider struct {
+	providers  map[string]ipProvider
+	requireAll bool
+}
+
+// consensusResult is the response of a single IP provider.
+type consensusResult struct {
+	name string
+	ip   net.IP
+	err  error
+}
+
+// GetIP queries all providers concurrently and returns the reported IP
+// address if enough providers agree on it. Failing providers count as
+// disagreeing.
+func (provider consensusIPProvider) GetIP() (net.IP, error) {
+	results := make(chan consensusResult, len(provider.providers))
+	for name, serviceProvider := range provider.providers {
+		go func(name string, serviceProvider ipProvider) {
+			ip, ipError := serviceProvider.GetIP()
+			results <- consensusResult{name, ip, ipError}
+		}(name, serviceProvider)
+	}
+
+	votes := make(map[string]int)
+	var responses []string
+	for range provider.providers {
+		result := <-results
+		if result.err != nil {
+			responses = append(responses, fmt.Sprintf("%s: %s", result.name, result.err.Error()))
+			continue
+		}
+
+		votes[result.ip.String()]++
+		responses = append(responses, fmt.Sprintf("%s: %s", result.name, result.ip))
+	}
+
+	required := len(provider.providers)/2 + 1
+	if provider.requireAll {
+		required = len(provider.providers)
+	}
+
+	for ip, count := range votes {
+		if count >= required {
+			return net.ParseIP(ip), nil
+		}
+	}
+
+	return nil, fmt.Errorf("The IP services do not agree (%d of %d required): %s", required, len(provider.providers), strings.Join(responses, "; "))
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+// The consensus IP source should return the address reported by the majority of the services.
+func Test_consensusIPProvider_GetIP_Majority(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		ips         []string
+		requireAll  bool
+		expected    string
+		expectError bool
+	}{
+		{[]string{"203.0.113.1", "203.0.113.1", "198.51.100.1"}, false, "203.0.113.1", false},
+		{[]string{"203.0.113.1", "203.0.113.1", ""}, false, "203.0.113.1", false},
+		{[]string{"203.0.113.1", "198.51.100.1", ""}, false, "", true},
+		{[]string{"203.0.113.1", "203.0.113.1", "198.51.100.1"}, true, "", true},
+		{[]string{"203.0.113.1", "203.0.113.1", "203.0.113.1"}, true, "203.0.113.1", false},
+	}
+
+	for _, input := range inputs {
+		providers := make(map[string]ipProvider)
+		for index, ip := range input.ips {
+			if ip == "" {
+				providers[fmt.Sprintf("service%d", index)] = testIPProvider{nil, fmt.Errorf("timeout")}
+				continue
+			}
+
+			providers[fmt.Sprintf("service%d", index)] = testIPProvider{net.ParseIP(ip), nil}
+		}
+
+		provider := consensusIPProvider{providers, input.requireAll}
+
+		// act
+		ip, err := provider.GetIP()
+
+		// assert
+		if (err != nil) != input.expectError || (!input.expectError && ip.String() != input.expected) {
+			t.Fail()
+			t.Logf("consensusIPProvider.GetIP() for %q (all: %t) should return %q (error expected: %t) but returned %s (error: %v)", input.ips, input.requireAll, input.expected, input.expectError, ip, err)
+		}
+	}
+}
+
+// The mode and the URLs should be parsed from the parameter.
+func Test_newConsensusIPProvider_ParameterIsParsed(t *testing.T) {
+	// act
+	provider, err := newConsensusIPProvider("all, https://a.example, https://b.example")
+
+	// assert
+	if err != nil || !provider.requireAll || len(provider.providers) != 2 {
+		t.Fail()
+		t.Logf("newConsensusIPProvider should require all of the two services but returned %+v (error: %v)", provider, err)
+	}
+
+	if _, singleURLError := newConsensusIPProvider("https://a.example"); singleURLError == nil {
+		t.Fail()
+		t.Logf("newConsensusIPProvider should return an error if only one URL is given")
+	}
+}
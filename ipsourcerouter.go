@@ -0,0 +1,303 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"github.com/spf13/afero"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// natPMPPort is the UDP port NAT-PMP gateways listen on.
+	natPMPPort = 5351
+
+	// routerTimeout is the time to wait for the responses of the router.
+	routerTimeout = 3 * time.Second
+
+	// ssdpAddress is the multicast address used for UPnP discovery.
+	ssdpAddress = "239.255.255.250:1900"
+
+	// routeTableFilePath is the path of the Linux kernel routing table.
+	routeTableFilePath = "/proc/net/route"
+)
+
+// newNATPMPIPProvider creates an IP provider that requests the external
+// address from the NAT-PMP gateway with the given address. If no gateway
+// is given the default gateway is used.
+func newNATPMPIPProvider(fs afero.Fs, gateway string) (natPMPIPProvider, error) {
+	if gateway == "" {
+		defaultGateway, gatewayError := getDefaultGateway(fs)
+		if gatewayError != nil {
+			return natPMPIPProvider{}, fmt.Errorf("Unable to determine the default gateway (e.g. natpmp:192.168.1.1): %s", gatewayError.Error())
+		}
+
+		gateway = defaultGateway.String()
+	}
+
+	if _, _, splitError := net.SplitHostPort(gateway); splitError != nil {
+		gateway = net.JoinHostPort(gateway, strconv.Itoa(natPMPPort))
+	}
+
+	return natPMPIPProvider{gateway, routerTimeout}, nil
+}
+
+// natPMPIPProvider returns the external address of a NAT-PMP gateway (RFC 6886).
+type natPMPIPProvider struct {
+	gatewayAddress string
+	timeout        time.Duration
+}
+
+// GetIP sends an external address request to the gateway.
+func (provider natPMPIPProvider) GetIP() (net.IP, error) {
+	connection, dialError := net.DialTimeout("udp", provider.gatewayAddress, provider.timeout)
+	if dialError != nil {
+		return nil, dialError
+	}
+
+	defer connection.Close()
+	connection.SetDeadline(time.Now().Add(provider.timeout))
+
+	// version 0, opcode 0 (external address request)
+	if _, writeError := connection.Write([]byte{0, 0}); writeError != nil {
+		return nil, writeError
+	}
+
+	response := make([]byte, 16)
+	length, readError := connection.Read(response)
+	if readError != nil {
+		return nil, fmt.Errorf("No NAT-PMP response from %s: %s", provider.gatewayAddress, readError.Error())
+	}
+
+	if length < 12 || response[0] != 0 || response[1] != 128 {
+		return nil, fmt.Errorf("Invalid NAT-PMP response from %s", provider.gatewayAddress)
+	}
+
+	if resultCode := binary.BigEndian.Uint16(response[2:4]); resultCode != 0 {
+		return nil, fmt.Errorf("%s responded with NAT-PMP result code %d", provider.gatewayAddress, resultCode)
+	}
+
+	return net.IPv4(response[8], response[9], response[10], response[11]), nil
+}
+
+// getDefaultGateway returns the IPv4 address of the default
+// gateway from the Linux kernel routing table.
+func getDefaultGateway(fs afero.Fs) (net.IP, error) {
+	if fs == nil {
+		return nil, fmt.Errorf("No filesystem provided")
+	}
+
+	content, readError := afero.ReadFile(fs, routeTableFilePath)
+	if readError != nil {
+		return nil, readError
+	}
+
+	// Iface Destination Gateway Flags ...
+	for _, line := range strings.Split(string(content), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+
+		gateway, parseError := strconv.ParseUint(fields[2], 16, 32)
+		if parseError != nil || gateway == 0 {
+			continue
+		}
+
+		// the addresses are stored in host byte order (little endian)
+		ip := make(net.IP, 4)
+		binary.LittleEndian.PutUint32(ip, uint32(gateway))
+		return ip, nil
+	}
+
+	return nil, fmt.Errorf("No default route found in %s", routeTableFilePath)
+}
+
+// newUPnPIPProvider creates an IP provider that requests the external address
+// from the UPnP internet gateway device described at the given location. If
+// no location is given the gateway is discovered via SSDP.
+func newUPnPIPProvider(location string) upnpIPProvider {
+	return upnpIPProvider{
+		location: location,
+		client:   &http.Client{Timeout: routerTimeout},
+	}
+}
+
+// upnpIPProvider returns the external address of a UPnP internet gateway device.
+type upnpIPProvider struct {
+	location string
+	client   *http.Client
+}
+
+// upnpService is a service entry of a UPnP device description.
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+// GetIP calls the GetExternalIPAddress action of the WAN connection service of the gateway.
+func (provider upnpIPProvider) GetIP() (net.IP, error) {
+	location := provider.location
+	if location == "" {
+		discoveredLocation, discoveryError := discoverUPnPGateway(routerTimeout)
+		if discoveryError != nil {
+			return nil, discoveryError
+		}
+
+		location = discoveredLocation
+	}
+
+	service, controlURL, serviceError := provider.getWANConnectionService(location)
+	if serviceError != nil {
+		return nil, serviceError
+	}
+
+	body := fmt.Sprintf(`<?xml version="1.0"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`+
+		`<s:Body><u:GetExternalIPAddress xmlns:u="%s"></u:GetExternalIPAddress></s:Body>`+
+		`</s:Envelope>`, service.ServiceType)
+
+	request, requestError := http.NewRequest("POST", controlURL, strings.NewReader(body))
+	if requestError != nil {
+		return nil, requestError
+	}
+
+	request.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	request.Header.Set("SOAPAction", fmt.Sprintf(`"%s#GetExternalIPAddress"`, service.ServiceType))
+
+	response, responseError := provider.client.Do(request)
+	if responseError != nil {
+		return nil, responseError
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %s", controlURL, response.Status)
+	}
+
+	var externalIP string
+	if decodeError := decodeXMLElement(response.Body, "NewExternalIPAddress", &externalIP); decodeError != nil {
+		return nil, decodeError
+	}
+
+	return parseIPFromText(externalIP)
+}
+
+// getWANConnectionService returns the WAN IP or PPP connection service of the
+// device described at the given location and its absolute control URL.
+func (provider upnpIPProvider) getWANConnectionService(location string) (upnpService, string, error) {
+	response, responseError := provider.client.Get(location)
+	if responseError != nil {
+		return upnpService{}, "", responseError
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return upnpService{}, "", fmt.Errorf("%s responded with %s", location, response.Status)
+	}
+
+	decoder := xml.NewDecoder(response.Body)
+	for {
+		var service upnpService
+		if decodeError := decodeNextXMLElement(decoder, "service", &service); decodeError != nil {
+			return upnpService{}, "", fmt.Errorf("%s does not describe a WAN connection service", location)
+		}
+
+		if !strings.Contains(service.ServiceType, ":WANIPConnection:") && !strings.Contains(service.ServiceType, ":WANPPPConnection:") {
+			continue
+		}
+
+		baseURL, baseURLError := url.Parse(location)
+		if baseURLError != nil {
+			return upnpService{}, "", baseURLError
+		}
+
+		controlURL, controlURLError := url.Parse(strings.TrimSpace(service.ControlURL))
+		if controlURLError != nil {
+			return upnpService{}, "", controlURLError
+		}
+
+		return service, baseURL.ResolveReference(controlURL).String(), nil
+	}
+}
+
+// discoverUPnPGateway searches the local network for an internet gateway
+// device and returns the location of its device description.
+func discoverUPnPGateway(timeout time.Duration) (string, error) {
+	connection, listenError := net.ListenPacket("udp4", ":0")
+	if listenError != nil {
+		return "", listenError
+	}
+
+	defer connection.Close()
+
+	multicastAddress, resolveError := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if resolveError != nil {
+		return "", resolveError
+	}
+
+	searchRequest := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddress + "\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+
+	if _, writeError := connection.WriteTo([]byte(searchRequest), multicastAddress); writeError != nil {
+		return "", writeError
+	}
+
+	connection.SetReadDeadline(time.Now().Add(timeout))
+
+	buffer := make([]byte, 2048)
+	for {
+		length, _, readError := connection.ReadFrom(buffer)
+		if readError != nil {
+			return "", fmt.Errorf("No UPnP internet gateway device found (e.g. upnp:http://192.168.1.1:5000/rootDesc.xml)")
+		}
+
+		response, parseError := http.ReadResponse(bufio.NewReader(bytes.NewReader(buffer[:length])), nil)
+		if parseError != nil {
+			continue
+		}
+
+		if location := response.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
+
+// decodeXMLElement decodes the first element with the given local name.
+func decodeXMLElement(reader io.Reader, name string, target interface{}) error {
+	return decodeNextXMLElement(xml.NewDecoder(reader), name, target)
+}
+
+// decodeNextXMLElement decodes the next element with the given local name.
+func decodeNextXMLElement(decoder *xml.Decoder, name string, target interface{}) error {
+	for {
+		token, tokenError := decoder.Token()
+		if tokenError != nil {
+			return fmt.Errorf("Element %q not found: %s", name, tokenError.Error())
+		}
+
+		startElement, isStartElement := token.(xml.StartElement)
+		if !isStartElement || startElement.Name.Local != name {
+			continue
+		}
+
+		return decoder.DecodeElement(target, &startElement)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/afero"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTestNATPMPGateway starts a UDP server that answers every
+// request with the given response and returns its address.
+func startTestNATPMPGateway(t *testing.T, response []byte) (string, func()) {
+	connection, listenError := net.ListenPacket("udp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatalf("Unable to start the NAT-PMP test gateway: %s", listenError.Error())
+	}
+
+	go func() {
+		buffer := make([]byte, 16)
+		for {
+			_, address, readError := connection.ReadFrom(buffer)
+			if readError != nil {
+				return
+			}
+
+			connection.WriteTo(response, address)
+		}
+	}()
+
+	return connection.LocalAddr().String(), func() { connection.Close() }
+}
+
+// The natpmp IP source should return the external address reported by the gateway.
+func Test_natPMPIPProvider_GetIP_ExternalAddressIsReturned(t *testing.T) {
+	// arrange
+	gatewayAddress, stop := startTestNATPMPGateway(t, []byte{0, 128, 0, 0, 0, 0, 0, 1, 203, 0, 113, 9})
+	defer stop()
+
+	provider, _ := newNATPMPIPProvider(nil, gatewayAddress)
+
+	// act
+	ip, err := provider.GetIP()
+
+	// assert
+	if err != nil || ip.String() != "203.0.113.9" {
+		t.Fail()
+		t.Logf("natPMPIPProvider.GetIP() should return 203.0.113.9 but returned %s (error: %v)", ip, err)
+	}
+}
+
+// The natpmp IP source should return an error if the gateway reports a failure.
+func Test_natPMPIPProvider_GetIP_ResultCodeIsNotSuccess_ErrorIsReturned(t *testing.T) {
+	// arrange
+	gatewayAddress, stop := startTestNATPMPGateway(t, []byte{0, 128, 0, 3, 0, 0, 0, 1, 0, 0, 0, 0})
+	defer stop()
+
+	provider := natPMPIPProvider{gatewayAddress, time.Second}
+
+	// act
+	_, err := provider.GetIP()
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("natPMPIPProvider.GetIP() should return an error if the gateway responds with a result code other than 0")
+	}
+}
+
+// The default gateway should be read from the kernel routing table.
+func Test_getDefaultGateway_DefaultRouteExists_GatewayIsReturned(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, routeTableFilePath, []byte(
+		"Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"+
+			"eth0\t0001A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n"+
+			"eth0\t00000000\t0101A8C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\n"), 0644)
+
+	// act
+	gateway, err := getDefaultGateway(fs)
+
+	// assert
+	if err != nil || gateway.String() != "192.168.1.1" {
+		t.Fail()
+		t.Logf("getDefaultGateway() should return 192.168.1.1 but returned %s (error: %v)", gateway, err)
+	}
+}
+
+// The upnp IP source should call GetExternalIPAddress on the WAN connection service.
+func Test_upnpIPProvider_GetIP_ExternalAddressIsReturned(t *testing.T) {
+	// arrange
+	soapAction := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rootDesc.xml":
+			fmt.Fprintf(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <serviceList>
+      <service><serviceType>urn:schemas-upnp-org:service:Layer3Forwarding:1</serviceType><controlURL>/ctl/L3F</controlURL></service>
+    </serviceList>
+    <deviceList>
+      <device>
+        <serviceList>
+          <service><serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType><controlURL>/ctl/IPConn</controlURL></service>
+        </serviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`)
+
+		case "/ctl/IPConn":
+			soapAction = r.Header.Get("SOAPAction")
+			ioutil.ReadAll(r.Body)
+			fmt.Fprintf(w, `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Body>
+    <u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+      <NewExternalIPAddress>198.51.100.77</NewExternalIPAddress>
+    </u:GetExternalIPAddressResponse>
+  </s:Body>
+</s:Envelope>`)
+
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := newUPnPIPProvider(server.URL + "/rootDesc.xml")
+
+	// act
+	ip, err := provider.GetIP()
+
+	// assert
+	if err != nil || ip.String() != "198.51.100.77" {
+		t.Fail()
+		t.Logf("upnpIPProvider.GetIP() should return 198.51.100.77 but returned %s (error: %v)", ip, err)
+	}
+
+	if !strings.HasSuffix(soapAction, `WANIPConnection:1#GetExternalIPAddress"`) {
+		t.Fail()
+		t.Logf("upnpIPProvider.GetIP() should call GetExternalIPAddress but called %q", soapAction)
+	}
+}
@@ -0,0 +1,463 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxJournalEntries is the number of changes the journal keeps.
+const maxJournalEntries = 1000
+
+// journalLockTimeout is the maximum time to wait for the lock of the journal file.
+var journalLockTimeout = 10 * time.Second
+
+const (
+	journalOperationCreate = "create"
+	journalOperationUpdate = "update"
+	journalOperationDelete = "delete"
+)
+
+// journalEntry describes a single change of a DNS record.
+type journalEntry struct {
+	Time      time.Time      `json:"time"`
+	Domain    string         `json:"domain"`
+	Operation string         `json:"operation"`
+	RecordID  string         `json:"record_id"`
+	Before    *journalRecord `json:"before,omitempty"`
+	After     *journalRecord `json:"after,omitempty"`
+
+	// Profile and Host identify who made the change.
+	Profile string `json:"profile,omitempty"`
+	Host    string `json:"host,omitempty"`
+}
+
+// journalOrigin is the profile and host that changes are made from.
+type journalOrigin struct {
+	Profile string
+	Host    string
+}
+
+// journalRecord is the state of a DNS record before or after a change.
+type journalRecord struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+// String returns a short description of the record (e.g. "www A 127.0.0.1").
+func (record journalRecord) String() string {
+	name := record.Name
+	if name == "" {
+		name = "@"
+	}
+
+	return fmt.Sprintf("%s %s %s", name, record.Type, record.Content)
+}
+
+// ChangeRecord returns the record as the parameters of a create or update request.
+func (record journalRecord) ChangeRecord() *dnsimple.ChangeRecord {
+	return &dnsimple.ChangeRecord{
+		Name:  record.Name,
+		Value: record.Content,
+		Type:  record.Type,
+		Ttl:   strconv.Itoa(record.TTL),
+	}
+}
+
+// changeJournal stores the changes made to DNS records.
+type changeJournal interface {
+	// Append adds the given entry to the journal.
+	Append(entry journalEntry) error
+
+	// GetEntries returns all entries, the oldest first.
+	GetEntries() ([]journalEntry, error)
+
+	// Remove removes the given entries (e.g. changes that were rolled back).
+	Remove(entries []journalEntry) error
+
+	// ReplaceRecordID assigns the entries of the given record to the
+	// record with the new ID (e.g. after a deleted record was recreated).
+	ReplaceRecordID(domain, id, newID string) error
+}
+
+// filesystemJournal stores the journal entries in a JSON file.
+type filesystemJournal struct {
+	fs       afero.Fs
+	filePath string
+}
+
+// Append adds the given entry to the journal file. Only the
+// most recent entries are kept.
+func (journal filesystemJournal) Append(entry journalEntry) error {
+	unlock, lockError := journal.lock()
+	if lockError != nil {
+		return lockError
+	}
+
+	defer unlock()
+
+	entries, readError := journal.GetEntries()
+	if readError != nil {
+		return readError
+	}
+
+	entries = append(entries, entry)
+	if len(entries) > maxJournalEntries {
+		entries = entries[len(entries)-maxJournalEntries:]
+	}
+
+	return journal.save(entries)
+}
+
+// GetEntries reads all entries from the journal file.
+func (journal filesystemJournal) GetEntries() ([]journalEntry, error) {
+	if journal.fs == nil {
+		return nil, fmt.Errorf("No filesystem provided")
+	}
+
+	content, readError := afero.ReadFile(journal.fs, journal.filePath)
+	if readError != nil {
+		if os.IsNotExist(readError) {
+			return nil, nil
+		}
+
+		return nil, readError
+	}
+
+	var entries []journalEntry
+	if unmarshalError := json.Unmarshal(content, &entries); unmarshalError != nil {
+		return nil, fmt.Errorf("Cannot parse the journal %q: %s", journal.filePath, unmarshalError.Error())
+	}
+
+	return entries, nil
+}
+
+// Remove removes the given entries from the journal file. Entries that
+// were appended in the meantime (e.g. by another invocation) are kept.
+func (journal filesystemJournal) Remove(removed []journalEntry) error {
+	unlock, lockError := journal.lock()
+	if lockError != nil {
+		return lockError
+	}
+
+	defer unlock()
+
+	entries, readError := journal.GetEntries()
+	if readError != nil {
+		return readError
+	}
+
+	var remaining []journalEntry
+	for _, entry := range entries {
+		if !containsJournalEntry(removed, entry) {
+			remaining = append(remaining, entry)
+		}
+	}
+
+	return journal.save(remaining)
+}
+
+// ReplaceRecordID replaces the record ID of all entries of the given record in the journal file.
+func (journal filesystemJournal) ReplaceRecordID(domain, id, newID string) error {
+	unlock, lockError := journal.lock()
+	if lockError != nil {
+		return lockError
+	}
+
+	defer unlock()
+
+	entries, readError := journal.GetEntries()
+	if readError != nil {
+		return readError
+	}
+
+	for index, entry := range entries {
+		if entry.Domain == domain && entry.RecordID == id {
+			entries[index].RecordID = newID
+		}
+	}
+
+	return journal.save(entries)
+}
+
+// lock locks the journal file for a read-modify-write (see lockFile).
+func (journal filesystemJournal) lock() (func(), error) {
+	if journal.fs == nil {
+		return nil, fmt.Errorf("No filesystem provided")
+	}
+
+	return lockFile(journal.fs, journal.filePath+".lock", journalLockTimeout)
+}
+
+// save replaces the journal file with the given entries. Readers never
+// see a partially written journal (see writeFileAtomic).
+func (journal filesystemJournal) save(entries []journalEntry) error {
+	content, marshalError := json.MarshalIndent(entries, "", "  ")
+	if marshalError != nil {
+		return marshalError
+	}
+
+	return writeFileAtomic(journal.fs, journal.filePath, content, 0600)
+}
+
+// containsJournalEntry checks if the given entries contain the given entry.
+func containsJournalEntry(entries []journalEntry, entry journalEntry) bool {
+	for _, candidate := range entries {
+		if candidate.Time.Equal(entry.Time) && candidate.Domain == entry.Domain && candidate.Operation == entry.Operation && candidate.RecordID == entry.RecordID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// journalingClientFactory creates DNS clients that record all changes
+// in the given journal together with the active profile and the host name.
+type journalingClientFactory struct {
+	clientFactory dnsClientFactory
+	journal       changeJournal
+	profiles      profileProvider
+	hostname      func() (string, error)
+
+	// warnings receives the warnings about changes that
+	// were applied but could not be recorded in the journal.
+	warnings io.Writer
+}
+
+// CreateClient creates a journaling DNS client.
+func (factory journalingClientFactory) CreateClient() (deens.DNSClient, error) {
+	client, clientError := factory.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, clientError
+	}
+
+	return journalingDNSClient{client, factory.journal, time.Now, factory.getOrigin(), factory.warnings}, nil
+}
+
+// getOrigin returns the active profile and the host name.
+func (factory journalingClientFactory) getOrigin() journalOrigin {
+	var origin journalOrigin
+	if factory.profiles != nil {
+		origin.Profile, _, _ = factory.profiles.GetProfile()
+	}
+
+	if factory.hostname != nil {
+		origin.Host, _ = factory.hostname()
+	}
+
+	return origin
+}
+
+// journalingDNSClient records the state of DNS records before
+// and after each change so that the changes can be rolled back.
+// A change that was applied is never reported as failed because
+// the journal cannot be written; a warning is written instead.
+type journalingDNSClient struct {
+	client   deens.DNSClient
+	journal  changeJournal
+	now      func() time.Time
+	origin   journalOrigin
+	warnings io.Writer
+}
+
+// GetRecords returns the DNS records of the given domain.
+func (client journalingDNSClient) GetRecords(domain string) ([]dnsimple.Record, error) {
+	return client.client.GetRecords(domain)
+}
+
+// GetDomains returns all domains.
+func (client journalingDNSClient) GetDomains() ([]dnsimple.Domain, error) {
+	return client.client.GetDomains()
+}
+
+// CreateRecord creates the given record and records the change.
+func (client journalingDNSClient) CreateRecord(domain string, opts *dnsimple.ChangeRecord) (string, error) {
+	id, err := client.client.CreateRecord(domain, opts)
+	if err != nil {
+		return id, err
+	}
+
+	client.record(domain, journalOperationCreate, id, nil, getJournalRecordFromChange(opts))
+	return id, nil
+}
+
+// UpdateRecord updates the given record and records its previous state.
+func (client journalingDNSClient) UpdateRecord(domain string, id string, opts *dnsimple.ChangeRecord) (string, error) {
+	before, lookupError := client.getRecord(domain, id)
+	if lookupError != nil {
+		return "", lookupError
+	}
+
+	updatedID, err := client.client.UpdateRecord(domain, id, opts)
+	if err != nil {
+		return updatedID, err
+	}
+
+	// partial updates (e.g. of the TTL only) keep the other fields
+	after := getJournalRecordFromChange(opts)
+	if before != nil {
+		if after.Name == "" && after.Type == "" {
+			after.Name = before.Name
+			after.Type = before.Type
+		}
+
+		if after.Content == "" {
+			after.Content = before.Content
+		}
+
+		if opts.Ttl == "" {
+			after.TTL = before.TTL
+		}
+	}
+
+	client.record(domain, journalOperationUpdate, id, before, after)
+	return updatedID, nil
+}
+
+// DestroyRecord deletes the given record and records its previous state.
+func (client journalingDNSClient) DestroyRecord(domain string, id string) error {
+	before, lookupError := client.getRecord(domain, id)
+	if lookupError != nil {
+		return lookupError
+	}
+
+	if err := client.client.DestroyRecord(domain, id); err != nil {
+		return err
+	}
+
+	client.record(domain, journalOperationDelete, id, before, nil)
+	return nil
+}
+
+// getRecord returns the current state of the record with the given id.
+func (client journalingDNSClient) getRecord(domain, id string) (*journalRecord, error) {
+	records, err := client.client.GetRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		if record.StringId() == id {
+			return &journalRecord{record.Name, record.RecordType, record.Content, int(record.Ttl)}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// record appends a change to the journal. If the journal cannot
+// be written a warning is written (the change itself was applied).
+func (client journalingDNSClient) record(domain, operation, id string, before, after *journalRecord) {
+	entry := journalEntry{
+		Time:      client.now(),
+		Domain:    domain,
+		Operation: operation,
+		RecordID:  id,
+		Before:    before,
+		After:     after,
+		Profile:   client.origin.Profile,
+		Host:      client.origin.Host,
+	}
+
+	if journalError := client.journal.Append(entry); journalError != nil && client.warnings != nil {
+		fmt.Fprintf(client.warnings, "Warning: The %s of record %s was applied but could not be written to the journal: %s\n", operation, id, journalError.Error())
+	}
+}
+
+// getJournalRecordFromChange returns the journal record for the given change request.
+func getJournalRecordFromChange(change *dnsimple.ChangeRecord) *journalRecord {
+	ttl, _ := strconv.Atoi(change.Ttl)
+	return &journalRecord{change.Name, change.Type, change.Value, ttl}
+}
+
+// recordProvenance describes when and from where a
+// record was created and last changed by dee.
+type recordProvenance struct {
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	UpdatedBy string     `json:"updated_by,omitempty"`
+}
+
+// String returns a short description of the provenance
+// (e.g. "created 2016-03-04 10:00 by personal@nas").
+func (provenance recordProvenance) String() string {
+	var parts []string
+	if provenance.CreatedAt != nil {
+		parts = append(parts, formatProvenanceEvent("created", *provenance.CreatedAt, provenance.CreatedBy))
+	}
+
+	if provenance.UpdatedAt != nil {
+		parts = append(parts, formatProvenanceEvent("updated", *provenance.UpdatedAt, provenance.UpdatedBy))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// formatProvenanceEvent returns a description of a single change (e.g. "updated 2016-03-04 10:00 by nas").
+func formatProvenanceEvent(event string, changedAt time.Time, origin string) string {
+	text := fmt.Sprintf("%s %s", event, changedAt.Local().Format("2006-01-02 15:04"))
+	if origin != "" {
+		text += " by " + origin
+	}
+
+	return text
+}
+
+// getRecordProvenance returns the provenance of the records of the given
+// domain from the given journal entries by record ID. Records that dee did
+// not change (or whose changes are no longer in the journal) are omitted.
+func getRecordProvenance(entries []journalEntry, domain string) map[string]recordProvenance {
+	provenance := make(map[string]recordProvenance)
+	for _, entry := range entries {
+		if entry.Domain != domain {
+			continue
+		}
+
+		changedAt := entry.Time
+		current := provenance[entry.RecordID]
+
+		switch entry.Operation {
+		case journalOperationCreate:
+			current = recordProvenance{CreatedAt: &changedAt, CreatedBy: entry.getOrigin()}
+
+		case journalOperationUpdate:
+			current.UpdatedAt = &changedAt
+			current.UpdatedBy = entry.getOrigin()
+
+		case journalOperationDelete:
+			delete(provenance, entry.RecordID)
+			continue
+		}
+
+		provenance[entry.RecordID] = current
+	}
+
+	return provenance
+}
+
+// getOrigin returns the profile and host of the change (e.g. "personal@nas").
+func (entry journalEntry) getOrigin() string {
+	switch {
+	case entry.Profile != "" && entry.Host != "":
+		return entry.Profile + "@" + entry.Host
+
+	case entry.Profile != "":
+		return entry.Profile
+	}
+
+	return entry.Host
+}
@@ -0,0 +1,204 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The journaling client should record the state before and after each change.
+func Test_journalingDNSClient_ChangesAreRecorded(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "www", RecordType: "A", Content: "127.0.0.1", Ttl: 600},
+			{Id: 2, Name: "old", RecordType: "A", Content: "127.0.0.2", Ttl: 600},
+		},
+	}
+
+	journal := filesystemJournal{afero.NewMemMapFs(), "/home/user/.dee/journal.json"}
+	client := journalingDNSClient{newInMemoryTestDNSClient(records), journal, time.Now, journalOrigin{"personal", "nas"}, nil}
+
+	// act
+	client.UpdateRecord("example.com", "1", &dnsimple.ChangeRecord{Name: "www", Value: "127.0.0.3", Type: "A", Ttl: "60"})
+	client.DestroyRecord("example.com", "2")
+	id, _ := client.CreateRecord("example.com", &dnsimple.ChangeRecord{Name: "new", Value: "127.0.0.4", Type: "A", Ttl: "600"})
+
+	// assert
+	entries, err := journal.GetEntries()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("The journal should contain 3 entries but contains %d (error: %v)", len(entries), err)
+	}
+
+	update := entries[0]
+	if update.Operation != journalOperationUpdate || update.RecordID != "1" || *update.Before != (journalRecord{"www", "A", "127.0.0.1", 600}) || update.After.Content != "127.0.0.3" {
+		t.Fail()
+		t.Logf("The update was not recorded correctly: %+v", update)
+	}
+
+	deletion := entries[1]
+	if deletion.Operation != journalOperationDelete || deletion.Before == nil || deletion.Before.Name != "old" || deletion.After != nil {
+		t.Fail()
+		t.Logf("The deletion was not recorded correctly: %+v", deletion)
+	}
+
+	creation := entries[2]
+	if creation.Operation != journalOperationCreate || creation.RecordID != id || creation.Before != nil || creation.After.Content != "127.0.0.4" {
+		t.Fail()
+		t.Logf("The creation was not recorded correctly: %+v", creation)
+	}
+
+	if creation.Profile != "personal" || creation.Host != "nas" {
+		t.Fail()
+		t.Logf("The profile and host of the change should be recorded: %+v", creation)
+	}
+}
+
+// A change that was applied should not be reported as failed if the journal cannot be written.
+func Test_journalingDNSClient_JournalCannotBeWritten_ChangeSucceedsWithWarning(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "www", RecordType: "A", Content: "127.0.0.1", Ttl: 600},
+		},
+	}
+
+	warnings := new(bytes.Buffer)
+	journal := filesystemJournal{afero.NewReadOnlyFs(afero.NewMemMapFs()), "/home/user/.dee/journal.json"}
+	client := journalingDNSClient{newInMemoryTestDNSClient(records), journal, time.Now, journalOrigin{}, warnings}
+
+	// act
+	id, createError := client.CreateRecord("example.com", &dnsimple.ChangeRecord{Name: "new", Value: "127.0.0.4", Type: "A", Ttl: "600"})
+	_, updateError := client.UpdateRecord("example.com", "1", &dnsimple.ChangeRecord{Value: "127.0.0.3"})
+	destroyError := client.DestroyRecord("example.com", id)
+
+	// assert
+	if createError != nil || updateError != nil || destroyError != nil || id == "" {
+		t.Fail()
+		t.Logf("The applied changes should not return an error: %v, %v, %v", createError, updateError, destroyError)
+	}
+
+	if strings.Count(warnings.String(), "could not be written to the journal") != 3 {
+		t.Fail()
+		t.Logf("A warning should have been written for each change: %q", warnings.String())
+	}
+}
+
+// Partial updates should record the unchanged fields of the record.
+func Test_journalingDNSClient_PartialUpdate_UnchangedFieldsAreRecorded(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "www", RecordType: "A", Content: "127.0.0.1", Ttl: 600},
+		},
+	}
+
+	journal := filesystemJournal{afero.NewMemMapFs(), "/home/user/.dee/journal.json"}
+	client := journalingDNSClient{newInMemoryTestDNSClient(records), journal, time.Now, journalOrigin{}, nil}
+
+	// act
+	client.UpdateRecord("example.com", "1", &dnsimple.ChangeRecord{Ttl: "60"})
+	client.UpdateRecord("example.com", "1", &dnsimple.ChangeRecord{Value: "127.0.0.2"})
+
+	// assert
+	entries, _ := journal.GetEntries()
+	if len(entries) != 2 {
+		t.Fatalf("The journal should contain 2 entries but contains %d", len(entries))
+	}
+
+	if *entries[0].After != (journalRecord{"www", "A", "127.0.0.1", 60}) {
+		t.Fail()
+		t.Logf("The TTL update should keep the content of the record: %+v", *entries[0].After)
+	}
+
+	if *entries[1].After != (journalRecord{"www", "A", "127.0.0.2", 60}) {
+		t.Fail()
+		t.Logf("The content update should keep the TTL of the record: %+v", *entries[1].After)
+	}
+}
+
+// The journal should only keep the most recent entries.
+func Test_filesystemJournal_Append_OldestEntriesAreRemoved(t *testing.T) {
+	// arrange
+	journal := filesystemJournal{afero.NewMemMapFs(), "/home/user/.dee/journal.json"}
+
+	var entries []journalEntry
+	for index := 0; index < maxJournalEntries; index++ {
+		entries = append(entries, journalEntry{Domain: "old.example.com"})
+	}
+
+	journal.save(entries)
+
+	// act
+	journal.Append(journalEntry{Domain: "example.com"})
+
+	// assert
+	result, _ := journal.GetEntries()
+	if len(result) != maxJournalEntries || result[len(result)-1].Domain != "example.com" {
+		t.Fail()
+		t.Logf("The journal should contain %d entries ending with the new one but contains %d", maxJournalEntries, len(result))
+	}
+}
+
+// Invocations that append to the same journal file at the same time should not drop each other's entries.
+func Test_filesystemJournal_Append_ConcurrentInvocations_NoEntriesAreLost(t *testing.T) {
+	// arrange
+	fs, cleanup := getLockTestFs(t)
+	defer cleanup()
+
+	// act
+	var wg sync.WaitGroup
+	for index := 0; index < 20; index++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+
+			journal := filesystemJournal{fs, "/home/user/.dee/journal.json"}
+			journal.Append(journalEntry{Domain: "example.com", RecordID: fmt.Sprintf("%d", index)})
+		}(index)
+	}
+
+	wg.Wait()
+
+	// assert
+	entries, err := filesystemJournal{fs, "/home/user/.dee/journal.json"}.GetEntries()
+	if err != nil || len(entries) != 20 {
+		t.Fail()
+		t.Logf("The journal should contain all 20 entries but contains %d (error: %v)", len(entries), err)
+	}
+
+	if exists, _ := afero.Exists(fs, "/home/user/.dee/journal.json.lock"); exists {
+		t.Fail()
+		t.Logf("The lock file should have been removed")
+	}
+}
+
+// Removing entries should keep the entries that were appended in the meantime.
+func Test_filesystemJournal_Remove_NewerEntriesAreKept(t *testing.T) {
+	// arrange
+	journal := filesystemJournal{afero.NewMemMapFs(), "/home/user/.dee/journal.json"}
+	reverted := journalEntry{Time: time.Date(2016, 3, 4, 10, 0, 0, 0, time.UTC), Domain: "example.com", Operation: journalOperationCreate, RecordID: "1"}
+	appended := journalEntry{Time: time.Date(2016, 3, 4, 10, 5, 0, 0, time.UTC), Domain: "example.com", Operation: journalOperationCreate, RecordID: "2"}
+
+	journal.Append(reverted)
+	journal.Append(appended)
+
+	// act
+	err := journal.Remove([]journalEntry{reverted})
+
+	// assert
+	entries, _ := journal.GetEntries()
+	if err != nil || len(entries) != 1 || entries[0].RecordID != "2" {
+		t.Fail()
+		t.Logf("Only the removed entry should have been removed from the journal: %+v (error: %v)", entries, err)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// logFormatText writes a line of text per log entry.
+	logFormatText = "text"
+
+	// logFormatJSON writes a JSON object per log entry.
+	logFormatJSON = "json"
+)
+
+// newLogger creates a logger that writes timestamped messages
+// to the given output in the given format ("text" or "json").
+func newLogger(output io.Writer, format *string) logger {
+	return logger{output: output, now: time.Now, format: format}
+}
+
+// validateLogFormat returns an error if the given log format is not supported.
+func validateLogFormat(format string) error {
+	if format != logFormatText && format != logFormatJSON {
+		return fmt.Errorf("Unknown log format %q (supported: %s, %s)", format, logFormatText, logFormatJSON)
+	}
+
+	return nil
+}
+
+// logFields contains the context of a log entry.
+type logFields struct {
+	Domain    string
+	Subdomain string
+	Action    string
+	Duration  time.Duration
+	Error     error
+}
+
+// logEntry is the JSON representation of a log entry.
+type logEntry struct {
+	Level      string `json:"level"`
+	Timestamp  string `json:"timestamp"`
+	Message    string `json:"message"`
+	Domain     string `json:"domain,omitempty"`
+	Subdomain  string `json:"subdomain,omitempty"`
+	Action     string `json:"action,omitempty"`
+	DurationMs *int64 `json:"duration_ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// logger writes the status messages of long-running actions.
+type logger struct {
+	output io.Writer
+	now    func() time.Time
+	format *string
+	fields logFields
+}
+
+// With returns a copy of the logger that adds the
+// given fields to all of its log entries.
+func (l logger) With(fields logFields) logger {
+	if fields.Domain != "" {
+		l.fields.Domain = fields.Domain
+	}
+
+	if fields.Subdomain != "" {
+		l.fields.Subdomain = fields.Subdomain
+	}
+
+	if fields.Action != "" {
+		l.fields.Action = fields.Action
+	}
+
+	if fields.Duration != 0 {
+		l.fields.Duration = fields.Duration
+	}
+
+	if fields.Error != nil {
+		l.fields.Error = fields.Error
+	}
+
+	return l
+}
+
+// WithOutput returns a copy of the logger that writes to the given output.
+func (l logger) WithOutput(output io.Writer) logger {
+	l.output = output
+	return l
+}
+
+// Infof writes an informational message.
+func (l logger) Infof(format string, args ...interface{}) {
+	l.write("INFO", format, args...)
+}
+
+// Errorf writes an error message.
+func (l logger) Errorf(format string, args ...interface{}) {
+	l.write("ERROR", format, args...)
+}
+
+func (l logger) write(level, format string, args ...interface{}) {
+	if l.output == nil {
+		return
+	}
+
+	entry := logEntry{
+		Level:     level,
+		Timestamp: l.now().Format(time.RFC3339),
+		Message:   fmt.Sprintf(format, args...),
+		Domain:    l.fields.Domain,
+		Subdomain: l.fields.Subdomain,
+		Action:    l.fields.Action,
+	}
+
+	if l.fields.Duration != 0 {
+		durationMs := int64(l.fields.Duration / time.Millisecond)
+		entry.DurationMs = &durationMs
+	}
+
+	if l.fields.Error != nil {
+		entry.Error = l.fields.Error.Error()
+	}
+
+	if l.format != nil && *l.format == logFormatJSON {
+		line, _ := json.Marshal(entry)
+		fmt.Fprintf(l.output, "%s\n", line)
+		return
+	}
+
+	fmt.Fprintf(l.output, "%s\n", formatLogEntry(entry))
+}
+
+// formatLogEntry returns the text representation of the given log
+// entry (e.g. `2016-03-04T10:00:00Z INFO  Updated domain=example.com duration=1.2s`).
+func formatLogEntry(entry logEntry) string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s %-5s %s", entry.Timestamp, entry.Level, entry.Message)
+
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"domain", entry.Domain},
+		{"subdomain", entry.Subdomain},
+		{"action", entry.Action},
+		{"error", entry.Error},
+	}
+
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+
+		if strings.ContainsAny(field.value, " \"=") {
+			fmt.Fprintf(buf, " %s=%q", field.name, field.value)
+			continue
+		}
+
+		fmt.Fprintf(buf, " %s=%s", field.name, field.value)
+	}
+
+	if entry.DurationMs != nil {
+		fmt.Fprintf(buf, " duration=%s", time.Duration(*entry.DurationMs)*time.Millisecond)
+	}
+
+	return buf.String()
+}
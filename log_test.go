@@ -0,0 +1,98 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// getTestLogger returns a logger with a fixed timestamp that writes to the given buffer.
+func getTestLogger(output *bytes.Buffer, format string) logger {
+	l := newLogger(output, &format)
+	l.now = func() time.Time {
+		return time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+	}
+
+	return l
+}
+
+// The JSON log format should write a JSON object with all fields per entry.
+func Test_logger_JSONFormat_FieldsAreWritten(t *testing.T) {
+	// arrange
+	output := new(bytes.Buffer)
+	l := getTestLogger(output, logFormatJSON).With(logFields{Domain: "example.com", Subdomain: "www", Action: "createorupdate"})
+
+	// act
+	l.With(logFields{Duration: 1500 * time.Millisecond, Error: fmt.Errorf("timeout")}).Errorf("update IP failed")
+
+	// assert
+	var entry map[string]interface{}
+	if unmarshalError := json.Unmarshal(output.Bytes(), &entry); unmarshalError != nil {
+		t.Fatalf("The log entry %q is not valid JSON: %s", output.String(), unmarshalError.Error())
+	}
+
+	expected := map[string]interface{}{
+		"level":       "ERROR",
+		"timestamp":   "2016-03-04T10:00:00Z",
+		"message":     "update IP failed",
+		"domain":      "example.com",
+		"subdomain":   "www",
+		"action":      "createorupdate",
+		"duration_ms": float64(1500),
+		"error":       "timeout",
+	}
+
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Fail()
+			t.Logf("The log entry should contain %q=%v but contains %v", key, value, entry[key])
+		}
+	}
+}
+
+// The text log format should append the fields to the message.
+func Test_logger_TextFormat_FieldsAreAppended(t *testing.T) {
+	// arrange
+	output := new(bytes.Buffer)
+	l := getTestLogger(output, logFormatText)
+
+	// act
+	l.With(logFields{Domain: "example.com", Error: fmt.Errorf("connection refused")}).Infof("Checked")
+
+	// assert
+	expected := "2016-03-04T10:00:00Z INFO  Checked domain=example.com error=\"connection refused\"\n"
+	if output.String() != expected {
+		t.Fail()
+		t.Logf("The log entry should be %q but was %q", expected, output.String())
+	}
+}
+
+func Test_validateLogFormat(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		format      string
+		expectError bool
+	}{
+		{"text", false},
+		{"json", false},
+		{"logfmt", true},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		err := validateLogFormat(input.format)
+
+		// assert
+		if (err != nil) != input.expectError {
+			t.Fail()
+			t.Logf("validateLogFormat(%q) should return an error: %t (error: %v)", input.format, input.expectError, err)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logFileTimestampFormat is the format of the timestamp
+// that is appended to the name of rotated log files.
+const logFileTimestampFormat = "20060102-150405"
+
+// newRotatingFileWriter creates a writer that appends to the log file of the
+// given configuration and rotates it by size or age.
+func newRotatingFileWriter(fs afero.Fs, settings logConfig) (*rotatingFileWriter, error) {
+	if fs == nil {
+		return nil, fmt.Errorf("No filesystem provided")
+	}
+
+	if settings.File == "" {
+		return nil, fmt.Errorf("No log file supplied")
+	}
+
+	if settings.MaxSizeMB < 0 || settings.MaxBackups < 0 {
+		return nil, fmt.Errorf("The log file size and the number of backups cannot be negative")
+	}
+
+	maxAge, maxAgeError := parseOptionalDuration(settings.MaxAge)
+	if maxAgeError != nil {
+		return nil, fmt.Errorf("Cannot parse the maximum log file age %q: %s", settings.MaxAge, maxAgeError.Error())
+	}
+
+	retention, retentionError := parseOptionalDuration(settings.Retention)
+	if retentionError != nil {
+		return nil, fmt.Errorf("Cannot parse the log file retention %q: %s", settings.Retention, retentionError.Error())
+	}
+
+	return &rotatingFileWriter{
+		fs:         fs,
+		filePath:   settings.File,
+		maxSize:    int64(settings.MaxSizeMB) * 1024 * 1024,
+		maxAge:     maxAge,
+		maxBackups: settings.MaxBackups,
+		retention:  retention,
+		now:        time.Now,
+	}, nil
+}
+
+// rotatingFileWriter appends to a log file. The file is renamed to
+// "<file>.<timestamp>" once it exceeds the maximum size or age and
+// old backups are deleted according to the retention settings.
+type rotatingFileWriter struct {
+	fs         afero.Fs
+	filePath   string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	retention  time.Duration
+	now        func() time.Time
+
+	mutex    sync.Mutex
+	file     afero.File
+	size     int64
+	openedAt time.Time
+}
+
+// Write appends the given data to the log file and rotates the file before if necessary.
+func (writer *rotatingFileWriter) Write(data []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.file == nil {
+		if openError := writer.open(); openError != nil {
+			return 0, openError
+		}
+	}
+
+	exceedsSize := writer.maxSize > 0 && writer.size > 0 && writer.size+int64(len(data)) > writer.maxSize
+	exceedsAge := writer.maxAge > 0 && writer.now().Sub(writer.openedAt) >= writer.maxAge
+	if exceedsSize || exceedsAge {
+		if rotateError := writer.rotate(); rotateError != nil {
+			return 0, rotateError
+		}
+	}
+
+	written, writeError := writer.file.Write(data)
+	writer.size += int64(written)
+	return written, writeError
+}
+
+// Close closes the log file.
+func (writer *rotatingFileWriter) Close() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.file == nil {
+		return nil
+	}
+
+	closeError := writer.file.Close()
+	writer.file = nil
+	return closeError
+}
+
+// open opens the log file for appending.
+func (writer *rotatingFileWriter) open() error {
+	if createFolderError := writer.fs.MkdirAll(filepath.Dir(writer.filePath), 0755); createFolderError != nil {
+		return createFolderError
+	}
+
+	file, openError := writer.fs.OpenFile(writer.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if openError != nil {
+		return openError
+	}
+
+	info, statError := file.Stat()
+	if statError != nil {
+		file.Close()
+		return statError
+	}
+
+	writer.file = file
+	writer.size = info.Size()
+	writer.openedAt = writer.now()
+	return nil
+}
+
+// rotate renames the current log file, removes expired
+// backups and opens a new log file.
+func (writer *rotatingFileWriter) rotate() error {
+	if closeError := writer.file.Close(); closeError != nil {
+		return closeError
+	}
+
+	writer.file = nil
+
+	backupPath := writer.filePath + "." + writer.now().Format(logFileTimestampFormat)
+	for index := 1; ; index++ {
+		if _, statError := writer.fs.Stat(backupPath); os.IsNotExist(statError) {
+			break
+		}
+
+		backupPath = fmt.Sprintf("%s.%s-%d", writer.filePath, writer.now().Format(logFileTimestampFormat), index)
+	}
+
+	if renameError := writer.fs.Rename(writer.filePath, backupPath); renameError != nil {
+		return renameError
+	}
+
+	if cleanupError := writer.removeExpiredBackups(); cleanupError != nil {
+		return cleanupError
+	}
+
+	return writer.open()
+}
+
+// removeExpiredBackups deletes the backups exceeding the maximum
+// number of backups and those older than the retention period.
+func (writer *rotatingFileWriter) removeExpiredBackups() error {
+	files, readError := afero.ReadDir(writer.fs, filepath.Dir(writer.filePath))
+	if readError != nil {
+		return readError
+	}
+
+	prefix := filepath.Base(writer.filePath) + "."
+	var backups []os.FileInfo
+	for _, file := range files {
+		if !file.IsDir() && strings.HasPrefix(file.Name(), prefix) {
+			backups = append(backups, file)
+		}
+	}
+
+	// newest first
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name() > backups[j].Name()
+	})
+
+	for index, backup := range backups {
+		tooMany := writer.maxBackups > 0 && index >= writer.maxBackups
+		tooOld := writer.retention > 0 && writer.now().Sub(writer.getBackupTime(backup, prefix)) > writer.retention
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		if removeError := writer.fs.Remove(filepath.Join(filepath.Dir(writer.filePath), backup.Name())); removeError != nil {
+			return removeError
+		}
+	}
+
+	return nil
+}
+
+// getBackupTime returns the time the given backup was rotated at
+// from its name or, if the name contains no timestamp, its modification time.
+func (writer *rotatingFileWriter) getBackupTime(backup os.FileInfo, prefix string) time.Time {
+	suffix := strings.TrimPrefix(backup.Name(), prefix)
+	if len(suffix) < len(logFileTimestampFormat) {
+		return backup.ModTime()
+	}
+
+	rotatedAt, parseError := time.ParseInLocation(logFileTimestampFormat, suffix[:len(logFileTimestampFormat)], writer.now().Location())
+	if parseError != nil {
+		return backup.ModTime()
+	}
+
+	return rotatedAt
+}
+
+// parseOptionalDuration parses the given duration. An empty text is zero.
+func parseOptionalDuration(text string) (time.Duration, error) {
+	if text == "" {
+		return 0, nil
+	}
+
+	duration, parseError := time.ParseDuration(text)
+	if parseError != nil {
+		return 0, parseError
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("The duration cannot be negative")
+	}
+
+	return duration, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/spf13/afero"
+	"sort"
+	"testing"
+	"time"
+)
+
+// getLogFiles returns the sorted names of all files in the log folder.
+func getLogFiles(fs afero.Fs) []string {
+	files, _ := afero.ReadDir(fs, "/var/log/dee")
+
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// The log file should be rotated once it exceeds the maximum size
+// and only the given number of backups should be kept.
+func Test_rotatingFileWriter_MaxSizeExceeded_FileIsRotated(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	writer, _ := newRotatingFileWriter(fs, logConfig{File: "/var/log/dee/dee.log", MaxBackups: 2})
+	writer.maxSize = 10
+
+	now := time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+	writer.now = func() time.Time { return now }
+
+	// act
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		writer.Write([]byte(line))
+		now = now.Add(time.Minute)
+	}
+
+	writer.Close()
+
+	// assert
+	expected := []string{"dee.log", "dee.log.20160304-100200", "dee.log.20160304-100300"}
+	files := getLogFiles(fs)
+	if len(files) != len(expected) {
+		t.Fatalf("The log folder should contain %q but contains %q", expected, files)
+	}
+
+	for index := range expected {
+		if files[index] != expected[index] {
+			t.Fail()
+			t.Logf("The log folder should contain %q but contains %q", expected, files)
+		}
+	}
+
+	if content, _ := afero.ReadFile(fs, "/var/log/dee/dee.log"); string(content) != "line 4\n" {
+		t.Fail()
+		t.Logf("The current log file should only contain the last line but contains %q", content)
+	}
+}
+
+// The log file should be rotated once it exceeds the maximum age and
+// backups older than the retention period should be deleted.
+func Test_rotatingFileWriter_MaxAgeExceeded_FileIsRotatedAndOldBackupsAreRemoved(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/var/log/dee/dee.log.20160201-000000", []byte("old\n"), 0644)
+
+	writer, _ := newRotatingFileWriter(fs, logConfig{File: "/var/log/dee/dee.log", MaxAge: "24h", Retention: "168h"})
+
+	now := time.Date(2016, time.March, 4, 10, 0, 0, 0, time.UTC)
+	writer.now = func() time.Time { return now }
+
+	// act
+	writer.Write([]byte("day 1\n"))
+	now = now.Add(25 * time.Hour)
+	writer.Write([]byte("day 2\n"))
+	writer.Close()
+
+	// assert
+	files := getLogFiles(fs)
+	if len(files) != 2 || files[0] != "dee.log" || files[1] != "dee.log.20160305-110000" {
+		t.Fail()
+		t.Logf("The log folder should contain the current log file and one backup but contains %q", files)
+	}
+}
+
+// Invalid log settings should result in an error.
+func Test_newRotatingFileWriter_InvalidSettings_ErrorIsReturned(t *testing.T) {
+	// arrange
+	settingsSet := []logConfig{
+		{},
+		{File: "/var/log/dee.log", MaxAge: "one day"},
+		{File: "/var/log/dee.log", Retention: "-1h"},
+		{File: "/var/log/dee.log", MaxSizeMB: -1},
+	}
+
+	for _, settings := range settingsSet {
+
+		// act
+		_, err := newRotatingFileWriter(afero.NewMemMapFs(), settings)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("newRotatingFileWriter(%+v) should return an error", settings)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/afero"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// recordMetadata contains the local notes and labels of a DNS record.
+// DNSimple does not store them; they are only kept in the state file.
+type recordMetadata struct {
+	Domain   string            `json:"domain"`
+	RecordID int64             `json:"record_id"`
+	Note     string            `json:"note,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+
+	// ExpiresAt is the time after which a temporary record is deleted by "gc".
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// IsEmpty returns true if the record has neither a note, labels nor an expiry time.
+func (metadata recordMetadata) IsEmpty() bool {
+	return metadata.Note == "" && len(metadata.Labels) == 0 && metadata.ExpiresAt == nil
+}
+
+// localState is the content of the state file.
+type localState struct {
+	Records []recordMetadata `json:"records"`
+	Runs    []completedRun   `json:"runs,omitempty"`
+}
+
+// metadataStore stores the local metadata of DNS records.
+type metadataStore interface {
+	// GetMetadata returns the metadata of all records of the given domain.
+	GetMetadata(domain string) (map[int64]recordMetadata, error)
+
+	// GetAllMetadata returns the metadata of the records of all domains.
+	GetAllMetadata() ([]recordMetadata, error)
+
+	// SetMetadata replaces the metadata of the given record.
+	// Empty metadata is removed.
+	SetMetadata(metadata recordMetadata) error
+}
+
+// stateLockTimeout is the maximum time to wait for the lock of the state file.
+var stateLockTimeout = 10 * time.Second
+
+// filesystemMetadataStore stores the record metadata in a JSON state file.
+type filesystemMetadataStore struct {
+	fs       afero.Fs
+	filePath string
+}
+
+// GetMetadata returns the metadata of all records of the given domain by record ID.
+func (store filesystemMetadataStore) GetMetadata(domain string) (map[int64]recordMetadata, error) {
+	state, readError := store.read()
+	if readError != nil {
+		return nil, readError
+	}
+
+	result := make(map[int64]recordMetadata)
+	for _, metadata := range state.Records {
+		if strings.EqualFold(metadata.Domain, domain) {
+			result[metadata.RecordID] = metadata
+		}
+	}
+
+	return result, nil
+}
+
+// GetAllMetadata returns the metadata of the records of all domains.
+func (store filesystemMetadataStore) GetAllMetadata() ([]recordMetadata, error) {
+	state, readError := store.read()
+	if readError != nil {
+		return nil, readError
+	}
+
+	return state.Records, nil
+}
+
+// SetMetadata replaces the metadata of the given record in the state file.
+func (store filesystemMetadataStore) SetMetadata(metadata recordMetadata) error {
+	unlock, lockError := store.lock()
+	if lockError != nil {
+		return lockError
+	}
+
+	defer unlock()
+
+	state, readError := store.read()
+	if readError != nil {
+		return readError
+	}
+
+	var records []recordMetadata
+	for _, existing := range state.Records {
+		if strings.EqualFold(existing.Domain, metadata.Domain) && existing.RecordID == metadata.RecordID {
+			continue
+		}
+
+		records = append(records, existing)
+	}
+
+	if !metadata.IsEmpty() {
+		records = append(records, metadata)
+	}
+
+	state.Records = records
+	return store.save(state)
+}
+
+// lock locks the state file for a read-modify-write (see lockFile).
+func (store filesystemMetadataStore) lock() (func(), error) {
+	if store.fs == nil {
+		return nil, fmt.Errorf("No filesystem provided")
+	}
+
+	return lockFile(store.fs, store.filePath+".lock", stateLockTimeout)
+}
+
+func (store filesystemMetadataStore) read() (localState, error) {
+	if store.fs == nil {
+		return localState{}, fmt.Errorf("No filesystem provided")
+	}
+
+	content, readError := afero.ReadFile(store.fs, store.filePath)
+	if readError != nil {
+		if os.IsNotExist(readError) {
+			return localState{}, nil
+		}
+
+		return localState{}, readError
+	}
+
+	var state localState
+	if unmarshalError := json.Unmarshal(content, &state); unmarshalError != nil {
+		return localState{}, fmt.Errorf("Cannot parse the state file %q: %s", store.filePath, unmarshalError.Error())
+	}
+
+	return state, nil
+}
+
+func (store filesystemMetadataStore) save(state localState) error {
+	content, marshalError := json.MarshalIndent(state, "", "  ")
+	if marshalError != nil {
+		return marshalError
+	}
+
+	return afero.WriteFile(store.fs, store.filePath, content, 0600)
+}
+
+// setRecordExpiry sets the expiry time of the given record
+// and keeps its other metadata.
+func setRecordExpiry(store metadataStore, domain string, recordID int64, expiresAt time.Time) error {
+	existing, metadataError := store.GetMetadata(domain)
+	if metadataError != nil {
+		return metadataError
+	}
+
+	metadata := existing[recordID]
+	metadata.Domain, metadata.RecordID, metadata.ExpiresAt = domain, recordID, &expiresAt
+	return store.SetMetadata(metadata)
+}
+
+// parseLabels parses a comma-separated list of labels (e.g. "env=prod,team=web").
+// Labels without a value (e.g. "critical") have an empty value.
+func parseLabels(text string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, entry := range strings.Split(text, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, value := entry, ""
+		if separator := strings.Index(entry, "="); separator >= 0 {
+			key, value = strings.TrimSpace(entry[:separator]), strings.TrimSpace(entry[separator+1:])
+		}
+
+		if key == "" {
+			return nil, fmt.Errorf("Invalid label %q (e.g. env=prod)", entry)
+		}
+
+		labels[key] = value
+	}
+
+	return labels, nil
+}
+
+// matchesLabels returns true if the given metadata has all labels of the
+// selector. Selector labels without a value match any value of the label.
+func matchesLabels(metadata recordMetadata, selector map[string]string) bool {
+	for key, value := range selector {
+		actual, exists := metadata.Labels[key]
+		if !exists || (value != "" && actual != value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// formatLabels returns the given labels as a sorted, comma-separated list.
+func formatLabels(labels map[string]string) string {
+	var entries []string
+	for key, value := range labels {
+		if value == "" {
+			entries = append(entries, key)
+			continue
+		}
+
+		entries = append(entries, key+"="+value)
+	}
+
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
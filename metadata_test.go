@@ -0,0 +1,88 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/spf13/afero"
+	"testing"
+)
+
+// The filesystem metadata store should return the saved metadata and remove empty metadata.
+func Test_filesystemMetadataStore_SetMetadata_MetadataIsStored(t *testing.T) {
+	// arrange
+	store := filesystemMetadataStore{afero.NewMemMapFs(), "/home/user/.dee/state.json"}
+
+	// act
+	store.SetMetadata(recordMetadata{Domain: "example.com", RecordID: 1, Note: "web server", Labels: map[string]string{"env": "prod"}})
+	store.SetMetadata(recordMetadata{Domain: "example.com", RecordID: 2, Labels: map[string]string{"env": "dev"}})
+	store.SetMetadata(recordMetadata{Domain: "example.com", RecordID: 2})
+	metadata, err := store.GetMetadata("example.com")
+
+	// assert
+	if err != nil {
+		t.Fatalf("GetMetadata returned an error: %s", err.Error())
+	}
+
+	if len(metadata) != 1 || metadata[1].Note != "web server" || metadata[1].Labels["env"] != "prod" {
+		t.Fail()
+		t.Logf("GetMetadata should only return the metadata of record 1 but returned %#v", metadata)
+	}
+}
+
+// parseLabels should parse labels with and without values and reject labels without a name.
+func Test_parseLabels(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		text     string
+		expected string
+		isValid  bool
+	}{
+		{"", "", true},
+		{"env=prod", "env=prod", true},
+		{" team = web , env=prod,critical", "critical,env=prod,team=web", true},
+		{"=prod", "", false},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		labels, err := parseLabels(input.text)
+
+		// assert
+		if (err == nil) != input.isValid || formatLabels(labels) != input.expected {
+			t.Fail()
+			t.Logf("parseLabels(%q) returned %q (%v) but %q was expected", input.text, formatLabels(labels), err, input.expected)
+		}
+	}
+}
+
+// matchesLabels should require all selector labels; selector labels without a value match any value.
+func Test_matchesLabels(t *testing.T) {
+	// arrange
+	metadata := recordMetadata{Labels: map[string]string{"env": "prod", "team": "web"}}
+	inputs := []struct {
+		selector map[string]string
+		expected bool
+	}{
+		{map[string]string{}, true},
+		{map[string]string{"env": "prod"}, true},
+		{map[string]string{"env": ""}, true},
+		{map[string]string{"env": "prod", "team": "web"}, true},
+		{map[string]string{"env": "dev"}, false},
+		{map[string]string{"env": "prod", "critical": ""}, false},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		result := matchesLabels(metadata, input.selector)
+
+		// assert
+		if result != input.expected {
+			t.Fail()
+			t.Logf("matchesLabels(%v) returned %t but %t was expected", input.selector, result, input.expected)
+		}
+	}
+}
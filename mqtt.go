@@ -0,0 +1,237 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	mqttPacketConnect    = 0x10
+	mqttPacketConnAck    = 0x20
+	mqttPacketPublish    = 0x30
+	mqttPacketDisconnect = 0xE0
+
+	// mqttKeepAlive is the keep alive interval in seconds sent with CONNECT.
+	mqttKeepAlive = 60
+)
+
+// newMQTTPublisher creates a publisher for the broker of the given settings
+// (e.g. "tcp://broker:1883" or "tls://broker:8883").
+func newMQTTPublisher(settings mqttConfig) (mqttPublisher, error) {
+	broker, parseError := url.Parse(settings.Broker)
+	if parseError != nil || broker.Host == "" {
+		return mqttPublisher{}, fmt.Errorf("Invalid MQTT broker %q (e.g. tcp://broker:1883)", settings.Broker)
+	}
+
+	useTLS := false
+	defaultPort := "1883"
+	switch strings.ToLower(broker.Scheme) {
+	case "tcp", "mqtt":
+	case "tls", "ssl", "mqtts":
+		useTLS = true
+		defaultPort = "8883"
+	default:
+		return mqttPublisher{}, fmt.Errorf("Unsupported MQTT broker scheme %q (available: tcp, tls)", broker.Scheme)
+	}
+
+	address := broker.Host
+	if broker.Port() == "" {
+		address = net.JoinHostPort(broker.Hostname(), defaultPort)
+	}
+
+	clientID := settings.ClientID
+	if clientID == "" {
+		clientID = "dee"
+	}
+
+	topic := strings.TrimSuffix(settings.Topic, "/")
+	if topic == "" {
+		topic = "dee"
+	}
+
+	return mqttPublisher{
+		address:  address,
+		useTLS:   useTLS,
+		clientID: clientID,
+		username: settings.Username,
+		password: settings.Password,
+		topic:    topic,
+		retain:   settings.Retain,
+		timeout:  10 * time.Second,
+	}, nil
+}
+
+// mqttPublisher publishes messages to an MQTT (3.1.1) broker.
+// A new connection is opened for every message because
+// events are rare.
+type mqttPublisher struct {
+	address  string
+	useTLS   bool
+	clientID string
+	username string
+	password string
+	topic    string
+	retain   bool
+	timeout  time.Duration
+}
+
+// Publish sends the given payload to the given subtopic
+// of the configured topic (e.g. "dee/ip-change") with QoS 0.
+func (publisher mqttPublisher) Publish(subtopic string, payload []byte) error {
+	connection, dialError := publisher.dial()
+	if dialError != nil {
+		return fmt.Errorf("Cannot connect to the MQTT broker %s: %s", publisher.address, dialError.Error())
+	}
+
+	defer connection.Close()
+	connection.SetDeadline(time.Now().Add(publisher.timeout))
+
+	if _, writeError := connection.Write(publisher.getConnectPacket()); writeError != nil {
+		return writeError
+	}
+
+	if connAckError := readMQTTConnAck(bufio.NewReader(connection)); connAckError != nil {
+		return connAckError
+	}
+
+	topic := publisher.topic + "/" + subtopic
+	if _, writeError := connection.Write(getMQTTPublishPacket(topic, payload, publisher.retain)); writeError != nil {
+		return writeError
+	}
+
+	_, disconnectError := connection.Write([]byte{mqttPacketDisconnect, 0})
+	return disconnectError
+}
+
+// dial opens the connection to the broker.
+func (publisher mqttPublisher) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: publisher.timeout}
+	if publisher.useTLS {
+		return tls.DialWithDialer(dialer, "tcp", publisher.address, nil)
+	}
+
+	return dialer.Dial("tcp", publisher.address)
+}
+
+// getConnectPacket returns the CONNECT packet with a clean session.
+func (publisher mqttPublisher) getConnectPacket() []byte {
+	flags := byte(0x02)
+	payload := encodeMQTTString(publisher.clientID)
+
+	if publisher.username != "" {
+		flags |= 0x80
+		payload = append(payload, encodeMQTTString(publisher.username)...)
+
+		if publisher.password != "" {
+			flags |= 0x40
+			payload = append(payload, encodeMQTTString(publisher.password)...)
+		}
+	}
+
+	body := append(encodeMQTTString("MQTT"), 4, flags, mqttKeepAlive>>8, mqttKeepAlive&0xFF)
+	body = append(body, payload...)
+
+	return encodeMQTTPacket(mqttPacketConnect, body)
+}
+
+// getMQTTPublishPacket returns a PUBLISH packet with QoS 0.
+func getMQTTPublishPacket(topic string, payload []byte, retain bool) []byte {
+	packetType := byte(mqttPacketPublish)
+	if retain {
+		packetType |= 0x01
+	}
+
+	return encodeMQTTPacket(packetType, append(encodeMQTTString(topic), payload...))
+}
+
+// readMQTTConnAck reads the CONNACK packet and checks its return code.
+func readMQTTConnAck(reader *bufio.Reader) error {
+	packetType, body, readError := readMQTTPacket(reader)
+	if readError != nil {
+		return fmt.Errorf("Cannot read the CONNACK packet: %s", readError.Error())
+	}
+
+	if packetType&0xF0 != mqttPacketConnAck || len(body) != 2 {
+		return fmt.Errorf("Unexpected MQTT packet type %#x", packetType)
+	}
+
+	switch body[1] {
+	case 0:
+		return nil
+	case 4, 5:
+		return fmt.Errorf("The MQTT broker rejected the credentials (return code %d)", body[1])
+	}
+
+	return fmt.Errorf("The MQTT broker refused the connection (return code %d)", body[1])
+}
+
+// readMQTTPacket reads the type and body of the next packet.
+func readMQTTPacket(reader *bufio.Reader) (byte, []byte, error) {
+	packetType, typeError := reader.ReadByte()
+	if typeError != nil {
+		return 0, nil, typeError
+	}
+
+	length := 0
+	for multiplier := 1; ; multiplier *= 128 {
+		digit, lengthError := reader.ReadByte()
+		if lengthError != nil {
+			return 0, nil, lengthError
+		}
+
+		length += int(digit&0x7F) * multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+
+		if multiplier > 128*128*128 {
+			return 0, nil, fmt.Errorf("Invalid remaining length")
+		}
+	}
+
+	body := make([]byte, length)
+	if _, readError := io.ReadFull(reader, body); readError != nil {
+		return 0, nil, readError
+	}
+
+	return packetType, body, nil
+}
+
+// encodeMQTTPacket returns a packet with the given type and body.
+func encodeMQTTPacket(packetType byte, body []byte) []byte {
+	packet := bytes.NewBuffer([]byte{packetType})
+
+	// remaining length
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+
+		packet.WriteByte(digit)
+		if length == 0 {
+			break
+		}
+	}
+
+	packet.Write(body)
+	return packet.Bytes()
+}
+
+// encodeMQTTString returns the given text prefixed with its length.
+func encodeMQTTString(text string) []byte {
+	return append([]byte{byte(len(text) >> 8), byte(len(text) & 0xFF)}, text...)
+}
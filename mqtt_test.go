@@ -0,0 +1,169 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+// testMQTTPacket is a packet received by the test broker.
+type testMQTTPacket struct {
+	packetType byte
+	body       []byte
+}
+
+// startTestMQTTBroker accepts a single connection, answers the CONNECT
+// packet with the given return code and sends all received packets
+// to the returned channel.
+func startTestMQTTBroker(t *testing.T, returnCode byte) (string, chan testMQTTPacket) {
+	listener, listenError := net.Listen("tcp", "127.0.0.1:0")
+	if listenError != nil {
+		t.Fatalf("Cannot start the test broker: %s", listenError.Error())
+	}
+
+	packets := make(chan testMQTTPacket, 10)
+	go func() {
+		defer listener.Close()
+		defer close(packets)
+
+		connection, acceptError := listener.Accept()
+		if acceptError != nil {
+			return
+		}
+
+		defer connection.Close()
+
+		reader := bufio.NewReader(connection)
+		for {
+			packetType, body, readError := readMQTTPacket(reader)
+			if readError != nil {
+				return
+			}
+
+			packets <- testMQTTPacket{packetType, body}
+
+			if packetType == mqttPacketConnect {
+				connection.Write([]byte{mqttPacketConnAck, 2, 0, returnCode})
+			}
+		}
+	}()
+
+	return "tcp://" + listener.Addr().String(), packets
+}
+
+// newMQTTPublisher should return an error for invalid broker URLs.
+func Test_newMQTTPublisher_InvalidBroker_ErrorIsReturned(t *testing.T) {
+	// arrange
+	brokers := []string{
+		"",
+		"broker:1883",
+		"http://broker:1883",
+	}
+
+	for _, broker := range brokers {
+
+		// act
+		_, err := newMQTTPublisher(mqttConfig{Broker: broker})
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("newMQTTPublisher(%q) should return an error", broker)
+		}
+	}
+}
+
+// newMQTTPublisher should use the default port of the scheme and the default topic.
+func Test_newMQTTPublisher_NoPortAndTopic_DefaultsAreUsed(t *testing.T) {
+	// arrange
+	inputs := map[string]string{
+		"tcp://broker":       "broker:1883",
+		"tls://broker":       "broker:8883",
+		"mqtts://broker:443": "broker:443",
+	}
+
+	for broker, expectedAddress := range inputs {
+
+		// act
+		publisher, err := newMQTTPublisher(mqttConfig{Broker: broker})
+
+		// assert
+		if err != nil || publisher.address != expectedAddress || publisher.topic != "dee" {
+			t.Fail()
+			t.Logf("newMQTTPublisher(%q) should use %q and topic %q but returned %q, %q (%v)", broker, expectedAddress, "dee", publisher.address, publisher.topic, err)
+		}
+	}
+}
+
+// mqttPublisher.Publish should connect with the configured credentials
+// and publish the payload to the subtopic of the configured topic.
+func Test_mqttPublisher_Publish_PayloadIsPublished(t *testing.T) {
+	// arrange
+	broker, packets := startTestMQTTBroker(t, 0)
+	publisher, _ := newMQTTPublisher(mqttConfig{Broker: broker, Topic: "home/dee/", ClientID: "dee-test", Username: "user", Password: "secret", Retain: true})
+
+	// act
+	err := publisher.Publish("ip-change", []byte(`{"ip":"203.0.113.1"}`))
+
+	// assert
+	if err != nil {
+		t.Fatalf("Publish returned an error: %s", err.Error())
+	}
+
+	connect := <-packets
+	if connect.packetType != mqttPacketConnect || !bytes.Contains(connect.body, []byte("dee-test")) || !bytes.Contains(connect.body, []byte("secret")) {
+		t.Fail()
+		t.Logf("The first packet should be a CONNECT packet with the client ID and credentials: %#x %q", connect.packetType, connect.body)
+	}
+
+	publish := <-packets
+	expected := getMQTTPublishPacket("home/dee/ip-change", []byte(`{"ip":"203.0.113.1"}`), true)
+	if publish.packetType != mqttPacketPublish|0x01 || !bytes.HasSuffix(expected, publish.body) {
+		t.Fail()
+		t.Logf("The second packet should be a retained PUBLISH packet for home/dee/ip-change: %#x %q", publish.packetType, publish.body)
+	}
+
+	disconnect := <-packets
+	if disconnect.packetType != mqttPacketDisconnect {
+		t.Fail()
+		t.Logf("The last packet should be a DISCONNECT packet: %#x", disconnect.packetType)
+	}
+}
+
+// mqttPublisher.Publish should return an error if the broker refuses the connection.
+func Test_mqttPublisher_Publish_ConnectionRefused_ErrorIsReturned(t *testing.T) {
+	// arrange
+	broker, _ := startTestMQTTBroker(t, 5)
+	publisher, _ := newMQTTPublisher(mqttConfig{Broker: broker, Username: "user", Password: "wrong"})
+
+	// act
+	err := publisher.Publish("ip-change", []byte("{}"))
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Fail()
+		t.Logf("Publish should return an error for rejected credentials: %v", err)
+	}
+}
+
+// encodeMQTTPacket should encode the remaining length as variable length integer.
+func Test_encodeMQTTPacket_LongBody_RemainingLengthIsEncoded(t *testing.T) {
+	// arrange
+	body := make([]byte, 321)
+
+	// act
+	packet := encodeMQTTPacket(mqttPacketPublish, body)
+
+	// assert
+	packetType, decoded, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(packet)))
+	if err != nil || packetType != mqttPacketPublish || len(decoded) != 321 || !bytes.Equal(packet[1:3], []byte{0xC1, 0x02}) {
+		t.Fail()
+		t.Logf("The packet should have a remaining length of 321 (0xC1 0x02) but is %x (%v)", packet[:3], err)
+	}
+}
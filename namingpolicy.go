@@ -0,0 +1,193 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// namingPolicy defines the record names that dee may change (the
+// "naming_policy" section of the configuration file). The names are the
+// subdomains of the records; "@" stands for the root domain.
+type namingPolicy struct {
+	// Reserved are the names or name patterns that must not be created,
+	// changed or deleted (e.g. "mail", "autodiscover", "*._domainkey").
+	Reserved []string `json:"reserved"`
+
+	// Allow are regular expressions of which a name must match at least one
+	// (e.g. "^[a-z0-9-]+\\.dyn$"). Without expressions all names are allowed.
+	Allow []string `json:"allow"`
+
+	// Deny are regular expressions of which a name must not match any (e.g. "^_").
+	Deny []string `json:"deny"`
+}
+
+// Check returns an error if the policy does not allow changes of the record with the given name.
+func (policy namingPolicy) Check(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = "@"
+	}
+
+	for _, reserved := range policy.Reserved {
+		reserved = strings.ToLower(strings.TrimSpace(reserved))
+		if matches, _ := path.Match(reserved, name); matches || reserved == name {
+			return fmt.Errorf("The name %q is reserved by the naming policy (reserved: %s)", name, reserved)
+		}
+	}
+
+	for _, pattern := range policy.Deny {
+		expression, expressionError := regexp.Compile(pattern)
+		if expressionError != nil {
+			return fmt.Errorf("Invalid deny pattern %q of the naming policy: %s", pattern, expressionError.Error())
+		}
+
+		if expression.MatchString(name) {
+			return fmt.Errorf("The name %q is denied by the naming policy (deny: %s)", name, pattern)
+		}
+	}
+
+	if len(policy.Allow) == 0 {
+		return nil
+	}
+
+	for _, pattern := range policy.Allow {
+		expression, expressionError := regexp.Compile(pattern)
+		if expressionError != nil {
+			return fmt.Errorf("Invalid allow pattern %q of the naming policy: %s", pattern, expressionError.Error())
+		}
+
+		if expression.MatchString(name) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("The name %q is not allowed by the naming policy (allow: %s)", name, strings.Join(policy.Allow, ", "))
+}
+
+// namingPolicyProvider returns the naming policy.
+type namingPolicyProvider interface {
+	GetNamingPolicy() (namingPolicy, error)
+}
+
+// configNamingPolicyProvider reads the naming policy from the configuration file.
+// If there is no configuration file all names are allowed.
+type configNamingPolicyProvider struct {
+	config *configFile
+}
+
+// GetNamingPolicy returns the naming policy of the configuration file.
+func (provider configNamingPolicyProvider) GetNamingPolicy() (namingPolicy, error) {
+	settings, _, configError := provider.config.Load()
+	if configError != nil {
+		return namingPolicy{}, configError
+	}
+
+	return settings.NamingPolicy, nil
+}
+
+// namingPolicyClientFactory creates DNS clients that refuse
+// changes of records whose names violate the naming policy.
+type namingPolicyClientFactory struct {
+	clientFactory dnsClientFactory
+	policies      namingPolicyProvider
+
+	// ignore turns off the naming policy (-ignore-naming-policy).
+	ignore *bool
+}
+
+// CreateClient returns a new DNS client that enforces the naming policy.
+func (factory namingPolicyClientFactory) CreateClient() (deens.DNSClient, error) {
+	client, clientError := factory.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, clientError
+	}
+
+	if factory.policies == nil || (factory.ignore != nil && *factory.ignore) {
+		return client, nil
+	}
+
+	policy, policyError := factory.policies.GetNamingPolicy()
+	if policyError != nil {
+		return nil, policyError
+	}
+
+	if len(policy.Reserved) == 0 && len(policy.Allow) == 0 && len(policy.Deny) == 0 {
+		return client, nil
+	}
+
+	return namingPolicyDNSClient{client, policy}, nil
+}
+
+// namingPolicyDNSClient checks the names of the records of every
+// change against the naming policy before the change is made.
+type namingPolicyDNSClient struct {
+	client deens.DNSClient
+	policy namingPolicy
+}
+
+// GetRecords returns the DNS records of the given domain.
+func (client namingPolicyDNSClient) GetRecords(domain string) ([]dnsimple.Record, error) {
+	return client.client.GetRecords(domain)
+}
+
+// GetDomains returns all domains.
+func (client namingPolicyDNSClient) GetDomains() ([]dnsimple.Domain, error) {
+	return client.client.GetDomains()
+}
+
+// CreateRecord creates the given record if the policy allows its name.
+func (client namingPolicyDNSClient) CreateRecord(domain string, opts *dnsimple.ChangeRecord) (string, error) {
+	if policyError := client.policy.Check(opts.Name); policyError != nil {
+		return "", fmt.Errorf("Cannot create %s: %s", getFormattedDomainName(opts.Name, domain), policyError.Error())
+	}
+
+	return client.client.CreateRecord(domain, opts)
+}
+
+// UpdateRecord updates the given record if the policy allows its current and its new name.
+func (client namingPolicyDNSClient) UpdateRecord(domain string, id string, opts *dnsimple.ChangeRecord) (string, error) {
+	if policyError := client.checkRecord(domain, id); policyError != nil {
+		return "", fmt.Errorf("Cannot update the record %s of %s: %s", id, domain, policyError.Error())
+	}
+
+	if opts.Name != "" {
+		if policyError := client.policy.Check(opts.Name); policyError != nil {
+			return "", fmt.Errorf("Cannot rename the record %s of %s: %s", id, domain, policyError.Error())
+		}
+	}
+
+	return client.client.UpdateRecord(domain, id, opts)
+}
+
+// DestroyRecord deletes the given record if the policy allows its name.
+func (client namingPolicyDNSClient) DestroyRecord(domain string, id string) error {
+	if policyError := client.checkRecord(domain, id); policyError != nil {
+		return fmt.Errorf("Cannot delete the record %s of %s: %s", id, domain, policyError.Error())
+	}
+
+	return client.client.DestroyRecord(domain, id)
+}
+
+// checkRecord checks the name of the record with the given ID against the policy.
+func (client namingPolicyDNSClient) checkRecord(domain, id string) error {
+	records, err := client.client.GetRecords(domain)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if record.StringId() == id {
+			return client.policy.Check(record.Name)
+		}
+	}
+
+	return fmt.Errorf("The record %s does not exist", id)
+}
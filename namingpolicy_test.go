@@ -0,0 +1,124 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"testing"
+)
+
+// getTestNamingPolicyProvider returns a provider for the naming policy of the given configuration file.
+func getTestNamingPolicyProvider(config string) configNamingPolicyProvider {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/user/.dee/config.json", []byte(config), 0600)
+	return configNamingPolicyProvider{newConfigFile(fs, configDecrypter{}, "/home/user/.dee/config.json")}
+}
+
+const testNamingPolicyConfig = `{
+  "naming_policy": {
+    "reserved": ["@", "mail", "autodiscover", "*._domainkey"],
+    "deny": ["^_"]
+  }
+}`
+
+// Records with reserved or denied names should neither be created, changed nor deleted.
+func Test_namingPolicyClientFactory_ReservedNames_ChangesAreRefused(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "mail", RecordType: "A", Content: "203.0.113.1"},
+			{Id: 2, Name: "home", RecordType: "A", Content: "203.0.113.2"},
+		},
+	}
+
+	ignore := false
+	factory := namingPolicyClientFactory{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, getTestNamingPolicyProvider(testNamingPolicyConfig), &ignore}
+	client, clientError := factory.CreateClient()
+	if clientError != nil {
+		t.Fatalf("CreateClient should succeed: %s", clientError.Error())
+	}
+
+	// act
+	_, createReservedError := client.CreateRecord("example.com", &dnsimple.ChangeRecord{Name: "Autodiscover", Type: "CNAME", Value: "example.net"})
+	_, createDeniedError := client.CreateRecord("example.com", &dnsimple.ChangeRecord{Name: "_dmarc", Type: "TXT", Value: "v=DMARC1"})
+	_, createPatternError := client.CreateRecord("example.com", &dnsimple.ChangeRecord{Name: "s1._domainkey", Type: "TXT", Value: "v=DKIM1"})
+	_, createRootError := client.CreateRecord("example.com", &dnsimple.ChangeRecord{Name: "", Type: "A", Value: "203.0.113.9"})
+	_, updateReservedError := client.UpdateRecord("example.com", "1", &dnsimple.ChangeRecord{Value: "203.0.113.9"})
+	_, renameError := client.UpdateRecord("example.com", "2", &dnsimple.ChangeRecord{Name: "mail", Value: "203.0.113.9"})
+	deleteReservedError := client.DestroyRecord("example.com", "1")
+	_, allowedError := client.UpdateRecord("example.com", "2", &dnsimple.ChangeRecord{Value: "203.0.113.9"})
+
+	// assert
+	for index, err := range []error{createReservedError, createDeniedError, createPatternError, createRootError, updateReservedError, renameError, deleteReservedError} {
+		if err == nil {
+			t.Fail()
+			t.Logf("Change %d should have been refused by the naming policy", index+1)
+		}
+	}
+
+	if records["example.com"][0].Content != "203.0.113.1" || len(records["example.com"]) != 2 {
+		t.Fail()
+		t.Logf("The reserved record should not have been changed: %#v", records["example.com"])
+	}
+
+	if allowedError != nil {
+		t.Fail()
+		t.Logf("The change of an allowed name should succeed: %s", allowedError.Error())
+	}
+}
+
+// If allow patterns are given only the matching names should be changeable.
+func Test_namingPolicy_Check_AllowPatterns(t *testing.T) {
+	inputs := []struct {
+		name     string
+		expected bool
+	}{
+		{"home.dyn", true},
+		{"NAS.dyn", true},
+		{"www", false},
+		{"", false},
+		{"_acme-challenge.dyn", false},
+	}
+
+	policy := namingPolicy{Allow: []string{`^[a-z0-9-]+\.dyn$`}, Deny: []string{"^_"}}
+
+	for _, input := range inputs {
+		// act
+		err := policy.Check(input.name)
+
+		// assert
+		if (err == nil) != input.expected {
+			t.Fail()
+			t.Logf("Check(%q) should allow the name: %t (error: %v)", input.name, input.expected, err)
+		}
+	}
+}
+
+// -ignore-naming-policy and configuration files without a policy should not restrict the client.
+func Test_namingPolicyClientFactory_NoPolicyOrIgnored_ClientIsNotRestricted(t *testing.T) {
+	inputs := []struct {
+		config string
+		ignore bool
+	}{
+		{`{}`, false},
+		{testNamingPolicyConfig, true},
+	}
+
+	for _, input := range inputs {
+		// arrange
+		ignore := input.ignore
+		factory := namingPolicyClientFactory{testDNSClientFactory{newInMemoryTestDNSClient(nil), nil}, getTestNamingPolicyProvider(input.config), &ignore}
+
+		// act
+		client, err := factory.CreateClient()
+
+		// assert
+		if _, isRestricted := client.(namingPolicyDNSClient); err != nil || isRestricted {
+			t.Fail()
+			t.Logf("The client should not be restricted for %s (ignore: %t; error: %v)", input.config, input.ignore, err)
+		}
+	}
+}
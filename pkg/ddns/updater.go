@@ -0,0 +1,230 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ddns is the dynamic DNS loop of dee for other Go programs: detect
+// the current IP address, and point a set of address records to it whenever
+// it changes. Programs embed it with their own IP detection, DNS backend and
+// lifecycle management.
+//
+// The createorupdate action of dee (and therefore its daemon) runs on the
+// Updater; it injects the change journal and the naming policy with the DNS
+// editor it passes as the DNSCreator.
+//
+//	updater := &ddns.Updater{
+//		IPProvider: myIPProvider,
+//		DNS:        deens.NewDNSEditor(client, deens.NewDNSInfoProvider(client)),
+//		Records:    []ddns.Record{{Domain: "example.com", Subdomain: "home", TTL: 60}},
+//		Interval:   5 * time.Minute,
+//	}
+//
+//	go updater.Run(ctx)
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPProvider returns the current IP address (e.g. of a network interface).
+type IPProvider interface {
+	GetIP() (net.IP, error)
+}
+
+// DNSCreator creates and updates address records.
+// The DNSRecordEditor of github.com/andreaskoch/dee-ns implements it.
+type DNSCreator interface {
+	// CreateSubdomain creates an address record with the given TTL.
+	CreateSubdomain(domain, subdomain string, timeToLive int, ip net.IP) error
+
+	// UpdateSubdomain points the existing address record to the given IP.
+	UpdateSubdomain(domain, subdomain string, ip net.IP) error
+}
+
+// Record is an address record that the updater keeps up to date.
+type Record struct {
+	Domain    string
+	Subdomain string
+
+	// TTL is the time to live in seconds of records that are created (default: 600).
+	TTL int
+}
+
+// String returns the fully qualified name of the record (e.g. "home.example.com").
+func (record Record) String() string {
+	if record.Subdomain == "" {
+		return record.Domain
+	}
+
+	return record.Subdomain + "." + record.Domain
+}
+
+// Result is the outcome of the update of a single record.
+type Result struct {
+	Record Record
+	IP     net.IP
+
+	// Changed is true if the record was created or updated.
+	Changed bool
+
+	// Created is true if the record did not exist and was created.
+	Created bool
+
+	Err error
+}
+
+// String describes the result (e.g. "Updated: home.example.com → 203.0.113.1").
+func (result Result) String() string {
+	switch {
+	case result.Err != nil:
+		return fmt.Sprintf("Failed: %s → %s: %s", result.Record, result.IP, result.Err.Error())
+
+	case result.Created:
+		return fmt.Sprintf("Created: %s → %s", result.Record, result.IP)
+
+	case result.Changed:
+		return fmt.Sprintf("Updated: %s → %s", result.Record, result.IP)
+	}
+
+	return fmt.Sprintf("Unchanged: %s → %s", result.Record, result.IP)
+}
+
+// defaultTTL is the TTL of created records without a TTL.
+const defaultTTL = 600
+
+// defaultInterval is the time between two passes of Run without an interval.
+const defaultInterval = 5 * time.Minute
+
+// Updater points address records to the current IP address.
+// The zero value is not usable; IPProvider, DNS and Records are required.
+type Updater struct {
+	IPProvider IPProvider
+	DNS        DNSCreator
+	Records    []Record
+
+	// Interval is the time between two passes of Run (default: 5 minutes).
+	Interval time.Duration
+
+	// Report is called after every pass of Run with the results of the
+	// pass or the error of the IP detection (optional).
+	Report func(results []Result, err error)
+
+	lock   sync.Mutex
+	lastIP net.IP
+}
+
+// Update detects the current IP address and points all records to it.
+// If the IP did not change since the last successful pass no records
+// are touched and no results are returned. Records that fail are
+// retried on the next pass.
+func (updater *Updater) Update() ([]Result, error) {
+	updater.lock.Lock()
+	defer updater.lock.Unlock()
+
+	if updater.IPProvider == nil || updater.DNS == nil {
+		return nil, fmt.Errorf("The updater has no IP provider or DNS creator")
+	}
+
+	ip, ipError := updater.IPProvider.GetIP()
+	if ipError != nil {
+		return nil, fmt.Errorf("Cannot detect the IP address: %s", ipError.Error())
+	}
+
+	if ip == nil {
+		return nil, fmt.Errorf("Cannot detect the IP address: no IP returned")
+	}
+
+	if ip.Equal(updater.lastIP) {
+		return nil, nil
+	}
+
+	var results []Result
+	failed := false
+	for _, record := range updater.Records {
+		result := updater.updateRecord(record, ip)
+		failed = failed || result.Err != nil
+		results = append(results, result)
+	}
+
+	if !failed {
+		updater.lastIP = ip
+	}
+
+	return results, nil
+}
+
+// updateRecord points the given record to the given IP and
+// creates the record if it does not exist yet.
+func (updater *Updater) updateRecord(record Record, ip net.IP) Result {
+	result := Result{Record: record, IP: ip}
+
+	updateError := updater.DNS.UpdateSubdomain(record.Domain, record.Subdomain, ip)
+	switch {
+	case updateError == nil:
+		result.Changed = true
+
+	case IsUnchangedError(updateError):
+
+	case IsNotFoundError(updateError):
+		ttl := record.TTL
+		if ttl <= 0 {
+			ttl = defaultTTL
+		}
+
+		if createError := updater.DNS.CreateSubdomain(record.Domain, record.Subdomain, ttl, ip); createError != nil {
+			result.Err = createError
+			break
+		}
+
+		result.Changed, result.Created = true, true
+
+	default:
+		result.Err = updateError
+	}
+
+	return result
+}
+
+// Run updates the records immediately and then after every interval
+// until the given context is cancelled. It returns the error of the context.
+func (updater *Updater) Run(ctx context.Context) error {
+	interval := updater.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		results, err := updater.Update()
+		if updater.Report != nil && (err != nil || len(results) > 0) {
+			updater.Report(results, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-ticker.C:
+		}
+	}
+}
+
+// IsUnchangedError returns true if the given error of UpdateSubdomain
+// indicates that the record already has the IP address. The DNS editor of
+// dee-ns reports this only with the text of the error, so it is matched here
+// in one place.
+func IsUnchangedError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "No update required")
+}
+
+// IsNotFoundError returns true if the given error of UpdateSubdomain
+// indicates that the record does not exist (see IsUnchangedError).
+func IsNotFoundError(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "No address record")
+}
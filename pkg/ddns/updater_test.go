@@ -0,0 +1,245 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/andreaskoch/dnsimple-cli/pkg/dnsimpletest"
+	"github.com/pearkes/dnsimple"
+	"net"
+	"testing"
+	"time"
+)
+
+// testIPProvider returns the given IP address or error.
+type testIPProvider struct {
+	ip  net.IP
+	err error
+}
+
+func (provider *testIPProvider) GetIP() (net.IP, error) {
+	return provider.ip, provider.err
+}
+
+// testDNSCreator keeps the address records in memory.
+type testDNSCreator struct {
+	records map[string]net.IP
+	calls   int
+	err     error
+}
+
+func (creator *testDNSCreator) CreateSubdomain(domain, subdomain string, timeToLive int, ip net.IP) error {
+	creator.calls++
+	creator.records[subdomain+"."+domain] = ip
+	return nil
+}
+
+func (creator *testDNSCreator) UpdateSubdomain(domain, subdomain string, ip net.IP) error {
+	creator.calls++
+	if creator.err != nil {
+		return creator.err
+	}
+
+	current, exists := creator.records[subdomain+"."+domain]
+	if !exists {
+		return fmt.Errorf("No address record of type %q found for %q", "A", subdomain+"."+domain)
+	}
+
+	if current.Equal(ip) {
+		return fmt.Errorf("No update required. IP address did not change (%s).", ip)
+	}
+
+	creator.records[subdomain+"."+domain] = ip
+	return nil
+}
+
+// Update should create missing records, update changed ones and skip unchanged IPs.
+func Test_Updater_Update_RecordsFollowTheIP(t *testing.T) {
+	// arrange
+	ipProvider := &testIPProvider{ip: net.ParseIP("203.0.113.1")}
+	dns := &testDNSCreator{records: map[string]net.IP{"home.example.com": net.ParseIP("198.51.100.1")}}
+	updater := &Updater{
+		IPProvider: ipProvider,
+		DNS:        dns,
+		Records:    []Record{{Domain: "example.com", Subdomain: "home"}, {Domain: "example.net", Subdomain: "vpn"}},
+	}
+
+	// act
+	first, firstError := updater.Update()
+	callsAfterFirstPass := dns.calls
+	second, secondError := updater.Update()
+
+	// assert
+	if firstError != nil || secondError != nil {
+		t.Fatalf("Update returned an error: %v, %v", firstError, secondError)
+	}
+
+	if len(first) != 2 || !first[0].Changed || first[0].Created || !first[1].Created {
+		t.Fail()
+		t.Logf("The first pass should update home.example.com and create vpn.example.net: %v", first)
+	}
+
+	if len(second) != 0 || dns.calls != callsAfterFirstPass {
+		t.Fail()
+		t.Logf("The second pass should not touch the records because the IP did not change: %v", second)
+	}
+
+	if !dns.records["vpn.example.net"].Equal(ipProvider.ip) {
+		t.Fail()
+		t.Logf("vpn.example.net should point to %s: %v", ipProvider.ip, dns.records)
+	}
+}
+
+// Update should retry failed records on the next pass.
+func Test_Updater_Update_FailedRecordsAreRetried(t *testing.T) {
+	// arrange
+	dns := &testDNSCreator{records: map[string]net.IP{"home.example.com": net.ParseIP("198.51.100.1")}, err: fmt.Errorf("API error")}
+	updater := &Updater{
+		IPProvider: &testIPProvider{ip: net.ParseIP("203.0.113.1")},
+		DNS:        dns,
+		Records:    []Record{{Domain: "example.com", Subdomain: "home"}},
+	}
+
+	// act
+	first, _ := updater.Update()
+	dns.err = nil
+	second, _ := updater.Update()
+
+	// assert
+	if len(first) != 1 || first[0].Err == nil {
+		t.Fail()
+		t.Logf("The first pass should fail: %v", first)
+	}
+
+	if len(second) != 1 || !second[0].Changed || second[0].Err != nil {
+		t.Fail()
+		t.Logf("The second pass should update the record: %v", second)
+	}
+}
+
+// Update should return an error if the IP address cannot be detected.
+func Test_Updater_Update_IPProviderFails_ErrorIsReturned(t *testing.T) {
+	// arrange
+	updater := &Updater{
+		IPProvider: &testIPProvider{err: fmt.Errorf("network is unreachable")},
+		DNS:        &testDNSCreator{records: map[string]net.IP{}},
+		Records:    []Record{{Domain: "example.com", Subdomain: "home"}},
+	}
+
+	// act
+	_, err := updater.Update()
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("Update should return an error if the IP cannot be detected")
+	}
+}
+
+// Run should report the first pass and stop when the context is cancelled.
+func Test_Updater_Run_ContextCancelled_RunStops(t *testing.T) {
+	// arrange
+	reported := make(chan []Result, 1)
+	updater := &Updater{
+		IPProvider: &testIPProvider{ip: net.ParseIP("203.0.113.1")},
+		DNS:        &testDNSCreator{records: map[string]net.IP{}},
+		Records:    []Record{{Domain: "example.com", Subdomain: "home"}},
+		Interval:   time.Hour,
+		Report: func(results []Result, err error) {
+			reported <- results
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	// act
+	go func() { done <- updater.Run(ctx) }()
+	results := <-reported
+	cancel()
+
+	// assert
+	if len(results) != 1 || !results[0].Created {
+		t.Fail()
+		t.Logf("The first pass should have created the record: %v", results)
+	}
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fail()
+			t.Logf("Run should return the error of the context but returned %v", err)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run did not stop after the context was cancelled")
+	}
+}
+
+// The updater should work with the DNS editor of dee-ns and the DNSimple API.
+func Test_Updater_Update_DNSimpleEditor_RecordIsCreated(t *testing.T) {
+	// arrange
+	server := dnsimpletest.NewServer("john@example.com", "secret")
+	defer server.Close()
+
+	server.AddDomain("example.com")
+	client, _ := dnsimple.NewClient("john@example.com", "secret")
+	client.URL = server.URL()
+
+	updater := &Updater{
+		IPProvider: &testIPProvider{ip: net.ParseIP("203.0.113.1")},
+		DNS:        deens.NewDNSEditor(client, deens.NewDNSInfoProvider(client)),
+		Records:    []Record{{Domain: "example.com", Subdomain: "home", TTL: 60}},
+	}
+
+	// act
+	results, err := updater.Update()
+
+	// assert
+	if err != nil || len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("Update should create the record but returned %v (%v)", results, err)
+	}
+
+	records := server.Records("example.com")
+	if len(records) != 1 || records[0].Name != "home" || records[0].Content != "203.0.113.1" || records[0].Ttl != 60 {
+		t.Fail()
+		t.Logf("The server should contain the created record: %#v", records)
+	}
+}
+
+// The error matchers should recognize the errors of the DNS editor of dee-ns.
+func Test_IsUnchangedError_IsNotFoundError_DNSimpleEditorErrorsAreRecognized(t *testing.T) {
+	// arrange
+	server := dnsimpletest.NewServer("john@example.com", "secret")
+	defer server.Close()
+
+	server.AddDomain("example.com")
+	client, _ := dnsimple.NewClient("john@example.com", "secret")
+	client.URL = server.URL()
+	editor := deens.NewDNSEditor(client, deens.NewDNSInfoProvider(client))
+
+	// act
+	notFoundError := editor.UpdateSubdomain("example.com", "home", net.ParseIP("203.0.113.1"))
+	editor.CreateSubdomain("example.com", "home", 60, net.ParseIP("203.0.113.1"))
+	unchangedError := editor.UpdateSubdomain("example.com", "home", net.ParseIP("203.0.113.1"))
+
+	// assert
+	if !IsNotFoundError(notFoundError) || IsUnchangedError(notFoundError) {
+		t.Fail()
+		t.Logf("The error of a missing record should be recognized: %v", notFoundError)
+	}
+
+	if !IsUnchangedError(unchangedError) || IsNotFoundError(unchangedError) {
+		t.Fail()
+		t.Logf("The error of an unchanged record should be recognized: %v", unchangedError)
+	}
+
+	if IsUnchangedError(nil) || IsNotFoundError(nil) {
+		t.Fail()
+		t.Logf("nil should not be recognized as an error")
+	}
+}
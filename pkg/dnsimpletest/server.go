@@ -0,0 +1,382 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dnsimpletest provides a fake DNSimple API (v1) server for
+// integration tests. It stores domains and records in memory, checks
+// the API credentials of every request and can simulate rate limits.
+//
+//	server := dnsimpletest.NewServer("john@example.com", "secret")
+//	defer server.Close()
+//
+//	server.AddDomain("example.com")
+//	client, _ := dnsimple.NewClient("john@example.com", "secret")
+//	client.URL = server.URL()
+package dnsimpletest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTTL is the TTL of records that are created without a TTL.
+const defaultTTL = 3600
+
+// Server is a fake DNSimple API server.
+type Server struct {
+	server *httptest.Server
+
+	email string
+	token string
+
+	lock        sync.Mutex
+	domains     map[string][]dnsimple.Record
+	nextID      int64
+	requests    int
+	notModified int
+
+	rateLimit       int
+	rateLimitWindow time.Duration
+	windowStart     time.Time
+	windowRequests  int
+	now             func() time.Time
+}
+
+// NewServer starts a fake DNSimple API server that accepts
+// the given email address and API token.
+func NewServer(email, token string) *Server {
+	server := &Server{
+		email:   email,
+		token:   token,
+		domains: make(map[string][]dnsimple.Record),
+		nextID:  1,
+		now:     time.Now,
+	}
+
+	server.server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+	return server
+}
+
+// URL returns the base URL of the API (e.g. "http://127.0.0.1:4711/v1").
+// Assign it to the URL field of a dnsimple.Client.
+func (server *Server) URL() string {
+	return server.server.URL + "/v1"
+}
+
+// Close shuts the server down.
+func (server *Server) Close() {
+	server.server.Close()
+}
+
+// AddDomain adds an empty domain to the account.
+func (server *Server) AddDomain(name string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	if _, exists := server.domains[name]; !exists {
+		server.domains[name] = []dnsimple.Record{}
+	}
+}
+
+// AddRecord adds the given record to the given domain (which is created if
+// it does not exist yet) and returns the record with its assigned ID.
+func (server *Server) AddRecord(domain string, record dnsimple.Record) dnsimple.Record {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	record.Id = server.nextID
+	server.nextID++
+
+	if record.Ttl == 0 {
+		record.Ttl = defaultTTL
+	}
+
+	server.domains[domain] = append(server.domains[domain], record)
+	return record
+}
+
+// Records returns a copy of the records of the given domain.
+func (server *Server) Records(domain string) []dnsimple.Record {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	records := make([]dnsimple.Record, len(server.domains[domain]))
+	copy(records, server.domains[domain])
+	return records
+}
+
+// Requests returns the number of requests the server has received.
+func (server *Server) Requests() int {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	return server.requests
+}
+
+// NotModified returns the number of conditional requests the server
+// has answered with "304 Not Modified".
+func (server *Server) NotModified() int {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	return server.notModified
+}
+
+// SetRateLimit limits the number of requests per time window. Requests above
+// the limit are answered with "429 Too Many Requests". A limit of 0 disables
+// the rate limit.
+func (server *Server) SetRateLimit(requests int, window time.Duration) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.rateLimit = requests
+	server.rateLimitWindow = window
+	server.windowStart = server.now()
+	server.windowRequests = 0
+}
+
+func (server *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.requests++
+
+	if r.Header.Get("X-DNSimple-Token") != server.email+":"+server.token {
+		writeError(w, http.StatusUnauthorized, "Authentication failed")
+		return
+	}
+
+	if !server.allowRequest(w) {
+		writeError(w, http.StatusTooManyRequests, "API rate limit exceeded")
+		return
+	}
+
+	// e.g. ["domains", "example.com", "records", "12"]
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1"), "/"), "/")
+	if segments[0] != "domains" {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	switch {
+	case len(segments) == 1 && r.Method == "GET":
+		server.getDomains(w, r)
+
+	case len(segments) == 3 && segments[2] == "records" && r.Method == "GET":
+		server.getRecords(w, r, segments[1])
+
+	case len(segments) == 3 && segments[2] == "records" && r.Method == "POST":
+		server.createRecord(w, r, segments[1])
+
+	case len(segments) == 4 && segments[2] == "records":
+		server.changeRecord(w, r, segments[1], segments[3])
+
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// allowRequest counts the request against the rate limit and sets the
+// rate limit headers. It returns false if the limit is exceeded.
+func (server *Server) allowRequest(w http.ResponseWriter) bool {
+	if server.rateLimit <= 0 {
+		return true
+	}
+
+	now := server.now()
+	if now.Sub(server.windowStart) >= server.rateLimitWindow {
+		server.windowStart = now
+		server.windowRequests = 0
+	}
+
+	server.windowRequests++
+
+	remaining := server.rateLimit - server.windowRequests
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(server.rateLimit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(server.windowStart.Add(server.rateLimitWindow).Unix(), 10))
+
+	return server.windowRequests <= server.rateLimit
+}
+
+func (server *Server) getDomains(w http.ResponseWriter, r *http.Request) {
+	var names []string
+	for name := range server.domains {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	response := []dnsimple.DomainResponse{}
+	for index, name := range names {
+		response = append(response, dnsimple.DomainResponse{Domain: dnsimple.Domain{
+			Id:          index + 1,
+			Name:        name,
+			UnicodeName: name,
+			State:       "hosted",
+			RecordCount: len(server.domains[name]),
+		}})
+	}
+
+	server.writeCacheableJSON(w, r, response)
+}
+
+func (server *Server) getRecords(w http.ResponseWriter, r *http.Request, domain string) {
+	records, exists := server.domains[domain]
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Domain %q not found", domain))
+		return
+	}
+
+	response := []dnsimple.RecordResponse{}
+	for _, record := range records {
+		response = append(response, dnsimple.RecordResponse{Record: record})
+	}
+
+	server.writeCacheableJSON(w, r, response)
+}
+
+// recordParameters are the request parameters of the create and update requests.
+type recordParameters struct {
+	Name       *string `json:"name"`
+	RecordType *string `json:"record_type"`
+	Content    *string `json:"content"`
+	TTL        *int64  `json:"ttl"`
+}
+
+func (server *Server) createRecord(w http.ResponseWriter, r *http.Request, domain string) {
+	if _, exists := server.domains[domain]; !exists {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Domain %q not found", domain))
+		return
+	}
+
+	var parameters recordParameters
+	if decodeError := json.NewDecoder(r.Body).Decode(&parameters); decodeError != nil {
+		writeError(w, http.StatusBadRequest, decodeError.Error())
+		return
+	}
+
+	if parameters.RecordType == nil || *parameters.RecordType == "" || parameters.Content == nil {
+		writeError(w, http.StatusBadRequest, "The record type and content are required")
+		return
+	}
+
+	record := dnsimple.Record{Id: server.nextID, RecordType: *parameters.RecordType, Content: *parameters.Content, Ttl: defaultTTL}
+	server.nextID++
+
+	if parameters.Name != nil {
+		record.Name = *parameters.Name
+	}
+
+	if parameters.TTL != nil {
+		record.Ttl = *parameters.TTL
+	}
+
+	server.domains[domain] = append(server.domains[domain], record)
+	writeJSON(w, http.StatusCreated, dnsimple.RecordResponse{Record: record})
+}
+
+// changeRecord returns, updates or deletes the record with the given ID.
+// Updates only change the given fields, like the DNSimple API.
+func (server *Server) changeRecord(w http.ResponseWriter, r *http.Request, domain, id string) {
+	records := server.domains[domain]
+
+	index := -1
+	for recordIndex, record := range records {
+		if strconv.FormatInt(record.Id, 10) == id {
+			index = recordIndex
+		}
+	}
+
+	if index < 0 {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Record %s not found", id))
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, dnsimple.RecordResponse{Record: records[index]})
+
+	case "PUT":
+		var parameters recordParameters
+		if decodeError := json.NewDecoder(r.Body).Decode(&parameters); decodeError != nil {
+			writeError(w, http.StatusBadRequest, decodeError.Error())
+			return
+		}
+
+		record := &records[index]
+		if parameters.Name != nil {
+			record.Name = *parameters.Name
+		}
+
+		if parameters.RecordType != nil {
+			record.RecordType = *parameters.RecordType
+		}
+
+		if parameters.Content != nil {
+			record.Content = *parameters.Content
+		}
+
+		if parameters.TTL != nil {
+			record.Ttl = *parameters.TTL
+		}
+
+		writeJSON(w, http.StatusOK, dnsimple.RecordResponse{Record: *record})
+
+	case "DELETE":
+		server.domains[domain] = append(records[:index:index], records[index+1:]...)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeCacheableJSON writes the given listing with an ETag validator. A
+// conditional request whose If-None-Match header matches the ETag is
+// answered with "304 Not Modified" and no body.
+func (server *Server) writeCacheableJSON(w http.ResponseWriter, r *http.Request, value interface{}) {
+	body := new(bytes.Buffer)
+	json.NewEncoder(body).Encode(value)
+
+	etag := fmt.Sprintf("\"%x\"", sha1.Sum(body.Bytes()))
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		server.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+// writeError writes an error in the format of the DNSimple API.
+func writeError(w http.ResponseWriter, status int, text string) {
+	writeJSON(w, status, map[string]interface{}{
+		"message": text,
+		"errors":  map[string][]string{"base": {text}},
+	})
+}
@@ -0,0 +1,157 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsimpletest
+
+import (
+	"github.com/pearkes/dnsimple"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getTestClient returns a DNSimple client for the given server.
+func getTestClient(server *Server, token string) *dnsimple.Client {
+	client, _ := dnsimple.NewClient("john@example.com", token)
+	client.URL = server.URL()
+	return client
+}
+
+// The server should create, update and delete records like the DNSimple API.
+func Test_Server_RecordLifecycle_RecordsAreStored(t *testing.T) {
+	// arrange
+	server := NewServer("john@example.com", "secret")
+	defer server.Close()
+
+	server.AddDomain("example.com")
+	client := getTestClient(server, "secret")
+
+	// act
+	id, createError := client.CreateRecord("example.com", &dnsimple.ChangeRecord{Name: "www", Type: "A", Value: "203.0.113.1", Ttl: "600"})
+	_, updateError := client.UpdateRecord("example.com", id, &dnsimple.ChangeRecord{Value: "203.0.113.2"})
+	records, getError := client.GetRecords("example.com")
+
+	// assert
+	if createError != nil || updateError != nil || getError != nil {
+		t.Fatalf("The requests should succeed (%v, %v, %v)", createError, updateError, getError)
+	}
+
+	if len(records) != 1 || records[0].Content != "203.0.113.2" || records[0].Ttl != 600 || records[0].Name != "www" {
+		t.Fail()
+		t.Logf("The update should only change the content but the records are %#v", records)
+	}
+
+	if destroyError := client.DestroyRecord("example.com", id); destroyError != nil || len(server.Records("example.com")) != 0 {
+		t.Fail()
+		t.Logf("The record should have been deleted (%v)", destroyError)
+	}
+}
+
+// The server should reject requests with invalid credentials.
+func Test_Server_InvalidToken_RequestIsRejected(t *testing.T) {
+	// arrange
+	server := NewServer("john@example.com", "secret")
+	defer server.Close()
+
+	server.AddDomain("example.com")
+	client := getTestClient(server, "wrong")
+
+	// act
+	_, err := client.CreateRecord("example.com", &dnsimple.ChangeRecord{Type: "A", Value: "203.0.113.1"})
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fail()
+		t.Logf("CreateRecord should fail with 401 Unauthorized but returned %v", err)
+	}
+}
+
+// The server should reject requests above the rate limit until the window has passed.
+func Test_Server_RateLimit_RequestsAboveTheLimitAreRejected(t *testing.T) {
+	// arrange
+	now := time.Date(2016, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	server := NewServer("john@example.com", "secret")
+	defer server.Close()
+
+	server.now = func() time.Time { return now }
+	server.AddDomain("example.com")
+	server.SetRateLimit(2, time.Hour)
+	client := getTestClient(server, "secret")
+
+	create := func() error {
+		_, err := client.CreateRecord("example.com", &dnsimple.ChangeRecord{Type: "A", Value: "203.0.113.1"})
+		return err
+	}
+
+	// act
+	first, second, third := create(), create(), create()
+	now = now.Add(time.Hour)
+	fourth := create()
+
+	// assert
+	if first != nil || second != nil || fourth != nil {
+		t.Fail()
+		t.Logf("The requests within the limit should succeed (%v, %v, %v)", first, second, fourth)
+	}
+
+	if third == nil || !strings.Contains(third.Error(), "429") {
+		t.Fail()
+		t.Logf("The third request should fail with 429 Too Many Requests but returned %v", third)
+	}
+
+	if server.Requests() != 4 {
+		t.Fail()
+		t.Logf("The server should have received 4 requests but received %d", server.Requests())
+	}
+}
+
+// The server should answer conditional requests for unchanged listings with "304 Not Modified".
+func Test_Server_ConditionalRequest_UnchangedRecordsAreNotSentAgain(t *testing.T) {
+	// arrange
+	server := NewServer("john@example.com", "secret")
+	defer server.Close()
+
+	server.AddDomain("example.com")
+	server.AddRecord("example.com", dnsimple.Record{Name: "www", RecordType: "A", Content: "203.0.113.1"})
+
+	get := func(etag string) *http.Response {
+		request, _ := http.NewRequest("GET", server.URL()+"/domains/example.com/records", nil)
+		request.Header.Set("X-DNSimple-Token", "john@example.com:secret")
+		if etag != "" {
+			request.Header.Set("If-None-Match", etag)
+		}
+
+		response, responseError := http.DefaultClient.Do(request)
+		if responseError != nil {
+			t.Fatalf("The request should succeed: %s", responseError.Error())
+		}
+
+		response.Body.Close()
+		return response
+	}
+
+	// act
+	first := get("")
+	unchanged := get(first.Header.Get("ETag"))
+	server.AddRecord("example.com", dnsimple.Record{Name: "mail", RecordType: "A", Content: "203.0.113.2"})
+	changed := get(first.Header.Get("ETag"))
+
+	// assert
+	if first.StatusCode != http.StatusOK || first.Header.Get("ETag") == "" {
+		t.Fail()
+		t.Logf("The first response should contain an ETag (status %d)", first.StatusCode)
+	}
+
+	if unchanged.StatusCode != http.StatusNotModified || server.NotModified() != 1 {
+		t.Fail()
+		t.Logf("The unchanged records should not be sent again (status %d)", unchanged.StatusCode)
+	}
+
+	if changed.StatusCode != http.StatusOK || changed.Header.Get("ETag") == first.Header.Get("ETag") {
+		t.Fail()
+		t.Logf("The changed records should be sent with a new ETag (status %d)", changed.StatusCode)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"path"
+	"strings"
+)
+
+// profileConfig is a named account of the "profiles"
+// section of the configuration file (e.g. "personal").
+type profileConfig struct {
+	// CredentialsFrom is the credential source of the profile
+	// (e.g. "vault://secret/data/dee-personal"). The -credentials-from
+	// option takes precedence.
+	CredentialsFrom string `json:"credentials_from"`
+
+	// AllowedDomains are the domains or domain patterns (e.g. "*.example.com")
+	// whose records the profile may change. If empty all domains may be changed.
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+// profileProvider returns the active profile.
+type profileProvider interface {
+	// GetProfile returns the name and settings of the active
+	// profile. The name is empty if no profile is active.
+	GetProfile() (string, profileConfig, error)
+}
+
+// configProfileProvider reads the profile that is selected with -profile
+// (or DEE_PROFILE) from the "profiles" section of the configuration file.
+type configProfileProvider struct {
+	config *configFile
+	name   *string
+	getenv func(key string) string
+}
+
+// GetProfile returns the selected profile or an error if the
+// configuration file does not contain a profile with the selected name.
+func (provider configProfileProvider) GetProfile() (string, profileConfig, error) {
+	name := ""
+	if provider.name != nil {
+		name = strings.TrimSpace(*provider.name)
+	}
+
+	if name == "" && provider.getenv != nil {
+		name = strings.TrimSpace(provider.getenv("DEE_PROFILE"))
+	}
+
+	if name == "" {
+		return "", profileConfig{}, nil
+	}
+
+	settings, exists, configError := provider.config.Load()
+	if configError != nil {
+		return "", profileConfig{}, configError
+	}
+
+	if !exists {
+		return "", profileConfig{}, fmt.Errorf("There is no configuration file at %q", provider.config.filePath)
+	}
+
+	profile, exists := settings.Profiles[name]
+	if !exists {
+		return "", profileConfig{}, fmt.Errorf("Unknown profile %q", name)
+	}
+
+	return name, profile, nil
+}
+
+// profileCredentialProvider returns the credentials of the credential
+// source of the active profile, unless -credentials-from is given.
+type profileCredentialProvider struct {
+	profiles profileProvider
+	source   *string
+	registry credentialSourceRegistry
+	fallback deens.CredentialProvider
+}
+
+// GetCredentials returns the credentials of the selected credential source.
+func (provider profileCredentialProvider) GetCredentials() (deens.APICredentials, error) {
+	source := ""
+	if provider.source != nil {
+		source = *provider.source
+	}
+
+	if isEmpty(source) {
+		_, profile, profileError := provider.profiles.GetProfile()
+		if profileError != nil {
+			return deens.APICredentials{}, profileError
+		}
+
+		source = profile.CredentialsFrom
+	}
+
+	return sourcedCredentialProvider{&source, provider.registry, provider.fallback}.GetCredentials()
+}
+
+// guardedClientFactory creates DNS clients that refuse to change
+// domains that are not allowed by the active profile.
+type guardedClientFactory struct {
+	clientFactory dnsClientFactory
+	profiles      profileProvider
+}
+
+// CreateClient creates a DNS client for the active profile.
+func (factory guardedClientFactory) CreateClient() (deens.DNSClient, error) {
+	name, profile, profileError := factory.profiles.GetProfile()
+	if profileError != nil {
+		return nil, profileError
+	}
+
+	client, clientError := factory.clientFactory.CreateClient()
+	if clientError != nil {
+		return nil, clientError
+	}
+
+	if len(profile.AllowedDomains) == 0 {
+		return client, nil
+	}
+
+	return guardedDNSClient{client, name, profile.AllowedDomains}, nil
+}
+
+// guardedDNSClient checks the domain of every change against
+// the allowed domains of a profile before the change is made.
+type guardedDNSClient struct {
+	client         deens.DNSClient
+	profile        string
+	allowedDomains []string
+}
+
+// GetRecords returns the DNS records of the given domain.
+func (client guardedDNSClient) GetRecords(domain string) ([]dnsimple.Record, error) {
+	return client.client.GetRecords(domain)
+}
+
+// GetDomains returns all domains.
+func (client guardedDNSClient) GetDomains() ([]dnsimple.Domain, error) {
+	return client.client.GetDomains()
+}
+
+// CreateRecord creates the given record if the domain is allowed.
+func (client guardedDNSClient) CreateRecord(domain string, opts *dnsimple.ChangeRecord) (string, error) {
+	if guardError := client.checkDomain(domain); guardError != nil {
+		return "", guardError
+	}
+
+	return client.client.CreateRecord(domain, opts)
+}
+
+// UpdateRecord updates the given record if the domain is allowed.
+func (client guardedDNSClient) UpdateRecord(domain string, id string, opts *dnsimple.ChangeRecord) (string, error) {
+	if guardError := client.checkDomain(domain); guardError != nil {
+		return "", guardError
+	}
+
+	return client.client.UpdateRecord(domain, id, opts)
+}
+
+// DestroyRecord deletes the given record if the domain is allowed.
+func (client guardedDNSClient) DestroyRecord(domain string, id string) error {
+	if guardError := client.checkDomain(domain); guardError != nil {
+		return guardError
+	}
+
+	return client.client.DestroyRecord(domain, id)
+}
+
+// checkDomain returns an error if the profile may not change the given domain.
+func (client guardedDNSClient) checkDomain(domain string) error {
+	if isDomainAllowed(domain, client.allowedDomains) {
+		return nil
+	}
+
+	return fmt.Errorf("The profile %q is not allowed to change %s (allowed_domains: %s)", client.profile, domain, strings.Join(client.allowedDomains, ", "))
+}
+
+// isDomainAllowed returns true if the given domain matches one of
+// the given domains or domain patterns (e.g. "*.example.com").
+func isDomainAllowed(domain string, allowedDomains []string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	for _, allowed := range allowedDomains {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == domain {
+			return true
+		}
+
+		if matches, _ := path.Match(allowed, domain); matches {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,168 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"net/url"
+	"testing"
+)
+
+// getTestProfileProvider returns a provider for the profiles of the given configuration file.
+func getTestProfileProvider(config, name string, environment map[string]string) configProfileProvider {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/user/.dee/config.json", []byte(config), 0600)
+	return configProfileProvider{newConfigFile(fs, configDecrypter{}, "/home/user/.dee/config.json"), &name, getTestEnvironment(environment)}
+}
+
+const testProfilesConfig = `{
+  "profiles": {
+    "personal": {"credentials_from": "test://personal", "allowed_domains": ["example.com", "*.example.org"]},
+    "work": {"credentials_from": "test://work"}
+  }
+}`
+
+// A profile should not be able to change domains that are not in its allowed_domains.
+func Test_guardedClientFactory_DomainNotAllowed_ChangeIsRefused(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com":   {{Id: 1, Name: "www", RecordType: "A", Content: "203.0.113.1"}},
+		"example.net":   {{Id: 2, Name: "www", RecordType: "A", Content: "203.0.113.2"}},
+		"a.example.org": {},
+	}
+
+	factory := guardedClientFactory{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, getTestProfileProvider(testProfilesConfig, "personal", nil)}
+	client, clientError := factory.CreateClient()
+	if clientError != nil {
+		t.Fatalf("CreateClient should succeed: %s", clientError.Error())
+	}
+
+	// act
+	_, allowedError := client.UpdateRecord("example.com", "1", &dnsimple.ChangeRecord{Value: "203.0.113.9"})
+	_, patternError := client.CreateRecord("a.example.org", &dnsimple.ChangeRecord{Name: "www", Type: "A", Value: "203.0.113.9"})
+	_, refusedUpdateError := client.UpdateRecord("example.net", "2", &dnsimple.ChangeRecord{Value: "203.0.113.9"})
+	refusedDeleteError := client.DestroyRecord("example.net", "2")
+	_, readError := client.GetRecords("example.net")
+
+	// assert
+	if allowedError != nil || patternError != nil {
+		t.Fail()
+		t.Logf("The allowed domains should be changed (%v, %v)", allowedError, patternError)
+	}
+
+	if refusedUpdateError == nil || refusedDeleteError == nil {
+		t.Fail()
+		t.Logf("The changes of example.net should be refused")
+	}
+
+	if records["example.net"][0].Content != "203.0.113.2" || len(records["example.net"]) != 1 {
+		t.Fail()
+		t.Logf("The record of example.net should not have been changed: %#v", records["example.net"])
+	}
+
+	if readError != nil {
+		t.Fail()
+		t.Logf("Reading the records of other domains should be allowed: %s", readError.Error())
+	}
+}
+
+// Without an active profile or without allowed_domains all domains should be changeable.
+func Test_guardedClientFactory_NoAllowList_ClientIsNotGuarded(t *testing.T) {
+	for _, name := range []string{"", "work"} {
+		// arrange
+		client := newInMemoryTestDNSClient(map[string][]dnsimple.Record{})
+		factory := guardedClientFactory{testDNSClientFactory{client, nil}, getTestProfileProvider(testProfilesConfig, name, nil)}
+
+		// act
+		result, err := factory.CreateClient()
+
+		// assert
+		if err != nil {
+			t.Fail()
+			t.Logf("CreateClient should succeed for the profile %q: %s", name, err.Error())
+			continue
+		}
+
+		if _, isGuarded := result.(guardedDNSClient); isGuarded {
+			t.Fail()
+			t.Logf("The client of the profile %q should not be guarded", name)
+		}
+	}
+}
+
+// An unknown profile should result in an error instead of an unrestricted client.
+func Test_guardedClientFactory_UnknownProfile_ErrorIsReturned(t *testing.T) {
+	// arrange
+	factory := guardedClientFactory{testDNSClientFactory{newInMemoryTestDNSClient(nil), nil}, getTestProfileProvider(testProfilesConfig, "", map[string]string{"DEE_PROFILE": "wrok"})}
+
+	// act
+	_, err := factory.CreateClient()
+
+	// assert
+	if err == nil {
+		t.Fail()
+		t.Logf("CreateClient should fail for an unknown profile")
+	}
+}
+
+// The credentials should be read from the credential source of the profile unless -credentials-from is given.
+func Test_profileCredentialProvider_CredentialSourceOfTheProfileIsUsed(t *testing.T) {
+	// arrange
+	registry := credentialSourceRegistry{
+		"test": func(location *url.URL) (deens.CredentialProvider, error) {
+			return testCredentialProvider{deens.APICredentials{Email: "john@example.com", Token: location.Host + "-token"}, nil}, nil
+		},
+	}
+
+	fallback := testCredentialProvider{deens.APICredentials{}, fmt.Errorf("The fallback should not be used")}
+	profiles := getTestProfileProvider(testProfilesConfig, "work", nil)
+
+	noSource, explicitSource := "", "test://explicit"
+
+	// act
+	profileCredentials, profileError := profileCredentialProvider{profiles, &noSource, registry, fallback}.GetCredentials()
+	explicitCredentials, explicitError := profileCredentialProvider{profiles, &explicitSource, registry, fallback}.GetCredentials()
+
+	// assert
+	if profileError != nil || profileCredentials.Token != "work-token" {
+		t.Fail()
+		t.Logf("The credentials of the profile should be used but GetCredentials() returned %+v (error: %v)", profileCredentials, profileError)
+	}
+
+	if explicitError != nil || explicitCredentials.Token != "explicit-token" {
+		t.Fail()
+		t.Logf("-credentials-from should take precedence but GetCredentials() returned %+v (error: %v)", explicitCredentials, explicitError)
+	}
+}
+
+func Test_isDomainAllowed(t *testing.T) {
+	inputs := []struct {
+		domain   string
+		allowed  []string
+		expected bool
+	}{
+		{"example.com", []string{"example.com"}, true},
+		{"Example.COM.", []string{"example.com"}, true},
+		{"www.example.com", []string{"example.com"}, false},
+		{"shop.example.org", []string{"example.com", "*.example.org"}, true},
+		{"example.org", []string{"*.example.org"}, false},
+		{"example.net", []string{"example.*"}, true},
+		{"example.net", nil, false},
+	}
+
+	for _, input := range inputs {
+		// act
+		result := isDomainAllowed(input.domain, input.allowed)
+
+		// assert
+		if result != input.expected {
+			t.Fail()
+			t.Logf("isDomainAllowed(%q, %q) should return %t but returned %t", input.domain, input.allowed, input.expected, result)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultDNSProvider is the DNS provider that is used if none is configured.
+const defaultDNSProvider = "dnsimple"
+
+// dnsClientFactory provides the ability to create DNS clients. The actions,
+// the daemon and the DNS editor only work with the clients of this interface;
+// configDNSProviderFactory creates them for the DNS provider of the configuration.
+type dnsClientFactory interface {
+	// CreateClient create a new dnsClient client instance.
+	CreateClient() (deens.DNSClient, error)
+}
+
+// dnsRecord is a DNS record independent of the API of a DNS provider.
+type dnsRecord struct {
+	// ID identifies the record at the provider.
+	ID string
+
+	// Name is the name relative to the domain (empty for the domain itself).
+	Name string
+
+	Type     string
+	Content  string
+	TTL      int
+	Priority int
+}
+
+// dnsDomain is a domain of the account at a DNS provider.
+type dnsDomain struct {
+	Name string
+
+	// ExpiresOn is the expiry date of the registration (e.g. "2016-03-10";
+	// empty if the domain is not registered with the provider).
+	ExpiresOn string
+}
+
+// dnsProvider is the interface of all DNS providers (e.g. dnsimpleProvider).
+// Providers only implement the operations of their API; the journal, the
+// profiles and the naming policy apply to all providers alike.
+type dnsProvider interface {
+	// GetDomains returns the domains of the account.
+	GetDomains() ([]dnsDomain, error)
+
+	// GetRecords returns the records of the given domain.
+	GetRecords(domain string) ([]dnsRecord, error)
+
+	// CreateRecord creates the given record and returns its ID.
+	CreateRecord(domain string, record dnsRecord) (string, error)
+
+	// UpdateRecord changes the record with the given ID. Only the
+	// non-empty fields of the given record are changed.
+	UpdateRecord(domain, id string, record dnsRecord) error
+
+	// DeleteRecord deletes the record with the given ID.
+	DeleteRecord(domain, id string) error
+}
+
+// dnsProviderConfig selects the DNS provider (the "provider"
+// section of the configuration file).
+type dnsProviderConfig struct {
+	// Name is the name of the provider (default: "dnsimple").
+	Name string `json:"name"`
+
+	// APIURL replaces the URL of the API of the provider (optional).
+	APIURL string `json:"api_url"`
+}
+
+// dnsProviderFactory creates a DNS provider with the given settings.
+type dnsProviderFactory func(settings dnsProviderConfig) (dnsProvider, error)
+
+// dnsProviderRegistry maps the names of DNS providers (e.g. "dnsimple") to their factories.
+type dnsProviderRegistry map[string]dnsProviderFactory
+
+// newDNSProviderRegistry creates a registry that contains all built-in DNS providers.
+// The API URL of DNSimple can be replaced with the given default API URL
+// (e.g. the URL of a dnsimpletest server).
+func newDNSProviderRegistry(credentialProvider deens.CredentialProvider, httpClient *sharedHTTPClient, defaultAPIURL string) dnsProviderRegistry {
+	return dnsProviderRegistry{
+		"dnsimple": func(settings dnsProviderConfig) (dnsProvider, error) {
+			apiURL := defaultAPIURL
+			if settings.APIURL != "" {
+				apiURL = settings.APIURL
+			}
+
+			client, clientError := dnsimpleClientFactory{credentialProvider, httpClient, apiURL}.CreateClient()
+			if clientError != nil {
+				return nil, clientError
+			}
+
+			return dnsimpleProvider{client}, nil
+		},
+	}
+}
+
+// Register adds the given DNS provider to the registry.
+func (registry dnsProviderRegistry) Register(name string, factory dnsProviderFactory) {
+	registry[name] = factory
+}
+
+// Names returns the sorted names of all registered DNS providers.
+func (registry dnsProviderRegistry) Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// GetProvider returns the DNS provider of the given settings.
+func (registry dnsProviderRegistry) GetProvider(settings dnsProviderConfig) (dnsProvider, error) {
+	name := strings.ToLower(strings.TrimSpace(settings.Name))
+	if name == "" {
+		name = defaultDNSProvider
+	}
+
+	factory, exists := registry[name]
+	if !exists {
+		return nil, fmt.Errorf("Unknown DNS provider %q (available: %s)", name, strings.Join(registry.Names(), ", "))
+	}
+
+	return factory(settings)
+}
+
+// configDNSProviderFactory creates the clients of the DNS provider that is
+// selected with -provider, the DEE_PROVIDER environment variable or the
+// "provider" section of the configuration file (in this order).
+type configDNSProviderFactory struct {
+	registry dnsProviderRegistry
+	config   *configFile
+
+	// name is the value of the -provider option.
+	name   *string
+	getenv func(key string) string
+}
+
+// CreateClient creates a client of the selected DNS provider.
+func (factory configDNSProviderFactory) CreateClient() (deens.DNSClient, error) {
+	settings, settingsError := factory.getSettings()
+	if settingsError != nil {
+		return nil, settingsError
+	}
+
+	provider, providerError := factory.registry.GetProvider(settings)
+	if providerError != nil {
+		return nil, providerError
+	}
+
+	return newProviderDNSClient(provider), nil
+}
+
+// getSettings returns the provider settings of the configuration file
+// with the name of the -provider option or the environment.
+func (factory configDNSProviderFactory) getSettings() (dnsProviderConfig, error) {
+	config, _, configError := factory.config.Load()
+	if configError != nil {
+		return dnsProviderConfig{}, configError
+	}
+
+	settings := config.Provider
+
+	name := ""
+	if factory.name != nil {
+		name = *factory.name
+	}
+
+	if name == "" && factory.getenv != nil {
+		name = factory.getenv("DEE_PROVIDER")
+	}
+
+	// the API URL of the configuration file belongs to the provider of the configuration file
+	configuredName := settings.Name
+	if configuredName == "" {
+		configuredName = defaultDNSProvider
+	}
+
+	if name != "" && !strings.EqualFold(name, configuredName) {
+		settings = dnsProviderConfig{}
+	}
+
+	if name != "" {
+		settings.Name = name
+	}
+
+	return settings, nil
+}
+
+// providerDNSClient adapts a DNS provider to the DNS client interface of
+// dee-ns, on which the actions are built. dee-ns identifies records by
+// numbers; other IDs of the provider are mapped to numbers with getNumericRecordID.
+type providerDNSClient struct {
+	provider dnsProvider
+
+	// ids maps the numeric IDs ("<domain>/<number>") to the IDs of the provider.
+	lock *sync.Mutex
+	ids  map[string]string
+}
+
+func newProviderDNSClient(provider dnsProvider) providerDNSClient {
+	return providerDNSClient{provider, &sync.Mutex{}, make(map[string]string)}
+}
+
+// GetDomains returns the domains of the provider.
+func (client providerDNSClient) GetDomains() ([]dnsimple.Domain, error) {
+	domains, domainsError := client.provider.GetDomains()
+	if domainsError != nil {
+		return nil, domainsError
+	}
+
+	var result []dnsimple.Domain
+	for _, domain := range domains {
+		result = append(result, dnsimple.Domain{Name: domain.Name, ExpiresOn: domain.ExpiresOn})
+	}
+
+	return result, nil
+}
+
+// GetRecords returns the records of the given domain.
+func (client providerDNSClient) GetRecords(domain string) ([]dnsimple.Record, error) {
+	records, recordsError := client.provider.GetRecords(domain)
+	if recordsError != nil {
+		return nil, recordsError
+	}
+
+	var result []dnsimple.Record
+	for _, record := range records {
+		result = append(result, dnsimple.Record{
+			Id:         client.remember(domain, record.ID),
+			Name:       record.Name,
+			RecordType: record.Type,
+			Content:    record.Content,
+			Ttl:        int64(record.TTL),
+			Prio:       int64(record.Priority),
+		})
+	}
+
+	return result, nil
+}
+
+// CreateRecord creates the given record and returns its numeric ID.
+func (client providerDNSClient) CreateRecord(domain string, opts *dnsimple.ChangeRecord) (string, error) {
+	record, recordError := getProviderRecord(opts)
+	if recordError != nil {
+		return "", recordError
+	}
+
+	id, createError := client.provider.CreateRecord(domain, record)
+	if createError != nil {
+		return "", createError
+	}
+
+	return strconv.FormatInt(client.remember(domain, id), 10), nil
+}
+
+// UpdateRecord changes the record with the given numeric ID.
+func (client providerDNSClient) UpdateRecord(domain string, id string, opts *dnsimple.ChangeRecord) (string, error) {
+	record, recordError := getProviderRecord(opts)
+	if recordError != nil {
+		return "", recordError
+	}
+
+	providerID, idError := client.getProviderID(domain, id)
+	if idError != nil {
+		return "", idError
+	}
+
+	if updateError := client.provider.UpdateRecord(domain, providerID, record); updateError != nil {
+		return "", updateError
+	}
+
+	return id, nil
+}
+
+// DestroyRecord deletes the record with the given numeric ID.
+func (client providerDNSClient) DestroyRecord(domain string, id string) error {
+	providerID, idError := client.getProviderID(domain, id)
+	if idError != nil {
+		return idError
+	}
+
+	return client.provider.DeleteRecord(domain, providerID)
+}
+
+// remember returns the numeric ID of the given record ID of the provider.
+func (client providerDNSClient) remember(domain, id string) int64 {
+	numericID := getNumericRecordID(id)
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	client.ids[domain+"/"+strconv.FormatInt(numericID, 10)] = id
+	return numericID
+}
+
+// getProviderID returns the ID of the provider for the given numeric ID.
+// Mapped IDs that the client has not seen yet (e.g. IDs given on the
+// command line) are looked up in the records of the domain.
+func (client providerDNSClient) getProviderID(domain, id string) (string, error) {
+	numericID, parseError := strconv.ParseInt(id, 10, 64)
+	if parseError != nil || numericID < mappedRecordIDs {
+		return id, nil
+	}
+
+	if providerID, exists := client.getKnownID(domain, id); exists {
+		return providerID, nil
+	}
+
+	if _, recordsError := client.GetRecords(domain); recordsError != nil {
+		return "", recordsError
+	}
+
+	if providerID, exists := client.getKnownID(domain, id); exists {
+		return providerID, nil
+	}
+
+	return "", fmt.Errorf("Record %s not found", id)
+}
+
+func (client providerDNSClient) getKnownID(domain, id string) (string, bool) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	providerID, exists := client.ids[domain+"/"+id]
+	return providerID, exists
+}
+
+// mappedRecordIDs is the first number that getNumericRecordID maps
+// non-numeric IDs to; smaller numbers are IDs of the provider.
+const mappedRecordIDs = int64(1) << 61
+
+// getNumericRecordID returns numeric IDs unchanged and maps other IDs
+// (e.g. UUIDs) to a stable number of at least mappedRecordIDs.
+func getNumericRecordID(id string) int64 {
+	if numericID, parseError := strconv.ParseInt(id, 10, 64); parseError == nil && numericID >= 0 && numericID < mappedRecordIDs {
+		return numericID
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(id))
+	return mappedRecordIDs | int64(hash.Sum64()>>3)
+}
+
+// getProviderRecord returns the given change as a record of the DNS provider interface.
+func getProviderRecord(change *dnsimple.ChangeRecord) (dnsRecord, error) {
+	record := dnsRecord{Name: change.Name, Type: change.Type, Content: change.Value}
+	if change.Ttl == "" {
+		return record, nil
+	}
+
+	ttl, parseError := strconv.Atoi(change.Ttl)
+	if parseError != nil {
+		return dnsRecord{}, fmt.Errorf("Invalid TTL %q", change.Ttl)
+	}
+
+	record.TTL = ttl
+	return record, nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"strings"
+	"testing"
+)
+
+// memoryTestDNSProvider is a DNS provider that stores the records in memory
+// and identifies them with non-numeric IDs (like the IDs of many DNS APIs).
+type memoryTestDNSProvider struct {
+	records map[string][]dnsRecord
+}
+
+func (provider memoryTestDNSProvider) GetDomains() ([]dnsDomain, error) {
+	var domains []dnsDomain
+	for name := range provider.records {
+		domains = append(domains, dnsDomain{Name: name})
+	}
+
+	return domains, nil
+}
+
+func (provider memoryTestDNSProvider) GetRecords(domain string) ([]dnsRecord, error) {
+	return provider.records[domain], nil
+}
+
+func (provider memoryTestDNSProvider) CreateRecord(domain string, record dnsRecord) (string, error) {
+	record.ID = fmt.Sprintf("rec-%d", len(provider.records[domain])+1)
+	provider.records[domain] = append(provider.records[domain], record)
+	return record.ID, nil
+}
+
+func (provider memoryTestDNSProvider) UpdateRecord(domain, id string, record dnsRecord) error {
+	for index, existing := range provider.records[domain] {
+		if existing.ID == id {
+			provider.records[domain][index].Content = record.Content
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Record %s not found", id)
+}
+
+func (provider memoryTestDNSProvider) DeleteRecord(domain, id string) error {
+	for index, existing := range provider.records[domain] {
+		if existing.ID == id {
+			provider.records[domain] = append(provider.records[domain][:index], provider.records[domain][index+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Record %s not found", id)
+}
+
+// getTestProviderFactory returns a factory for the DNS provider of the given configuration
+// file. The registry contains DNSimple and a test provider named "memory".
+func getTestProviderFactory(config, name string, environment map[string]string) configDNSProviderFactory {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/home/user/.dee/config.json", []byte(config), 0600)
+
+	credentials := testCredentialProvider{deens.APICredentials{Email: "john@example.com", Token: "secret"}, nil}
+	registry := newDNSProviderRegistry(credentials, nil, "")
+	registry.Register("memory", func(settings dnsProviderConfig) (dnsProvider, error) {
+		if settings.APIURL == "" {
+			return nil, fmt.Errorf("No API URL given")
+		}
+
+		return memoryTestDNSProvider{map[string][]dnsRecord{"example.com": {{"rec-www", "www", "A", "203.0.113.1", 600, 0}}}}, nil
+	})
+
+	return configDNSProviderFactory{registry, newConfigFile(fs, configDecrypter{}, "/home/user/.dee/config.json"), &name, getTestEnvironment(environment)}
+}
+
+// Without a provider setting the DNSimple API should be used.
+func Test_configDNSProviderFactory_NoProvider_DNSimpleIsUsed(t *testing.T) {
+	// arrange
+	factory := getTestProviderFactory(`{}`, "", nil)
+
+	// act
+	client, err := factory.CreateClient()
+
+	// assert
+	providerClient, isProviderClient := client.(providerDNSClient)
+	if err != nil || !isProviderClient {
+		t.Fatalf("CreateClient() should return a client of the DNS provider but returned %T (error: %v)", client, err)
+	}
+
+	if _, isDNSimple := providerClient.provider.(dnsimpleProvider); !isDNSimple {
+		t.Fail()
+		t.Logf("CreateClient() should return a client of DNSimple but returned %T", providerClient.provider)
+	}
+}
+
+// The provider of the configuration file should be used with its settings.
+func Test_configDNSProviderFactory_ConfiguredProvider_ProviderIsUsed(t *testing.T) {
+	// arrange
+	factory := getTestProviderFactory(`{"provider": {"name": "memory", "api_url": "http://localhost:8080"}}`, "", nil)
+
+	// act
+	client, err := factory.CreateClient()
+
+	// assert
+	providerClient, isProviderClient := client.(providerDNSClient)
+	if err != nil || !isProviderClient {
+		t.Fatalf("CreateClient() should return a client of the DNS provider but returned %T (error: %v)", client, err)
+	}
+
+	if _, isMemory := providerClient.provider.(memoryTestDNSProvider); !isMemory {
+		t.Fail()
+		t.Logf("CreateClient() should return a client of the configured provider but returned %T", providerClient.provider)
+	}
+}
+
+// Records of providers with non-numeric IDs should be changeable with the numeric IDs of the client.
+func Test_providerDNSClient_NonNumericIDs_RecordsAreChanged(t *testing.T) {
+	// arrange
+	provider := memoryTestDNSProvider{map[string][]dnsRecord{"example.com": {{"rec-www", "www", "A", "203.0.113.1", 600, 0}}}}
+	listingClient := newProviderDNSClient(provider)
+	changingClient := newProviderDNSClient(provider)
+
+	// act
+	records, recordsError := listingClient.GetRecords("example.com")
+	if recordsError != nil || len(records) != 1 {
+		t.Fatalf("GetRecords should return the record: %v (error: %v)", records, recordsError)
+	}
+
+	_, updateError := changingClient.UpdateRecord("example.com", records[0].StringId(), &dnsimple.ChangeRecord{Value: "203.0.113.2"})
+	id, createError := changingClient.CreateRecord("example.com", &dnsimple.ChangeRecord{Name: "api", Type: "A", Value: "203.0.113.3", Ttl: "60"})
+	destroyError := changingClient.DestroyRecord("example.com", id)
+
+	// assert
+	if updateError != nil || createError != nil || destroyError != nil {
+		t.Fatalf("The changes should succeed (errors: %v, %v, %v)", updateError, createError, destroyError)
+	}
+
+	expected := []dnsRecord{{"rec-www", "www", "A", "203.0.113.2", 600, 0}}
+	if len(provider.records["example.com"]) != 1 || provider.records["example.com"][0] != expected[0] {
+		t.Fail()
+		t.Logf("The record should have been updated and the created record deleted: %+v", provider.records["example.com"])
+	}
+}
+
+// The DNSimple adapter should convert the records of the DNSimple API.
+func Test_dnsimpleProvider_RecordsAreConverted(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "", RecordType: "MX", Content: "mail.example.com", Ttl: 3600, Prio: 10},
+		},
+	}
+
+	provider := dnsimpleProvider{newInMemoryTestDNSClient(records)}
+
+	// act
+	result, recordsError := provider.GetRecords("example.com")
+	id, createError := provider.CreateRecord("example.com", dnsRecord{Name: "www", Type: "A", Content: "203.0.113.1", TTL: 60})
+
+	// assert
+	if recordsError != nil || len(result) != 1 || result[0] != (dnsRecord{"1", "", "MX", "mail.example.com", 3600, 10}) {
+		t.Fail()
+		t.Logf("GetRecords should return the converted records: %+v (error: %v)", result, recordsError)
+	}
+
+	created := records["example.com"][1]
+	if createError != nil || id != created.StringId() || created.Name != "www" || created.Content != "203.0.113.1" || created.Ttl != 60 {
+		t.Fail()
+		t.Logf("CreateRecord should create the converted record: %+v (error: %v)", created, createError)
+	}
+}
+
+// -provider and DEE_PROVIDER should take precedence over the configuration file.
+func Test_configDNSProviderFactory_ProviderOption_TakesPrecedence(t *testing.T) {
+	// arrange
+	config := `{"provider": {"name": "memory", "api_url": "http://localhost:8080"}}`
+	option := getTestProviderFactory(config, "dnsimple", nil)
+	environment := getTestProviderFactory(config, "", map[string]string{"DEE_PROVIDER": "DNSimple"})
+
+	// act
+	optionSettings, optionError := option.getSettings()
+	environmentSettings, environmentError := environment.getSettings()
+
+	// assert
+	if optionError != nil || optionSettings != (dnsProviderConfig{Name: "dnsimple"}) {
+		t.Fail()
+		t.Logf("-provider should replace the provider of the configuration file but the settings are %+v (error: %v)", optionSettings, optionError)
+	}
+
+	if environmentError != nil || environmentSettings != (dnsProviderConfig{Name: "DNSimple"}) {
+		t.Fail()
+		t.Logf("DEE_PROVIDER should replace the provider of the configuration file but the settings are %+v (error: %v)", environmentSettings, environmentError)
+	}
+}
+
+// Unknown providers should be reported with the available providers.
+func Test_dnsProviderRegistry_GetProvider_UnknownProvider_ErrorIsReturned(t *testing.T) {
+	// arrange
+	factory := getTestProviderFactory(`{"provider": {"name": "route53"}}`, "", nil)
+
+	// act
+	_, err := factory.CreateClient()
+
+	// assert
+	if err == nil || !strings.Contains(err.Error(), "dnsimple, memory") {
+		t.Fail()
+		t.Logf("CreateClient() should report the available providers but returned %v", err)
+	}
+}
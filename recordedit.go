@@ -0,0 +1,225 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// editableRecord contains the fields of a record that "record edit" shows in the editor.
+type editableRecord struct {
+	Name    string
+	Type    string
+	Content string
+	TTL     int
+}
+
+// findEditableRecord returns the record with the given ID or, if no ID is given,
+// the only record with the given name (and type). An error is returned if the
+// name matches several records.
+func findEditableRecord(records []dnsimple.Record, domain, name, recordType string, id int64) (dnsimple.Record, error) {
+	var matches []dnsimple.Record
+	for _, record := range records {
+		if id > 0 {
+			if record.Id == id {
+				return record, nil
+			}
+
+			continue
+		}
+
+		if record.Name != name {
+			continue
+		}
+
+		if recordType != "" && !strings.EqualFold(record.RecordType, recordType) {
+			continue
+		}
+
+		matches = append(matches, record)
+	}
+
+	if id > 0 {
+		return dnsimple.Record{}, fmt.Errorf("The record %d of %s does not exist", id, domain)
+	}
+
+	if len(matches) == 0 {
+		return dnsimple.Record{}, fmt.Errorf("No record %s found", describeRecordSelection(domain, name, recordType))
+	}
+
+	if len(matches) > 1 {
+		var candidates []string
+		for _, match := range matches {
+			candidates = append(candidates, fmt.Sprintf("%s (ID %d)", match.RecordType, match.Id))
+		}
+
+		return dnsimple.Record{}, fmt.Errorf("%d records %s found: %s (use -type or -id)", len(matches), describeRecordSelection(domain, name, recordType), strings.Join(candidates, ", "))
+	}
+
+	return matches[0], nil
+}
+
+// describeRecordSelection returns a description of the records with the given name and type (e.g. "www.example.com TXT").
+func describeRecordSelection(domain, name, recordType string) string {
+	description := getFormattedDomainName(name, domain)
+	if recordType != "" {
+		description += " " + strings.ToUpper(recordType)
+	}
+
+	return description
+}
+
+// editRecordDocument writes the fields of the given record to a temporary file,
+// opens the file with the given editor and returns the saved fields.
+func editRecordDocument(record dnsimple.Record, domain string, editFile func(filePath string) error) (editableRecord, error) {
+	file, createError := ioutil.TempFile("", "dee-record-*.yaml")
+	if createError != nil {
+		return editableRecord{}, fmt.Errorf("Cannot create a temporary file: %s", createError.Error())
+	}
+
+	defer os.Remove(file.Name())
+
+	document := formatRecordDocument(record, domain)
+	_, writeError := file.Write(document)
+	file.Close()
+	if writeError != nil {
+		return editableRecord{}, fmt.Errorf("Cannot write %q: %s", file.Name(), writeError.Error())
+	}
+
+	if editError := editFile(file.Name()); editError != nil {
+		return editableRecord{}, fmt.Errorf("The editor failed: %s", editError.Error())
+	}
+
+	edited, readError := ioutil.ReadFile(file.Name())
+	if readError != nil {
+		return editableRecord{}, fmt.Errorf("Cannot read %q: %s", file.Name(), readError.Error())
+	}
+
+	return parseRecordDocument(edited)
+}
+
+// formatRecordDocument returns the fields of the given record as a YAML document.
+func formatRecordDocument(record dnsimple.Record, domain string) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "# Record %d: %s %s\n", record.Id, getFormattedDomainName(record.Name, domain), record.RecordType)
+	fmt.Fprintf(buf, "# Save the file to update the record. The type cannot be changed.\n")
+	fmt.Fprintf(buf, "name: %s\n", strconv.Quote(record.Name))
+	fmt.Fprintf(buf, "type: %s\n", record.RecordType)
+	fmt.Fprintf(buf, "content: %s\n", strconv.Quote(record.Content))
+	fmt.Fprintf(buf, "ttl: %d\n", record.Ttl)
+	return buf.Bytes()
+}
+
+// parseRecordDocument parses the flat YAML document written by formatRecordDocument.
+// Values can be plain or double-quoted, comments and blank lines are ignored.
+func parseRecordDocument(document []byte) (editableRecord, error) {
+	record := editableRecord{}
+	fields := make(map[string]bool)
+
+	for index, line := range strings.Split(string(document), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		separator := strings.Index(line, ":")
+		if separator < 0 {
+			return editableRecord{}, fmt.Errorf("Line %d: expected \"key: value\"", index+1)
+		}
+
+		key := strings.TrimSpace(line[:separator])
+		value, valueError := parseDocumentValue(strings.TrimSpace(line[separator+1:]))
+		if valueError != nil {
+			return editableRecord{}, fmt.Errorf("Line %d: %s", index+1, valueError.Error())
+		}
+
+		if fields[key] {
+			return editableRecord{}, fmt.Errorf("Line %d: duplicate field %q", index+1, key)
+		}
+
+		fields[key] = true
+
+		switch key {
+		case "name":
+			record.Name = value
+
+		case "type":
+			record.Type = strings.ToUpper(value)
+
+		case "content":
+			record.Content = value
+
+		case "ttl":
+			ttl, parseError := strconv.Atoi(value)
+			if parseError != nil {
+				return editableRecord{}, fmt.Errorf("Line %d: invalid ttl %q", index+1, value)
+			}
+
+			record.TTL = ttl
+
+		default:
+			return editableRecord{}, fmt.Errorf("Line %d: unknown field %q (name, type, content, ttl)", index+1, key)
+		}
+	}
+
+	for _, key := range []string{"name", "type", "content", "ttl"} {
+		if !fields[key] {
+			return editableRecord{}, fmt.Errorf("The field %q is missing", key)
+		}
+	}
+
+	return record, nil
+}
+
+// parseDocumentValue returns the given plain, single- or double-quoted value.
+func parseDocumentValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "\""):
+		unquoted, unquoteError := strconv.Unquote(value)
+		if unquoteError != nil {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+
+		return unquoted, nil
+
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+
+		return strings.Replace(value[1:len(value)-1], "''", "'", -1), nil
+	}
+
+	return value, nil
+}
+
+// runEditor opens the given file with the editor of the $VISUAL or
+// $EDITOR environment variable (default: vi) and waits until it is closed.
+func runEditor(filePath string) error {
+	editor := os.Getenv("VISUAL")
+	if strings.TrimSpace(editor) == "" {
+		editor = os.Getenv("EDITOR")
+	}
+
+	if strings.TrimSpace(editor) == "" {
+		editor = "vi"
+	}
+
+	// the editor variable can contain arguments (e.g. "code --wait")
+	fields := strings.Fields(editor)
+	command := exec.Command(fields[0], append(fields[1:], filePath)...)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	return command.Run()
+}
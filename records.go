@@ -0,0 +1,185 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/andreaskoch/dee-ns"
+	"github.com/pearkes/dnsimple"
+	"strings"
+)
+
+// maxTXTStringLength defines the maximum length of a single
+// character-string in a TXT record (see RFC 1035, section 3.3.14).
+const maxTXTStringLength = 255
+
+// findRecord returns the first record of the given domain that matches
+// the given name and record type. If no matching record was found
+// the second return value will be false.
+func findRecord(client deens.DNSClient, domain, name, recordType string) (dnsimple.Record, bool, error) {
+	records, err := client.GetRecords(domain)
+	if err != nil {
+		return dnsimple.Record{}, false, err
+	}
+
+	for _, record := range records {
+		if record.Name == name && record.RecordType == recordType {
+			return record, true, nil
+		}
+	}
+
+	return dnsimple.Record{}, false, nil
+}
+
+// findConflictingRecords returns the records of the given domain that cannot
+// coexist with a new record of the given name and type: a CNAME record
+// conflicts with every other record of the same name.
+func findConflictingRecords(client deens.DNSClient, domain, name, recordType string) ([]dnsimple.Record, error) {
+	records, err := client.GetRecords(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []dnsimple.Record
+	for _, record := range records {
+		if record.Name != name {
+			continue
+		}
+
+		if record.RecordType == "CNAME" || recordType == "CNAME" {
+			conflicts = append(conflicts, record)
+		}
+	}
+
+	return conflicts, nil
+}
+
+// resolveConflicts checks the given domain for records that conflict with a
+// new record of the given name and type. The conflicting records are deleted
+// and returned if replace is true, otherwise an error describing the conflict
+// is returned. A CNAME record cannot coexist with the conflicting records, so
+// they are deleted before the new record is created; if the creation fails
+// the caller reports them with getReplacedRecordsError.
+func resolveConflicts(client deens.DNSClient, domain, name, recordType string, replace bool) ([]dnsimple.Record, error) {
+	conflicts, err := findConflictingRecords(client, domain, name, recordType)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+
+	if !replace {
+		var descriptions []string
+		for _, conflict := range conflicts {
+			descriptions = append(descriptions, fmt.Sprintf("%s %s", conflict.RecordType, conflict.Content))
+		}
+
+		return nil, fmt.Errorf("Cannot create the %s record for %q because it conflicts with the existing records (%s). Use -replace-conflicting to replace them", recordType, getFormattedDomainName(name, domain), strings.Join(descriptions, ", "))
+	}
+
+	var deleted []dnsimple.Record
+	for _, conflict := range conflicts {
+		if destroyError := client.DestroyRecord(domain, conflict.StringId()); destroyError != nil {
+			return nil, getReplacedRecordsError(fmt.Errorf("Cannot delete the conflicting %s record: %s", conflict.RecordType, destroyError.Error()), domain, deleted)
+		}
+
+		deleted = append(deleted, conflict)
+	}
+
+	return deleted, nil
+}
+
+// getReplacedRecordsError adds the given conflicting records, which were
+// deleted before the given error occurred, to the error, so that they can
+// be restored with the rollback action.
+func getReplacedRecordsError(err error, domain string, deleted []dnsimple.Record) error {
+	if len(deleted) == 0 {
+		return err
+	}
+
+	var descriptions []string
+	for _, record := range deleted {
+		descriptions = append(descriptions, fmt.Sprintf("%s %s %s", getFormattedDomainName(record.Name, domain), record.RecordType, record.Content))
+	}
+
+	return fmt.Errorf("%s\nThe conflicting records were deleted (%s). Restore them with: dee rollback -steps %d -apply", err.Error(), strings.Join(descriptions, ", "), len(deleted))
+}
+
+// setRecord creates the DNS record with the given name and type or updates
+// the content and TTL of the existing one. The returned bool is true if
+// a new record was created and false if an existing record was updated.
+func setRecord(client deens.DNSClient, domain, name, recordType, content string, timeToLive int) (bool, error) {
+	if validationError := validateRecord(name, recordType, content, timeToLive); validationError != nil {
+		return false, validationError
+	}
+
+	existingRecord, exists, err := findRecord(client, domain, name, recordType)
+	if err != nil {
+		return false, err
+	}
+
+	changeRecord := &dnsimple.ChangeRecord{
+		Name:  name,
+		Value: content,
+		Type:  recordType,
+		Ttl:   fmt.Sprintf("%d", timeToLive),
+	}
+
+	if !exists {
+		if _, createError := client.CreateRecord(domain, changeRecord); createError != nil {
+			return false, createError
+		}
+
+		return true, nil
+	}
+
+	if _, updateError := client.UpdateRecord(domain, existingRecord.StringId(), changeRecord); updateError != nil {
+		return false, updateError
+	}
+
+	return false, nil
+}
+
+// formatTXTContent splits the given text into quoted character-strings
+// of at most 255 characters each (e.g. "v=DKIM1; k=rsa; p=..." "...").
+func formatTXTContent(text string) string {
+	buf := new(bytes.Buffer)
+
+	for len(text) > 0 {
+		length := maxTXTStringLength
+		if len(text) < length {
+			length = len(text)
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteString(" ")
+		}
+
+		fmt.Fprintf(buf, "%q", text[:length])
+		text = text[length:]
+	}
+
+	return buf.String()
+}
+
+// parseTXTContent joins the quoted character-strings of the given
+// TXT record content into a single string. Unquoted content is
+// returned as-is.
+func parseTXTContent(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, `"`) {
+		return content
+	}
+
+	var parts []string
+	for _, part := range strings.Split(content, `" "`) {
+		parts = append(parts, strings.Trim(part, `"`))
+	}
+
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,60 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_formatTXTContent_ShortText_SingleStringIsReturned(t *testing.T) {
+	// arrange
+	text := "v=spf1 -all"
+
+	// act
+	result := formatTXTContent(text)
+
+	// assert
+	if result != `"v=spf1 -all"` {
+		t.Fail()
+		t.Logf("formatTXTContent(%q) should return %q but returned %q", text, `"v=spf1 -all"`, result)
+	}
+}
+
+func Test_formatTXTContent_LongText_TextIsSplitInto255CharacterStrings(t *testing.T) {
+	// arrange
+	text := strings.Repeat("a", 600)
+
+	// act
+	result := formatTXTContent(text)
+
+	// assert
+	parts := strings.Split(result, " ")
+	if len(parts) != 3 || len(parts[0]) != 257 || len(parts[2]) != 92 {
+		t.Fail()
+		t.Logf("formatTXTContent should split a 600 character text into three strings but returned %q", result)
+	}
+}
+
+func Test_parseTXTContent_FormattedContent_OriginalTextIsReturned(t *testing.T) {
+	// arrange
+	inputs := []string{
+		"v=spf1 -all",
+		strings.Repeat("b", 255),
+		strings.Repeat("c", 1024),
+	}
+
+	for _, input := range inputs {
+
+		// act
+		result := parseTXTContent(formatTXTContent(input))
+
+		// assert
+		if result != input {
+			t.Fail()
+			t.Logf("parseTXTContent(formatTXTContent(%q)) returned %q", input, result)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule returns the times a task is due.
+type schedule interface {
+	// Next returns the first time after the given time the task is due.
+	Next(after time.Time) time.Time
+}
+
+// scheduleAliases maps the predefined schedules to their cron expressions.
+var scheduleAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// parseSchedule parses the given schedule. Supported are "@every <duration>"
+// (e.g. "@every 5m"), the predefined schedules (e.g. "@daily") and cron
+// expressions with five fields (minute hour day-of-month month day-of-week,
+// e.g. "0 3 * * *").
+func parseSchedule(expression string) (schedule, error) {
+	expression = strings.TrimSpace(expression)
+
+	if strings.HasPrefix(expression, "@every ") {
+		interval, parseError := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expression, "@every ")))
+		if parseError != nil {
+			return nil, fmt.Errorf("Cannot parse schedule %q: %s", expression, parseError.Error())
+		}
+
+		if interval < time.Second {
+			return nil, fmt.Errorf("The interval of schedule %q must be at least one second", expression)
+		}
+
+		return intervalSchedule{interval}, nil
+	}
+
+	if alias, isAlias := scheduleAliases[expression]; isAlias {
+		expression = alias
+	}
+
+	return parseCronSchedule(expression)
+}
+
+// intervalSchedule is due after each interval.
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+// Next returns the given time plus the interval.
+func (s intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(s.interval)
+}
+
+// cronField defines the allowed range of a cron expression field.
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// cronSchedule is due at the times matching a cron expression.
+// Each field is a bit set of the allowed values.
+type cronSchedule struct {
+	minutes     uint64
+	hours       uint64
+	daysOfMonth uint64
+	months      uint64
+	daysOfWeek  uint64
+
+	// anyDayOfMonth and anyDayOfWeek are true if the field starts with "*".
+	// If both day fields are restricted, either of them must match.
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+// parseCronSchedule parses a cron expression with five fields. Each field
+// can be "*", a value, a range ("1-5"), a step ("*/15", "0-30/10") or a
+// comma-separated list of them.
+func parseCronSchedule(expression string) (cronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return cronSchedule{}, fmt.Errorf("Cannot parse schedule %q: expected %d fields (minute hour day-of-month month day-of-week)", expression, len(cronFields))
+	}
+
+	var sets []uint64
+	for index, field := range fields {
+		set, parseError := parseCronField(field, cronFields[index])
+		if parseError != nil {
+			return cronSchedule{}, fmt.Errorf("Cannot parse schedule %q: %s", expression, parseError.Error())
+		}
+
+		sets = append(sets, set)
+	}
+
+	// allow 7 for sunday
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return cronSchedule{
+		minutes:       sets[0],
+		hours:         sets[1],
+		daysOfMonth:   sets[2],
+		months:        sets[3],
+		daysOfWeek:    sets[4],
+		anyDayOfMonth: strings.HasPrefix(fields[2], "*"),
+		anyDayOfWeek:  strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField returns the bit set of the values of the given field.
+func parseCronField(text string, field cronField) (uint64, error) {
+	maxValue := field.max
+	if field.name == "day of week" {
+		maxValue = 7
+	}
+
+	var set uint64
+	for _, part := range strings.Split(text, ",") {
+		valueRange := part
+		step := 1
+		if slash := strings.Index(part, "/"); slash >= 0 {
+			parsedStep, stepError := strconv.Atoi(part[slash+1:])
+			if stepError != nil || parsedStep < 1 {
+				return 0, fmt.Errorf("Invalid step in %s field %q", field.name, part)
+			}
+
+			valueRange = part[:slash]
+			step = parsedStep
+		}
+
+		start, end := field.min, maxValue
+		if valueRange != "*" {
+			bounds := strings.SplitN(valueRange, "-", 2)
+
+			var startError, endError error
+			start, startError = strconv.Atoi(bounds[0])
+			end = start
+			if len(bounds) == 2 {
+				end, endError = strconv.Atoi(bounds[1])
+			} else if step > 1 {
+				end = maxValue
+			}
+
+			if startError != nil || endError != nil || start < field.min || end > maxValue || start > end {
+				return 0, fmt.Errorf("Invalid %s %q (allowed: %d-%d)", field.name, part, field.min, maxValue)
+			}
+		}
+
+		for value := start; value <= end; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+
+	return set, nil
+}
+
+// Next returns the first full minute after the given time that matches the cron expression.
+func (s cronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+
+	// give up if no matching time exists (e.g. "0 0 31 2 *")
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// matchesDay returns true if the day of the given time matches
+// the day-of-month and the day-of-week fields.
+func (s cronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.daysOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := s.daysOfWeek&(1<<uint(t.Weekday())) != 0
+
+	if !s.anyDayOfMonth && !s.anyDayOfWeek {
+		return dayOfMonth || dayOfWeek
+	}
+
+	return dayOfMonth && dayOfWeek
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseSchedule_NextRunIsCalculated(t *testing.T) {
+	// arrange
+	after := time.Date(2016, time.March, 4, 10, 17, 30, 0, time.UTC) // Friday
+
+	inputs := []struct {
+		expression string
+		expected   time.Time
+	}{
+		{"@every 5m", time.Date(2016, time.March, 4, 10, 22, 30, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2016, time.March, 4, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2016, time.March, 5, 3, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2016, time.March, 5, 0, 0, 0, 0, time.UTC)},
+		{"30 8 * * 1-5", time.Date(2016, time.March, 7, 8, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2016, time.March, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1,15 * *", time.Date(2016, time.March, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2016, time.March, 11, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, input := range inputs {
+		s, parseError := parseSchedule(input.expression)
+		if parseError != nil {
+			t.Fail()
+			t.Logf("parseSchedule(%q) returned an error: %s", input.expression, parseError.Error())
+			continue
+		}
+
+		// act
+		result := s.Next(after)
+
+		// assert
+		if !result.Equal(input.expected) {
+			t.Fail()
+			t.Logf("parseSchedule(%q).Next(%s) should return %s but returned %s", input.expression, after, input.expected, result)
+		}
+	}
+}
+
+func Test_parseSchedule_InvalidExpression_ErrorIsReturned(t *testing.T) {
+	// arrange
+	expressions := []string{
+		"",
+		"@every",
+		"@every 100ms",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"@fortnightly",
+	}
+
+	for _, expression := range expressions {
+
+		// act
+		_, err := parseSchedule(expression)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("parseSchedule(%q) should return an error", expression)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"hash/crc32"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// secondaryProvider receives mirrored copies of zones, so that the
+// domains still resolve while DNSimple is not available.
+type secondaryProvider interface {
+	// PushZone stores the given zone file of the given domain. The
+	// returned bool is false if the provider already had the same zone.
+	PushZone(domain string, zone []byte) (bool, error)
+}
+
+// secondaryProviderFactory creates a secondary provider from the parameter
+// of a mirror target (e.g. "/var/named" in "zonefile:/var/named").
+type secondaryProviderFactory func(parameter string) (secondaryProvider, error)
+
+// secondaryProviderRegistry maps the names of mirror targets
+// (e.g. "zonefile") to their provider factories.
+type secondaryProviderRegistry map[string]secondaryProviderFactory
+
+// newSecondaryProviderRegistry creates a registry that contains all built-in mirror targets.
+func newSecondaryProviderRegistry(fs afero.Fs) secondaryProviderRegistry {
+	return secondaryProviderRegistry{
+		"zonefile": func(parameter string) (secondaryProvider, error) {
+			return newZoneFileSecondaryProvider(fs, parameter)
+		},
+		"command": func(parameter string) (secondaryProvider, error) {
+			return newCommandSecondaryProvider(parameter, runCommandWithInput)
+		},
+	}
+}
+
+// Register adds the given mirror target to the registry.
+func (registry secondaryProviderRegistry) Register(name string, factory secondaryProviderFactory) {
+	registry[name] = factory
+}
+
+// Names returns the sorted names of all registered mirror targets.
+func (registry secondaryProviderRegistry) Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// GetProvider returns the secondary provider for the given mirror target. The
+// target consists of the name and a parameter (e.g. "zonefile:/var/named").
+func (registry secondaryProviderRegistry) GetProvider(target string) (secondaryProvider, error) {
+	nameAndParameter := strings.SplitN(target, ":", 2)
+	name := strings.ToLower(strings.TrimSpace(nameAndParameter[0]))
+
+	parameter := ""
+	if len(nameAndParameter) == 2 {
+		parameter = strings.TrimSpace(nameAndParameter[1])
+	}
+
+	factory, exists := registry[name]
+	if !exists {
+		return nil, fmt.Errorf("Unknown mirror target %q (available: %s)", name, strings.Join(registry.Names(), ", "))
+	}
+
+	return factory(parameter)
+}
+
+// zoneFileSecondaryProvider writes the zones as "<domain>.zone" files into
+// a directory that is served by a secondary name server (e.g. BIND or NSD).
+type zoneFileSecondaryProvider struct {
+	fs        afero.Fs
+	directory string
+}
+
+func newZoneFileSecondaryProvider(fs afero.Fs, directory string) (secondaryProvider, error) {
+	if directory == "" {
+		return nil, fmt.Errorf("The zonefile target requires a directory (e.g. zonefile:/var/named)")
+	}
+
+	return zoneFileSecondaryProvider{fs, directory}, nil
+}
+
+// PushZone writes the zone file unless the existing file has the same content.
+// The file is written to a temporary file first, so that the name server
+// never reads a partially written zone.
+func (provider zoneFileSecondaryProvider) PushZone(domain string, zone []byte) (bool, error) {
+	filePath := filepath.Join(provider.directory, domain+".zone")
+
+	if existing, readError := afero.ReadFile(provider.fs, filePath); readError == nil && bytes.Equal(existing, zone) {
+		return false, nil
+	}
+
+	if directoryError := provider.fs.MkdirAll(provider.directory, 0755); directoryError != nil {
+		return false, directoryError
+	}
+
+	temporaryFilePath := filePath + ".tmp"
+	if writeError := afero.WriteFile(provider.fs, temporaryFilePath, zone, 0644); writeError != nil {
+		return false, writeError
+	}
+
+	if renameError := provider.fs.Rename(temporaryFilePath, filePath); renameError != nil {
+		return false, renameError
+	}
+
+	return true, nil
+}
+
+// commandSecondaryProvider passes the zones to a command (e.g. a script that
+// uploads the zone to another DNS provider). The command receives the domain
+// as its only argument and the zone file on stdin.
+type commandSecondaryProvider struct {
+	command    string
+	runCommand func(input []byte, name string, arguments ...string) ([]byte, error)
+}
+
+func newCommandSecondaryProvider(command string, runCommand func(input []byte, name string, arguments ...string) ([]byte, error)) (secondaryProvider, error) {
+	if command == "" {
+		return nil, fmt.Errorf("The command target requires a command (e.g. command:/usr/local/bin/push-zone)")
+	}
+
+	return commandSecondaryProvider{command, runCommand}, nil
+}
+
+// PushZone runs the command. Commands cannot report unchanged zones,
+// so every push counts as a change.
+func (provider commandSecondaryProvider) PushZone(domain string, zone []byte) (bool, error) {
+	if _, err := provider.runCommand(zone, provider.command, domain); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// unmirrorableRecordTypes contains the DNSimple-specific record types
+// that have no equivalent in a standard zone file.
+var unmirrorableRecordTypes = []string{"ALIAS", "POOL", "URL"}
+
+// formatZoneFile returns the given records of the given domain as a zone file
+// (RFC 1035). Records of DNSimple-specific types are not included; they are
+// returned as the second value. The zone starts with the SOA record, which
+// name servers require to load the zone; if the records contain none, one
+// is synthesized (see getSynthesizedSOARecord).
+func formatZoneFile(domain string, records []dnsimple.Record) ([]byte, []dnsimple.Record) {
+	sorted := make([]dnsimple.Record, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Name != sorted[j].Name {
+			return sorted[i].Name < sorted[j].Name
+		}
+
+		if sorted[i].RecordType != sorted[j].RecordType {
+			return sorted[i].RecordType < sorted[j].RecordType
+		}
+
+		return sorted[i].Content < sorted[j].Content
+	})
+
+	body := new(bytes.Buffer)
+	var soa *dnsimple.Record
+	var skipped []dnsimple.Record
+	for index, record := range sorted {
+		if containsString(unmirrorableRecordTypes, record.RecordType) {
+			skipped = append(skipped, record)
+			continue
+		}
+
+		// a zone has exactly one SOA record
+		if record.RecordType == "SOA" {
+			if soa == nil {
+				soa = &sorted[index]
+			}
+
+			continue
+		}
+
+		writeZoneFileRecord(body, record)
+	}
+
+	if soa == nil {
+		synthesized := getSynthesizedSOARecord(domain, sorted, body.Bytes())
+		soa = &synthesized
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "$ORIGIN %s.\n", strings.TrimSuffix(domain, "."))
+	writeZoneFileRecord(buf, *soa)
+	buf.Write(body.Bytes())
+
+	return buf.Bytes(), skipped
+}
+
+// writeZoneFileRecord writes the given record as a line of a zone file.
+func writeZoneFileRecord(buf *bytes.Buffer, record dnsimple.Record) {
+	name := record.Name
+	if name == "" {
+		name = "@"
+	}
+
+	fmt.Fprintf(buf, "%s\t%d\tIN\t%s\t%s\n", name, record.Ttl, record.RecordType, getZoneFileContent(record))
+}
+
+// getSynthesizedSOARecord returns an SOA record for zones without one. The
+// primary name server is the first name server of the zone apex and the
+// timers are the defaults of DNSimple. The serial is derived from the given
+// records of the zone, so that it only changes when the zone changes.
+func getSynthesizedSOARecord(domain string, records []dnsimple.Record, zone []byte) dnsimple.Record {
+	domain = strings.TrimSuffix(domain, ".")
+
+	primary := "ns1." + domain
+	for _, record := range records {
+		if record.Name == "" && record.RecordType == "NS" {
+			primary = record.Content
+			break
+		}
+	}
+
+	serial := crc32.ChecksumIEEE(zone)
+	return dnsimple.Record{
+		RecordType: "SOA",
+		Content:    fmt.Sprintf("%s hostmaster.%s %d 86400 7200 604800 300", primary, domain, serial),
+		Ttl:        3600,
+	}
+}
+
+// getZoneFileContent returns the content of the given record in zone file
+// notation: hostnames are fully qualified, texts are quoted and the priority
+// of MX and SRV records is prepended.
+func getZoneFileContent(record dnsimple.Record) string {
+	content := strings.TrimSpace(record.Content)
+
+	switch record.RecordType {
+	case "CNAME", "NS", "PTR":
+		return getFullyQualifiedName(content)
+
+	case "SOA":
+		// the primary name server and the mailbox of the responsible person
+		fields := strings.Fields(content)
+		if len(fields) == 7 {
+			fields[0] = getFullyQualifiedName(fields[0])
+			fields[1] = getFullyQualifiedName(fields[1])
+		}
+
+		return strings.Join(fields, " ")
+
+	case "MX":
+		return fmt.Sprintf("%d %s", record.Prio, getFullyQualifiedName(content))
+
+	case "SRV":
+		fields := strings.Fields(content)
+		if len(fields) == 3 {
+			fields[2] = getFullyQualifiedName(fields[2])
+		}
+
+		return fmt.Sprintf("%d %s", record.Prio, strings.Join(fields, " "))
+
+	case "TXT", "SPF":
+		if strings.HasPrefix(content, `"`) {
+			return content
+		}
+
+		return formatTXTContent(content)
+	}
+
+	return content
+}
+
+// getFullyQualifiedName appends the root label to the given hostname (e.g. "mail.example.com.").
+func getFullyQualifiedName(hostname string) string {
+	if hostname == "" || strings.HasSuffix(hostname, ".") {
+		return hostname
+	}
+
+	return hostname + "."
+}
@@ -0,0 +1,178 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// formatZoneFile should write fully qualified targets, quoted texts and
+// priorities and skip the DNSimple-specific record types.
+func Test_formatZoneFile_RecordsAreWrittenInZoneFileNotation(t *testing.T) {
+	// arrange
+	records := []dnsimple.Record{
+		{Name: "www", RecordType: "CNAME", Content: "example.com", Ttl: 3600},
+		{Name: "", RecordType: "A", Content: "203.0.113.1", Ttl: 600},
+		{Name: "", RecordType: "MX", Content: "mail.example.com", Prio: 10, Ttl: 3600},
+		{Name: "", RecordType: "TXT", Content: "v=spf1 mx -all", Ttl: 3600},
+		{Name: "_sip._tcp", RecordType: "SRV", Content: "5 5060 sip.example.com", Prio: 20, Ttl: 3600},
+		{Name: "app", RecordType: "ALIAS", Content: "app.herokuapp.com", Ttl: 3600},
+		{Name: "", RecordType: "SOA", Content: "ns1.dnsimple.com admin.dnsimple.com 1453736920 86400 7200 604800 300", Ttl: 3600},
+	}
+
+	// act
+	zone, skipped := formatZoneFile("example.com", records)
+
+	// assert
+	expected := "$ORIGIN example.com.\n" +
+		"@\t3600\tIN\tSOA\tns1.dnsimple.com. admin.dnsimple.com. 1453736920 86400 7200 604800 300\n" +
+		"@\t600\tIN\tA\t203.0.113.1\n" +
+		"@\t3600\tIN\tMX\t10 mail.example.com.\n" +
+		"@\t3600\tIN\tTXT\t\"v=spf1 mx -all\"\n" +
+		"_sip._tcp\t3600\tIN\tSRV\t20 5 5060 sip.example.com.\n" +
+		"www\t3600\tIN\tCNAME\texample.com.\n"
+
+	if string(zone) != expected {
+		t.Fail()
+		t.Logf("formatZoneFile returned\n%s\nbut should have returned\n%s", zone, expected)
+	}
+
+	if len(skipped) != 1 || skipped[0].RecordType != "ALIAS" {
+		t.Fail()
+		t.Logf("formatZoneFile should skip the ALIAS record but skipped %#v", skipped)
+	}
+}
+
+// parseTestZoneFile parses the records of the given zone file like a name server
+// and fails if a line is not a valid record.
+func parseTestZoneFile(t *testing.T, zone []byte) [][]string {
+	var records [][]string
+	for _, line := range strings.Split(strings.TrimSpace(string(zone)), "\n") {
+		if strings.HasPrefix(line, "$ORIGIN ") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 5 || fields[2] != "IN" {
+			t.Fatalf("The line %q is not a valid record", line)
+		}
+
+		if _, ttlError := strconv.ParseUint(fields[1], 10, 32); ttlError != nil {
+			t.Fatalf("The TTL of the line %q is invalid", line)
+		}
+
+		records = append(records, fields)
+	}
+
+	return records
+}
+
+// Zones without an SOA record cannot be loaded by name servers,
+// so formatZoneFile should synthesize a valid one.
+func Test_formatZoneFile_NoSOARecord_SOARecordIsSynthesized(t *testing.T) {
+	// arrange
+	records := []dnsimple.Record{
+		{Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 600},
+		{Name: "", RecordType: "NS", Content: "ns2.dnsimple.com", Ttl: 3600},
+		{Name: "", RecordType: "NS", Content: "ns1.dnsimple.com", Ttl: 3600},
+	}
+
+	changedRecords := append([]dnsimple.Record{{Name: "api", RecordType: "A", Content: "203.0.113.2", Ttl: 600}}, records...)
+
+	// act
+	zone, _ := formatZoneFile("example.com", records)
+	sameZone, _ := formatZoneFile("example.com", records)
+	changedZone, _ := formatZoneFile("example.com", changedRecords)
+
+	// assert
+	parsed := parseTestZoneFile(t, zone)
+	if len(parsed) != 4 || parsed[0][0] != "@" || parsed[0][3] != "SOA" {
+		t.Fatalf("The zone should start with an SOA record:\n%s", zone)
+	}
+
+	soa := strings.Fields(parsed[0][4])
+	if len(soa) != 7 || soa[0] != "ns1.dnsimple.com." || soa[1] != "hostmaster.example.com." {
+		t.Fail()
+		t.Logf("The SOA record should name the first name server and the hostmaster of the zone: %q", parsed[0][4])
+	}
+
+	for _, timer := range soa[2:] {
+		if _, parseError := strconv.ParseUint(timer, 10, 32); parseError != nil {
+			t.Fail()
+			t.Logf("The serial and the timers of the SOA record should be numbers: %q", parsed[0][4])
+		}
+	}
+
+	changedSOA := strings.Fields(parseTestZoneFile(t, changedZone)[0][4])
+	if string(zone) != string(sameZone) || len(changedSOA) != 7 || changedSOA[2] == soa[2] {
+		t.Fail()
+		t.Logf("The serial should only change if the zone changes: %q, %q", soa, changedSOA)
+	}
+}
+
+// The zonefile provider should only write zones that have changed.
+func Test_zoneFileSecondaryProvider_PushZone_UnchangedZoneIsNotWritten(t *testing.T) {
+	// arrange
+	fs := afero.NewMemMapFs()
+	provider, _ := newZoneFileSecondaryProvider(fs, "/var/named")
+
+	// act
+	firstChanged, firstError := provider.PushZone("example.com", []byte("zone"))
+	secondChanged, _ := provider.PushZone("example.com", []byte("zone"))
+	content, _ := afero.ReadFile(fs, "/var/named/example.com.zone")
+
+	// assert
+	if firstError != nil || !firstChanged || secondChanged {
+		t.Fail()
+		t.Logf("Only the first push should change the zone (%t, %t, %v)", firstChanged, secondChanged, firstError)
+	}
+
+	if string(content) != "zone" {
+		t.Fail()
+		t.Logf("The zone file should contain the zone but contains %q", content)
+	}
+}
+
+// The command provider should pass the domain as argument and the zone on stdin.
+func Test_commandSecondaryProvider_PushZone_CommandReceivesZone(t *testing.T) {
+	// arrange
+	var calls []string
+	provider, _ := newCommandSecondaryProvider("/usr/local/bin/push-zone", func(input []byte, name string, arguments ...string) ([]byte, error) {
+		calls = append(calls, name+" "+strings.Join(arguments, " ")+": "+string(input))
+		return nil, nil
+	})
+
+	// act
+	changed, err := provider.PushZone("example.com", []byte("zone"))
+
+	// assert
+	if err != nil || !changed || len(calls) != 1 || calls[0] != "/usr/local/bin/push-zone example.com: zone" {
+		t.Fail()
+		t.Logf("PushZone should run the command once with the zone on stdin but ran %q (%v)", calls, err)
+	}
+}
+
+// GetProvider should return an error for unknown targets and missing parameters.
+func Test_secondaryProviderRegistry_GetProvider_InvalidTarget_ErrorIsReturned(t *testing.T) {
+	// arrange
+	registry := newSecondaryProviderRegistry(afero.NewMemMapFs())
+	targets := []string{"", "ftp:/zones", "zonefile", "command:"}
+
+	for _, target := range targets {
+
+		// act
+		_, err := registry.GetProvider(target)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("GetProvider(%q) should return an error", target)
+		}
+	}
+}
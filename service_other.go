@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+)
+
+// runWindowsService is only available on Windows.
+func runWindowsService(name string, run func(events eventLog, stop <-chan bool)) error {
+	return fmt.Errorf("Windows services are not supported on this platform")
+}
@@ -0,0 +1,218 @@
+//go:build windows
+// +build windows
+
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// The Windows service API (advapi32.dll).
+var (
+	advapi32 = syscall.NewLazyDLL("advapi32.dll")
+
+	procStartServiceCtrlDispatcher = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	procRegisterServiceCtrlHandler = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	procSetServiceStatus           = advapi32.NewProc("SetServiceStatus")
+	procRegisterEventSource        = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource      = advapi32.NewProc("DeregisterEventSource")
+	procReportEvent                = advapi32.NewProc("ReportEventW")
+	serviceMainCallback            = syscall.NewCallback(serviceMain)
+	serviceControlHandlerCallback  = syscall.NewCallback(serviceControlHandler)
+	activeService                  *windowsService
+)
+
+const (
+	serviceWin32OwnProcess = 0x10
+
+	serviceStopped        = 1
+	serviceStartPending   = 2
+	serviceStopPending    = 3
+	serviceRunning        = 4
+	serviceAcceptStop     = 1
+	serviceAcceptShutdown = 4
+
+	serviceControlStop        = 1
+	serviceControlInterrogate = 4
+	serviceControlShutdown    = 5
+
+	// serviceStopWaitHint is the time in milliseconds the service control
+	// manager waits for the running task of the daemon when the service stops.
+	serviceStopWaitHint = 60000
+
+	eventLogErrorType       = 1
+	eventLogInformationType = 4
+)
+
+// serviceTableEntry is a SERVICE_TABLE_ENTRYW.
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// serviceStatus is a SERVICE_STATUS.
+type serviceStatus struct {
+	serviceType             uint32
+	currentState            uint32
+	controlsAccepted        uint32
+	win32ExitCode           uint32
+	serviceSpecificExitCode uint32
+	checkPoint              uint32
+	waitHint                uint32
+}
+
+// windowsService is the service that is run by the service control manager.
+type windowsService struct {
+	name   string
+	run    func(events eventLog, stop <-chan bool)
+	events windowsEventLog
+	status uintptr
+	stop   chan bool
+}
+
+// runWindowsService connects to the service control manager and runs the
+// given function as the service with the given name until the service is stopped.
+func runWindowsService(name string, run func(events eventLog, stop <-chan bool)) error {
+	events, eventsError := openWindowsEventLog(name)
+	if eventsError != nil {
+		return eventsError
+	}
+
+	defer events.Close()
+
+	activeService = &windowsService{name: name, run: run, events: events, stop: make(chan bool, 1)}
+
+	serviceName, _ := syscall.UTF16PtrFromString(name)
+	table := []serviceTableEntry{{serviceName, serviceMainCallback}, {nil, 0}}
+
+	// returns after the service has stopped
+	if result, _, callError := procStartServiceCtrlDispatcher.Call(uintptr(unsafe.Pointer(&table[0]))); result == 0 {
+		return fmt.Errorf("Cannot connect to the service control manager (the service run command can only be started by Windows): %s", callError.Error())
+	}
+
+	return nil
+}
+
+// serviceMain is the ServiceMain function of the service.
+func serviceMain(argc uint32, argv **uint16) uintptr {
+	service := activeService
+
+	serviceName, _ := syscall.UTF16PtrFromString(service.name)
+	status, _, _ := procRegisterServiceCtrlHandler.Call(uintptr(unsafe.Pointer(serviceName)), serviceControlHandlerCallback, 0)
+	if status == 0 {
+		return 0
+	}
+
+	service.status = status
+	service.setStatus(serviceStartPending)
+
+	stopDaemon := make(chan bool)
+	done := make(chan bool, 1)
+	go func() {
+		service.run(service.events, stopDaemon)
+		done <- true
+	}()
+
+	service.setStatus(serviceRunning)
+	service.events.Info(fmt.Sprintf("The service %s started", service.name))
+
+	select {
+	case <-service.stop:
+		// the process exits when the service is stopped,
+		// so the running task of the daemon must finish first
+		service.setStatus(serviceStopPending)
+		close(stopDaemon)
+		<-done
+		service.events.Info(fmt.Sprintf("The service %s stopped", service.name))
+
+	case <-done:
+		service.events.Error(fmt.Sprintf("The daemon of the service %s exited", service.name))
+	}
+
+	service.setStatus(serviceStopped)
+	return 0
+}
+
+// serviceControlHandler handles the control requests of the service control manager.
+func serviceControlHandler(control, eventType, eventData, context uintptr) uintptr {
+	switch control {
+	case serviceControlStop, serviceControlShutdown:
+		select {
+		case activeService.stop <- true:
+		default:
+		}
+
+	case serviceControlInterrogate:
+	}
+
+	return 0
+}
+
+// setStatus reports the given state to the service control manager.
+func (service *windowsService) setStatus(state uint32) {
+	status := serviceStatus{serviceType: serviceWin32OwnProcess, currentState: state}
+	switch state {
+	case serviceRunning:
+		status.controlsAccepted = serviceAcceptStop | serviceAcceptShutdown
+
+	case serviceStopPending:
+		status.waitHint = serviceStopWaitHint
+	}
+
+	procSetServiceStatus.Call(service.status, uintptr(unsafe.Pointer(&status)))
+}
+
+// windowsEventLog writes messages to the Application event log
+// with the event source that "service install" registered.
+type windowsEventLog struct {
+	handle uintptr
+}
+
+// openWindowsEventLog opens the event source with the given name.
+func openWindowsEventLog(source string) (windowsEventLog, error) {
+	sourceName, _ := syscall.UTF16PtrFromString(source)
+	handle, _, callError := procRegisterEventSource.Call(0, uintptr(unsafe.Pointer(sourceName)))
+	if handle == 0 {
+		return windowsEventLog{}, fmt.Errorf("Cannot open the event log: %s", callError.Error())
+	}
+
+	return windowsEventLog{handle}, nil
+}
+
+// Info writes an information event.
+func (events windowsEventLog) Info(message string) error {
+	return events.report(eventLogInformationType, message)
+}
+
+// Error writes an error event.
+func (events windowsEventLog) Error(message string) error {
+	return events.report(eventLogErrorType, message)
+}
+
+// Close closes the event source.
+func (events windowsEventLog) Close() error {
+	procDeregisterEventSource.Call(events.handle)
+	return nil
+}
+
+// report writes an event of the given type. The event ID 1 of
+// EventCreate.exe displays the message as it is.
+func (events windowsEventLog) report(eventType uint16, message string) error {
+	text, textError := syscall.UTF16PtrFromString(message)
+	if textError != nil {
+		return textError
+	}
+
+	messages := []*uint16{text}
+	if result, _, callError := procReportEvent.Call(events.handle, uintptr(eventType), 0, 1, 0, 1, 0, uintptr(unsafe.Pointer(&messages[0])), 0); result == 0 {
+		return fmt.Errorf("Cannot write to the event log: %s", callError.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// ttlPolicy defines the TTLs of new records (the "ttl_policy"
+// section of the configuration file). All values are in seconds.
+type ttlPolicy struct {
+	// Dynamic is the default TTL of the address records of the
+	// dynamic DNS actions "create" and "createorupdate" (e.g. 60).
+	Dynamic int `json:"dynamic"`
+
+	// Default is the default TTL of all other records (e.g. 3600).
+	Default int `json:"default"`
+
+	// Minimum is the smallest TTL that is accepted. It is never
+	// below the minimum TTL of DNSimple (60 seconds).
+	Minimum int `json:"minimum"`
+
+	// Commands overrides the default TTL of
+	// single commands (e.g. {"record create": 300}).
+	Commands map[string]int `json:"commands"`
+}
+
+// GetDefaultTTL returns the TTL of records that the given
+// command creates without an explicit -ttl argument.
+func (policy ttlPolicy) GetDefaultTTL(command string, isDynamic bool) int {
+	ttl := defaultTTL
+
+	switch {
+	case policy.Commands[command] > 0:
+		ttl = policy.Commands[command]
+
+	case isDynamic && policy.Dynamic > 0:
+		ttl = policy.Dynamic
+
+	case policy.Default > 0:
+		ttl = policy.Default
+	}
+
+	if ttl < policy.GetMinimumTTL() {
+		return policy.GetMinimumTTL()
+	}
+
+	return ttl
+}
+
+// GetMinimumTTL returns the smallest TTL the policy accepts.
+func (policy ttlPolicy) GetMinimumTTL() int {
+	if policy.Minimum > minimumTTL {
+		return policy.Minimum
+	}
+
+	return minimumTTL
+}
+
+// ttlPolicyProvider determines the TTLs of new records.
+type ttlPolicyProvider interface {
+	// GetTTL returns the TTL of a record that the given command creates. If no TTL
+	// was given the default TTL of the command is returned, TTLs below the
+	// minimum are raised to the minimum.
+	GetTTL(command string, isDynamic bool, ttl int, ttlGiven bool) (int, error)
+}
+
+// configTTLPolicyProvider reads the TTL policy from the configuration file.
+// If there is no configuration file the built-in defaults are used.
+type configTTLPolicyProvider struct {
+	config *configFile
+
+	// warnings receives the warnings about TTLs that violate the policy.
+	warnings io.Writer
+}
+
+// GetTTL returns the TTL of a record that the given command creates.
+func (provider configTTLPolicyProvider) GetTTL(command string, isDynamic bool, ttl int, ttlGiven bool) (int, error) {
+	settings, _, configError := provider.config.Load()
+	if configError != nil {
+		return 0, configError
+	}
+
+	policy := settings.TTLPolicy
+
+	if !ttlGiven {
+		return policy.GetDefaultTTL(command, isDynamic), nil
+	}
+
+	if minimum := policy.GetMinimumTTL(); ttl < minimum {
+		if provider.warnings != nil {
+			fmt.Fprintf(provider.warnings, "Warning: The TTL of %d seconds is below the minimum of the TTL policy. Using %d seconds instead.\n", ttl, minimum)
+		}
+
+		return minimum, nil
+	}
+
+	return ttl, nil
+}
+
+// applyTTLPolicy returns the TTL of a record that the given command creates
+// with the given arguments. Without a policy the given TTL is returned.
+func applyTTLPolicy(policy ttlPolicyProvider, command string, isDynamic bool, ttl int, arguments []string) (int, error) {
+	if policy == nil {
+		return ttl, nil
+	}
+
+	return policy.GetTTL(command, isDynamic, ttl, isFlagGiven(arguments, "ttl"))
+}
+
+// applyRecordTTLPolicy returns the TTL of a record that the given command
+// writes with the given TTL (e.g. from a template, an API request or an
+// edited record). A TTL of 0 means that no TTL was given. Without a policy
+// the given TTL or the built-in default is returned.
+func applyRecordTTLPolicy(policy ttlPolicyProvider, command string, isDynamic bool, ttl int) (int, error) {
+	if policy == nil {
+		if ttl == 0 {
+			return defaultTTL, nil
+		}
+
+		return ttl, nil
+	}
+
+	return policy.GetTTL(command, isDynamic, ttl, ttl != 0)
+}
@@ -0,0 +1,169 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pearkes/dnsimple"
+	"github.com/spf13/afero"
+	"net"
+	"strings"
+	"testing"
+)
+
+// getTestTTLPolicyProvider returns a TTL policy provider for a configuration file with the given content.
+func getTestTTLPolicyProvider(content string, warnings *bytes.Buffer) configTTLPolicyProvider {
+	fs := afero.NewMemMapFs()
+	if content != "" {
+		afero.WriteFile(fs, "/home/user/.dee/config.json", []byte(content), 0600)
+	}
+
+	return configTTLPolicyProvider{newConfigFile(fs, configDecrypter{}, "/home/user/.dee/config.json"), warnings}
+}
+
+// GetDefaultTTL should prefer the command TTL over the dynamic and the default TTL.
+func Test_ttlPolicy_GetDefaultTTL(t *testing.T) {
+	// arrange
+	policy := ttlPolicy{Dynamic: 60, Default: 3600, Minimum: 120, Commands: map[string]int{"record create": 300}}
+	inputs := []struct {
+		policy    ttlPolicy
+		command   string
+		isDynamic bool
+		expected  int
+	}{
+		{ttlPolicy{}, "create", true, defaultTTL},
+		{ttlPolicy{Minimum: 30}, "record create", false, defaultTTL},
+		{policy, "createorupdate", true, 120},
+		{policy, "record create", false, 300},
+		{policy, "dkim set", false, 3600},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		result := input.policy.GetDefaultTTL(input.command, input.isDynamic)
+
+		// assert
+		if result != input.expected {
+			t.Fail()
+			t.Logf("GetDefaultTTL(%q, %t) of %#v returned %d but should have returned %d", input.command, input.isDynamic, input.policy, result, input.expected)
+		}
+	}
+}
+
+// GetTTL should raise TTLs below the minimum of the policy and print a warning.
+func Test_configTTLPolicyProvider_GetTTL_TTLBelowMinimum_WarningIsPrinted(t *testing.T) {
+	// arrange
+	warnings := new(bytes.Buffer)
+	provider := getTestTTLPolicyProvider(`{"ttl_policy":{"minimum":300}}`, warnings)
+
+	// act
+	ttl, err := provider.GetTTL("create", true, 60, true)
+
+	// assert
+	if err != nil || ttl != 300 {
+		t.Fail()
+		t.Logf("GetTTL should have returned 300 but returned %d (%v)", ttl, err)
+	}
+
+	if !strings.Contains(warnings.String(), "below the minimum") {
+		t.Fail()
+		t.Logf("GetTTL should have printed a warning but printed %q", warnings.String())
+	}
+}
+
+// Without a configuration file GetTTL should use the built-in defaults.
+func Test_configTTLPolicyProvider_GetTTL_NoConfigFile_DefaultsAreUsed(t *testing.T) {
+	// arrange
+	provider := getTestTTLPolicyProvider("", nil)
+
+	// act
+	defaultResult, defaultError := provider.GetTTL("create", true, defaultTTL, false)
+	givenResult, givenError := provider.GetTTL("create", true, 120, true)
+
+	// assert
+	if defaultError != nil || givenError != nil || defaultResult != defaultTTL || givenResult != 120 {
+		t.Fail()
+		t.Logf("GetTTL should return the default and the given TTL but returned %d (%v) and %d (%v)", defaultResult, defaultError, givenResult, givenError)
+	}
+}
+
+// createorupdate should create new records with the dynamic TTL of the policy if no TTL is given.
+func Test_createOrUpdateAction_TTLPolicy_DynamicTTLIsUsed(t *testing.T) {
+	// arrange
+	createdTTL := 0
+	editor := &testDNSEditor{
+		createSubdomainFunc: func(domain, subdomain string, timeToLive int, ip net.IP) error {
+			createdTTL = timeToLive
+			return nil
+		},
+	}
+
+	infoProvider := testDNSInfoProvider{
+		getSubdomainRecordFunc: func(domain, subdomain, recordType string) (dnsimple.Record, error) {
+			return dnsimple.Record{}, fmt.Errorf("No record found")
+		},
+	}
+
+	ttlPolicy := getTestTTLPolicyProvider(`{"ttl_policy":{"dynamic":60,"default":3600}}`, nil)
+	action := createOrUpdateAction{testDNSEditorFactory{editor, nil}, testInfoProviderFactory{infoProvider, nil}, nil, nil, ttlPolicy}
+
+	// act
+	_, err := action.Execute([]string{"-domain", "example.com", "-subdomain", "home", "-ip", "203.0.113.1"})
+
+	// assert
+	if err != nil || createdTTL != 60 {
+		t.Fail()
+		t.Logf("createorupdate should create the record with a TTL of 60 seconds but used %d (%v)", createdTTL, err)
+	}
+}
+
+// record update should raise a TTL below the minimum of the policy.
+func Test_recordAction_Update_TTLPolicy_TTLIsRaisedToMinimum(t *testing.T) {
+	// arrange
+	records := map[string][]dnsimple.Record{
+		"example.com": {
+			{Id: 1, Name: "www", RecordType: "A", Content: "203.0.113.1", Ttl: 3600},
+		},
+	}
+
+	warnings := new(bytes.Buffer)
+	ttlPolicy := getTestTTLPolicyProvider(`{"ttl_policy":{"minimum":300}}`, warnings)
+	action := recordAction{testDNSClientFactory{newInMemoryTestDNSClient(records), nil}, nil, ttlPolicy, nil}
+
+	// act
+	_, err := action.Execute([]string{"update", "-domain", "example.com", "-id", "1", "-ttl", "60"})
+
+	// assert
+	if err != nil || records["example.com"][0].Ttl != 300 {
+		t.Fail()
+		t.Logf("record update should raise the TTL to 300 seconds but the TTL is %d (%v)", records["example.com"][0].Ttl, err)
+	}
+
+	if !strings.Contains(warnings.String(), "below the minimum") {
+		t.Fail()
+		t.Logf("A warning should have been printed: %q", warnings.String())
+	}
+}
+
+// The REST API should create records with the dynamic TTL of the policy and raise TTLs below the minimum.
+func Test_apiHandler_CreateRecord_TTLPolicy_PolicyTTLIsUsed(t *testing.T) {
+	// arrange
+	var changes []string
+	handler := getTestAPIHandler(&changes)
+	handler.ttlPolicy = getTestTTLPolicyProvider(`{"ttl_policy":{"dynamic":120,"default":3600,"minimum":90}}`, new(bytes.Buffer))
+
+	// act
+	sendTestAPIRequest(handler, "POST", "/domains/example.com/records", "secret", `{"subdomain":"www","ip":"203.0.113.1"}`)
+	sendTestAPIRequest(handler, "POST", "/domains/example.com/records", "secret", `{"subdomain":"api","ip":"203.0.113.2","ttl":60}`)
+
+	// assert
+	expected := []string{"create example.com www 203.0.113.1 120", "create example.com api 203.0.113.2 90"}
+	if strings.Join(changes, "\n") != strings.Join(expected, "\n") {
+		t.Fail()
+		t.Logf("The records should have been created with the TTLs of the policy: %q", changes)
+	}
+}
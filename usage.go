@@ -5,6 +5,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 )
@@ -32,7 +33,13 @@ func (printer usagePrinter) PrintUsageInformation(output io.Writer) {
 
 	fmt.Fprintf(output, "Usage:\n")
 	fmt.Fprintf(output, "\n")
-	fmt.Fprintf(output, "  %s <action> [arguments ...]\n", printer.executableName)
+	fmt.Fprintf(output, "  %s [options] <action> [arguments ...]\n", printer.executableName)
+	fmt.Fprintf(output, "\n")
+
+	// List of all global options
+	fmt.Fprintf(output, "Options:\n")
+	flag.CommandLine.SetOutput(output)
+	flag.CommandLine.PrintDefaults()
 	fmt.Fprintf(output, "\n")
 
 	// List of all actions
@@ -55,3 +55,76 @@ func getDNSRecordTypeByIP(ip net.IP) string {
 
 	return "A"
 }
+
+// getDNSRecordType returns the given address record type or, if no
+// type is given, the type of the given IP. An error is returned if the
+// IP does not match the given type (e.g. an IPv6 address for "A").
+func getDNSRecordType(recordType string, ip net.IP) (string, error) {
+	ipRecordType := getDNSRecordTypeByIP(ip)
+
+	recordType = strings.ToUpper(strings.TrimSpace(recordType))
+	if recordType == "" {
+		return ipRecordType, nil
+	}
+
+	if recordType != "A" && recordType != "AAAA" {
+		return "", fmt.Errorf("The record type %q is not an address record type (A or AAAA); use the record action for other record types", recordType)
+	}
+
+	if recordType != ipRecordType {
+		return "", fmt.Errorf("The IP address %s does not match the record type %s", ip.String(), recordType)
+	}
+
+	return recordType, nil
+}
+
+// getArgumentValue returns the value of the flag with the given name
+// from the given command line arguments (e.g. "-domain example.com").
+func getArgumentValue(arguments []string, name string) string {
+	for index, argument := range arguments {
+		flagName := strings.TrimLeft(argument, "-")
+		if flagName == argument {
+			continue
+		}
+
+		if flagName == name && index+1 < len(arguments) {
+			return arguments[index+1]
+		}
+
+		if strings.HasPrefix(flagName, name+"=") {
+			return strings.TrimPrefix(flagName, name+"=")
+		}
+	}
+
+	return ""
+}
+
+// containsString returns true if the given list contains the given value.
+func containsString(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isFlagGiven returns true if the given command line arguments contain
+// the flag with the given name (e.g. "-note", "--note" or "-note=value").
+// The flag sets are reused between executions, so flag.FlagSet.Visit
+// also reports flags of earlier executions.
+func isFlagGiven(arguments []string, name string) bool {
+	for _, argument := range arguments {
+		if argument == "--" {
+			return false
+		}
+
+		argument = strings.TrimPrefix(strings.TrimPrefix(argument, "-"), "-")
+		if argument == name || strings.HasPrefix(argument, name+"=") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"net"
 	"testing"
 )
 
@@ -77,3 +78,59 @@ func Test_getFormattedDomainName(t *testing.T) {
 		}
 	}
 }
+
+func Test_getArgumentValue(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		arguments []string
+		name      string
+		expected  string
+	}{
+		{[]string{"-domain", "example.com", "-subdomain", "www"}, "subdomain", "www"},
+		{[]string{"--domain=example.com"}, "domain", "example.com"},
+		{[]string{"audit", "-allowed", "letsencrypt.org"}, "domain", ""},
+		{[]string{"-domain"}, "domain", ""},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		result := getArgumentValue(input.arguments, input.name)
+
+		// assert
+		if result != input.expected {
+			t.Fail()
+			t.Logf("getArgumentValue(%q, %q) should return %q but returned %q", input.arguments, input.name, input.expected, result)
+		}
+	}
+}
+
+func Test_getDNSRecordType(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		recordType     string
+		ip             string
+		expectedResult string
+		expectError    bool
+	}{
+		{"", "127.0.0.1", "A", false},
+		{"", "::1", "AAAA", false},
+		{"a", "127.0.0.1", "A", false},
+		{" AAAA ", "2001:db8::1", "AAAA", false},
+		{"AAAA", "127.0.0.1", "", true},
+		{"A", "2001:db8::1", "", true},
+		{"CNAME", "127.0.0.1", "", true},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		result, err := getDNSRecordType(input.recordType, net.ParseIP(input.ip))
+
+		// assert
+		if result != input.expectedResult || (err != nil) != input.expectError {
+			t.Fail()
+			t.Logf("getDNSRecordType(%q, %q) returned %q (%v) but should have returned %q (error: %t).", input.recordType, input.ip, result, err, input.expectedResult, input.expectError)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// minimumTTL defines the smallest time-to-live in seconds DNSimple accepts.
+const minimumTTL = 60
+
+// maxHostnameLength defines the maximum length of a domain name
+// in its textual representation (see RFC 1035, section 2.3.4).
+const maxHostnameLength = 253
+
+// underscoreRecordTypes contains the record types whose names
+// may contain underscores (e.g. "_dmarc", "_443._tcp").
+var underscoreRecordTypes = []string{"TXT", "SRV", "TLSA", "CNAME", "NAPTR", "SPF", "CAA"}
+
+// hostnameRecordTypes contains the record types whose content is a hostname.
+var hostnameRecordTypes = []string{"CNAME", "ALIAS", "MX", "NS", "PTR", "POOL"}
+
+// recordValidationError is an invalid field of a record.
+type recordValidationError struct {
+	// field is the invalid field ("name", "content" or "TTL").
+	field string
+
+	// value is the quoted invalid value (optional).
+	value string
+
+	reason string
+}
+
+func (err recordValidationError) Error() string {
+	return err.format(err.field)
+}
+
+// format returns the error message with the given name of the field.
+func (err recordValidationError) format(field string) string {
+	if err.value == "" {
+		return fmt.Sprintf("Invalid %s: %s", field, err.reason)
+	}
+
+	return fmt.Sprintf("Invalid %s %s: %s", field, err.value, err.reason)
+}
+
+// recordArguments are the command line arguments that contain the name,
+// the content and the TTL of a record (e.g. "-subdomain", "-ip", "-ttl").
+type recordArguments struct {
+	name    string
+	content string
+	ttl     string
+}
+
+// validateRecordArguments checks the given record like validateRecord and
+// names the command line argument that contains the invalid value.
+func validateRecordArguments(name, recordType, content string, timeToLive int, arguments recordArguments) error {
+	validationError := validateRecord(name, recordType, content, timeToLive)
+	invalidField, isRecordError := validationError.(recordValidationError)
+	if !isRecordError {
+		return validationError
+	}
+
+	argument := map[string]string{"name": arguments.name, "content": arguments.content, "TTL": arguments.ttl}[invalidField.field]
+	if argument == "" {
+		return validationError
+	}
+
+	return fmt.Errorf("%s", invalidField.format(argument))
+}
+
+// validateRecord checks the given record before it is sent to the API.
+// The returned recordValidationError names the invalid field.
+func validateRecord(name, recordType, content string, timeToLive int) error {
+	if timeToLive < minimumTTL {
+		return recordValidationError{"TTL", fmt.Sprintf("%d", timeToLive), fmt.Sprintf("the TTL must be at least %d seconds", minimumTTL)}
+	}
+
+	if name != "" {
+		allowUnderscores := containsString(underscoreRecordTypes, recordType)
+		if nameError := validateHostname(name, allowUnderscores, true); nameError != nil {
+			return recordValidationError{"name", fmt.Sprintf("%q", name), nameError.Error()}
+		}
+	}
+
+	switch {
+	case recordType == "A":
+		if ip := net.ParseIP(content); ip == nil || ip.To4() == nil {
+			return recordValidationError{"content", fmt.Sprintf("%q", content), "an A record requires an IPv4 address"}
+		}
+
+	case recordType == "AAAA":
+		if ip := net.ParseIP(content); ip == nil || ip.To4() != nil {
+			return recordValidationError{"content", fmt.Sprintf("%q", content), "an AAAA record requires an IPv6 address"}
+		}
+
+	case recordType == "TXT" || recordType == "SPF":
+		if txtError := validateTXTContent(content); txtError != nil {
+			return recordValidationError{"content", "", txtError.Error()}
+		}
+
+	case containsString(hostnameRecordTypes, recordType):
+		if net.ParseIP(content) != nil {
+			return recordValidationError{"content", fmt.Sprintf("%q", content), fmt.Sprintf("the target of a %s record must be a hostname, not an IP address", recordType)}
+		}
+
+		// targets are domain names, not host names, so underscores are
+		// allowed (e.g. "selector1._domainkey.contoso.onmicrosoft.com")
+		if hostnameError := validateHostname(strings.TrimSuffix(content, "."), true, false); hostnameError != nil {
+			return recordValidationError{"content", fmt.Sprintf("%q", content), hostnameError.Error()}
+		}
+	}
+
+	return nil
+}
+
+// validateHostname checks that the given name consists of valid
+// labels (letters, digits and hyphens that neither start nor end
+// with a hyphen). Underscores and a leading wildcard label are
+// only accepted if allowed.
+func validateHostname(hostname string, allowUnderscores, allowWildcard bool) error {
+	if hostname == "" {
+		return fmt.Errorf("the name is empty")
+	}
+
+	if len(hostname) > maxHostnameLength {
+		return fmt.Errorf("the name is longer than %d characters", maxHostnameLength)
+	}
+
+	for index, label := range strings.Split(hostname, ".") {
+		if label == "*" && index == 0 && allowWildcard {
+			continue
+		}
+
+		if label == "" {
+			return fmt.Errorf("the name contains an empty label")
+		}
+
+		if len(label) > 63 {
+			return fmt.Errorf("the label %q is longer than 63 characters", label)
+		}
+
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return fmt.Errorf("the label %q cannot start or end with a hyphen", label)
+		}
+
+		for _, character := range label {
+			switch {
+			case character >= 'a' && character <= 'z', character >= 'A' && character <= 'Z', character >= '0' && character <= '9', character == '-':
+				continue
+
+			case character == '_':
+				if !allowUnderscores {
+					return fmt.Errorf("the label %q contains an underscore which is not allowed for this record type", label)
+				}
+
+			default:
+				return fmt.Errorf("the label %q contains the invalid character %q", label, character)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateTXTContent checks that no character-string of the
+// given TXT record content exceeds 255 characters.
+func validateTXTContent(content string) error {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, `"`) {
+		if len(content) > maxTXTStringLength {
+			return fmt.Errorf("the text is %d characters long; split it into quoted strings of at most %d characters", len(content), maxTXTStringLength)
+		}
+
+		return nil
+	}
+
+	for _, part := range strings.Split(content, `" "`) {
+		part = strings.Trim(part, `"`)
+		if len(part) > maxTXTStringLength {
+			return fmt.Errorf("the string %.20q... is %d characters long; the maximum is %d", part, len(part), maxTXTStringLength)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Andreas Koch. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// validateRecord should accept valid records.
+func Test_validateRecord_ValidRecords_NoErrorIsReturned(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		name       string
+		recordType string
+		content    string
+		ttl        int
+	}{
+		{"", "A", "203.0.113.1", 600},
+		{"*.www", "AAAA", "2001:db8::1", 60},
+		{"www", "CNAME", "example.com.", 3600},
+		{"_dmarc", "TXT", "v=DMARC1; p=none", 600},
+		{"mail._domainkey", "TXT", formatTXTContent(strings.Repeat("a", 400)), 600},
+		{"_443._tcp.www", "TLSA", "3 1 1 abcdef", 600},
+		{"", "MX", "mx1.example.com", 600},
+		{"selector1._domainkey", "CNAME", "selector1-contoso-com._domainkey.contoso.onmicrosoft.com.", 3600},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		err := validateRecord(input.name, input.recordType, input.content, input.ttl)
+
+		// assert
+		if err != nil {
+			t.Fail()
+			t.Logf("validateRecord(%q, %q, %q, %d) should not return an error: %s", input.name, input.recordType, input.content, input.ttl, err.Error())
+		}
+	}
+}
+
+// validateRecord should reject invalid records and name the offending argument.
+func Test_validateRecord_InvalidRecords_ErrorIsReturned(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		name          string
+		recordType    string
+		content       string
+		ttl           int
+		expectedField string
+	}{
+		{"www", "A", "203.0.113.1", 30, "Invalid TTL"},
+		{"www", "CNAME", "203.0.113.1", 600, "Invalid content"},
+		{"", "MX", "mx-.example.com", 600, "Invalid content"},
+		{"my_host", "A", "203.0.113.1", 600, "Invalid name"},
+		{"-www", "A", "203.0.113.1", 600, "Invalid name"},
+		{"www", "A", "2001:db8::1", 600, "Invalid content"},
+		{"www", "AAAA", "203.0.113.1", 600, "Invalid content"},
+		{"", "TXT", strings.Repeat("a", 256), 600, "Invalid content"},
+		{"", "TXT", `"short" "` + strings.Repeat("a", 256) + `"`, 600, "Invalid content"},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		err := validateRecord(input.name, input.recordType, input.content, input.ttl)
+
+		// assert
+		if err == nil {
+			t.Fail()
+			t.Logf("validateRecord(%q, %q, %q, %d) should return an error", input.name, input.recordType, input.content, input.ttl)
+			continue
+		}
+
+		if !strings.HasPrefix(err.Error(), input.expectedField) {
+			t.Fail()
+			t.Logf("The error of validateRecord(%q, %q, %q, %d) should start with %q but was %q", input.name, input.recordType, input.content, input.ttl, input.expectedField, err.Error())
+		}
+	}
+}
+
+// validateRecordArguments should name the command line argument of the invalid field.
+func Test_validateRecordArguments_InvalidRecords_ArgumentIsNamed(t *testing.T) {
+	// arrange
+	inputs := []struct {
+		name     string
+		content  string
+		ttl      int
+		expected string
+	}{
+		{"my_host", "203.0.113.1", 600, `Invalid -subdomain "my_host": `},
+		{"www", "2001:db8::1", 600, `Invalid -ip "2001:db8::1": `},
+		{"www", "203.0.113.1", 30, "Invalid TTL 30: "},
+	}
+
+	for _, input := range inputs {
+
+		// act
+		err := validateRecordArguments(input.name, "A", input.content, input.ttl, recordArguments{"-subdomain", "-ip", ""})
+
+		// assert
+		if err == nil || !strings.HasPrefix(err.Error(), input.expected) {
+			t.Fail()
+			t.Logf("The error of validateRecordArguments(%q, %q, %d) should start with %q but was %v", input.name, input.content, input.ttl, input.expected, err)
+		}
+	}
+}